@@ -0,0 +1,79 @@
+package git
+
+import (
+	"context"
+	"fmt"
+)
+
+// An AccessControl decides which refs a principal, e.g. the authenticated
+// user of a fetch or push, may read and update. Refs it doesn't let a
+// principal read are left out of ForEachVisibleRef, as a server leaves them
+// out of the refs it advertises; updates it refuses fail ReceiveRef with an
+// *AccessDeniedError.
+type AccessControl interface {
+	CanRead(principal, ref string) bool
+	// old is zero if the ref is created, new if it is deleted.
+	CanWrite(principal, ref string, old, new ObjectID) bool
+}
+
+// An AccessDeniedError is returned when the AccessControl refuses an
+// update.
+type AccessDeniedError struct {
+	Principal string
+	Ref       string
+}
+
+func (e *AccessDeniedError) Error() string {
+	return fmt.Sprintf("%s may not update %s", e.Principal, e.Ref)
+}
+
+// SetAccessControl sets the AccessControl consulted by ForEachVisibleRef
+// and ReceiveRef. Without one, all refs can be read and updated.
+func (repo *Repository) SetAccessControl(ac AccessControl) {
+	repo.accessControl = ac
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying principal, for the
+// AccessControl to be asked about.
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal ctx carries, empty for an
+// anonymous one.
+func PrincipalFromContext(ctx context.Context) string {
+	principal, _ := ctx.Value(principalKey{}).(string)
+	return principal
+}
+
+// ForEachVisibleRef is like ForEachRef, but skips refs the AccessControl
+// doesn't let the principal of ctx read.
+func (repo *Repository) ForEachVisibleRef(ctx context.Context, prefix string, fn func(Ref) error) error {
+	if repo.accessControl == nil {
+		return repo.ForEachRef(prefix, fn)
+	}
+	principal := PrincipalFromContext(ctx)
+	return repo.ForEachRef(prefix, func(ref Ref) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !repo.accessControl.CanRead(principal, ref.Name) {
+			return nil
+		}
+		return fn(ref)
+	})
+}
+
+// Check that the principal of ctx may update the ref name from old to id.
+func (repo *Repository) checkWriteAccess(ctx context.Context, name string, old, id ObjectID) error {
+	if repo.accessControl == nil {
+		return nil
+	}
+	principal := PrincipalFromContext(ctx)
+	if !repo.accessControl.CanWrite(principal, name, old, id) {
+		return &AccessDeniedError{Principal: principal, Ref: name}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package git
+
+import (
+	"container/heap"
+)
+
+// AheadBehind returns the number of commits local has that upstream
+// doesn't, and the number upstream has that local doesn't, like git
+// rev-list --count --left-right local...upstream. Only the commits down
+// to the merge bases are read, from the commit-graph file if there is one.
+func (repo *Repository) AheadBehind(local, upstream string) (ahead, behind int, err error) {
+	a, err := repo.resolveRevision(local)
+	if err != nil {
+		return 0, 0, err
+	}
+	b, err := repo.resolveRevision(upstream)
+	if err != nil {
+		return 0, 0, err
+	}
+	if a.Equal(b) {
+		return 0, 0, nil
+	}
+
+	// Commits are looked at in generation order, so all the commits a
+	// commit is reachable from have painted it before.
+	paint := make(map[ObjectID]int)
+	done := make(map[ObjectID]bool)
+	q := &genQueue{}
+	push := func(id ObjectID, flags int) error {
+		if paint[id]&flags == flags {
+			return nil
+		}
+		paint[id] |= flags
+		node, err := repo.commitNode(id)
+		if err != nil {
+			return err
+		}
+		gen, err := repo.generation(id)
+		if err != nil {
+			return err
+		}
+		heap.Push(q, genQueued{node, gen})
+		return nil
+	}
+	if err := push(a, paintOne); err != nil {
+		return 0, 0, err
+	}
+	if err := push(b, paintTwo); err != nil {
+		return 0, 0, err
+	}
+
+	for q.Len() > 0 && !q.allStale(paint) {
+		node := heap.Pop(q).(genQueued).node
+		if done[node.Id] {
+			continue
+		}
+		done[node.Id] = true
+		flags := paint[node.Id]
+		switch flags {
+		case paintOne:
+			ahead++
+		case paintTwo:
+			behind++
+		case paintOne | paintTwo:
+			// a common ancestor, and so are all commits below it
+			flags |= paintStale
+			paint[node.Id] = flags
+		}
+		for _, p := range node.Parents {
+			if err := push(p, flags); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+	return ahead, behind, nil
+}
+
+// queue of commit nodes, highest generation first, then newest first
+type genQueue []genQueued
+
+type genQueued struct {
+	node CommitNode
+	gen  uint64
+}
+
+func (q genQueue) Len() int { return len(q) }
+func (q genQueue) Less(i, j int) bool {
+	if q[i].gen != q[j].gen {
+		return q[i].gen > q[j].gen
+	}
+	return q[i].node.Time > q[j].node.Time
+}
+func (q genQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *genQueue) Push(x interface{}) { *q = append(*q, x.(genQueued)) }
+func (q *genQueue) Pop() interface{} {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return x
+}
+
+func (q genQueue) allStale(paint map[ObjectID]int) bool {
+	for _, qc := range q {
+		if paint[qc.node.Id]&paintStale == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,280 @@
+package git
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotReference is returned by AddReference for a path that isn't a
+// repository.
+var ErrNotReference = errors.New("reference is not a repository")
+
+// Git follows alternates of alternates this deep.
+const maxAlternateDepth = 5
+
+// Alternates returns the object directories objects are borrowed from,
+// like git clone --reference and --shared set up: those listed in the
+// objects/info/alternates file, recursively, and in
+// GIT_ALTERNATE_OBJECT_DIRECTORIES if OpenRepository applied the
+// environment.
+func (repo *Repository) Alternates() []string {
+	return append([]string(nil), repo.alternates...)
+}
+
+// Read the alternates of the object database.
+func (repo *Repository) readAlternates() []string {
+	var dirs []string
+	seen := map[string]bool{repo.ObjectsDir: true}
+	var add func(dir string, depth int)
+	add = func(dir string, depth int) {
+		dir = filepath.Clean(dir)
+		if seen[dir] {
+			return
+		}
+		seen[dir] = true
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			repo.log().Warn("ignoring missing alternate object directory", "dir", dir)
+			return
+		}
+		dirs = append(dirs, dir)
+		if depth < maxAlternateDepth {
+			for _, next := range alternatesFile(dir) {
+				add(next, depth+1)
+			}
+		}
+	}
+	for _, dir := range alternatesFile(repo.ObjectsDir) {
+		add(dir, 1)
+	}
+	if !repo.fromEnv {
+		return dirs
+	}
+	for _, dir := range filepath.SplitList(os.Getenv("GIT_ALTERNATE_OBJECT_DIRECTORIES")) {
+		if dir != "" {
+			add(dir, 1)
+		}
+	}
+	return dirs
+}
+
+// Return the directories listed in the info/alternates file of an object
+// directory, relative ones resolved against it.
+func alternatesFile(objectsDir string) []string {
+	data, err := ioutil.ReadFile(filepath.Join(objectsDir, "info", "alternates"))
+	if err != nil {
+		return nil
+	}
+	var dirs []string
+	s := bufio.NewScanner(strings.NewReader(string(data)))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if unquoted, err := unquotePath(line); err == nil {
+			line = unquoted
+		}
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(objectsDir, line)
+		}
+		dirs = append(dirs, line)
+	}
+	return dirs
+}
+
+// AddReference makes the repository borrow the objects of the repository
+// at path, like git clone --reference: its object directory is added to
+// the objects/info/alternates file, so that objects it has don't need to
+// be fetched or stored again. The reference repository must not lose
+// objects, e.g. by pruning, while it is borrowed from; Dissociate copies
+// the borrowed objects to stop depending on it.
+func (repo *Repository) AddReference(path string) error {
+	dir, err := referenceObjectsDir(path)
+	if err != nil {
+		return err
+	}
+	for _, d := range repo.alternates {
+		if d == dir {
+			return nil
+		}
+	}
+	if repo.dryRun != nil {
+		repo.recordChange(Change{Op: ChangeWriteFile, Name: "objects/info/alternates"})
+		return nil
+	}
+	if repo.snapshot != nil {
+		return ErrReadOnlySnapshot
+	}
+
+	infoDir := filepath.Join(repo.ObjectsDir, "info")
+	if err := os.MkdirAll(infoDir, 0775); err != nil {
+		return err
+	}
+	altPath := filepath.Join(infoDir, "alternates")
+	data, err := ioutil.ReadFile(altPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	lock, err := lockPath(altPath)
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+	data = append(data, dir+"\n"...)
+	if _, err := lock.Write(data); err != nil {
+		lock.rollback()
+		return err
+	}
+	if err := lock.commit(); err != nil {
+		return err
+	}
+	repo.alternates = repo.readAlternates()
+	repo.log().Debug("borrowing objects", "dir", dir)
+	return repo.loadPacks()
+}
+
+// Return the absolute path of the object directory of a repository, bare
+// or not.
+func referenceObjectsDir(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	for _, dir := range []string{filepath.Join(path, "objects"), filepath.Join(path, ".git", "objects")} {
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("%s: %v", path, ErrNotReference)
+}
+
+// Dissociate makes the repository self-contained, like git clone
+// --dissociate: the objects reachable from its refs and HEAD that it
+// borrows from alternates are copied into a new pack of its own, and the
+// objects/info/alternates file is removed. Alternates given in
+// GIT_ALTERNATE_OBJECT_DIRECTORIES are still read afterwards.
+func (repo *Repository) Dissociate() error {
+	if len(alternatesFile(repo.ObjectsDir)) == 0 {
+		return nil
+	}
+	if repo.dryRun != nil {
+		repo.recordChange(Change{Op: ChangeDeleteFile, Name: "objects/info/alternates"})
+		return nil
+	}
+	if repo.snapshot != nil {
+		return ErrReadOnlySnapshot
+	}
+
+	refs := make(map[string]ObjectID)
+	if head, ok, err := repo.readLooseRef("HEAD"); err != nil {
+		return err
+	} else if ok {
+		refs["HEAD"] = head.Id
+	}
+	err := repo.ForEachRef("refs/", func(ref Ref) error {
+		refs[ref.Name] = ref.Id
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	ids, _, err := repo.backupObjects(refs, nil)
+	if err != nil {
+		return err
+	}
+
+	// the objects the repository has itself
+	local := *repo
+	local.alternates = nil
+	local.indexfiles = nil
+	if err := local.loadPacks(); err != nil {
+		return err
+	}
+	var borrowed []ObjectID
+	for _, id := range ids {
+		found, _, err := local.haveObject(id)
+		if err != nil {
+			return err
+		}
+		if !found {
+			borrowed = append(borrowed, id)
+		}
+	}
+
+	if len(borrowed) > 0 {
+		if err := repo.writeOwnPack(borrowed); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(filepath.Join(repo.ObjectsDir, "info", "alternates")); err != nil {
+		return err
+	}
+	repo.alternates = repo.readAlternates()
+	repo.log().Debug("dissociated from alternates", "objects", len(borrowed))
+	return repo.loadPacks()
+}
+
+// Write a pack with the objects into the object database.
+func (repo *Repository) writeOwnPack(ids []ObjectID) error {
+	tmp, err := repo.TempObjectDir()
+	if err != nil {
+		return err
+	}
+	packDir := filepath.Join(tmp.dir, "pack")
+	if err := os.Mkdir(packDir, 0775); err != nil {
+		tmp.Discard()
+		return err
+	}
+	f, err := ioutil.TempFile(packDir, "tmp_pack_")
+	if err != nil {
+		tmp.Discard()
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	sum, entries, err := repo.writePack(bw, ids, nil)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	base := filepath.Join(packDir, fmt.Sprintf("pack-%x", sum))
+	// packs are read-only like git makes them
+	if err == nil {
+		err = os.Chmod(f.Name(), 0444)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), base+".pack")
+	}
+	if err == nil {
+		err = writeIndexFile(base+".idx", entries, sum)
+	}
+	if err != nil {
+		tmp.Discard()
+		return err
+	}
+	return tmp.Migrate()
+}
+
+func writeIndexFile(path string, entries []packEntry, packSum []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0444)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	err = writePackIndex(bw, entries, packSum)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,148 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// AmOptions configure Repository.Am.
+type AmOptions struct {
+	// The branch the commits are made on. It must exist.
+	Branch string
+	// Merge patches that don't apply, like git am --3way. Patches merged
+	// with conflicts stop Am.
+	ThreeWay bool
+	// If nil, DefaultCommitter is used. The authors and author dates come
+	// from the mails.
+	Committer *Signature
+}
+
+// An AmError is returned by Am for a mail that couldn't be applied.
+type AmError struct {
+	// The mail that failed, counting from 1.
+	Mail    int
+	Subject string
+	Err     error
+}
+
+func (e *AmError) Error() string {
+	if e.Subject == "" {
+		return fmt.Sprintf("mail %d: %v", e.Mail, e.Err)
+	}
+	return fmt.Sprintf("mail %d (%s): %v", e.Mail, e.Subject, e.Err)
+}
+
+// Am applies the patches of the mailbox read from r on top of a branch, a
+// commit each, like git am. The patches are applied to the trees of the
+// commits rather than to the working tree, so this works in bare
+// repositories and leaves the working tree and index alone. It stops at
+// the first mail that can't be applied with an *AmError, returning the
+// commits made so far; the branch points at the last of them.
+//
+// The mails are applied in thread order: a mail replying to another one
+// of the mailbox, by its In-Reply-To header or else the last of its
+// References, is applied after it, so a series mailed with each patch
+// replying to the previous one applies whatever order the mailbox has.
+// Replies to the same mail keep their mailbox order. All mails are parsed
+// before any is applied.
+func (repo *Repository) Am(r io.Reader, opts AmOptions) ([]ObjectID, error) {
+	ref, exists, err := repo.lookupRef("refs/heads/" + opts.Branch)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotExist
+	}
+	mails, err := SplitMailbox(r)
+	if err != nil {
+		return nil, err
+	}
+
+	patches := make([]*MailPatch, len(mails))
+	for i, mail := range mails {
+		mp, err := ParseMailPatch(bytes.NewReader(mail))
+		if err != nil {
+			return nil, &AmError{Mail: i + 1, Err: err}
+		}
+		patches[i] = mp
+	}
+
+	parent := ref.Id
+	var commits []ObjectID
+	for _, i := range threadOrder(patches) {
+		mp := patches[i]
+		fail := func(err error) error {
+			return &AmError{Mail: i + 1, Subject: mp.Subject, Err: err}
+		}
+		result, err := repo.ApplyPatch(strings.NewReader(mp.Patch), ApplyOptions{
+			Tree:     parent.String(),
+			ThreeWay: opts.ThreeWay,
+		})
+		if err != nil {
+			return commits, fail(err)
+		}
+		id, err := repo.CreateCommit(CommitOptions{
+			Tree:      result.Tree,
+			Parents:   []ObjectID{parent},
+			Author:    mp.Author,
+			Committer: opts.Committer,
+			Message:   mp.CommitMessage(),
+			Branch:    opts.Branch,
+		})
+		if err != nil {
+			return commits, fail(err)
+		}
+		repo.log().Debug("applied mail", "subject", mp.Subject, "commit", id.String())
+		commits = append(commits, id)
+		parent = id
+	}
+	return commits, nil
+}
+
+// The order to apply mails in: each mail after the mail of the mailbox it
+// replies to, depth first, and in mailbox order otherwise. Mails in a
+// reply cycle come last, in mailbox order.
+func threadOrder(patches []*MailPatch) []int {
+	byId := make(map[string]int)
+	for i, mp := range patches {
+		if _, dup := byId[mp.MessageId]; mp.MessageId != "" && !dup {
+			byId[mp.MessageId] = i
+		}
+	}
+	replies := make(map[int][]int)
+	var roots []int
+	for i, mp := range patches {
+		parent := mp.InReplyTo
+		if parent == "" && len(mp.References) > 0 {
+			parent = mp.References[len(mp.References)-1]
+		}
+		if p, ok := byId[parent]; ok && p != i {
+			replies[p] = append(replies[p], i)
+		} else {
+			roots = append(roots, i)
+		}
+	}
+
+	order := make([]int, 0, len(patches))
+	seen := make([]bool, len(patches))
+	var visit func(i int)
+	visit = func(i int) {
+		if seen[i] {
+			return
+		}
+		seen[i] = true
+		order = append(order, i)
+		for _, r := range replies[i] {
+			visit(r)
+		}
+	}
+	for _, i := range roots {
+		visit(i)
+	}
+	for i := range patches {
+		visit(i)
+	}
+	return order
+}
@@ -0,0 +1,100 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// A mail of a patch changing a.txt from old to new.
+func testPatchMail(n int, subject, headers, old, new string) string {
+	return fmt.Sprintf(`From 1234567890abcdef1234567890abcdef12345678 Mon Sep 17 00:00:00 2001
+From: Jane Doe <jane@example.com>
+Date: Tue, 10 Sep 2013 16:34:1%d +0200
+Subject: [PATCH %d/3] %s
+Message-Id: <%d.patch@example.com>
+%s
+Change a.txt.
+---
+diff --git a/a.txt b/a.txt
+--- a/a.txt
++++ b/a.txt
+@@ -1 +1 @@
+-%s
++%s
+`, n, n, subject, n, headers, old, new)
+}
+
+func TestAmThreadOrder(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	base := writeTestCommit(t, repo, map[string]string{"a.txt": "one\n"}, "base")
+	if err := repo.CreateBranch("topic", base.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	// a deep thread, mailed out of order; the third patch only has
+	// References
+	mbox := testPatchMail(2, "second", "In-Reply-To: <1.patch@example.com>\n", "two", "three") +
+		testPatchMail(3, "third", "References: <1.patch@example.com> <2.patch@example.com>\n", "three", "four") +
+		testPatchMail(1, "first", "", "one", "two")
+	commits, err := repo.Am(strings.NewReader(mbox), AmOptions{Branch: "topic"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var subjects []string
+	parent := base
+	for _, id := range commits {
+		c, err := repo.getCommit(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p, _ := c.ParentId(0); !p.Equal(parent) {
+			t.Errorf("%s has parent %s, expected %s", c.Summary(), p, parent)
+		}
+		if c.Author.Name != "Jane Doe" {
+			t.Errorf("%s has author %q", c.Summary(), c.Author.Name)
+		}
+		subjects = append(subjects, c.Summary())
+		parent = id
+	}
+	if strings.Join(subjects, " ") != "first second third" {
+		t.Errorf("applied %v", subjects)
+	}
+	tip := refId(t, repo, "refs/heads/topic")
+	if !tip.Equal(parent) {
+		t.Errorf("topic is at %s, expected %s", tip, parent)
+	}
+	c, err := repo.getCommit(tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data := readTestFile(t, repo, c.TreeId(), "a.txt"); data != "four\n" {
+		t.Errorf("a.txt is %q", data)
+	}
+}
+
+func TestAmStopsAtFailure(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	base := writeTestCommit(t, repo, map[string]string{"a.txt": "one\n"}, "base")
+	if err := repo.CreateBranch("topic", base.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	mbox := testPatchMail(1, "first", "", "one", "two") +
+		testPatchMail(2, "second", "", "one", "three")
+	commits, err := repo.Am(strings.NewReader(mbox), AmOptions{Branch: "topic"})
+	amErr, ok := err.(*AmError)
+	if !ok {
+		t.Fatalf("expected an *AmError, got %v", err)
+	}
+	if amErr.Mail != 2 || amErr.Subject != "second" {
+		t.Errorf("failed at mail %d (%s), expected 2 (second)", amErr.Mail, amErr.Subject)
+	}
+	if len(commits) != 1 {
+		t.Fatalf("made %d commits, expected 1", len(commits))
+	}
+	if tip := refId(t, repo, "refs/heads/topic"); !tip.Equal(commits[0]) {
+		t.Errorf("topic is at %s, expected %s", tip, commits[0])
+	}
+}
@@ -0,0 +1,918 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParsePatch parses the file patches of a unified diff, like the output of
+// git diff or format-patch, or of diff -u. Text around the patches, like a
+// commit message or a diffstat, is skipped.
+//
+// The ids of the index lines are usually abbreviated, and are then only
+// kept for ApplyPatch. Patches not made by git have no modes, their
+// OldMode and NewMode are 0.
+func ParsePatch(r io.Reader) ([]*FilePatch, error) {
+	p := &patchParser{}
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			p.lines = append(p.lines, strings.TrimSuffix(line, "\n"))
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	var patches []*FilePatch
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		var fp *FilePatch
+		var err error
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			fp, err = p.gitPatch()
+		case strings.HasPrefix(line, "--- ") && p.pos+1 < len(p.lines) && strings.HasPrefix(p.lines[p.pos+1], "+++ "):
+			fp, err = p.plainPatch()
+		default:
+			p.pos++
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		patches = append(patches, fp)
+	}
+	return patches, nil
+}
+
+// A PatchError is returned for patches ParsePatch can't parse.
+type PatchError struct {
+	Line   int
+	Reason string
+}
+
+func (e *PatchError) Error() string {
+	return fmt.Sprintf("corrupt patch at line %d: %s", e.Line, e.Reason)
+}
+
+type patchParser struct {
+	lines []string
+	pos   int
+}
+
+func (p *patchParser) errorf(format string, args ...interface{}) error {
+	return &PatchError{p.pos + 1, fmt.Sprintf(format, args...)}
+}
+
+// Parse a patch starting with a "diff --git" line.
+func (p *patchParser) gitPatch() (*FilePatch, error) {
+	fp := &FilePatch{Status: FileModified}
+	fp.OldPath, fp.NewPath = gitHeaderPaths(strings.TrimPrefix(p.lines[p.pos], "diff --git "))
+	p.pos++
+
+	var err error
+	hasHunks := false
+headers:
+	for ; p.pos < len(p.lines); p.pos++ {
+		line := p.lines[p.pos]
+		switch {
+		case strings.HasPrefix(line, "old mode "):
+			fp.OldMode, err = parsePatchMode(line[len("old mode "):])
+		case strings.HasPrefix(line, "new mode "):
+			fp.NewMode, err = parsePatchMode(line[len("new mode "):])
+		case strings.HasPrefix(line, "deleted file mode "):
+			fp.Status = FileDeleted
+			fp.OldMode, err = parsePatchMode(line[len("deleted file mode "):])
+		case strings.HasPrefix(line, "new file mode "):
+			fp.Status = FileAdded
+			fp.NewMode, err = parsePatchMode(line[len("new file mode "):])
+		case strings.HasPrefix(line, "similarity index "):
+			fp.Similarity, err = strconv.Atoi(strings.TrimSuffix(line[len("similarity index "):], "%"))
+		case strings.HasPrefix(line, "dissimilarity index "):
+		case strings.HasPrefix(line, "rename from "):
+			fp.Status = FileRenamed
+			fp.OldPath, err = unquotePath(line[len("rename from "):])
+		case strings.HasPrefix(line, "rename to "):
+			fp.NewPath, err = unquotePath(line[len("rename to "):])
+		case strings.HasPrefix(line, "copy from "):
+			fp.Status = FileCopied
+			fp.OldPath, err = unquotePath(line[len("copy from "):])
+		case strings.HasPrefix(line, "copy to "):
+			fp.NewPath, err = unquotePath(line[len("copy to "):])
+		case strings.HasPrefix(line, "index "):
+			err = p.indexLine(fp, line[len("index "):])
+		case strings.HasPrefix(line, "Binary files "), line == "GIT binary patch":
+			fp.Binary = true
+		case strings.HasPrefix(line, "--- "):
+			if err = p.fileNames(fp, true); err != nil {
+				return nil, err
+			}
+			hasHunks = true
+			break headers
+		default:
+			break headers
+		}
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+	}
+
+	switch fp.Status {
+	case FileAdded:
+		fp.OldPath = ""
+	case FileDeleted:
+		fp.NewPath = ""
+	}
+	if fp.OldPath == "" && fp.NewPath == "" {
+		return nil, p.errorf("no file names in git diff header")
+	}
+	if fp.Status == FileModified && fp.OldMode != fp.NewMode && fp.OldMode&0170000 != fp.NewMode&0170000 {
+		fp.Status = FileTypeChanged
+	}
+	if hasHunks {
+		return fp, p.hunks(fp)
+	}
+	return fp, nil
+}
+
+// Parse a patch of diff -u, starting with its "---" line.
+func (p *patchParser) plainPatch() (*FilePatch, error) {
+	fp := &FilePatch{Status: FileModified}
+	if err := p.fileNames(fp, false); err != nil {
+		return nil, err
+	}
+	switch {
+	case fp.OldPath == "":
+		fp.Status = FileAdded
+	case fp.NewPath == "":
+		fp.Status = FileDeleted
+	}
+	return fp, p.hunks(fp)
+}
+
+// Parse the "--- a/old" and "+++ b/new" lines, setting the paths of fp
+// unless it is a git patch that has them already.
+func (p *patchParser) fileNames(fp *FilePatch, git bool) error {
+	if p.pos+1 >= len(p.lines) || !strings.HasPrefix(p.lines[p.pos+1], "+++ ") {
+		return p.errorf("--- line without +++ line")
+	}
+	from, err := patchFileName(p.lines[p.pos][4:], git)
+	if err != nil {
+		return p.errorf("%v", err)
+	}
+	p.pos++
+	to, err := patchFileName(p.lines[p.pos][4:], git)
+	if err != nil {
+		return p.errorf("%v", err)
+	}
+	p.pos++
+	if !git || fp.OldPath == "" && fp.NewPath == "" {
+		fp.OldPath, fp.NewPath = from, to
+	}
+	return nil
+}
+
+// Parse "abc123..def456 100644", the abbreviated ids of the old and new
+// content and the mode if it didn't change.
+func (p *patchParser) indexLine(fp *FilePatch, s string) error {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return fmt.Errorf("bad index line %q", s)
+	}
+	ids := strings.SplitN(fields[0], "..", 2)
+	if len(fields) > 2 || len(ids) != 2 || !isHexString(ids[0]) || !isHexString(ids[1]) {
+		return fmt.Errorf("bad index line %q", s)
+	}
+	fp.oldIndex, fp.newIndex = ids[0], ids[1]
+	// full ids are kept, abbreviated ones resolved when applying
+	fp.OldId, _ = NewIdFromString(ids[0])
+	fp.NewId, _ = NewIdFromString(ids[1])
+	if len(fields) == 2 {
+		mode, err := parsePatchMode(fields[1])
+		if err != nil {
+			return err
+		}
+		fp.OldMode, fp.NewMode = mode, mode
+	}
+	return nil
+}
+
+// Parse the "@@" hunks following the file names.
+func (p *patchParser) hunks(fp *FilePatch) error {
+	for p.pos < len(p.lines) && strings.HasPrefix(p.lines[p.pos], "@@ ") {
+		h := &Hunk{}
+		if !parseHunkHeader(p.lines[p.pos], h) {
+			return p.errorf("bad hunk header %q", p.lines[p.pos])
+		}
+		p.pos++
+
+		oldLine, newLine := h.OldStart, h.NewStart
+		oldLeft, newLeft := h.OldLines, h.NewLines
+		var last *DiffLine
+		for oldLeft > 0 || newLeft > 0 || p.pos < len(p.lines) && strings.HasPrefix(p.lines[p.pos], `\`) {
+			if p.pos >= len(p.lines) {
+				return p.errorf("hunk ends early")
+			}
+			line := p.lines[p.pos]
+			l := &DiffLine{}
+			switch {
+			case line == "" || line[0] == ' ':
+				// some editors strip the space of empty context lines
+				if oldLeft == 0 || newLeft == 0 {
+					return p.errorf("hunk has too many lines")
+				}
+				l.Type, l.OldLine, l.NewLine = DiffLineContext, oldLine, newLine
+				oldLine, newLine, oldLeft, newLeft = oldLine+1, newLine+1, oldLeft-1, newLeft-1
+			case line[0] == '-':
+				if oldLeft == 0 {
+					return p.errorf("hunk has too many lines")
+				}
+				l.Type, l.OldLine = DiffLineDelete, oldLine
+				oldLine, oldLeft = oldLine+1, oldLeft-1
+			case line[0] == '+':
+				if newLeft == 0 {
+					return p.errorf("hunk has too many lines")
+				}
+				l.Type, l.NewLine = DiffLineAdd, newLine
+				newLine, newLeft = newLine+1, newLeft-1
+			case line[0] == '\\':
+				// "\ No newline at end of file"
+				if last == nil {
+					return p.errorf("no line before %q", line)
+				}
+				last.NoNewline = true
+				p.pos++
+				continue
+			default:
+				return p.errorf("bad hunk line %q", line)
+			}
+			if line != "" {
+				l.Content = line[1:]
+			}
+			h.Lines = append(h.Lines, l)
+			last = l
+			p.pos++
+		}
+		fp.Hunks = append(fp.Hunks, h)
+	}
+	return nil
+}
+
+// Parse "@@ -1,3 +1,4 @@ func", where a missing count is 1.
+func parseHunkHeader(line string, h *Hunk) bool {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || fields[3] != "@@" || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return false
+	}
+	var ok1, ok2 bool
+	h.OldStart, h.OldLines, ok1 = parseHunkRange(fields[1][1:])
+	h.NewStart, h.NewLines, ok2 = parseHunkRange(fields[2][1:])
+	return ok1 && ok2
+}
+
+func parseHunkRange(s string) (int, int, bool) {
+	lines := 1
+	var err error
+	if i := strings.IndexByte(s, ','); i >= 0 {
+		if lines, err = strconv.Atoi(s[i+1:]); err != nil {
+			return 0, 0, false
+		}
+		s = s[:i]
+	}
+	start, err := strconv.Atoi(s)
+	return start, lines, err == nil && start >= 0 && lines >= 0
+}
+
+func parsePatchMode(s string) (EntryMode, error) {
+	mode, err := strconv.ParseUint(strings.TrimSpace(s), 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("bad mode %q", s)
+	}
+	return EntryMode(mode), nil
+}
+
+// Return the name of a "---" or "+++" line without its "a/" or "b/"
+// prefix, or "" for /dev/null. diff -u appends a tab and a time.
+func patchFileName(s string, git bool) (string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		if i := strings.IndexByte(s, '\t'); i >= 0 && !git {
+			s = s[:i]
+		}
+		// git appends a tab to names with spaces
+		s = strings.TrimSuffix(s, "\t")
+	}
+	name, err := unquotePath(s)
+	if err != nil || name == "/dev/null" {
+		return "", err
+	}
+	// strip the first directory, like patch -p1
+	if i := strings.IndexByte(name, '/'); i >= 0 {
+		name = name[i+1:]
+	}
+	return path.Clean(name), nil
+}
+
+// Split the "a/old b/new" of a "diff --git" line. Without quotes, the names
+// can only be told apart if they are the same, as for changes that aren't
+// renames or copies, whose headers have them on own lines.
+func gitHeaderPaths(s string) (string, string) {
+	if strings.HasPrefix(s, `"`) || strings.HasSuffix(s, `"`) {
+		var names []string
+		for s != "" && len(names) < 2 {
+			var name string
+			if s[0] == '"' {
+				end := quotedEnd(s)
+				if end < 0 {
+					return "", ""
+				}
+				name, s = s[:end], strings.TrimPrefix(s[end:], " ")
+			} else if i := strings.IndexByte(s, ' '); i >= 0 && len(names) == 0 {
+				name, s = s[:i], s[i+1:]
+			} else {
+				name, s = s, ""
+			}
+			name, err := unquotePath(name)
+			if err != nil {
+				return "", ""
+			}
+			names = append(names, name)
+		}
+		if len(names) != 2 || !strings.HasPrefix(names[0], "a/") || !strings.HasPrefix(names[1], "b/") {
+			return "", ""
+		}
+		return names[0][2:], names[1][2:]
+	}
+
+	// "a/" + name + " b/" + name
+	n := (len(s) - 5) / 2
+	if n <= 0 || !strings.HasPrefix(s, "a/") || s[2+n:] != " b/"+s[2:2+n] {
+		return "", ""
+	}
+	return s[2 : 2+n], s[2 : 2+n]
+}
+
+// Return the index after the closing quote of a quoted name at the start of
+// s, or -1.
+func quotedEnd(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// Undo quotePath.
+func unquotePath(s string) (string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return s, nil
+	}
+	if len(s) < 2 || !strings.HasSuffix(s, `"`) {
+		return "", fmt.Errorf("bad quoted name %s", s)
+	}
+	var buf bytes.Buffer
+	for i := 1; i < len(s)-1; i++ {
+		c := s[i]
+		if c != '\\' {
+			buf.WriteByte(c)
+			continue
+		}
+		i++
+		if i >= len(s)-1 {
+			return "", fmt.Errorf("bad quoted name %s", s)
+		}
+		switch c = s[i]; c {
+		case 'a':
+			buf.WriteByte('\a')
+		case 'b':
+			buf.WriteByte('\b')
+		case 't':
+			buf.WriteByte('\t')
+		case 'n':
+			buf.WriteByte('\n')
+		case 'v':
+			buf.WriteByte('\v')
+		case 'f':
+			buf.WriteByte('\f')
+		case 'r':
+			buf.WriteByte('\r')
+		case '"', '\\':
+			buf.WriteByte(c)
+		default:
+			if i+3 > len(s)-1 {
+				return "", fmt.Errorf("bad quoted name %s", s)
+			}
+			v, err := strconv.ParseUint(s[i:i+3], 8, 8)
+			if err != nil {
+				return "", fmt.Errorf("bad quoted name %s", s)
+			}
+			buf.WriteByte(byte(v))
+			i += 2
+		}
+	}
+	return buf.String(), nil
+}
+
+func isHexString(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// ApplyOptions configure Repository.ApplyPatch.
+type ApplyOptions struct {
+	// The revision of the tree to apply the patch to. If empty, it is
+	// applied to the working tree.
+	Tree string
+	// When a patch doesn't apply, apply it to the content it was made
+	// from, if the repository has that blob, and merge the result, like
+	// git apply --3way.
+	ThreeWay bool
+}
+
+// ApplyResult is what Repository.ApplyPatch did.
+type ApplyResult struct {
+	// The tree with the patch applied, if it was applied to a tree.
+	Tree ObjectID
+	// The paths that were written or removed.
+	Paths []string
+	// The paths merged with conflicts by ApplyOptions.ThreeWay.
+	Conflicts []string
+}
+
+// An ApplyError is returned for patches that don't apply.
+type ApplyError struct {
+	Path string
+	// The hunk that failed, counting from 1, or 0 if the patch failed for
+	// another reason.
+	Hunk   int
+	Reason string
+}
+
+func (e *ApplyError) Error() string {
+	if e.Hunk > 0 {
+		return fmt.Sprintf("patch failed: %s: hunk #%d %s", e.Path, e.Hunk, e.Reason)
+	}
+	return fmt.Sprintf("patch failed: %s: %s", e.Path, e.Reason)
+}
+
+// ApplyPatch applies the unified diff read from r, like git apply. The
+// patch is applied to the working tree, or to the tree opts.Tree names, in
+// which case a new tree is written and nothing else is changed. Hunks must
+// match their context exactly, but may have moved.
+//
+// Either the whole patch is applied or, if a file patch doesn't apply, an
+// *ApplyError is returned and nothing is changed. With opts.ThreeWay, files
+// merged with conflicts are written to the working tree with conflict
+// markers, and a *MergeConflictError naming them is returned along with the
+// result; trees with conflicts aren't written. Like with Checkout, paths
+// outside the tree or inside its .git directory, and symlinks pointing
+// outside it, are refused with an *UnsafePathsError.
+func (repo *Repository) ApplyPatch(r io.Reader, opts ApplyOptions) (*ApplyResult, error) {
+	patches, err := ParsePatch(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, fp := range patches {
+		if fp.Status != FileAdded {
+			if err := ValidatePath(fp.OldPath); err != nil {
+				return nil, err
+			}
+		}
+		if fp.Status != FileDeleted {
+			if err := ValidatePath(fp.NewPath); err != nil {
+				return nil, err
+			}
+		}
+	}
+	a := &applier{repo: repo, opts: opts, files: make(map[string]*applyFile)}
+	if opts.Tree == "" {
+		if repo.WorkTree == "" {
+			return nil, ErrBareRepository
+		}
+	} else {
+		// resolveRevision only resolves commits
+		var id ObjectID
+		var err error
+		if IsSha1(opts.Tree) {
+			id, err = NewIdFromString(opts.Tree)
+		} else {
+			id, err = repo.resolveRevision(opts.Tree)
+		}
+		if err != nil {
+			return nil, err
+		}
+		id, tp, err := repo.peel(id)
+		if err != nil {
+			return nil, err
+		}
+		var tree *Tree
+		switch tp {
+		case ObjectCommit:
+			commit, err := repo.getCommit(id)
+			if err != nil {
+				return nil, err
+			}
+			tree = &commit.Tree
+		case ObjectTree:
+			if tree, err = repo.getTree(id); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%s is not a tree", opts.Tree)
+		}
+		if a.tree, err = repo.flattenTree(tree); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, fp := range patches {
+		if err := a.apply(fp); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &ApplyResult{Conflicts: a.conflicts}
+	changed := make(map[string]treeFile)
+	for p, f := range a.files {
+		if f.changed {
+			result.Paths = append(result.Paths, p)
+			if f.exists {
+				changed[p] = treeFile{mode: f.mode}
+			}
+		}
+	}
+	sort.Strings(result.Paths)
+	sort.Strings(result.Conflicts)
+	unsafe, _ := repo.unsafePaths(checkTreePaths(changed))
+	if len(unsafe) > 0 {
+		return nil, &UnsafePathsError{unsafe}
+	}
+	if err := a.checkSymlinks(); err != nil {
+		return nil, err
+	}
+	var conflictErr error
+	if len(result.Conflicts) > 0 {
+		conflictErr = &MergeConflictError{result.Conflicts}
+	}
+
+	if a.tree != nil {
+		if conflictErr != nil {
+			return result, conflictErr
+		}
+		for _, p := range result.Paths {
+			f := a.files[p]
+			if !f.exists {
+				delete(a.tree, p)
+				continue
+			}
+			id, err := repo.WriteObject(ObjectBlob, f.data)
+			if err != nil {
+				return nil, err
+			}
+			a.tree[p] = treeFile{f.mode, id}
+		}
+		if result.Tree, err = repo.writeTree(a.tree); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	if repo.dryRun != nil {
+		for _, p := range result.Paths {
+			if f := a.files[p]; f.exists {
+				id, _ := HashObject("blob", bytes.NewReader(f.data))
+				repo.recordChange(Change{Op: ChangeWriteFile, Name: p, New: id})
+			} else {
+				repo.recordChange(Change{Op: ChangeDeleteFile, Name: p})
+			}
+		}
+		return result, conflictErr
+	}
+	if repo.snapshot != nil {
+		return nil, ErrReadOnlySnapshot
+	}
+	// removals first, a file may be replaced by a directory
+	for _, p := range result.Paths {
+		if !a.files[p].exists {
+			if err := repo.removeWorkTreeFile(p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, p := range result.Paths {
+		if f := a.files[p]; f.exists {
+			if err := repo.writeApplied(p, f); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return result, conflictErr
+}
+
+type applier struct {
+	repo *Repository
+	opts ApplyOptions
+	// the files of the tree the patch is applied to, nil for the working
+	// tree
+	tree map[string]treeFile
+	// the files as patched so far
+	files     map[string]*applyFile
+	conflicts []string
+}
+
+type applyFile struct {
+	data    []byte
+	mode    EntryMode
+	exists  bool
+	changed bool
+}
+
+// Return the file at p, as patched so far.
+func (a *applier) file(p string) (*applyFile, error) {
+	if f, ok := a.files[p]; ok {
+		return f, nil
+	}
+	f := &applyFile{}
+	if a.tree != nil {
+		if tf, ok := a.tree[p]; ok && tf.mode != ModeCommit {
+			data, err := a.repo.readBlob(tf.id)
+			if err != nil {
+				return nil, err
+			}
+			f.data, f.mode, f.exists = data, tf.mode, true
+		}
+	} else {
+		fpath := filepath.Join(a.repo.WorkTree, filepath.FromSlash(p))
+		fi, err := os.Lstat(fpath)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return nil, err
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(fpath)
+			if err != nil {
+				return nil, err
+			}
+			f.data, f.mode, f.exists = []byte(target), ModeSymlink, true
+		case fi.Mode().IsRegular():
+			if f.data, err = ioutil.ReadFile(fpath); err != nil {
+				return nil, err
+			}
+			f.mode, f.exists = ModeBlob, true
+			if fi.Mode()&0111 != 0 {
+				f.mode = ModeExec
+			}
+		default:
+			return nil, &ApplyError{Path: p, Reason: "not a file"}
+		}
+	}
+	a.files[p] = f
+	return f, nil
+}
+
+// Apply one file patch.
+func (a *applier) apply(fp *FilePatch) error {
+	var src *applyFile
+	var err error
+	if fp.Status != FileAdded {
+		if src, err = a.file(fp.OldPath); err != nil {
+			return err
+		}
+		if !src.exists {
+			return &ApplyError{Path: fp.OldPath, Reason: "does not exist"}
+		}
+	}
+	var dst *applyFile
+	if fp.Status != FileDeleted {
+		if dst, err = a.file(fp.NewPath); err != nil {
+			return err
+		}
+		if dst.exists && dst != src {
+			return &ApplyError{Path: fp.NewPath, Reason: "already exists"}
+		}
+	}
+
+	var data []byte
+	var conflict bool
+	if src != nil {
+		data, conflict, err = a.patchContent(fp, src.data)
+	} else {
+		data, conflict, err = a.patchContent(fp, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	if fp.Status == FileDeleted {
+		if len(data) > 0 {
+			return &ApplyError{Path: fp.OldPath, Reason: "removal patch leaves file contents"}
+		}
+		*src = applyFile{changed: true}
+		return nil
+	}
+	mode := fp.NewMode
+	if mode == 0 {
+		if mode = ModeBlob; src != nil {
+			mode = src.mode
+		}
+	}
+	*dst = applyFile{data: data, mode: mode, exists: true, changed: true}
+	if fp.Status == FileRenamed {
+		*src = applyFile{changed: true}
+	}
+	if conflict {
+		a.conflicts = append(a.conflicts, fp.NewPath)
+	}
+	return nil
+}
+
+// Check that the symlinks the patch writes don't point outside the tree,
+// following the other symlinks of the tree, or those the patch writes to
+// the working tree.
+func (a *applier) checkSymlinks() error {
+	links := make(map[string]string)
+	var written []string
+	for p, f := range a.files {
+		if f.exists && f.mode == ModeSymlink {
+			links[p] = string(f.data)
+			if f.changed {
+				written = append(written, p)
+			}
+		}
+	}
+	if len(written) == 0 {
+		return nil
+	}
+	for p, tf := range a.tree {
+		if _, ok := a.files[p]; !ok && tf.mode == ModeSymlink {
+			target, err := a.repo.readBlob(tf.id)
+			if err != nil {
+				return err
+			}
+			links[p] = string(target)
+		}
+	}
+	sort.Strings(written)
+	for _, p := range written {
+		if err := ValidateSymlink(p, links[p], links); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Return the content of a file patched by fp, and whether it was merged
+// with conflicts.
+func (a *applier) patchContent(fp *FilePatch, data []byte) ([]byte, bool, error) {
+	if fp.Binary {
+		// binary patches can only be applied when the repository has the
+		// new blob, and the index line names the old one
+		if fp.Status != FileAdded {
+			oldId, _ := HashObject("blob", bytes.NewReader(data))
+			if fp.oldIndex == "" || !strings.HasPrefix(oldId.String(), fp.oldIndex) {
+				return nil, false, &ApplyError{Path: fp.Path(), Reason: "binary patch does not apply"}
+			}
+		}
+		if fp.Status == FileDeleted {
+			return nil, false, nil
+		}
+		newId, ok := a.patchBlob(fp.newIndex)
+		if !ok {
+			return nil, false, &ApplyError{Path: fp.Path(), Reason: "cannot apply binary patch without the new blob"}
+		}
+		newData, err := a.repo.readBlob(newId)
+		return newData, false, err
+	}
+
+	patched, err := applyHunks(fp, data)
+	if err == nil || !a.opts.ThreeWay {
+		return patched, false, err
+	}
+	baseId, ok := a.patchBlob(fp.oldIndex)
+	if !ok {
+		return nil, false, err
+	}
+	base, berr := a.repo.readBlob(baseId)
+	if berr != nil {
+		return nil, false, berr
+	}
+	theirs, terr := applyHunks(fp, base)
+	if terr != nil {
+		// the patch wasn't made from that blob either
+		return nil, false, err
+	}
+	merged, conflicts := merge3Lines(splitLines(base), splitLines(data), splitLines(theirs), "ours", "theirs")
+	return []byte(strings.Join(merged, "")), len(conflicts) > 0, nil
+}
+
+// Return the id of the blob an index line names, if the repository has it.
+func (a *applier) patchBlob(prefix string) (ObjectID, bool) {
+	if prefix == "" || strings.Trim(prefix, "0") == "" {
+		// the null id of a missing file
+		return ObjectID{}, false
+	}
+	id, err := a.repo.expandShortId(prefix)
+	return id, err == nil
+}
+
+// Apply the hunks of fp to data.
+func applyHunks(fp *FilePatch, data []byte) ([]byte, error) {
+	lines := splitLines(data)
+	var out []string
+	pos, offset := 0, 0
+	for n, h := range fp.Hunks {
+		var pre, post []string
+		for _, l := range h.Lines {
+			s := l.Content
+			if !l.NoNewline {
+				s += "\n"
+			}
+			if l.Type != DiffLineAdd {
+				pre = append(pre, s)
+			}
+			if l.Type != DiffLineDelete {
+				post = append(post, s)
+			}
+		}
+
+		want := h.OldStart - 1
+		if h.OldLines == 0 {
+			// the hunk inserts after line OldStart
+			want = h.OldStart
+		}
+		at := findLines(lines, pre, pos, want+offset)
+		if at < 0 {
+			return nil, &ApplyError{Path: fp.Path(), Hunk: n + 1, Reason: "does not apply"}
+		}
+		out = append(out, lines[pos:at]...)
+		out = append(out, post...)
+		pos, offset = at+len(pre), at-want
+	}
+	out = append(out, lines[pos:]...)
+	return []byte(strings.Join(out, "")), nil
+}
+
+// Return the index of lines at which want is, the closest to near at or
+// after from, or -1.
+func findLines(lines, want []string, from, near int) int {
+	last := len(lines) - len(want)
+	if near < from {
+		near = from
+	}
+	if near > last {
+		near = last
+	}
+	for d := 0; near-d >= from || near+d <= last; d++ {
+		if i := near - d; i >= from && i <= last && equalLines(lines[i:i+len(want)], want) {
+			return i
+		}
+		if i := near + d; d > 0 && i >= from && i <= last && equalLines(lines[i:i+len(want)], want) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Write a patched file into the working tree.
+func (repo *Repository) writeApplied(p string, f *applyFile) error {
+	if err := checkNoSymlinkParents(repo.WorkTree, p); err != nil {
+		return err
+	}
+	fpath := filepath.Join(repo.WorkTree, filepath.FromSlash(p))
+	if err := os.MkdirAll(filepath.Dir(fpath), 0777); err != nil {
+		return err
+	}
+	if err := os.Remove(fpath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var err error
+	switch f.mode {
+	case ModeSymlink:
+		_, err = writeSymlink(fpath, bytes.NewReader(f.data))
+	case ModeExec:
+		_, err = writeWorkTreeFile(fpath, bytes.NewReader(f.data), 0777)
+	default:
+		_, err = writeWorkTreeFile(fpath, bytes.NewReader(f.data), 0666)
+	}
+	return err
+}
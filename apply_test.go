@@ -0,0 +1,291 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The lines 1 to n, with some of them replaced.
+func numberedLines(n int, replace ...string) string {
+	var lines []string
+	for i := 1; i <= n; i++ {
+		lines = append(lines, fmt.Sprint(i))
+	}
+	for i := 0; i < len(replace); i += 2 {
+		for j, l := range lines {
+			if l == replace[i] {
+				lines[j] = replace[i+1]
+			}
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+const (
+	// 6 -> six
+	patchSix = "--- a/f\n+++ b/f\n@@ -3,7 +3,7 @@\n 3\n 4\n 5\n-6\n+six\n 7\n 8\n 9\n"
+	// 2 -> two and 11 -> eleven
+	patchTwoHunks = "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n 1\n-2\n+two\n 3\n@@ -10,3 +10,3 @@\n 10\n-11\n+eleven\n 12\n"
+)
+
+func TestApplyHunks(t *testing.T) {
+	tests := []struct {
+		name     string
+		patch    string
+		in, out  string
+		failHunk int
+	}{
+		{"exact", patchSix, numberedLines(12), numberedLines(12, "6", "six"), 0},
+		{"moved down", patchSix, "a\nb\n" + numberedLines(12), "a\nb\n" + numberedLines(12, "6", "six"), 0},
+		{"moved up", patchSix, numberedLines(12)[4:], numberedLines(12, "6", "six")[4:], 0},
+		{"second hunk moved by the first one's offset",
+			patchTwoHunks, "0\n" + numberedLines(12), "0\n" + numberedLines(12, "2", "two", "11", "eleven"), 0},
+		{"second hunk moved", patchTwoHunks,
+			numberedLines(12, "5", "5\n5.5"), numberedLines(12, "2", "two", "5", "5\n5.5", "11", "eleven"), 0},
+		{"insert at the start", "--- a/f\n+++ b/f\n@@ -0,0 +1 @@\n+0\n", numberedLines(2), "0\n" + numberedLines(2), 0},
+		{"insert at the end", "--- a/f\n+++ b/f\n@@ -2,0 +3 @@\n+3\n", numberedLines(2), numberedLines(3), 0},
+		{"no newline at the end", "--- a/f\n+++ b/f\n@@ -2 +2 @@\n-2\n+two\n\\ No newline at end of file\n",
+			numberedLines(2), "1\ntwo", 0},
+		// hunks apply without fuzz, like git apply without -C
+		{"context changed", patchSix, numberedLines(12, "4", "four"), "", 1},
+		{"context missing", patchSix, numberedLines(7), "", 1},
+		{"removed line changed", patchSix, numberedLines(12, "6", "SIX"), "", 1},
+		{"second hunk rejected", patchTwoHunks, numberedLines(12, "12", "twelve"), "", 2},
+		{"hunks out of order", patchTwoHunks, numberedLines(12)[strings.Index(numberedLines(12), "10"):] + "1\n2\n3\n", "", 2},
+	}
+	for _, test := range tests {
+		patches, err := ParsePatch(strings.NewReader(test.patch))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		out, err := applyHunks(patches[0], []byte(test.in))
+		if test.failHunk > 0 {
+			if aerr, ok := err.(*ApplyError); !ok || aerr.Hunk != test.failHunk {
+				t.Errorf("%s: expected hunk #%d to fail, got %v", test.name, test.failHunk, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if string(out) != test.out {
+			t.Errorf("%s: expected\n%q\ngot\n%q", test.name, test.out, out)
+		}
+	}
+}
+
+// Write a tree with the files, all ModeBlob, and return its id.
+func writeTestTree(t *testing.T, repo *Repository, files map[string]string) ObjectID {
+	t.Helper()
+	b, err := repo.NewTreeBuilder(ObjectID{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, data := range files {
+		id, err := repo.WriteObject(ObjectBlob, []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Insert(p, ModeBlob, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	id, err := b.Write()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func readTestFile(t *testing.T, repo *Repository, tree ObjectID, p string) string {
+	t.Helper()
+	tr, err := repo.GetTree(tree.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := tr.GetTreeEntryByPath(p)
+	if err != nil {
+		t.Fatalf("%s: %v", p, err)
+	}
+	data, err := repo.readBlob(entry.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestApplyPatchToTree(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	tree := writeTestTree(t, repo, map[string]string{
+		"f":        numberedLines(12),
+		"old":      "old\n",
+		"dir/gone": "gone\n",
+	})
+	patch := "diff --git a/f b/f\n" + patchSix +
+		"diff --git a/old b/new\nsimilarity index 100%\nrename from old\nrename to new\n" +
+		"diff --git a/dir/gone b/dir/gone\ndeleted file mode 100644\n--- a/dir/gone\n+++ /dev/null\n@@ -1 +0,0 @@\n-gone\n" +
+		"diff --git a/added b/added\nnew file mode 100755\n--- /dev/null\n+++ b/added\n@@ -0,0 +1 @@\n+added\n"
+	result, err := repo.ApplyPatch(strings.NewReader(patch), ApplyOptions{Tree: tree.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"added", "dir/gone", "f", "new", "old"}; !reflect.DeepEqual(result.Paths, expected) {
+		t.Errorf("expected paths %v, got %v", expected, result.Paths)
+	}
+	if data := readTestFile(t, repo, result.Tree, "f"); data != numberedLines(12, "6", "six") {
+		t.Errorf("f patched to %q", data)
+	}
+	if data := readTestFile(t, repo, result.Tree, "new"); data != "old\n" {
+		t.Errorf("renamed file has %q", data)
+	}
+	tr, err := repo.GetTree(result.Tree.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"old", "dir/gone", "dir"} {
+		if _, err := tr.GetTreeEntryByPath(p); err != ErrNotExist {
+			t.Errorf("%s wasn't removed: %v", p, err)
+		}
+	}
+	if entry, err := tr.GetTreeEntryByPath("added"); err != nil || entry.EntryMode() != ModeExec {
+		t.Errorf("added file missing or with the wrong mode: %v", err)
+	}
+}
+
+func TestApplyPatchRejects(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	tree := writeTestTree(t, repo, map[string]string{
+		"f": numberedLines(12, "4", "four"),
+		"g": numberedLines(12),
+	})
+	tests := []struct {
+		name, patch, path string
+	}{
+		{"context changed", "diff --git a/g b/g\n" + strings.Replace(patchSix, "/f", "/g", -1) +
+			"diff --git a/f b/f\n" + patchSix, "f"},
+		{"missing file", "diff --git a/missing b/missing\n" + strings.Replace(patchSix, "/f", "/missing", -1), "missing"},
+		{"added file exists", "diff --git a/g b/g\nnew file mode 100644\n--- /dev/null\n+++ b/g\n@@ -0,0 +1 @@\n+g\n", "g"},
+		{"deleted file changed", "diff --git a/g b/g\ndeleted file mode 100644\n--- a/g\n+++ /dev/null\n@@ -1,2 +0,0 @@\n-1\n-2\n", "g"},
+	}
+	for _, test := range tests {
+		result, err := repo.ApplyPatch(strings.NewReader(test.patch), ApplyOptions{Tree: tree.String()})
+		aerr, ok := err.(*ApplyError)
+		if !ok || aerr.Path != test.path {
+			t.Errorf("%s: expected an *ApplyError for %s, got %v", test.name, test.path, err)
+		}
+		if result != nil {
+			t.Errorf("%s: patch partly applied", test.name)
+		}
+	}
+}
+
+func TestApplyPatchThreeWay(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	base, err := repo.WriteObject(ObjectBlob, []byte(numberedLines(12)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the patch was made from base, f has changed since
+	patch := fmt.Sprintf("diff --git a/f b/f\nindex %s..0000001 100644\n%s", base.String()[:7], patchSix)
+	unknownBase := "diff --git a/f b/f\nindex 1234567..0000001 100644\n" + patchSix
+
+	tests := []struct {
+		name      string
+		patch     string
+		file      string
+		merged    string
+		conflicts bool
+	}{
+		{"merged", patch, numberedLines(12, "4", "four"), numberedLines(12, "4", "four", "6", "six"), false},
+		{"conflict", patch, numberedLines(12, "6", "SIX"), "", true},
+		{"base missing", unknownBase, numberedLines(12, "4", "four"), "", false},
+	}
+	for _, test := range tests {
+		tree := writeTestTree(t, repo, map[string]string{"f": test.file})
+
+		// without ThreeWay, the patch doesn't apply
+		_, err := repo.ApplyPatch(strings.NewReader(test.patch), ApplyOptions{Tree: tree.String()})
+		if _, ok := err.(*ApplyError); !ok {
+			t.Errorf("%s: expected an *ApplyError without ThreeWay, got %v", test.name, err)
+		}
+
+		result, err := repo.ApplyPatch(strings.NewReader(test.patch), ApplyOptions{Tree: tree.String(), ThreeWay: true})
+		switch {
+		case test.conflicts:
+			cerr, ok := err.(*MergeConflictError)
+			if !ok || !reflect.DeepEqual(cerr.Paths, []string{"f"}) {
+				t.Errorf("%s: expected a conflict in f, got %v", test.name, err)
+			} else if !reflect.DeepEqual(result.Conflicts, []string{"f"}) || !result.Tree.IsZero() {
+				t.Errorf("%s: tree written despite conflicts", test.name)
+			}
+		case test.merged == "":
+			if _, ok := err.(*ApplyError); !ok {
+				t.Errorf("%s: expected an *ApplyError, got %v", test.name, err)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		default:
+			if data := readTestFile(t, repo, result.Tree, "f"); data != test.merged {
+				t.Errorf("%s: expected\n%q\ngot\n%q", test.name, test.merged, data)
+			}
+		}
+	}
+}
+
+func TestApplyPatchUnsafePaths(t *testing.T) {
+	add := func(p, mode, content string) string {
+		return fmt.Sprintf("diff --git a/%s b/%s\nnew file mode %s\n--- /dev/null\n+++ b/%s\n@@ -0,0 +1 @@\n+%s\n\\ No newline at end of file\n",
+			p, p, mode, p, content)
+	}
+	tests := []struct {
+		name, patch string
+	}{
+		{"parent directory", add("../escaped", "100644", "escaped")},
+		{"hook", add(".git/hooks/post-checkout", "100755", "#!/bin/sh")},
+		{"hook through a short name", add("GIT~1/hooks/post-checkout", "100755", "#!/bin/sh")},
+		{"renamed into .git", "diff --git a/data b/.git/config\nsimilarity index 100%\nrename from data\nrename to .git/config\n"},
+		{"deleted outside", "diff --git a/../x b/../x\ndeleted file mode 100644\n--- a/../x\n+++ /dev/null\n@@ -1 +0,0 @@\n-x\n"},
+		{"symlink outside", add("link", "120000", "../../etc")},
+		{"symlink through a symlink", add("dir/up", "120000", "..") + add("link", "120000", "dir/up/../etc")},
+	}
+	for _, mode := range []string{"tree", "worktree"} {
+		for _, test := range tests {
+			var repo *Repository
+			opts := ApplyOptions{}
+			if mode == "tree" {
+				repo = openTestRepoCopy(t)
+				opts.Tree = "master"
+			} else {
+				repo = openTestWorkTree(t)
+			}
+			_, err := repo.ApplyPatch(strings.NewReader(test.patch), opts)
+			if _, ok := err.(*UnsafePathsError); !ok {
+				t.Errorf("%s, %s: expected an *UnsafePathsError, got %v", mode, test.name, err)
+			}
+			if mode == "worktree" {
+				parent := filepath.Dir(repo.WorkTree)
+				for _, p := range []string{filepath.Join(parent, "escaped"), filepath.Join(repo.Path, "hooks/post-checkout"), filepath.Join(repo.WorkTree, "link")} {
+					if _, err := os.Lstat(p); !os.IsNotExist(err) {
+						t.Errorf("%s, %s: %s written", mode, test.name, p)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestApplyPatchSymlinkInside(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	tree := writeTestTree(t, repo, map[string]string{"dir/file": "file\n"})
+	patch := "diff --git a/dir/link b/dir/link\nnew file mode 120000\n--- /dev/null\n+++ b/dir/link\n@@ -0,0 +1 @@\n+../dir/file\n\\ No newline at end of file\n"
+	result, err := repo.ApplyPatch(strings.NewReader(patch), ApplyOptions{Tree: tree.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data := readTestFile(t, repo, result.Tree, "dir/link"); data != "../dir/file" {
+		t.Errorf("link points to %q", data)
+	}
+}
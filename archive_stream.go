@@ -0,0 +1,118 @@
+package git
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// A reproducibleStreamer writes archives that only depend on the archived
+// files: entries get the same time, no owner, and permissions that only
+// tell whether a file is executable. The gzip header has no time or name.
+type reproducibleStreamer struct {
+	mtime time.Time
+	tw    *tar.Writer
+	gw    *gzip.Writer
+	zw    *zip.Writer
+}
+
+func newReproducibleStreamer(w io.Writer, archiveType ArchiveType, mtime time.Time) *reproducibleStreamer {
+	s := &reproducibleStreamer{mtime: mtime}
+	if archiveType == AT_ZIP {
+		s.zw = zip.NewWriter(w)
+	} else {
+		s.gw, _ = gzip.NewWriterLevel(w, gzip.BestCompression)
+		s.tw = tar.NewWriter(s.gw)
+	}
+	return s
+}
+
+// StreamFile writes the directory at relPath.
+func (s *reproducibleStreamer) StreamFile(relPath string, fi os.FileInfo, data []byte) error {
+	name := filepath.ToSlash(relPath) + "/"
+	if s.zw != nil {
+		hdr := &zip.FileHeader{Name: name, Method: zip.Store, Modified: s.mtime}
+		hdr.SetMode(os.ModeDir | 0755)
+		_, err := s.zw.CreateHeader(hdr)
+		return err
+	}
+	return s.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name,
+		Mode:     0755,
+		ModTime:  s.mtime,
+	})
+}
+
+// StreamReader writes the file fi in the directory relPath.
+func (s *reproducibleStreamer) StreamReader(relPath string, fi os.FileInfo, r io.Reader) error {
+	name := path.Join(filepath.ToSlash(relPath), fi.Name())
+	mode := int64(0644)
+	if fi.Mode()&0100 != 0 {
+		mode = 0755
+	}
+
+	if fi.Mode()&os.ModeSymlink != 0 {
+		target, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if s.zw != nil {
+			hdr := &zip.FileHeader{Name: name, Method: zip.Store, Modified: s.mtime}
+			hdr.SetMode(os.ModeSymlink | 0777)
+			w, err := s.zw.CreateHeader(hdr)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(target)
+			return err
+		}
+		return s.tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeSymlink,
+			Name:     name,
+			Linkname: string(target),
+			Mode:     0777,
+			ModTime:  s.mtime,
+		})
+	}
+
+	if s.zw != nil {
+		hdr := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: s.mtime}
+		hdr.SetMode(os.FileMode(mode))
+		w, err := s.zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, r)
+		return err
+	}
+	err := s.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     fi.Size(),
+		Mode:     mode,
+		ModTime:  s.mtime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(s.tw, r)
+	return err
+}
+
+func (s *reproducibleStreamer) Close() error {
+	if s.zw != nil {
+		return s.zw.Close()
+	}
+	if err := s.tw.Close(); err != nil {
+		s.gw.Close()
+		return err
+	}
+	return s.gw.Close()
+}
@@ -0,0 +1,177 @@
+package git
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// Special values of an attribute, as reported by CheckAttr. Any other value
+// is the string the attribute was set to.
+const (
+	AttrSet         = "set"
+	AttrUnset       = "unset"
+	AttrUnspecified = "unspecified"
+)
+
+// An AttrMatch is the value of one attribute for one path, and the line of
+// the attributes file that set it.
+type AttrMatch struct {
+	Path   string
+	Attr   string
+	Value  string
+	Source string
+	Line   int
+}
+
+type attrLine struct {
+	pattern *pathPattern
+	specs   []string
+	source  string
+	line    int
+}
+
+var builtinAttrMacros = map[string][]string{
+	"binary": {"-diff", "-merge", "-text"},
+}
+
+// CheckAttr returns the values of the given attributes for each path, as
+// set by the .gitattributes files of the HEAD commit and the repository's
+// info/attributes file. If attrs is empty, all attributes that are set for
+// a path are returned, like git check-attr -a.
+func (repo *Repository) CheckAttr(attrs, paths []string) ([]*AttrMatch, error) {
+	tree, err := repo.headTree()
+	if err != nil {
+		return nil, err
+	}
+	return tree.CheckAttr(attrs, paths)
+}
+
+// CheckAttr is like Repository.CheckAttr, with the .gitattributes files
+// read from this tree.
+func (t *Tree) CheckAttr(attrs, paths []string) ([]*AttrMatch, error) {
+	reader := newTreePatternReader(t, ".gitattributes")
+	info, err := t.repo.infoPatterns("attributes")
+	if err != nil {
+		return nil, err
+	}
+
+	// macros may only be defined at the top level
+	macros := make(map[string][]string, len(builtinAttrMacros))
+	for name, specs := range builtinAttrMacros {
+		macros[name] = specs
+	}
+	rootLines, err := reader.lines("")
+	if err != nil {
+		return nil, err
+	}
+	infoLines := make([]string, 0, len(info))
+	for _, p := range info {
+		infoLines = append(infoLines, p.pattern)
+	}
+	for _, lines := range [][]string{rootLines, infoLines} {
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			if len(fields) > 0 && strings.HasPrefix(fields[0], "[attr]") {
+				macros[strings.TrimPrefix(fields[0], "[attr]")] = fields[1:]
+			}
+		}
+	}
+
+	var matches []*AttrMatch
+	for _, p := range paths {
+		p = strings.Trim(path.Clean("/"+p), "/")
+		values, err := attrsOfPath(reader, info, macros, p)
+		if err != nil {
+			return nil, err
+		}
+
+		want := attrs
+		if len(want) == 0 {
+			for attr := range values {
+				want = append(want, attr)
+			}
+			sort.Strings(want)
+		}
+		for _, attr := range want {
+			m, ok := values[attr]
+			if !ok {
+				m = &AttrMatch{Value: AttrUnspecified}
+			}
+			m.Path, m.Attr = p, attr
+			matches = append(matches, m)
+		}
+	}
+	return matches, nil
+}
+
+func attrsOfPath(reader *treePatternReader, info []*sourcedPattern, macros map[string][]string, name string) (map[string]*AttrMatch, error) {
+	// lowest precedence first: the root .gitattributes, deeper ones, and
+	// finally info/attributes
+	var lines []*attrLine
+	for _, dir := range parentDirs(name) {
+		raw, err := reader.lines(dir)
+		if err != nil {
+			return nil, err
+		}
+		for i, line := range raw {
+			if al := parseAttrLine(line, dir, path.Join(dir, ".gitattributes"), i+1); al != nil {
+				lines = append(lines, al)
+			}
+		}
+	}
+	for _, p := range info {
+		if al := parseAttrLine(p.pattern, "", p.source, p.line); al != nil {
+			lines = append(lines, al)
+		}
+	}
+
+	values := make(map[string]*AttrMatch)
+	var apply func(specs []string, source string, line int, depth int)
+	apply = func(specs []string, source string, line int, depth int) {
+		for _, spec := range specs {
+			attr, value := parseAttrSpec(spec)
+			if value == AttrUnspecified {
+				delete(values, attr)
+			} else {
+				values[attr] = &AttrMatch{Value: value, Source: source, Line: line}
+			}
+			if expansion, ok := macros[attr]; ok && value == AttrSet && depth < 8 {
+				apply(expansion, source, line, depth+1)
+			}
+		}
+	}
+
+	for _, al := range lines {
+		if al.pattern.match(name, false) {
+			apply(al.specs, al.source, al.line, 0)
+		}
+	}
+	return values, nil
+}
+
+func parseAttrLine(line, base, source string, lineNo int) *attrLine {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || strings.HasPrefix(fields[0], "[attr]") {
+		return nil
+	}
+	pattern := parsePathPattern(fields[0], base)
+	if pattern.negate {
+		// negative patterns are forbidden in attributes files
+		return nil
+	}
+	return &attrLine{pattern: pattern, specs: fields[1:], source: source, line: lineNo}
+}
+
+func parseAttrSpec(spec string) (attr, value string) {
+	switch {
+	case strings.HasPrefix(spec, "-"):
+		return spec[1:], AttrUnset
+	case strings.HasPrefix(spec, "!"):
+		return spec[1:], AttrUnspecified
+	}
+	if i := strings.IndexByte(spec, '='); i >= 0 {
+		return spec[:i], spec[i+1:]
+	}
+	return spec, AttrSet
+}
@@ -0,0 +1,364 @@
+package git
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// A BackupManifest describes a backup made with Backup. It is kept next to
+// the backup and passed to the next one to make it incremental.
+type BackupManifest struct {
+	Time time.Time `json:"time"`
+	// All refs of the repository when the backup was made, with HEAD.
+	Refs map[string]ObjectID `json:"refs"`
+	// Commits the backup doesn't contain but builds upon. They have to be
+	// restored from earlier backups first.
+	Prerequisites []ObjectID `json:"prerequisites,omitempty"`
+	// The number of objects in the backup.
+	Objects int `json:"objects"`
+}
+
+// ReadBackupManifest reads a manifest written by BackupManifest.Write.
+func ReadBackupManifest(r io.Reader) (*BackupManifest, error) {
+	m := new(BackupManifest)
+	if err := json.NewDecoder(r).Decode(m); err != nil {
+		return nil, fmt.Errorf("reading backup manifest: %v", err)
+	}
+	return m, nil
+}
+
+// Write writes the manifest as JSON.
+func (m *BackupManifest) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(m)
+}
+
+type BackupFormat int
+
+const (
+	// A git bundle with the refs, which git clone and git fetch read.
+	BackupBundle BackupFormat = iota
+	// A bare pack, e.g. for git index-pack. The refs are only in the
+	// manifest.
+	BackupPack
+)
+
+type BackupOptions struct {
+	Format BackupFormat
+	// The manifest of the previous backup. Objects reachable from its
+	// refs are left out. Nil makes a full backup.
+	Since *BackupManifest
+}
+
+// Backup writes the refs of the repository and all objects reachable from
+// them to w, or only the objects that are new since a previous backup.
+// The refs are read first and only objects are read afterwards, which
+// don't change, so the backup is consistent even while the repository is
+// pushed to; packs removed by a concurrent repack are looked up again.
+func (repo *Repository) Backup(w io.Writer, opts BackupOptions) (*BackupManifest, error) {
+	m := &BackupManifest{Time: time.Now(), Refs: make(map[string]ObjectID)}
+	if head, ok, err := repo.readLooseRef("HEAD"); err != nil {
+		return nil, err
+	} else if ok {
+		m.Refs["HEAD"] = head.Id
+	}
+	err := repo.ForEachRef("refs/", func(ref Ref) error {
+		m.Refs[ref.Name] = ref.Id
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ids, prereqs, err := repo.backupObjects(m.Refs, opts.Since)
+	if err != nil {
+		// a repack may have removed a pack while we were reading it
+		if rerr := repo.ReloadPacks(); rerr != nil {
+			return nil, err
+		}
+		if ids, prereqs, err = repo.backupObjects(m.Refs, opts.Since); err != nil {
+			return nil, err
+		}
+	}
+	m.Prerequisites = prereqs
+	m.Objects = len(ids)
+
+	bw := bufio.NewWriter(w)
+	if opts.Format == BackupBundle {
+		if err := writeBundleHeader(bw, m); err != nil {
+			return nil, err
+		}
+	}
+	read := func(id ObjectID) (ObjectType, int64, io.ReadCloser, error) {
+		tp, size, rc, err := repo.GetRawObject(id, false)
+		if err != nil && repo.ReloadPacks() == nil {
+			tp, size, rc, err = repo.GetRawObject(id, false)
+		}
+		return tp, size, rc, err
+	}
+	if _, _, err := repo.writePack(bw, ids, read); err != nil {
+		return nil, err
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
+	repo.log().Debug("wrote backup", "refs", len(m.Refs), "objects", len(ids), "prerequisites", len(prereqs))
+	return m, nil
+}
+
+// Write the header of a v2 bundle: the prerequisites, the refs and an
+// empty line.
+func writeBundleHeader(w io.Writer, m *BackupManifest) error {
+	if _, err := io.WriteString(w, "# v2 git bundle\n"); err != nil {
+		return err
+	}
+	for _, id := range m.Prerequisites {
+		if _, err := fmt.Fprintf(w, "-%s\n", id); err != nil {
+			return err
+		}
+	}
+	names := make([]string, 0, len(m.Refs))
+	for name := range m.Refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := fmt.Fprintf(w, "%s %s\n", m.Refs[name], name); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Return the objects reachable from refs but not from the refs of since,
+// and the commits of since the new history is based on.
+func (repo *Repository) backupObjects(refs map[string]ObjectID, since *BackupManifest) (ids, prereqs []ObjectID, err error) {
+	w := &backupWalk{
+		repo:  repo,
+		old:   make(map[ObjectID]bool),
+		seen:  make(map[ObjectID]bool),
+		edges: make(map[ObjectID]bool),
+	}
+	if since != nil {
+		if err := w.markOld(since.Refs); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	tips := make([]ObjectID, 0, len(refs))
+	for _, id := range refs {
+		tips = append(tips, id)
+	}
+	sort.Slice(tips, func(i, j int) bool { return tips[i].String() < tips[j].String() })
+	for _, id := range tips {
+		if err := w.add(id); err != nil {
+			return nil, nil, err
+		}
+	}
+	// the trees of the old commits the new ones build upon have most of
+	// the unchanged files
+	for id := range w.edges {
+		commit, err := repo.getCommit(id)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := w.markOldTree(commit.Tree.Id); err != nil {
+			return nil, nil, err
+		}
+		prereqs = append(prereqs, id)
+	}
+	sort.Slice(prereqs, func(i, j int) bool { return prereqs[i].String() < prereqs[j].String() })
+
+	for len(w.trees) > 0 {
+		id := w.trees[len(w.trees)-1]
+		w.trees = w.trees[:len(w.trees)-1]
+		if w.old[id] {
+			continue
+		}
+		w.ids = append(w.ids, id)
+		if err := w.scanTree(id, false); err != nil {
+			return nil, nil, err
+		}
+	}
+	return w.ids, prereqs, nil
+}
+
+type backupWalk struct {
+	repo *Repository
+	// objects reachable from the previous backup
+	old  map[ObjectID]bool
+	seen map[ObjectID]bool
+	// old commits that are parents or refs of the backup
+	edges map[ObjectID]bool
+	// trees still to be scanned, once the old trees are known
+	trees []ObjectID
+	ids   []ObjectID
+}
+
+// Mark the history of the refs of the previous backup as old. Refs to
+// objects that are gone, e.g. deleted branches, are ignored.
+func (w *backupWalk) markOld(refs map[string]ObjectID) error {
+	var commits []ObjectID
+	for _, id := range refs {
+		id, tp, err := w.peel(id, func(tag ObjectID) { w.old[tag] = true })
+		if err != nil {
+			return err
+		}
+		switch tp {
+		case ObjectCommit:
+			commits = append(commits, id)
+		case ObjectTree:
+			if err := w.markOldTree(id); err != nil {
+				return err
+			}
+		case ObjectBlob:
+			w.old[id] = true
+		}
+	}
+
+	for len(commits) > 0 {
+		id := commits[len(commits)-1]
+		commits = commits[:len(commits)-1]
+		if w.old[id] {
+			continue
+		}
+		w.old[id] = true
+		commit, err := w.repo.getCommit(id)
+		if err != nil {
+			return err
+		}
+		for _, p := range commit.parents {
+			if !w.old[p] {
+				commits = append(commits, p)
+			}
+		}
+	}
+	return nil
+}
+
+// Follow tags from id, calling fn for each, and return the object at the
+// end and its type, or zero if an object is missing.
+func (w *backupWalk) peel(id ObjectID, fn func(ObjectID)) (ObjectID, ObjectType, error) {
+	for {
+		found, _, err := w.repo.haveObject(id)
+		if err != nil || !found {
+			return id, 0, err
+		}
+		tp, err := w.repo.objectType(id)
+		if err != nil || tp != ObjectTag {
+			return id, tp, err
+		}
+		fn(id)
+		tag, err := w.repo.getTag(id)
+		if err != nil {
+			return id, 0, err
+		}
+		id = tag.Object
+	}
+}
+
+// Add the object a ref points to, with everything reachable from it that
+// isn't old. Trees are only queued.
+func (w *backupWalk) add(id ObjectID) error {
+	id, tp, err := w.peel(id, func(tag ObjectID) {
+		if !w.old[tag] && !w.seen[tag] {
+			w.seen[tag] = true
+			w.ids = append(w.ids, tag)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	switch tp {
+	case 0:
+		return fmt.Errorf("object %s is missing", id)
+	case ObjectCommit:
+		if w.old[id] {
+			w.edges[id] = true
+			return nil
+		}
+	case ObjectTree:
+		w.queueTree(id)
+		return nil
+	default:
+		if !w.old[id] && !w.seen[id] {
+			w.seen[id] = true
+			w.ids = append(w.ids, id)
+		}
+		return nil
+	}
+
+	commits := []ObjectID{id}
+	for len(commits) > 0 {
+		id := commits[len(commits)-1]
+		commits = commits[:len(commits)-1]
+		if w.seen[id] {
+			continue
+		}
+		w.seen[id] = true
+		w.ids = append(w.ids, id)
+		commit, err := w.repo.getCommit(id)
+		if err != nil {
+			return err
+		}
+		w.queueTree(commit.Tree.Id)
+		for _, p := range commit.parents {
+			if w.old[p] {
+				w.edges[p] = true
+			} else if !w.seen[p] {
+				commits = append(commits, p)
+			}
+		}
+	}
+	return nil
+}
+
+func (w *backupWalk) queueTree(id ObjectID) {
+	if !w.seen[id] {
+		w.seen[id] = true
+		w.trees = append(w.trees, id)
+	}
+}
+
+// Mark a tree of the previous backup and everything in it as old.
+func (w *backupWalk) markOldTree(id ObjectID) error {
+	if w.old[id] {
+		return nil
+	}
+	w.old[id] = true
+	return w.scanTree(id, true)
+}
+
+// Go through the entries of a tree. Old subtrees are marked right away,
+// new ones are queued. Submodule commits aren't followed.
+func (w *backupWalk) scanTree(id ObjectID, old bool) error {
+	scanner, err := NewTree(w.repo, id).Scanner()
+	if err != nil {
+		return err
+	}
+	for scanner.Scan() {
+		te := scanner.TreeEntry()
+		switch {
+		case te.Type == ObjectTree && old:
+			if err := w.markOldTree(te.Id); err != nil {
+				return err
+			}
+		case te.Type == ObjectTree:
+			w.queueTree(te.Id)
+		case te.Type == ObjectBlob && old:
+			w.old[te.Id] = true
+		case te.Type == ObjectBlob:
+			if !w.old[te.Id] && !w.seen[te.Id] {
+				w.seen[te.Id] = true
+				w.ids = append(w.ids, te.Id)
+			}
+		}
+	}
+	return scanner.Err()
+}
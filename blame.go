@@ -0,0 +1,250 @@
+package git
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// A BlameLine is a line of a file and the commit that added it in its
+// current form.
+type BlameLine struct {
+	// The commit that last changed the line. Its Author is the author of
+	// the line.
+	Commit *Commit
+	// The path of the file in Commit, which differs from the blamed path if
+	// the file was renamed since.
+	OrigPath string
+	// The number of the line in the file in Commit, counting from 1.
+	OrigLine int
+	// The number of the line in the blamed file, counting from 1.
+	Line    int
+	Content string // without the line ending
+}
+
+// BlameFile returns the lines of the file at path in the commit rev names,
+// each with the commit that last changed it, like git blame. Files renamed
+// as a whole are followed to their old path, but lines moved or copied
+// between files are blamed on the commit that moved them.
+func (repo *Repository) BlameFile(rev, path string) ([]*BlameLine, error) {
+	return repo.BlameFileContext(context.Background(), rev, path)
+}
+
+// BlameFileContext is like BlameFile, but stops with the context's error
+// once ctx is done.
+func (repo *Repository) BlameFileContext(ctx context.Context, rev, path string) ([]*BlameLine, error) {
+	id, err := repo.resolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.getCommit(id)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := commit.GetTreeEntryByPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Type != ObjectBlob {
+		return nil, fmt.Errorf("%s is not a file", path)
+	}
+
+	b := &blamer{
+		repo:    repo,
+		commits: map[ObjectID]*Commit{commit.Id: commit},
+		origins: make(map[blameKey]*blameOrigin),
+	}
+	start := b.origin(commit, path, entry.Id)
+	lines, err := b.lines(start)
+	if err != nil {
+		return nil, err
+	}
+	b.result = make([]*BlameLine, len(lines))
+	for i := range lines {
+		start.entries = append(start.entries, blameEntry{final: i, cur: i})
+		b.result[i] = &BlameLine{Line: i + 1, Content: strings.TrimSuffix(lines[i], "\n")}
+	}
+	b.push(start)
+
+	for b.queue.Len() > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		o := heap.Pop(&b.queue).(*blameOrigin)
+		o.queued = false
+		if err := b.pass(o); err != nil {
+			return nil, err
+		}
+	}
+	return b.result, nil
+}
+
+// A blameEntry is a line of the blamed file not blamed yet: its index in
+// the blamed file, and in the file of the origin it's at.
+type blameEntry struct {
+	final, cur int
+}
+
+type blameKey struct {
+	commit ObjectID
+	path   string
+}
+
+// A blameOrigin is a version of the file, at a path in a commit, with the
+// lines that may have come from it.
+type blameOrigin struct {
+	commit  *Commit
+	path    string
+	id      ObjectID
+	data    []string
+	entries []blameEntry
+	queued  bool
+}
+
+type blamer struct {
+	repo    *Repository
+	commits map[ObjectID]*Commit
+	origins map[blameKey]*blameOrigin
+	queue   blameQueue
+	result  []*BlameLine
+}
+
+func (b *blamer) origin(commit *Commit, path string, id ObjectID) *blameOrigin {
+	key := blameKey{commit.Id, path}
+	o, ok := b.origins[key]
+	if !ok {
+		o = &blameOrigin{commit: commit, path: path, id: id}
+		b.origins[key] = o
+	}
+	return o
+}
+
+// Queue an origin, again if lines were passed to it after it was looked at.
+func (b *blamer) push(o *blameOrigin) {
+	if !o.queued && len(o.entries) > 0 {
+		o.queued = true
+		heap.Push(&b.queue, o)
+	}
+}
+
+func (b *blamer) lines(o *blameOrigin) ([]string, error) {
+	if o.data == nil {
+		data, err := b.repo.readBlob(o.id)
+		if err != nil {
+			return nil, err
+		}
+		o.data = splitLines(data)
+	}
+	return o.data, nil
+}
+
+func (b *blamer) commit(id ObjectID) (*Commit, error) {
+	if c, ok := b.commits[id]; ok {
+		return c, nil
+	}
+	c, err := b.repo.getCommit(id)
+	if err != nil {
+		return nil, err
+	}
+	b.commits[id] = c
+	return c, nil
+}
+
+// Pass the lines of o that its parents have to them, in order, and blame
+// the others on the commit of o. If a parent has the same file, all lines
+// are passed to it.
+func (b *blamer) pass(o *blameOrigin) error {
+	entries := o.entries
+	o.entries = nil
+	for i := 0; i < o.commit.ParentCount() && len(entries) > 0; i++ {
+		id, err := o.commit.ParentId(i)
+		if err != nil {
+			return err
+		}
+		parent, err := b.commit(id)
+		if err != nil {
+			return err
+		}
+		p, err := b.parentOrigin(o, parent)
+		if err != nil {
+			return err
+		}
+		if p == nil {
+			continue
+		}
+		if p.id.Equal(o.id) {
+			p.entries = append(p.entries, entries...)
+			entries = nil
+			b.push(p)
+			break
+		}
+
+		lines, err := b.lines(o)
+		if err != nil {
+			return err
+		}
+		plines, err := b.lines(p)
+		if err != nil {
+			return err
+		}
+		match := matchLines(lines, plines)
+		kept := entries[:0]
+		for _, e := range entries {
+			if m := match[e.cur]; m >= 0 {
+				p.entries = append(p.entries, blameEntry{final: e.final, cur: m})
+			} else {
+				kept = append(kept, e)
+			}
+		}
+		entries = kept
+		b.push(p)
+	}
+
+	for _, e := range entries {
+		l := b.result[e.final]
+		l.Commit, l.OrigPath, l.OrigLine = o.commit, o.path, e.cur+1
+	}
+	return nil
+}
+
+// Return the version of the file of o in parent, at its old path if the
+// commit of o renamed it, or nil if parent doesn't have it.
+func (b *blamer) parentOrigin(o *blameOrigin, parent *Commit) (*blameOrigin, error) {
+	entry, err := parent.GetTreeEntryByPath(o.path)
+	if err == nil && entry.Type == ObjectBlob {
+		return b.origin(parent, o.path, entry.Id), nil
+	} else if err != nil && err != ErrNotExist {
+		return nil, err
+	}
+
+	changes, err := diffTrees(&parent.Tree, &o.commit.Tree)
+	if err != nil {
+		return nil, err
+	}
+	if changes, err = b.repo.detectRenames(changes, RenameOptions{}); err != nil {
+		return nil, err
+	}
+	for _, c := range changes {
+		if c.path == o.path && c.oldPath != "" && !c.copy {
+			return b.origin(parent, c.oldPath, c.from.Id), nil
+		}
+	}
+	return nil, nil
+}
+
+// queue of origins, newest commit first
+type blameQueue []*blameOrigin
+
+func (q blameQueue) Len() int { return len(q) }
+func (q blameQueue) Less(i, j int) bool {
+	return q[i].commit.Committer.When.After(q[j].commit.Committer.When)
+}
+func (q blameQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *blameQueue) Push(x interface{}) { *q = append(*q, x.(*blameOrigin)) }
+func (q *blameQueue) Pop() interface{} {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return x
+}
@@ -67,7 +67,7 @@ func StoreObjectSHA(
 	objectType ObjectType,
 	w io.Writer,
 	r io.ReadSeeker,
-) (sha1, error) {
+) (ObjectID, error) {
 
 	reader, err := PrependObjectHeader(objectType, r)
 	if err != nil {
@@ -78,7 +78,7 @@ func StoreObjectSHA(
 	reader = io.TeeReader(reader, hash)
 
 	if w == ioutil.Discard {
-		_, err = io.Copy(w, r)
+		_, err = io.Copy(w, reader)
 	} else {
 		err = copyCompressed(w, reader)
 	}
@@ -95,7 +95,7 @@ func StoreObjectSHA(
 func (repo *Repository) HaveObjectFromReadSeeker(
 	objectType ObjectType,
 	r io.ReadSeeker,
-) (found bool, id sha1, err error) {
+) (found bool, id ObjectID, err error) {
 	initialPosition, err := r.Seek(0, os.SEEK_CUR)
 	if err != nil {
 		return false, [20]byte{}, err
@@ -120,62 +120,122 @@ func (repo *Repository) HaveObjectFromReadSeeker(
 }
 
 // Write an object into git's loose database.
-// If the object already exists in the database, it is not overwritten, though
-// the compression is still performed. To avoid the compression, call
-// HaveObjectFromReader first, which is fast and just does the SHA.
+// If the object already exists in the database, loose or packed, it is not
+// overwritten, though the compression is still performed. To avoid the
+// compression, call HaveObjectFromReader first, which is fast and just does
+// the SHA.
 func (repo *Repository) StoreObjectLoose(
 	objectType ObjectType,
 	r io.ReadSeeker,
-) (sha1, error) {
-	fd, err := ioutil.TempFile(filepath.Join(repo.Path, "objects"), ".gogit_")
+) (ObjectID, error) {
+	if repo.dryRun != nil {
+		return repo.storeMemObject(objectType, r)
+	}
+	if repo.snapshot != nil {
+		return ObjectID{}, ErrReadOnlySnapshot
+	}
+
+	fd, err := ioutil.TempFile(repo.ObjectsDir, ".gogit_")
 	if err != nil {
 		return [20]byte{}, fmt.Errorf("failed to make tmpfile: %v", err)
 	}
 
 	id, err := StoreObjectSHA(objectType, fd, r)
+	if err == nil && repo.fsyncLooseObject() {
+		err = fd.Sync()
+	}
 	if err != nil {
 		fd.Close()
+		os.Remove(fd.Name())
 		return [20]byte{}, err
 	}
 	fd.Close() // Not deferred, intentionally.
 
-	objectPath := filepathFromSHA1(repo.Path, id.String())
-	if _, err = os.Stat(objectPath); err == nil {
+	if found, _, err := repo.haveObject(id); err != nil || found {
 		// Object already exists. Delete the temporary file.
-		err = os.Remove(fd.Name())
-		if err != nil {
-			return [20]byte{}, err
-		}
-		return id, nil
+		os.Remove(fd.Name())
+		return id, err
 	}
 
+	objectPath := filepathFromSHA1(repo.ObjectsDir, id.String())
 	err = os.MkdirAll(filepath.Dir(objectPath), 0775)
 	if err != nil {
 		// Failed to create the directory, and not because it already exists.
+		os.Remove(fd.Name())
+		return [20]byte{}, err
+	}
+
+	// Objects are read-only like git makes them, and renamed into place so
+	// that readers never see one half written.
+	if err = os.Chmod(fd.Name(), 0444); err == nil {
+		err = os.Rename(fd.Name(), objectPath)
+	}
+	if err != nil {
+		os.Remove(fd.Name())
+		if found, _, _ := repo.haveObject(id); found {
+			// written concurrently
+			return id, nil
+		}
 		return [20]byte{}, err
 	}
 
-	copy, err := os.Create(objectPath)
+	return id, nil
+}
+
+// WriteObject stores data as an object of type t in the loose object
+// database and returns its id, like git hash-object -w. Objects the
+// repository already has, loose or packed, aren't written again.
+func (repo *Repository) WriteObject(t ObjectType, data []byte) (ObjectID, error) {
+	return repo.StoreObjectLoose(t, bytes.NewReader(data))
+}
+
+// HashObject returns the id the content of r would get as an object of the
+// given type ("blob", "tree", "commit" or "tag"), without writing it, like
+// git hash-object.
+func HashObject(objType string, r io.Reader) (ObjectID, error) {
+	t, err := ParseObjectType(objType)
 	if err != nil {
 		return [20]byte{}, err
 	}
-	defer copy.Close()
-	original, err := os.Open(fd.Name())
+
+	rs, err := readSeeker(r)
 	if err != nil {
 		return [20]byte{}, err
 	}
-	defer original.Close()
 
-	_, err = io.Copy(copy, original)
+	return StoreObjectSHA(t, ioutil.Discard, rs)
+}
+
+// HashObject returns the id the content of r would get as an object of the
+// given type. If write is true, the object is also stored in the loose
+// object database, like git hash-object -w.
+func (repo *Repository) HashObject(objType string, r io.Reader, write bool) (ObjectID, error) {
+	if !write {
+		return HashObject(objType, r)
+	}
+
+	t, err := ParseObjectType(objType)
 	if err != nil {
 		return [20]byte{}, err
 	}
 
-	original.Close()
-	err = os.Remove(fd.Name())
+	rs, err := readSeeker(r)
 	if err != nil {
 		return [20]byte{}, err
 	}
 
-	return id, nil
+	return repo.StoreObjectLoose(t, rs)
+}
+
+// The object header needs the size up front, so a plain reader has to be
+// buffered.
+func readSeeker(r io.Reader) (io.ReadSeeker, error) {
+	if rs, ok := r.(io.ReadSeeker); ok {
+		return rs, nil
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
 }
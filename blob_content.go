@@ -0,0 +1,209 @@
+package git
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// SniffLen is the number of bytes at the start of a blob that are examined
+// to detect its content. git uses the same limit to tell binary files.
+const SniffLen = 8000
+
+// Head returns up to n bytes from the start of the blob, without reading
+// the rest of it.
+func (b *Blob) Head(n int) ([]byte, error) {
+	rc, err := b.Data()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(io.LimitReader(rc, int64(n)))
+}
+
+// IsBinary reports whether the blob looks like binary data, like git does:
+// it contains a NUL byte within its first SniffLen bytes.
+func (b *Blob) IsBinary() (bool, error) {
+	head, err := b.Head(SniffLen)
+	if err != nil {
+		return false, err
+	}
+	return isBinaryData(head), nil
+}
+
+// ContentType returns the MIME type of the blob, as guessed from its first
+// bytes by http.DetectContentType.
+func (b *Blob) ContentType() (string, error) {
+	head, err := b.Head(512)
+	if err != nil {
+		return "", err
+	}
+	return http.DetectContentType(head), nil
+}
+
+func isBinaryData(data []byte) bool {
+	if len(data) > SniffLen {
+		data = data[:SniffLen]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// A LanguageDetector guesses the programming language of a file from its
+// path and the first SniffLen bytes of its content. It returns "" if it
+// can't tell.
+type LanguageDetector func(path string, head []byte) string
+
+// DetectLanguage is the LanguageDetector used by ClassifyFile when none is
+// given. It only looks at file names and shebang lines; replace it to plug
+// in something like linguist.
+var DetectLanguage LanguageDetector = detectLanguageByName
+
+// A FileClass describes what kind of file a blob is, for repository
+// browsers.
+type FileClass struct {
+	Language    string
+	ContentType string
+	Binary      bool
+	// Set with the linguist-vendored, linguist-generated and
+	// linguist-documentation attributes, either set or set to "true" as
+	// linguist writes them.
+	Vendored      bool
+	Generated     bool
+	Documentation bool
+}
+
+// ClassifyFile returns the class of the file at path. The content is
+// sniffed, but the .gitattributes of the tree take precedence: the text
+// and binary attributes decide whether the file is binary, and
+// linguist-language overrides the detected language. If detect is nil,
+// DetectLanguage is used.
+func (t *Tree) ClassifyFile(p string, detect LanguageDetector) (*FileClass, error) {
+	blob, err := t.GetBlobByPath(p)
+	if err != nil {
+		return nil, err
+	}
+	head, err := blob.Head(SniffLen)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs, err := t.CheckAttr([]string{
+		"text", "diff", "linguist-language", "linguist-vendored",
+		"linguist-generated", "linguist-documentation",
+	}, []string{p})
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(attrs))
+	for _, m := range attrs {
+		values[m.Attr] = m.Value
+	}
+
+	class := &FileClass{
+		ContentType:   http.DetectContentType(head),
+		Binary:        isBinaryData(head),
+		Vendored:      linguistAttrSet(values["linguist-vendored"]),
+		Generated:     linguistAttrSet(values["linguist-generated"]),
+		Documentation: linguistAttrSet(values["linguist-documentation"]),
+	}
+	switch {
+	case values["text"] == AttrUnset:
+		class.Binary = true
+	case values["text"] == AttrSet:
+		class.Binary = false
+	case values["diff"] == AttrUnset:
+		class.Binary = true
+	}
+
+	if lang := values["linguist-language"]; lang != AttrUnspecified && lang != AttrSet && lang != AttrUnset {
+		class.Language = lang
+	} else if !class.Binary {
+		if detect == nil {
+			detect = DetectLanguage
+		}
+		class.Language = detect(p, head)
+	}
+	return class, nil
+}
+
+// Whether a linguist boolean attribute is set: "linguist-generated" and
+// "linguist-generated=true" both are, "linguist-generated=false" isn't.
+func linguistAttrSet(value string) bool {
+	return value == AttrSet || strings.EqualFold(value, "true")
+}
+
+var languagesByExt = map[string]string{
+	".c":     "C",
+	".h":     "C",
+	".cc":    "C++",
+	".cpp":   "C++",
+	".hpp":   "C++",
+	".cs":    "C#",
+	".css":   "CSS",
+	".go":    "Go",
+	".html":  "HTML",
+	".java":  "Java",
+	".js":    "JavaScript",
+	".json":  "JSON",
+	".kt":    "Kotlin",
+	".lua":   "Lua",
+	".m":     "Objective-C",
+	".md":    "Markdown",
+	".php":   "PHP",
+	".pl":    "Perl",
+	".py":    "Python",
+	".rb":    "Ruby",
+	".rs":    "Rust",
+	".scala": "Scala",
+	".sh":    "Shell",
+	".sql":   "SQL",
+	".swift": "Swift",
+	".ts":    "TypeScript",
+	".xml":   "XML",
+	".yaml":  "YAML",
+	".yml":   "YAML",
+}
+
+var languagesByName = map[string]string{
+	"Makefile":   "Makefile",
+	"Dockerfile": "Dockerfile",
+}
+
+var languagesByInterpreter = map[string]string{
+	"sh":      "Shell",
+	"bash":    "Shell",
+	"python":  "Python",
+	"python3": "Python",
+	"perl":    "Perl",
+	"ruby":    "Ruby",
+	"node":    "JavaScript",
+}
+
+func detectLanguageByName(p string, head []byte) string {
+	name := path.Base(p)
+	if lang, ok := languagesByName[name]; ok {
+		return lang
+	}
+	if lang, ok := languagesByExt[strings.ToLower(path.Ext(name))]; ok {
+		return lang
+	}
+
+	// #!/usr/bin/env python or #!/bin/sh
+	if bytes.HasPrefix(head, []byte("#!")) {
+		line := string(head[2:])
+		if i := strings.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) > 1 && path.Base(fields[0]) == "env" {
+			fields = fields[1:]
+		}
+		if len(fields) > 0 {
+			return languagesByInterpreter[path.Base(fields[0])]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,160 @@
+package git
+
+import (
+	"bytes"
+	"compress/zlib"
+	libsha1 "crypto/sha1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Blobs up to this size are held in memory by OpenBlob, bigger ones are
+// inflated into a temporary file.
+const blobSpoolSize = 16 << 20
+
+// StoreBlob writes a blob of the given size read from r into the loose
+// object database, compressing and hashing it while it is read, so even
+// huge blobs are written with little memory. If size is negative, r is
+// copied into a temporary file first to find it.
+func (repo *Repository) StoreBlob(r io.Reader, size int64) (ObjectID, error) {
+	if repo.dryRun != nil {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return ObjectID{}, err
+		}
+		return repo.storeMemObject(ObjectBlob, bytes.NewReader(data))
+	}
+	if repo.snapshot != nil {
+		return ObjectID{}, ErrReadOnlySnapshot
+	}
+
+	if size < 0 {
+		spool, err := ioutil.TempFile("", "gogit-blob-")
+		if err != nil {
+			return ObjectID{}, err
+		}
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+		if size, err = io.Copy(spool, r); err != nil {
+			return ObjectID{}, err
+		}
+		if _, err := spool.Seek(0, io.SeekStart); err != nil {
+			return ObjectID{}, err
+		}
+		r = spool
+	}
+
+	fd, err := ioutil.TempFile(repo.ObjectsDir, ".gogit_")
+	if err != nil {
+		return ObjectID{}, fmt.Errorf("failed to make tmpfile: %v", err)
+	}
+	id, err := writeBlobStream(fd, r, size)
+	if err == nil && repo.fsyncLooseObject() {
+		err = fd.Sync()
+	}
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(fd.Name())
+		return ObjectID{}, err
+	}
+
+	objectPath := filepathFromSHA1(repo.ObjectsDir, id.String())
+	if _, err := os.Stat(objectPath); err == nil {
+		return id, os.Remove(fd.Name())
+	}
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0775); err != nil {
+		os.Remove(fd.Name())
+		return ObjectID{}, err
+	}
+	os.Chmod(fd.Name(), 0444)
+	if err := os.Rename(fd.Name(), objectPath); err != nil {
+		os.Remove(fd.Name())
+		return ObjectID{}, err
+	}
+	return id, nil
+}
+
+// Write the compressed blob object of size bytes from r to w and return
+// its id.
+func writeBlobStream(w io.Writer, r io.Reader, size int64) (ObjectID, error) {
+	zw, err := zlib.NewWriterLevel(w, zlib.BestSpeed)
+	if err != nil {
+		return ObjectID{}, err
+	}
+	hash := libsha1.New()
+	out := io.MultiWriter(zw, hash)
+	if _, err := fmt.Fprintf(out, "blob %d\x00", size); err != nil {
+		return ObjectID{}, err
+	}
+	n, err := io.Copy(out, io.LimitReader(r, size+1))
+	if err != nil {
+		return ObjectID{}, err
+	}
+	if n != size {
+		return ObjectID{}, fmt.Errorf("blob has %d bytes, expected %d", n, size)
+	}
+	if err := zw.Close(); err != nil {
+		return ObjectID{}, err
+	}
+	return NewId(hash.Sum(nil))
+}
+
+// A BlobReader reads the content of a blob from any offset. Close releases
+// the temporary file holding a big blob.
+type BlobReader struct {
+	*io.SectionReader
+	f *os.File
+}
+
+func (b *BlobReader) Close() error {
+	if b.f == nil {
+		return nil
+	}
+	err := b.f.Close()
+	os.Remove(b.f.Name())
+	b.f = nil
+	return err
+}
+
+// OpenBlob returns a reader for random access to a blob. Big blobs are
+// inflated into a temporary file, so only a bounded amount of memory is
+// used for blobs that aren't stored as deltas.
+func (repo *Repository) OpenBlob(id ObjectID) (*BlobReader, error) {
+	tp, size, rc, err := repo.GetRawObject(id, false)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	if tp != ObjectBlob {
+		return nil, fmt.Errorf("%s is a %s, not a blob", id, tp)
+	}
+
+	if size <= blobSpoolSize {
+		data, err := ioutil.ReadAll(rc)
+		if err != nil {
+			return nil, err
+		}
+		return &BlobReader{SectionReader: io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data)))}, nil
+	}
+
+	f, err := ioutil.TempFile("", "gogit-blob-")
+	if err != nil {
+		return nil, err
+	}
+	b := &BlobReader{f: f}
+	n, err := io.Copy(f, rc)
+	if err == nil && n != size {
+		err = fmt.Errorf("blob %s has %d bytes, expected %d", id, n, size)
+	}
+	if err != nil {
+		b.Close()
+		return nil, err
+	}
+	b.SectionReader = io.NewSectionReader(f, 0, size)
+	return b, nil
+}
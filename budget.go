@@ -0,0 +1,118 @@
+package git
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+var (
+	ErrBudgetExceeded = errors.New("object read budget exceeded")
+)
+
+// A Budget limits the object reads of the calls made through a repository
+// returned by WithBudget. Zero fields are unlimited. Once a limit is hit,
+// every read fails with ErrBudgetExceeded.
+type Budget struct {
+	// Maximum number of objects read, not counting reads of only the type
+	// and size.
+	MaxObjects int
+	// Maximum number of bytes of object content read, including the delta
+	// bases packed objects are rebuilt from.
+	MaxBytes int64
+	// Maximum wall time from WithBudget on.
+	MaxDuration time.Duration
+
+	mu       sync.Mutex
+	objects  int
+	bytes    int64
+	deadline time.Time
+}
+
+// WithBudget returns a view of the repository whose object reads are
+// charged to b. The view has its own object caches, so commits read
+// through it are charged even if the original repository has them cached.
+// The repository itself is not affected.
+func (repo *Repository) WithBudget(b *Budget) *Repository {
+	view := *repo
+	view.commitCache = nil
+	view.tagCache = nil
+	view.budget = b
+
+	b.mu.Lock()
+	if b.MaxDuration > 0 && b.deadline.IsZero() {
+		b.deadline = time.Now().Add(b.MaxDuration)
+	}
+	b.mu.Unlock()
+	return &view
+}
+
+// Used returns the objects and bytes read so far.
+func (b *Budget) Used() (objects int, bytes int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.objects, b.bytes
+}
+
+func (b *Budget) exceeded() bool {
+	return (b.MaxObjects > 0 && b.objects > b.MaxObjects) ||
+		(b.MaxBytes > 0 && b.bytes > b.MaxBytes) ||
+		(!b.deadline.IsZero() && time.Now().After(b.deadline))
+}
+
+// Charge one object read.
+func (b *Budget) chargeObject() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.objects++
+	if b.exceeded() {
+		return ErrBudgetExceeded
+	}
+	return nil
+}
+
+func (b *Budget) chargeBytes(n int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bytes += int64(n)
+	if b.exceeded() {
+		return ErrBudgetExceeded
+	}
+	return nil
+}
+
+// Check that n more bytes can be read, without charging them.
+func (b *Budget) allows(n int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.exceeded() || (b.MaxBytes > 0 && b.bytes+n > b.MaxBytes) {
+		return ErrBudgetExceeded
+	}
+	return nil
+}
+
+func (b *Budget) checkTime() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.deadline.IsZero() && time.Now().After(b.deadline) {
+		return ErrBudgetExceeded
+	}
+	return nil
+}
+
+// Charges the bytes read from an object to a budget.
+type budgetReader struct {
+	io.ReadCloser
+	budget *Budget
+}
+
+func (r *budgetReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		if berr := r.budget.chargeBytes(n); berr != nil {
+			return n, berr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,194 @@
+package git
+
+import (
+	"sort"
+	"strings"
+)
+
+type ChangelogOptions struct {
+	// Group commits by the value of this trailer, e.g. "Changelog" for
+	// "Changelog: fixed", instead of by conventional commit type.
+	GroupByTrailer string
+	// Leave out commits whose patch is already in from but not in to, like
+	// a fix cherry-picked to a release branch, and all but the oldest of
+	// commits in the range with the same patch.
+	DedupeCherryPicks bool
+	// Merges are left out unless set.
+	IncludeMerges bool
+}
+
+// A ChangelogEntry is a commit of a changelog. Commits that don't follow
+// conventional commits ("type(scope)!: subject") have no Type and their
+// summary as Subject.
+type ChangelogEntry struct {
+	Id       ObjectID   `json:"id"`
+	Type     string     `json:"type,omitempty"`
+	Scope    string     `json:"scope,omitempty"`
+	Breaking bool       `json:"breaking,omitempty"`
+	Subject  string     `json:"subject"`
+	Author   *Signature `json:"author"`
+}
+
+// A ChangelogGroup are the entries of a type or trailer value, newest
+// first. Entries without one are in the group with the empty name.
+type ChangelogGroup struct {
+	Name    string            `json:"name"`
+	Entries []*ChangelogEntry `json:"entries"`
+}
+
+// A Changelog are the commits between two revisions, grouped. Groups are
+// sorted by name, with the one without a name last.
+type Changelog struct {
+	From   ObjectID          `json:"from"`
+	To     ObjectID          `json:"to"`
+	Groups []*ChangelogGroup `json:"groups"`
+}
+
+// Changelog collects the commits reachable from revision to but not from
+// from, usually two tags, for release notes. An empty from collects all
+// commits reachable from to, for a first release; an empty to is HEAD.
+func (repo *Repository) Changelog(from, to string, opts ChangelogOptions) (*Changelog, error) {
+	if to == "" {
+		to = "HEAD"
+	}
+	spec := to
+	if from != "" {
+		spec = from + ".." + to
+	}
+	old, tip, err := repo.parseRange(spec)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := repo.newCommits(old, tip)
+	if err != nil {
+		return nil, err
+	}
+	if opts.DedupeCherryPicks {
+		if commits, err = repo.dropCherryPicks(commits, old, tip); err != nil {
+			return nil, err
+		}
+	}
+
+	cl := &Changelog{From: old, To: tip}
+	groups := make(map[string]*ChangelogGroup)
+	for _, c := range commits {
+		if c.ParentCount() > 1 && !opts.IncludeMerges {
+			continue
+		}
+		entry := parseChangelogEntry(c)
+		name := entry.Type
+		if opts.GroupByTrailer != "" {
+			name = ""
+			for _, t := range c.Trailers() {
+				if strings.EqualFold(t.Key, opts.GroupByTrailer) {
+					name = t.Value
+				}
+			}
+		}
+		g := groups[name]
+		if g == nil {
+			g = &ChangelogGroup{Name: name}
+			groups[name] = g
+			cl.Groups = append(cl.Groups, g)
+		}
+		g.Entries = append(g.Entries, entry)
+	}
+	sort.Slice(cl.Groups, func(i, j int) bool {
+		a, b := cl.Groups[i].Name, cl.Groups[j].Name
+		if a == "" || b == "" {
+			return b == "" && a != ""
+		}
+		return a < b
+	})
+	return cl, nil
+}
+
+// Drop commits whose patch id is the same as that of a commit reachable
+// from old but not tip, or of an older commit in the list.
+func (repo *Repository) dropCherryPicks(commits []*Commit, old, tip ObjectID) ([]*Commit, error) {
+	seen := make(map[ObjectID]bool)
+	if !old.IsZero() {
+		upstream, err := repo.newCommits(tip, old)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range upstream {
+			id, err := c.PatchId()
+			if err != nil {
+				return nil, err
+			}
+			seen[id] = true
+		}
+	}
+
+	keep := make([]bool, len(commits))
+	for i := len(commits) - 1; i >= 0; i-- {
+		id, err := commits[i].PatchId()
+		if err != nil {
+			return nil, err
+		}
+		if id.IsZero() || !seen[id] {
+			keep[i] = true
+			seen[id] = true
+		}
+	}
+	var kept []*Commit
+	for i, c := range commits {
+		if keep[i] {
+			kept = append(kept, c)
+		}
+	}
+	return kept, nil
+}
+
+func parseChangelogEntry(c *Commit) *ChangelogEntry {
+	entry := &ChangelogEntry{Id: c.Id, Author: c.Author, Subject: c.Summary()}
+	if _, ok := trailerValue(c.CommitMessage, "BREAKING CHANGE"); ok {
+		entry.Breaking = true
+	}
+
+	i := strings.Index(entry.Subject, ": ")
+	if i <= 0 {
+		return entry
+	}
+	prefix := entry.Subject[:i]
+	breaking := strings.HasSuffix(prefix, "!")
+	prefix = strings.TrimSuffix(prefix, "!")
+	typ, scope := prefix, ""
+	if j := strings.IndexByte(prefix, '('); j > 0 && strings.HasSuffix(prefix, ")") {
+		typ, scope = prefix[:j], prefix[j+1:len(prefix)-1]
+	}
+	if strings.IndexFunc(typ, func(r rune) bool { return !isTypeChar(r) }) >= 0 {
+		return entry
+	}
+	entry.Type = strings.ToLower(typ)
+	entry.Scope = scope
+	entry.Breaking = entry.Breaking || breaking
+	entry.Subject = strings.TrimSpace(entry.Subject[i+2:])
+	return entry
+}
+
+func isTypeChar(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_'
+}
+
+// Return the value of the last "key: value" line in the last paragraph of a
+// commit message. Keys are compared case-insensitively. Unlike Trailers,
+// this finds footers like conventional commits' "BREAKING CHANGE", whose
+// key has a space.
+func trailerValue(msg, key string) (string, bool) {
+	msg = strings.TrimRight(msg, "\n")
+	i := strings.LastIndex(msg, "\n\n")
+	if i < 0 {
+		return "", false
+	}
+	msg = msg[i+2:]
+	lines := strings.Split(msg, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		j := strings.IndexByte(lines[i], ':')
+		if j > 0 && strings.EqualFold(strings.TrimSpace(lines[i][:j]), key) {
+			return strings.TrimSpace(lines[i][j+1:]), true
+		}
+	}
+	return "", false
+}
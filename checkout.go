@@ -0,0 +1,353 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+var ErrBareRepository = errors.New("operation needs a working tree")
+
+// CheckoutOptions configure Repository.Checkout.
+type CheckoutOptions struct {
+	// Number of files written in parallel. If zero, the checkout.workers
+	// config is used, which defaults to 1 like in git; if negative, one
+	// worker per CPU is used.
+	Workers int
+	// Called after each written file, from the goroutine that called
+	// Checkout.
+	Progress func(CheckoutProgress)
+	// Called for paths that can't be checked out as is on other systems.
+	// Paths that can't be checked out on this one make Checkout fail with
+	// an UnsafePathsError before anything is written.
+	Warn func(PathWarning)
+}
+
+// CheckoutProgress tells how far a checkout is.
+type CheckoutProgress struct {
+	Files      int
+	TotalFiles int
+	Bytes      int64
+}
+
+type checkoutJob struct {
+	path string
+	file treeFile
+}
+
+type checkoutResult struct {
+	entry *IndexEntry
+	bytes int64
+	err   error
+}
+
+// Checkout writes the tree of the commit rev names into the working tree,
+// removes the files of the HEAD commit that aren't part of it, writes the
+// index and points HEAD at rev: at the branch if rev is one, at the commit
+// otherwise. Local changes of the working tree are overwritten.
+//
+// Trees with paths that would be written outside of the working tree or
+// into its .git directory are refused with an UnsafePathsError.
+//
+// If ctx is cancelled or a file can't be written, Checkout stops, writes an
+// index listing the files written so far and leaves HEAD alone.
+func (repo *Repository) Checkout(ctx context.Context, rev string, opts CheckoutOptions) error {
+	if repo.WorkTree == "" {
+		return ErrBareRepository
+	}
+	id, err := repo.resolveRevision(rev)
+	if err != nil {
+		return err
+	}
+	commit, err := repo.getCommit(id)
+	if err != nil {
+		return err
+	}
+	files, err := repo.flattenTree(&commit.Tree)
+	if err != nil {
+		return err
+	}
+	if err := repo.checkCheckout(files, opts); err != nil {
+		return err
+	}
+
+	var oldFiles map[string]treeFile
+	if tree, err := repo.headTree(); err == nil {
+		if oldFiles, err = repo.flattenTree(tree); err != nil {
+			return err
+		}
+	}
+
+	head := id.String()
+	if repo.IsBranchExist(rev) {
+		head = "ref: refs/heads/" + rev
+	} else if strings.HasPrefix(rev, "refs/heads/") {
+		head = "ref: " + rev
+	}
+
+	if repo.dryRun != nil {
+		repo.recordCheckout(files, oldFiles)
+		repo.recordHeadUpdate(head, id)
+		return nil
+	}
+	if repo.snapshot != nil {
+		return ErrReadOnlySnapshot
+	}
+	if err := repo.switchFiles(ctx, files, oldFiles, opts); err != nil {
+		return err
+	}
+	return repo.setHead(head)
+}
+
+// Check that the files of a tree can be checked out, and report the paths
+// that can't be on other systems.
+func (repo *Repository) checkCheckout(files map[string]treeFile, opts CheckoutOptions) error {
+	if err := repo.validateTree(files); err != nil {
+		return err
+	}
+	unsafe, warnings := repo.unsafePaths(checkTreePaths(files))
+	if len(unsafe) > 0 {
+		return &UnsafePathsError{unsafe}
+	}
+	if opts.Warn != nil {
+		for _, w := range warnings {
+			opts.Warn(w)
+		}
+	}
+	return nil
+}
+
+// Replace oldFiles in the working tree and the index with files, leaving
+// HEAD alone. If writing stops early, the index lists the files written so
+// far.
+func (repo *Repository) switchFiles(ctx context.Context, files, oldFiles map[string]treeFile, opts CheckoutOptions) error {
+	index, err := repo.lock(filepath.Join(repo.Path, "index"), FsyncIndex)
+	if err != nil {
+		return err
+	}
+	defer index.rollback()
+
+	for p := range oldFiles {
+		if _, ok := files[p]; !ok && pathProblem(p) == "" {
+			if err := repo.removeWorkTreeFile(p); err != nil {
+				return err
+			}
+		}
+	}
+
+	entries, err := repo.checkoutFiles(ctx, files, opts)
+	if werr := writeIndex(index, entries); werr != nil {
+		return werr
+	}
+	if cerr := index.commit(); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// Write the files with a pool of workers and return the index entries of
+// the files written, which are all files unless an error is returned.
+func (repo *Repository) checkoutFiles(ctx context.Context, files map[string]treeFile, opts CheckoutOptions) ([]*IndexEntry, error) {
+	workers := opts.Workers
+	if workers == 0 {
+		workers = repo.settings().CheckoutWorkers
+	}
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan checkoutJob)
+	results := make(chan checkoutResult)
+	go func() {
+		defer close(jobs)
+		for _, p := range paths {
+			select {
+			case jobs <- checkoutJob{p, files[p]}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	done := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range jobs {
+				entry, n, err := repo.checkoutFile(job.path, job.file)
+				results <- checkoutResult{entry, n, err}
+			}
+			done <- struct{}{}
+		}()
+	}
+	go func() {
+		for i := 0; i < workers; i++ {
+			<-done
+		}
+		close(results)
+	}()
+
+	var firstErr error
+	progress := CheckoutProgress{TotalFiles: len(paths)}
+	entries := make([]*IndexEntry, 0, len(paths))
+	for res := range results {
+		if res.err != nil {
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			cancel()
+			continue
+		}
+		entries = append(entries, res.entry)
+		progress.Files++
+		progress.Bytes += res.bytes
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+	}
+	if firstErr == nil && len(entries) < len(paths) {
+		firstErr = ctx.Err()
+	}
+	return entries, firstErr
+}
+
+// Write one file of the tree into the working tree.
+func (repo *Repository) checkoutFile(p string, f treeFile) (*IndexEntry, int64, error) {
+	if err := checkNoSymlinkParents(repo.WorkTree, p); err != nil {
+		return nil, 0, err
+	}
+	fpath := filepath.Join(repo.WorkTree, filepath.FromSlash(p))
+	if err := os.MkdirAll(filepath.Dir(fpath), 0777); err != nil {
+		return nil, 0, err
+	}
+	if f.mode == ModeCommit {
+		// submodules are checked out as empty directories
+		if err := os.MkdirAll(fpath, 0777); err != nil {
+			return nil, 0, err
+		}
+		return &IndexEntry{Path: p, Id: f.id, Mode: f.mode}, 0, nil
+	}
+	if err := os.Remove(fpath); err != nil && !os.IsNotExist(err) {
+		return nil, 0, err
+	}
+
+	_, _, rc, err := repo.GetRawObject(f.id, false)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rc.Close()
+
+	var n int64
+	if f.mode == ModeSymlink {
+		n, err = writeSymlink(fpath, rc)
+	} else {
+		perm := os.FileMode(0666)
+		if f.mode == ModeExec {
+			perm = 0777
+		}
+		n, err = writeWorkTreeFile(fpath, rc, perm)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	fi, err := os.Lstat(fpath)
+	if err != nil {
+		return nil, 0, err
+	}
+	return newIndexEntry(p, f.id, f.mode, fi), n, nil
+}
+
+func writeWorkTreeFile(fpath string, r io.Reader, perm os.FileMode) (int64, error) {
+	f, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// Symlinks that can't be created are written as plain files holding the
+// link target, like git does with core.symlinks=false.
+func writeSymlink(fpath string, r io.Reader) (int64, error) {
+	target, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Symlink(string(target), fpath); err == nil {
+		return int64(len(target)), nil
+	}
+	return writeWorkTreeFile(fpath, strings.NewReader(string(target)), 0666)
+}
+
+// Remove a file of the working tree and the directories left empty.
+func (repo *Repository) removeWorkTreeFile(p string) error {
+	if err := checkNoSymlinkParents(repo.WorkTree, p); err != nil {
+		return err
+	}
+	fpath := filepath.Join(repo.WorkTree, filepath.FromSlash(p))
+	if err := os.Remove(fpath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+		if os.Remove(filepath.Join(repo.WorkTree, filepath.FromSlash(dir))) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// Point HEAD at a branch ("ref: refs/heads/...") or a commit id.
+func (repo *Repository) setHead(head string) error {
+	lock, err := repo.lock(filepath.Join(repo.Path, "HEAD"), FsyncReference)
+	if err != nil {
+		return err
+	}
+	if _, err := lock.WriteString(head + "\n"); err != nil {
+		lock.rollback()
+		return err
+	}
+	if err := lock.commit(); err != nil {
+		return err
+	}
+	repo.log().Debug("updated HEAD", "head", head)
+	return nil
+}
+
+// Record what a checkout would change in the working tree.
+func (repo *Repository) recordCheckout(files, oldFiles map[string]treeFile) {
+	var removed, written []string
+	for p := range oldFiles {
+		if _, ok := files[p]; !ok && pathProblem(p) == "" {
+			removed = append(removed, p)
+		}
+	}
+	for p := range files {
+		written = append(written, p)
+	}
+	sort.Strings(removed)
+	sort.Strings(written)
+	for _, p := range removed {
+		repo.recordChange(Change{Op: ChangeDeleteFile, Name: p, Old: oldFiles[p].id})
+	}
+	for _, p := range written {
+		repo.recordChange(Change{Op: ChangeWriteFile, Name: p, Old: oldFiles[p].id, New: files[p].id})
+	}
+}
@@ -0,0 +1,239 @@
+package git
+
+import (
+	"bufio"
+	"container/heap"
+	"container/list"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A Checkpoint records the ref tips and pack files of a repository at some
+// point in time. Indexers persist it after a run and pass it back on the
+// next run to get only what was added in between.
+type Checkpoint struct {
+	// Ref name to id of the object the ref pointed to.
+	Tips map[string]ObjectID
+	// Base names of the pack files.
+	Packs []string
+}
+
+// Checkpoint records the current ref tips and packs of the repository.
+func (repo *Repository) Checkpoint() (*Checkpoint, error) {
+	tips, err := repo.listRefs()
+	if err != nil {
+		return nil, err
+	}
+
+	cp := &Checkpoint{Tips: tips}
+	for _, idx := range repo.indexfiles {
+		cp.Packs = append(cp.Packs, filepath.Base(idx.packpath))
+	}
+	sort.Strings(cp.Packs)
+	return cp, nil
+}
+
+// WriteTo writes the checkpoint in a line based text format, which can be
+// read back with ReadCheckpoint.
+func (cp *Checkpoint) WriteTo(w io.Writer) (int64, error) {
+	names := make([]string, 0, len(cp.Tips))
+	for name := range cp.Tips {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var written int64
+	for _, name := range names {
+		n, err := fmt.Fprintf(w, "tip %s %s\n", cp.Tips[name], name)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	for _, pack := range cp.Packs {
+		n, err := fmt.Fprintf(w, "pack %s\n", pack)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// ReadCheckpoint reads a checkpoint written by Checkpoint.WriteTo.
+func ReadCheckpoint(r io.Reader) (*Checkpoint, error) {
+	cp := &Checkpoint{Tips: make(map[string]ObjectID)}
+	scan := bufio.NewScanner(r)
+	for scan.Scan() {
+		fields := strings.Fields(scan.Text())
+		switch {
+		case len(fields) == 0:
+			continue
+		case fields[0] == "tip" && len(fields) == 3:
+			id, err := NewIdFromString(fields[1])
+			if err != nil {
+				return nil, err
+			}
+			cp.Tips[fields[2]] = id
+		case fields[0] == "pack" && len(fields) == 2:
+			cp.Packs = append(cp.Packs, fields[1])
+		default:
+			return nil, fmt.Errorf("invalid checkpoint line %q", scan.Text())
+		}
+	}
+	if err := scan.Err(); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// CommitsSince returns the commits reachable from the current refs but not
+// from the tips recorded in cp, children before parents. This is what
+// "git rev-list --all --not <old tips>" would print; history below the old
+// tips is not walked. Old tips that no longer exist are ignored.
+func (repo *Repository) CommitsSince(cp *Checkpoint) (*list.List, error) {
+	tips, err := repo.listRefs()
+	if err != nil {
+		return nil, err
+	}
+
+	var newTips, oldTips []ObjectID
+	for _, id := range tips {
+		if id, tp, err := repo.peel(id); err == nil && tp == ObjectCommit {
+			newTips = append(newTips, id)
+		}
+	}
+	for _, id := range cp.Tips {
+		if id, tp, err := repo.peel(id); err == nil && tp == ObjectCommit {
+			oldTips = append(oldTips, id)
+		}
+	}
+
+	return repo.commitsExcluding(newTips, oldTips, 0)
+}
+
+// git rev-list keeps walking this many commits after only uninteresting
+// ones are left, in case of clock skew
+const walkSlop = 5
+
+// commitsExcluding returns commits reachable from include but not from
+// exclude, at most limit of them unless limit is 0. With a commit-graph
+// file, commits are walked by generation and the walk stops at the
+// excluded commits. Without one, generation numbers
+// would need the whole history, so like git rev-list, commits are walked
+// newest first and the walk stops walkSlop commits after only excluded
+// ones are left; a commit more skewed than that is wrongly included.
+func (repo *Repository) commitsExcluding(include, exclude []ObjectID, limit int) (*list.List, error) {
+	const (
+		interesting = 1 << iota
+		uninteresting
+	)
+
+	byGeneration := repo.getCommitGraph() != nil
+	results := list.New()
+	flags := make(map[ObjectID]int)
+	popped := make(map[ObjectID]bool)
+	q := &commitQueue{}
+
+	push := func(id ObjectID, f int) error {
+		old, seen := flags[id]
+		if old&f == f {
+			return nil
+		}
+		flags[id] = old | f
+		if seen && !popped[id] {
+			// already in the queue, the new flag is picked up when popped
+			return nil
+		}
+		delete(popped, id)
+		if byGeneration {
+			return repo.pushQueue(q, id)
+		}
+		commit, err := repo.getCommit(id)
+		if err != nil {
+			return err
+		}
+		// all at generation 0, so newest first
+		heap.Push(q, &queuedCommit{commit, 0})
+		return nil
+	}
+
+	for _, id := range exclude {
+		if err := push(id, uninteresting); err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range include {
+		if err := push(id, interesting); err != nil {
+			return nil, err
+		}
+	}
+
+	slop := walkSlop
+	for q.Len() > 0 && (limit == 0 || results.Len() < limit) {
+		// stop when only uninteresting commits are left
+		done := true
+		for _, qc := range *q {
+			if flags[qc.commit.Id]&uninteresting == 0 {
+				done = false
+				break
+			}
+		}
+		if done {
+			if slop--; byGeneration || slop == 0 {
+				break
+			}
+		} else {
+			slop = walkSlop
+		}
+
+		// by generation, all children of cur have been processed and its
+		// flags are final; by date, it's queued again if a child turns
+		// out to be uninteresting later
+		cur := heap.Pop(q).(*queuedCommit).commit
+		popped[cur.Id] = true
+		f := interesting
+		if flags[cur.Id]&uninteresting != 0 {
+			f = uninteresting
+		} else {
+			results.PushBack(cur)
+		}
+		for _, p := range cur.parents {
+			if err := push(p, f); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// drop the commits found uninteresting after they were popped
+	for e := results.Front(); e != nil; {
+		next := e.Next()
+		if flags[e.Value.(*Commit).Id]&uninteresting != 0 {
+			results.Remove(e)
+		}
+		e = next
+	}
+	return results, nil
+}
+
+// PacksSince returns the packs of the repository that did not exist when
+// cp was recorded.
+func (repo *Repository) PacksSince(cp *Checkpoint) []string {
+	old := make(map[string]struct{}, len(cp.Packs))
+	for _, pack := range cp.Packs {
+		old[pack] = struct{}{}
+	}
+
+	var packs []string
+	for _, idx := range repo.indexfiles {
+		name := filepath.Base(idx.packpath)
+		if _, ok := old[name]; !ok {
+			packs = append(packs, idx.packpath)
+		}
+	}
+	sort.Strings(packs)
+	return packs
+}
@@ -0,0 +1,172 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrEmptyPick is returned when a commit would be created for a change
+// that is in the commit it's applied to already.
+var ErrEmptyPick = errors.New("the change is already applied, nothing to commit")
+
+// PickOptions configure Repository.CherryPick and Repository.Revert.
+type PickOptions struct {
+	// The parent of a merge commit whose changes are taken, counting from
+	// 1, like git's -m. Merge commits can't be picked without it.
+	Mainline int
+	// The name of the commit the change is applied to in conflict
+	// markers, the revision given as onto if empty.
+	OursLabel string
+
+	// Create a commit of the result with onto as parent if it is clean.
+	// The author and message of a cherry-pick are those of the
+	// picked commit; a revert has the default author and a message
+	// saying what it reverts.
+	Commit    bool
+	Author    *Signature
+	Committer *Signature
+	Message   string
+	// Create the commit even if it changes nothing, instead of returning
+	// ErrEmptyPick.
+	AllowEmpty bool
+	// If set, the branch is pointed at the new commit; it must be at onto.
+	Branch string
+}
+
+// A PickResult is the outcome of Repository.CherryPick or
+// Repository.Revert.
+type PickResult struct {
+	// The tree with the change applied, with conflicts as MergeCommits
+	// leaves them.
+	Tree ObjectID
+	// The commit created, zero if none was.
+	Commit    ObjectID
+	Conflicts []*MergeConflict
+}
+
+// Clean reports whether the change applied without conflicts.
+func (r *PickResult) Clean() bool {
+	return len(r.Conflicts) == 0
+}
+
+// CherryPick applies the changes the commit rev names made to its parent
+// to the commit onto names, like git cherry-pick: the changes are merged
+// into the tree of onto, with the parent as merge base, without touching
+// the working tree or the index. If opts.Commit is set and the change
+// applied cleanly, a commit is created; otherwise only the tree is
+// written, and conflicts are returned in the result.
+func (repo *Repository) CherryPick(rev, onto string, opts PickOptions) (*PickResult, error) {
+	return repo.pick(rev, onto, opts, false)
+}
+
+// Revert applies the reverse of the changes the commit rev names made to
+// its parent to the commit onto names, like git revert. It works like
+// CherryPick otherwise.
+func (repo *Repository) Revert(rev, onto string, opts PickOptions) (*PickResult, error) {
+	return repo.pick(rev, onto, opts, true)
+}
+
+func (repo *Repository) pick(rev, onto string, opts PickOptions, revert bool) (*PickResult, error) {
+	id, err := repo.resolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.getCommit(id)
+	if err != nil {
+		return nil, err
+	}
+	ontoId, err := repo.resolveRevision(onto)
+	if err != nil {
+		return nil, err
+	}
+	head, err := repo.getCommit(ontoId)
+	if err != nil {
+		return nil, err
+	}
+
+	var parent *Commit
+	switch n := commit.ParentCount(); {
+	case n > 1 && opts.Mainline == 0:
+		return nil, fmt.Errorf("commit %s is a merge but no mainline was given", id)
+	case opts.Mainline < 0 || opts.Mainline > n:
+		return nil, fmt.Errorf("commit %s does not have parent %d", id, opts.Mainline)
+	case n > 0:
+		i := opts.Mainline - 1
+		if i < 0 {
+			i = 0
+		}
+		if parent, err = commit.Parent(i); err != nil {
+			return nil, err
+		}
+	}
+
+	parentFiles := make(map[string]treeFile)
+	if parent != nil {
+		if parentFiles, err = repo.commitFiles(parent.Id); err != nil {
+			return nil, err
+		}
+	}
+	commitFiles, err := repo.commitFiles(commit.Id)
+	if err != nil {
+		return nil, err
+	}
+	ours, err := repo.commitFiles(ontoId)
+	if err != nil {
+		return nil, err
+	}
+
+	short := fmt.Sprintf("%s (%s)", id.Short(7), commit.Summary())
+	base, theirs, theirsLabel := parentFiles, commitFiles, short
+	if revert {
+		base, theirs, theirsLabel = commitFiles, parentFiles, "parent of "+short
+	}
+	if opts.OursLabel == "" {
+		opts.OursLabel = onto
+	}
+	files, conflicts, err := repo.mergeFiles(base, ours, theirs, opts.OursLabel, theirsLabel)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := repo.writeTree(files)
+	if err != nil {
+		return nil, err
+	}
+	result := &PickResult{Tree: tree, Conflicts: conflicts}
+	if !opts.Commit || !result.Clean() {
+		return result, nil
+	}
+	if tree.Equal(head.Tree.Id) && !opts.AllowEmpty {
+		return result, ErrEmptyPick
+	}
+
+	co := CommitOptions{
+		Tree:      tree,
+		Parents:   []ObjectID{ontoId},
+		Author:    opts.Author,
+		Committer: opts.Committer,
+		Message:   opts.Message,
+		Branch:    opts.Branch,
+	}
+	if !revert && co.Author == nil {
+		co.Author = commit.Author
+	}
+	if co.Message == "" {
+		co.Message = commit.CommitMessage
+		if revert {
+			co.Message = revertMessage(commit, parent)
+		}
+	}
+	if result.Commit, err = repo.CreateCommit(co); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// The message git revert gives the revert of c.
+func revertMessage(c, parent *Commit) string {
+	msg := fmt.Sprintf("Revert \"%s\"\n\nThis reverts commit %s", c.Summary(), c.Id)
+	if c.ParentCount() > 1 {
+		msg += fmt.Sprintf(", reversing\nchanges made to %s", parent.Id)
+	}
+	return msg + ".\n"
+}
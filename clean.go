@@ -0,0 +1,172 @@
+package git
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// ErrCleanRequiresForce is returned by Clean without Force or DryRun when
+// clean.requireForce is set, as it is by default.
+var ErrCleanRequiresForce = errors.New("clean.requireForce is set, refusing to clean without Force or DryRun")
+
+// CleanOptions select what Clean removes, like the options of git clean.
+type CleanOptions struct {
+	// Only list what would be removed (-n).
+	DryRun bool
+	// Remove the files even if clean.requireForce is set (-f).
+	Force bool
+	// Remove untracked directories too (-d); otherwise they are left
+	// alone, except for ignored files with OnlyIgnored.
+	Directories bool
+	// Remove ignored files too (-x).
+	Ignored bool
+	// Remove only ignored files (-X).
+	OnlyIgnored bool
+}
+
+// Clean removes the files of the working tree that aren't in the index,
+// except ignored ones unless opts says so, and returns their paths, sorted.
+// Directories removed as a whole end in a slash. The .gitignore files of
+// the working tree and info/exclude decide what is ignored. Directories of
+// other repositories are never removed.
+func (repo *Repository) Clean(opts CleanOptions) ([]string, error) {
+	if repo.WorkTree == "" {
+		return nil, ErrBareRepository
+	}
+	if !opts.DryRun && !opts.Force && repo.settings().CleanRequireForce {
+		return nil, ErrCleanRequiresForce
+	}
+
+	entries, err := repo.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	c := &cleaner{
+		repo:        repo,
+		opts:        opts,
+		reader:      newWorkTreePatternReader(repo.WorkTree, ".gitignore"),
+		tracked:     make(map[string]bool, len(entries)),
+		trackedDirs: make(map[string]bool),
+	}
+	for _, e := range entries {
+		c.tracked[e.Path] = true
+		for _, dir := range parentDirs(e.Path)[1:] {
+			c.trackedDirs[dir] = true
+		}
+	}
+	if c.exclude, err = repo.infoPatterns("exclude"); err != nil {
+		return nil, err
+	}
+	removals, _, err := c.walk("", false)
+	if err != nil || opts.DryRun {
+		return removals, err
+	}
+
+	if repo.dryRun != nil {
+		for _, p := range removals {
+			repo.recordChange(Change{Op: ChangeDeleteFile, Name: p})
+		}
+		return removals, nil
+	}
+	if repo.snapshot != nil {
+		return nil, ErrReadOnlySnapshot
+	}
+	for i, p := range removals {
+		if err := os.RemoveAll(filepath.Join(repo.WorkTree, filepath.FromSlash(p))); err != nil {
+			return removals[:i], err
+		}
+	}
+	return removals, nil
+}
+
+type cleaner struct {
+	repo        *Repository
+	opts        CleanOptions
+	reader      *treePatternReader
+	exclude     []*sourcedPattern
+	tracked     map[string]bool
+	trackedDirs map[string]bool
+}
+
+// Return what to remove in dir, and whether anything in it stays.
+func (c *cleaner) walk(dir string, ignored bool) ([]string, bool, error) {
+	infos, err := ioutil.ReadDir(filepath.Join(c.repo.WorkTree, filepath.FromSlash(dir)))
+	if err != nil {
+		return nil, false, err
+	}
+	var removals []string
+	keep := false
+	for _, fi := range infos {
+		p := path.Join(dir, fi.Name())
+		if fi.Name() == ".git" || c.tracked[p] {
+			keep = true
+			continue
+		}
+		isIgnored := ignored
+		if !isIgnored {
+			m, err := matchIgnore(c.reader, c.exclude, p, fi.IsDir())
+			if err != nil {
+				return nil, false, err
+			}
+			isIgnored = m != nil && m.Ignored
+		}
+
+		if !fi.IsDir() {
+			if c.selected(isIgnored) {
+				removals = append(removals, p)
+			} else {
+				keep = true
+			}
+			continue
+		}
+		if c.trackedDirs[p] {
+			sub, _, err := c.walk(p, isIgnored)
+			if err != nil {
+				return nil, false, err
+			}
+			removals = append(removals, sub...)
+			keep = true
+			continue
+		}
+		if c.isRepository(p) || !c.opts.Directories && !c.opts.OnlyIgnored {
+			keep = true
+			continue
+		}
+		sub, subKeep, err := c.walk(p, isIgnored)
+		if err != nil {
+			return nil, false, err
+		}
+		if !c.opts.Directories {
+			// like git, only the ignored files of directories that
+			// aren't ignored as a whole
+			if subKeep {
+				removals = append(removals, sub...)
+			}
+			keep = true
+		} else if !subKeep && (len(sub) > 0 || c.selected(isIgnored)) {
+			removals = append(removals, p+"/")
+		} else {
+			removals = append(removals, sub...)
+			keep = true
+		}
+	}
+	return removals, keep, nil
+}
+
+// Whether dir has a .git directory, or file of a submodule or linked
+// working tree.
+func (c *cleaner) isRepository(dir string) bool {
+	_, err := os.Lstat(filepath.Join(c.repo.WorkTree, filepath.FromSlash(dir), ".git"))
+	return err == nil
+}
+
+// Whether an untracked path is removed.
+func (c *cleaner) selected(ignored bool) bool {
+	if c.opts.OnlyIgnored {
+		return ignored
+	}
+	return !ignored || c.opts.Ignored
+}
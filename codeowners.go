@@ -0,0 +1,170 @@
+package git
+
+import (
+	"sort"
+	"strings"
+)
+
+// Where CODEOWNERS files are looked for, in order. The first one found is
+// used, like GitHub does.
+var codeOwnersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// A CodeOwnersRule is a line of a CODEOWNERS file. A rule without owners
+// makes the paths it matches unowned.
+type CodeOwnersRule struct {
+	Pattern string
+	// Users (@name), teams (@org/team) or email addresses.
+	Owners []string
+	Line   int
+
+	pattern *pathPattern
+}
+
+// CodeOwners are the rules of a CODEOWNERS file. The last rule matching a
+// path decides who owns it.
+type CodeOwners struct {
+	// The path of the file in the tree it was read from.
+	Source string
+	Rules  []*CodeOwnersRule
+}
+
+// A PathOwners is who owns a path.
+type PathOwners struct {
+	Path   string
+	Owners []string
+	// The line of the rule that matched, 0 if none did.
+	Line int
+}
+
+// ParseCodeOwners parses the content of a CODEOWNERS file. Patterns are
+// like in .gitignore files, but can't be negated; lines with negated
+// patterns and section headers are left out.
+func ParseCodeOwners(data []byte) *CodeOwners {
+	co := new(CodeOwners)
+	for i, line := range patternLines(data) {
+		if j := strings.Index(line, " #"); j >= 0 {
+			line = line[:j]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "!") || strings.HasPrefix(fields[0], "[") {
+			continue
+		}
+		co.Rules = append(co.Rules, &CodeOwnersRule{
+			Pattern: fields[0],
+			Owners:  fields[1:],
+			Line:    i + 1,
+			pattern: parsePathPattern(fields[0], ""),
+		})
+	}
+	return co
+}
+
+// CodeOwners reads the CODEOWNERS file of the tree, from .github/, the top
+// or docs/. It returns ErrNotExist if there is none.
+func (t *Tree) CodeOwners() (*CodeOwners, error) {
+	for _, p := range codeOwnersPaths {
+		entry, err := t.GetTreeEntryByPath(p)
+		if err == ErrNotExist || err == nil && entry.IsDir() {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		data, err := t.repo.readBlob(entry.Id)
+		if err != nil {
+			return nil, err
+		}
+		co := ParseCodeOwners(data)
+		co.Source = p
+		return co, nil
+	}
+	return nil, ErrNotExist
+}
+
+// Match returns the owners of a file. A rule matching a directory matches
+// everything below it, except that "dir/*" only matches the files directly
+// in dir.
+func (co *CodeOwners) Match(name string) PathOwners {
+	for i := len(co.Rules) - 1; i >= 0; i-- {
+		rule := co.Rules[i]
+		if rule.matches(name) {
+			return PathOwners{Path: name, Owners: rule.Owners, Line: rule.Line}
+		}
+	}
+	return PathOwners{Path: name}
+}
+
+func (r *CodeOwnersRule) matches(name string) bool {
+	if r.pattern.match(name, false) {
+		return true
+	}
+	if r.pattern.comps[len(r.pattern.comps)-1] == "*" {
+		return false
+	}
+	for _, dir := range parentDirs(name)[1:] {
+		if r.pattern.match(dir, true) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchPatches returns the owners of the files changed by the patches,
+// sorted by path. Both paths of a renamed file are matched.
+func (co *CodeOwners) MatchPatches(patches []*FilePatch) []PathOwners {
+	seen := make(map[string]bool)
+	var owners []PathOwners
+	for _, fp := range patches {
+		for _, p := range []string{fp.OldPath, fp.NewPath} {
+			if p == "" || seen[p] {
+				continue
+			}
+			seen[p] = true
+			owners = append(owners, co.Match(p))
+		}
+	}
+	sort.Slice(owners, func(i, j int) bool { return owners[i].Path < owners[j].Path })
+	return owners
+}
+
+// GroupByOwner groups the paths by owner, e.g. to request reviews from
+// each owner for their files. Paths without owners are listed under "".
+func GroupByOwner(owners []PathOwners) map[string][]string {
+	byOwner := make(map[string][]string)
+	for _, po := range owners {
+		if len(po.Owners) == 0 {
+			byOwner[""] = append(byOwner[""], po.Path)
+		}
+		for _, o := range po.Owners {
+			byOwner[o] = append(byOwner[o], po.Path)
+		}
+	}
+	return byOwner
+}
+
+// CodeOwners returns the owners of the files the commit changes. The
+// CODEOWNERS file of the first parent is used, like reviews use the one of
+// the branch changes are merged into, or the commit's own for root commits.
+func (c *Commit) CodeOwners() ([]PathOwners, error) {
+	ptree, err := firstParentTree(c)
+	if err != nil {
+		return nil, err
+	}
+	rulesTree := ptree
+	if rulesTree == nil {
+		rulesTree = &c.Tree
+	}
+	co, err := rulesTree.CodeOwners()
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := diffTrees(ptree, &c.Tree)
+	if err != nil {
+		return nil, err
+	}
+	owners := make([]PathOwners, len(changes))
+	for i, change := range changes {
+		owners[i] = co.Match(change.path)
+	}
+	return owners, nil
+}
@@ -2,18 +2,47 @@ package git
 
 import (
 	"container/list"
+	"context"
 	"strings"
 )
 
 // Commit represents a git commit.
 type Commit struct {
 	Tree
-	Id            sha1 // The id of this commit object
+	Id            ObjectID // The id of this commit object
 	Author        *Signature
 	Committer     *Signature
 	CommitMessage string
 
-	parents []sha1 // sha1 strings
+	parents []ObjectID // sha1 strings
+	headers []CommitHeader
+	// the commit object without its signature, if it's signed
+	payload []byte
+}
+
+// A CommitHeader is a header of a commit object other than tree, parent,
+// author and committer, like encoding, gpgsig or headers of other tools
+// ("change-id"). The continuation lines of multi-line values are joined
+// with newlines, without their leading space.
+type CommitHeader struct {
+	Key   string
+	Value string
+}
+
+// ExtraHeaders returns the commit's other headers, in the order they
+// appear in the commit object.
+func (c *Commit) ExtraHeaders() []CommitHeader {
+	return c.headers
+}
+
+// ExtraHeader returns the value of the first other header called key.
+func (c *Commit) ExtraHeader(key string) (string, bool) {
+	for _, h := range c.headers {
+		if h.Key == key {
+			return h.Value, true
+		}
+	}
+	return "", false
 }
 
 func (c *Commit) Summary() string {
@@ -39,7 +68,7 @@ func (c *Commit) Parent(n int) (*Commit, error) {
 }
 
 // Return oid of the parent number n (0-based index). Return nil if no such parent exists.
-func (c *Commit) ParentId(n int) (id sha1, err error) {
+func (c *Commit) ParentId(n int) (id ObjectID, err error) {
 	if n >= len(c.parents) {
 		err = IdNotExist
 		return
@@ -54,12 +83,12 @@ func (c *Commit) ParentCount() int {
 }
 
 // Return oid of the (root) tree of this commit.
-func (c *Commit) TreeId() sha1 {
+func (c *Commit) TreeId() ObjectID {
 	return c.Tree.Id
 }
 
 func (c *Commit) CommitsBefore() (*list.List, error) {
-	return c.repo.getCommitsBefore(c.Id)
+	return c.repo.getCommitsBefore(context.Background(), c.Id)
 }
 
 func (c *Commit) CommitsBeforeUntil(commitId string) (*list.List, error) {
@@ -71,17 +100,25 @@ func (c *Commit) CommitsBeforeUntil(commitId string) (*list.List, error) {
 }
 
 func (c *Commit) CommitsCount() (int, error) {
-	return c.repo.commitsCount(c.Id)
+	return c.repo.commitsCount(context.Background(), c.Id)
 }
 
 func (c *Commit) SearchCommits(keyword string) (*list.List, error) {
-	return c.repo.searchCommits(c.Id, keyword)
+	return c.repo.searchCommits(context.Background(), c.Id, keyword)
 }
 
 func (c *Commit) CommitsByRange(page int) (*list.List, error) {
-	return c.repo.commitsByRange(c.Id, page)
+	return c.repo.commitsByRange(context.Background(), c.Id, page)
 }
 
 func (c *Commit) GetCommitOfRelPath(relPath string) (*Commit, error) {
-	return c.repo.getCommitOfRelPath(c.Id, relPath)
+	return c.repo.getCommitOfRelPath(context.Background(), c.Id, relPath)
+}
+
+func (c *Commit) SearchCommitsByContent(opts PickaxeOptions) (*list.List, error) {
+	return c.repo.searchCommitsByContent(context.Background(), c.Id, opts)
+}
+
+func (c *Commit) CommitsByTimeWindow(w TimeWindow) (*list.List, error) {
+	return c.repo.commitsByTimeWindow(context.Background(), c.Id, w)
 }
@@ -0,0 +1,101 @@
+package git
+
+import (
+	"errors"
+	"strings"
+)
+
+// AmendOptions describe how AmendCommit changes a commit. Zero values
+// keep what the amended commit has.
+type AmendOptions struct {
+	// The branch whose tip is amended; the one HEAD points to if empty,
+	// or HEAD itself if it is detached.
+	Branch  string
+	Tree    ObjectID
+	Message string
+	Author  *Signature
+	// If nil, DefaultCommitter is used.
+	Committer *Signature
+	// Keep the committer date of the amended commit instead of the
+	// current time, e.g. when only fixing a typo in the message.
+	KeepCommitterDate bool
+}
+
+// AmendCommit replaces the tip commit of a branch with one with the same
+// parents and the changes of opts, like git commit --amend, and returns
+// its id. The branch is updated atomically, so a *RefChangedError is
+// returned if it moved meanwhile, and the update is added to the reflogs
+// of the branch and HEAD. Signatures of the amended commit are dropped.
+func (repo *Repository) AmendCommit(opts AmendOptions) (ObjectID, error) {
+	name := "HEAD"
+	if opts.Branch != "" {
+		name = "refs/heads/" + opts.Branch
+	} else if target, err := repo.headTarget(); err != nil {
+		return ObjectID{}, err
+	} else if target != "" {
+		name = target
+	}
+	ref, err := repo.ResolveRef(name)
+	if err == ErrNotExist {
+		return ObjectID{}, errors.New("nothing to amend, " + name + " has no commits")
+	} else if err != nil {
+		return ObjectID{}, err
+	}
+	old, err := repo.getCommit(ref.Id)
+	if err != nil {
+		return ObjectID{}, err
+	}
+
+	co := CommitOptions{
+		Tree:      opts.Tree,
+		Parents:   old.parents,
+		Author:    opts.Author,
+		Committer: opts.Committer,
+		Message:   opts.Message,
+	}
+	if co.Tree.IsZero() {
+		co.Tree = old.Tree.Id
+	}
+	if co.Author == nil {
+		co.Author = old.Author
+	}
+	if co.Message == "" {
+		co.Message = old.CommitMessage
+	}
+	if err := repo.fillSignatures(&co); err != nil {
+		return ObjectID{}, err
+	}
+	if opts.KeepCommitterDate {
+		committer := *co.Committer
+		committer.When = old.Committer.When
+		co.Committer = &committer
+	}
+	id, err := repo.CreateCommit(co)
+	if err != nil {
+		return ObjectID{}, err
+	}
+
+	if name == "HEAD" {
+		if repo.dryRun != nil {
+			repo.recordHeadUpdate(id.String(), id)
+		} else if repo.snapshot != nil {
+			return id, ErrReadOnlySnapshot
+		} else if err := repo.setHead(id.String()); err != nil {
+			return id, err
+		}
+	} else if err := repo.UpdateRef(name, id, ref.Id); err != nil {
+		return id, err
+	}
+
+	msg := "commit (amend): " + strings.SplitN(co.Message, "\n", 2)[0]
+	if err := repo.appendReflog(name, ref.Id, id, co.Committer, msg); err != nil {
+		return id, err
+	}
+	if target, err := repo.headTarget(); err == nil && target == name {
+		err = repo.appendReflog("HEAD", ref.Id, id, co.Committer, msg)
+		if err != nil {
+			return id, err
+		}
+	}
+	return id, nil
+}
@@ -1,8 +1,13 @@
 package git
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 
 	"github.com/Unknwon/cae"
 	"github.com/Unknwon/cae/tz"
@@ -16,7 +21,49 @@ const (
 	AT_TARGZ
 )
 
+// A Submodule is a submodule of a tree, with the name and url .gitmodules
+// gives it, if it has an entry there.
+type Submodule struct {
+	Name string
+	Path string
+	URL  string
+	// The commit the tree records.
+	Id ObjectID
+}
+
+// A SubmoduleProvider returns the repository of a submodule to read its
+// commit from, or nil to leave the submodule empty.
+type SubmoduleProvider func(sub Submodule) (*Repository, error)
+
+// ArchiveOptions configure Commit.CreateArchiveWithOptions.
+type ArchiveOptions struct {
+	// If set, submodules are archived with the contents of their recorded
+	// commits, and so are their submodules in turn. Otherwise they are
+	// empty directories, like with git archive.
+	Submodules SubmoduleProvider
+	// Write the same archive byte for byte each time, as checksums of
+	// release archives need: all entries get the committer date of the
+	// commit as time, no owner, and 0644 or 0755 as permissions, and the
+	// gzip header has no time.
+	Reproducible bool
+}
+
+// CreateArchive writes the commit's tree into an archive at path. Trees
+// with paths that would be extracted outside of the archive's directory or
+// into a .git directory are refused with an UnsafePathsError. Like with
+// git archive, $Format:...$ keywords in files with the export-subst
+// attribute are replaced by the commit formatted as they say.
 func (c *Commit) CreateArchive(path string, archiveType ArchiveType) error {
+	return c.CreateArchiveWithOptions(path, archiveType, ArchiveOptions{})
+}
+
+// CreateArchiveWithOptions is like CreateArchive, with the submodules and
+// reproducibility as opts select.
+func (c *Commit) CreateArchiveWithOptions(path string, archiveType ArchiveType, opts ArchiveOptions) error {
+	if err := c.repo.validateArchive(&c.Tree, opts.Submodules); err != nil {
+		return err
+	}
+
 	f, err := os.OpenFile(path, os.O_CREATE, 0644)
 	if err == nil {
 		f.Close()
@@ -29,27 +76,183 @@ func (c *Commit) CreateArchive(path string, archiveType ArchiveType) error {
 	defer f.Close()
 
 	var streamer cae.Streamer
-	switch archiveType {
-	case AT_ZIP:
+	switch {
+	case opts.Reproducible:
+		streamer = newReproducibleStreamer(f, archiveType, c.Committer.When)
+	case archiveType == AT_ZIP:
 		streamer = zip.NewStreamArachive(f)
-	case AT_TARGZ:
+	case archiveType == AT_TARGZ:
 		streamer = tz.NewStreamArachive(f)
 	}
-	defer streamer.Close()
 
-	return createArchive(&c.Tree, streamer)
+	a := &archiver{streamer: streamer, provider: opts.Submodules}
+	if err := a.archive(c, ""); err != nil {
+		streamer.Close()
+		return err
+	}
+	return streamer.Close()
+}
+
+// Check the paths of a tree and, if they are archived, its submodules.
+func (repo *Repository) validateArchive(tree *Tree, provider SubmoduleProvider) error {
+	files, err := repo.flattenTree(tree)
+	if err != nil {
+		return err
+	}
+	if err := repo.validateTree(files); err != nil {
+		return err
+	}
+	if provider == nil {
+		return nil
+	}
+	return forEachSubmodule(tree, files, provider, func(sub *Repository, commit *Commit) error {
+		return sub.validateArchive(&commit.Tree, provider)
+	})
+}
+
+// Call fn with the repository and commit of each submodule among the files
+// of tree that provider returns a repository for.
+func forEachSubmodule(tree *Tree, files map[string]treeFile, provider SubmoduleProvider,
+	fn func(*Repository, *Commit) error) error {
+
+	var modules map[string]Submodule
+	for p, f := range files {
+		if f.mode != ModeCommit {
+			continue
+		}
+		if modules == nil {
+			var err error
+			if modules, err = readSubmodules(tree); err != nil {
+				return err
+			}
+		}
+		sub, commit, err := openSubmodule(modules, p, f.id, provider)
+		if err != nil {
+			return err
+		}
+		if sub == nil {
+			continue
+		}
+		if err := fn(sub, commit); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func createArchive(tree *Tree, streamer cae.Streamer, relPaths ...string) error {
-	var relPath string
+// Return the repository and commit of the submodule at p with the commit
+// id, or a nil repository if provider has none.
+func openSubmodule(modules map[string]Submodule, p string, id ObjectID,
+	provider SubmoduleProvider) (*Repository, *Commit, error) {
 
-	if len(relPaths) > 0 {
-		relPath = relPaths[0]
+	info, ok := modules[p]
+	if !ok {
+		info = Submodule{Name: p, Path: p}
 	}
+	info.Id = id
+	sub, err := provider(info)
+	if err != nil || sub == nil {
+		return nil, nil, err
+	}
+	commit, err := sub.getCommit(id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("submodule %s: %v", p, err)
+	}
+	return sub, commit, nil
+}
 
+// readSubmodules returns the submodules .gitmodules in tree lists, by
+// path.
+func readSubmodules(tree *Tree) (map[string]Submodule, error) {
+	modules := make(map[string]Submodule)
+	blob, err := tree.GetBlobByPath(".gitmodules")
+	if err == ErrNotExist {
+		return modules, nil
+	} else if err != nil {
+		return nil, err
+	}
+	rc, err := blob.Data()
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := parseConfig(data, ".gitmodules")
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*Submodule)
+	var names []string
+	for _, e := range entries {
+		if !strings.HasPrefix(e.name, "submodule.") {
+			continue
+		}
+		i := strings.LastIndexByte(e.name, '.')
+		name, key := e.name[len("submodule."):i], e.name[i+1:]
+		if name == "" {
+			continue
+		}
+		sub, ok := byName[name]
+		if !ok {
+			sub = &Submodule{Name: name}
+			byName[name] = sub
+			names = append(names, name)
+		}
+		switch key {
+		case "path":
+			sub.Path = e.value
+		case "url":
+			sub.URL = e.value
+		}
+	}
+	for _, name := range names {
+		if sub := byName[name]; sub.Path != "" {
+			modules[sub.Path] = *sub
+		}
+	}
+	return modules, nil
+}
+
+// archiver streams the tree of a repository and its submodules
+type archiver struct {
+	streamer cae.Streamer
+	provider SubmoduleProvider
+}
+
+// what is archived of one repository
+type archiveRoot struct {
+	commit *Commit
+	// submodules by path
+	modules map[string]Submodule
+	// paths of the files with the export-subst attribute
+	substs map[string]bool
+}
+
+// Stream the tree of commit below the directory prefix of the archive.
+func (a *archiver) archive(commit *Commit, prefix string) error {
+	root := &archiveRoot{commit: commit}
+	var err error
+	if a.provider != nil {
+		if root.modules, err = readSubmodules(&commit.Tree); err != nil {
+			return err
+		}
+	}
+	if root.substs, err = exportSubstPaths(commit); err != nil {
+		return err
+	}
+	return a.archiveTree(root, &commit.Tree, prefix, "")
+}
+
+func (a *archiver) archiveTree(root *archiveRoot, tree *Tree, prefix, dir string) error {
+	relPath := filepath.Join(prefix, filepath.FromSlash(dir))
 	for _, te := range tree.ListEntries() {
-		if te.IsDir() {
-			err := streamer.StreamFile(filepath.Join(relPath, te.name), te, nil)
+		switch {
+		case te.IsDir():
+			err := a.streamer.StreamFile(filepath.Join(relPath, te.name), te, nil)
 			if err != nil {
 				return err
 			}
@@ -59,15 +262,54 @@ func createArchive(tree *Tree, streamer cae.Streamer, relPaths ...string) error
 				return err
 			}
 
-			if err = createArchive(newTree, streamer, filepath.Join(relPath, te.name)); err != nil {
+			if err = a.archiveTree(root, newTree, prefix, path.Join(dir, te.name)); err != nil {
 				return err
 			}
-		} else {
+		case te.mode == ModeCommit:
+			// streamed as a directory
+			entry := *te
+			entry.mode = ModeTree
+			if err := a.streamer.StreamFile(filepath.Join(relPath, te.name), &entry, nil); err != nil {
+				return err
+			}
+			if a.provider == nil {
+				continue
+			}
+
+			sub, commit, err := openSubmodule(root.modules, path.Join(dir, te.name), te.Id, a.provider)
+			if err != nil {
+				return err
+			}
+			if sub == nil {
+				continue
+			}
+			if err := a.archive(commit, filepath.Join(relPath, te.name)); err != nil {
+				return err
+			}
+		case root.substs[path.Join(dir, te.name)]:
 			dataRc, err := te.Blob().Data()
 			if err != nil {
 				return err
 			}
-			if err := streamer.StreamReader(relPath, te, dataRc); err != nil {
+			data, err := ioutil.ReadAll(dataRc)
+			dataRc.Close()
+			if err != nil {
+				return err
+			}
+			data = expandExportSubst(data, root.commit)
+
+			// the size of the archived file is that of the expansion
+			entry := *te
+			entry.size, entry.sized = int64(len(data)), true
+			if err := a.streamer.StreamReader(relPath, &entry, bytes.NewReader(data)); err != nil {
+				return err
+			}
+		default:
+			dataRc, err := te.Blob().Data()
+			if err != nil {
+				return err
+			}
+			if err := a.streamer.StreamReader(relPath, te, dataRc); err != nil {
 				dataRc.Close()
 				return err
 			}
@@ -77,3 +319,52 @@ func createArchive(tree *Tree, streamer cae.Streamer, relPaths ...string) error
 
 	return nil
 }
+
+// Return the paths of the files of the commit's tree that have the
+// export-subst attribute.
+func exportSubstPaths(commit *Commit) (map[string]bool, error) {
+	files, err := commit.repo.flattenTree(&commit.Tree)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for p, f := range files {
+		if f.mode == ModeBlob || f.mode == ModeExec {
+			paths = append(paths, p)
+		}
+	}
+	matches, err := commit.Tree.CheckAttr([]string{"export-subst"}, paths)
+	if err != nil {
+		return nil, err
+	}
+	substs := make(map[string]bool)
+	for _, m := range matches {
+		if m.Value == AttrSet {
+			substs[m.Path] = true
+		}
+	}
+	return substs, nil
+}
+
+// expandExportSubst replaces the $Format:...$ keywords in data by the
+// commit formatted as they say, see Commit.Format, like git archive does
+// for files with the export-subst attribute.
+func expandExportSubst(data []byte, c *Commit) []byte {
+	var buf bytes.Buffer
+	for {
+		start := bytes.Index(data, []byte("$Format:"))
+		if start < 0 {
+			break
+		}
+		end := bytes.IndexByte(data[start+len("$Format:"):], '$')
+		if end < 0 {
+			break
+		}
+		end += start + len("$Format:")
+		buf.Write(data[:start])
+		buf.WriteString(c.Format(string(data[start+len("$Format:") : end])))
+		data = data[end+1:]
+	}
+	buf.Write(data)
+	return buf.Bytes()
+}
@@ -0,0 +1,206 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"context"
+	"encoding/hex"
+	"fmt"
+)
+
+// BulkWalk is WalkCommitNodes for walks over millions of commits, like
+// statistics over a whole repository or reachability for gc, starting at
+// all the commits revs name. It allocates little per commit: nodes are
+// reused once fn returns, commits in the commit-graph file are marked as
+// seen in a bit set instead of a map, and commit objects are read through
+// the same buffers. In return, the Parents of the node passed to fn are
+// only valid until fn returns; copy them to keep them.
+func (repo *Repository) BulkWalk(ctx context.Context, revs []string, fn func(CommitNode) error) error {
+	w := &bulkWalker{
+		repo:  repo,
+		graph: repo.getCommitGraph(),
+		seen:  make(map[ObjectID]struct{}),
+		br:    bufio.NewReader(nil),
+	}
+	if w.graph != nil {
+		last := w.graph.layers[len(w.graph.layers)-1]
+		w.seenGraph = make([]uint64, (last.base+last.n+63)/64)
+	}
+
+	for _, rev := range revs {
+		id, err := repo.resolveRevision(rev)
+		if err != nil {
+			return err
+		}
+		if err := w.push(id); err != nil {
+			return err
+		}
+	}
+	for w.queue.Len() > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n := heap.Pop(&w.queue).(*bulkNode)
+		if err := fn(n.CommitNode); err == StopIteration {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		for _, p := range n.Parents {
+			if err := w.push(p); err != nil {
+				return err
+			}
+		}
+		w.free = append(w.free, n)
+	}
+	return nil
+}
+
+// A node with room for two parents, which most commits have at most.
+type bulkNode struct {
+	CommitNode
+	parents [2]ObjectID
+}
+
+type bulkWalker struct {
+	repo  *Repository
+	graph *commitGraph
+	// seen commits by their position in the commit-graph, and the others
+	seenGraph []uint64
+	seen      map[ObjectID]struct{}
+	free      []*bulkNode
+	br        *bufio.Reader
+	queue     bulkQueue
+}
+
+// Queue the commit unless it has been already.
+func (w *bulkWalker) push(id ObjectID) error {
+	pos, inGraph := uint32(0), false
+	if w.graph != nil {
+		pos, inGraph = w.graph.find(id)
+	}
+	if inGraph {
+		bit := uint64(1) << (pos % 64)
+		if w.seenGraph[pos/64]&bit != 0 {
+			return nil
+		}
+		w.seenGraph[pos/64] |= bit
+	} else {
+		if _, ok := w.seen[id]; ok {
+			return nil
+		}
+		w.seen[id] = struct{}{}
+	}
+
+	n := w.alloc()
+	var err error
+	if inGraph {
+		err = w.graph.fillNode(pos, &n.CommitNode)
+	} else {
+		err = w.readNode(id, n)
+	}
+	if err != nil {
+		return err
+	}
+	heap.Push(&w.queue, n)
+	return nil
+}
+
+// Return a cleared node.
+func (w *bulkWalker) alloc() *bulkNode {
+	var n *bulkNode
+	if len(w.free) > 0 {
+		n = w.free[len(w.free)-1]
+		w.free = w.free[:len(w.free)-1]
+	} else {
+		n = new(bulkNode)
+	}
+	n.CommitNode = CommitNode{Parents: n.parents[:0]}
+	return n
+}
+
+// Read the node of a commit that isn't in the commit-graph from the
+// headers of the commit object, like commitNode.
+func (w *bulkWalker) readNode(id ObjectID, n *bulkNode) error {
+	tp, _, rc, err := w.repo.GetRawObject(id, false)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if tp != ObjectCommit {
+		return fmt.Errorf("%s is not a commit", id)
+	}
+
+	n.Id = id
+	w.br.Reset(rc)
+	for {
+		line, rerr := w.br.ReadSlice('\n')
+		if rerr != nil && rerr != bufio.ErrBufferFull {
+			return rerr
+		}
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		if len(line) == 0 {
+			// end of the headers
+			return nil
+		}
+		switch {
+		case bytes.HasPrefix(line, []byte("tree ")):
+			if err := decodeId(&n.Tree, line[5:]); err != nil {
+				return err
+			}
+		case bytes.HasPrefix(line, []byte("parent ")):
+			var p ObjectID
+			if err := decodeId(&p, line[7:]); err != nil {
+				return err
+			}
+			n.Parents = append(n.Parents, p)
+		case bytes.HasPrefix(line, []byte("committer ")):
+			n.Time = signatureTime(line[10:])
+		}
+		for rerr == bufio.ErrBufferFull {
+			// the rest of a long header, like a signature
+			_, rerr = w.br.ReadSlice('\n')
+		}
+	}
+}
+
+// Decode a hex id without allocating.
+func decodeId(id *ObjectID, hexId []byte) error {
+	if len(hexId) != 40 {
+		return fmt.Errorf("bad id %q", hexId)
+	}
+	_, err := hex.Decode(id[:], hexId)
+	return err
+}
+
+// Return the unix time of a signature, "Name <email> 1234567890 +0000",
+// or 0 if it has none.
+func signatureTime(sig []byte) int64 {
+	i := bytes.LastIndexByte(sig, '>')
+	if i < 0 {
+		return 0
+	}
+	var t int64
+	for _, c := range bytes.TrimLeft(sig[i+1:], " ") {
+		if c < '0' || c > '9' {
+			break
+		}
+		t = t*10 + int64(c-'0')
+	}
+	return t
+}
+
+// queue of bulk nodes, newest first
+type bulkQueue []*bulkNode
+
+func (q bulkQueue) Len() int            { return len(q) }
+func (q bulkQueue) Less(i, j int) bool  { return q[i].Time > q[j].Time }
+func (q bulkQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *bulkQueue) Push(x interface{}) { *q = append(*q, x.(*bulkNode)) }
+func (q *bulkQueue) Pop() interface{} {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return x
+}
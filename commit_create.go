@@ -0,0 +1,399 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// CommitOptions describe a commit to create.
+type CommitOptions struct {
+	Tree    ObjectID
+	Parents []ObjectID
+	// If nil, DefaultSignature and DefaultCommitter are used.
+	Author    *Signature
+	Committer *Signature
+	Message   string
+	// Allow parents that don't exist in the repository yet, e.g. while
+	// importing history in stages. CheckConnectivity tells whether they
+	// arrived once the import is done.
+	AllowMissingParents bool
+	// If set, the branch is pointed at the new commit. An existing branch
+	// must be at the first parent; a branch that doesn't exist yet, like
+	// an orphan branch, is created.
+	Branch string
+}
+
+// CreateCommit writes a new commit object and returns its id. No ref is
+// updated unless opts.Branch is set; the branch is updated atomically, and
+// if another update got there first, a *RefChangedError is returned
+// together with the id of the commit, which was written. The parents must
+// be commits of the repository, unless opts.AllowMissingParents is set.
+// Without parents, the commit starts a new history.
+func (repo *Repository) CreateCommit(opts CommitOptions) (ObjectID, error) {
+	if err := repo.fillSignatures(&opts); err != nil {
+		return ObjectID{}, err
+	}
+	if err := opts.Author.check(); err != nil {
+		return ObjectID{}, err
+	}
+	if err := opts.Committer.check(); err != nil {
+		return ObjectID{}, err
+	}
+
+	tp, err := repo.objectType(opts.Tree)
+	if err != nil {
+		return ObjectID{}, err
+	}
+	if tp != ObjectTree {
+		return ObjectID{}, fmt.Errorf("%s is not a tree", opts.Tree)
+	}
+	for _, p := range opts.Parents {
+		found, _, err := repo.haveObject(p)
+		if err != nil {
+			return ObjectID{}, err
+		}
+		if !found {
+			if opts.AllowMissingParents {
+				continue
+			}
+			return ObjectID{}, fmt.Errorf("parent %s does not exist", p)
+		}
+		if tp, err := repo.objectType(p); err != nil {
+			return ObjectID{}, err
+		} else if tp != ObjectCommit {
+			return ObjectID{}, fmt.Errorf("parent %s is not a commit", p)
+		}
+	}
+
+	var tip ObjectID
+	if opts.Branch != "" {
+		if tip, err = repo.checkBranchTip(opts.Branch, opts.Parents); err != nil {
+			return ObjectID{}, err
+		}
+	}
+
+	id, err := repo.StoreObjectLoose(ObjectCommit, bytes.NewReader(encodeCommit(&opts)))
+	if err != nil || opts.Branch == "" {
+		return id, err
+	}
+	// the branch may have moved since it was checked
+	return id, repo.UpdateRef("refs/heads/"+opts.Branch, id, tip)
+}
+
+// CreateFixupCommit creates a commit like git commit --fixup: its message
+// is "fixup! " and the subject of the commit target, so that a rebase plan
+// made with Autosquash melds it into target. opts.Message is ignored.
+func (repo *Repository) CreateFixupCommit(target ObjectID, opts CommitOptions) (ObjectID, error) {
+	c, err := repo.getCommit(target)
+	if err != nil {
+		return ObjectID{}, err
+	}
+	opts.Message = "fixup! " + c.Summary() + "\n"
+	return repo.CreateCommit(opts)
+}
+
+// CreateSquashCommit creates a commit like git commit --squash: its message
+// is "squash! " and the subject of the commit target, followed by
+// opts.Message, which is added to the message of target when a rebase plan
+// made with Autosquash melds the commit into it.
+func (repo *Repository) CreateSquashCommit(target ObjectID, opts CommitOptions) (ObjectID, error) {
+	c, err := repo.getCommit(target)
+	if err != nil {
+		return ObjectID{}, err
+	}
+	msg := "squash! " + c.Summary() + "\n"
+	if opts.Message != "" {
+		msg += "\n" + opts.Message
+	}
+	opts.Message = msg
+	return repo.CreateCommit(opts)
+}
+
+// Check that a commit with the parents can be put on the branch: it must
+// not exist or be at the first parent. Returns the tip of the branch, zero
+// if it doesn't exist.
+func (repo *Repository) checkBranchTip(branch string, parents []ObjectID) (ObjectID, error) {
+	ref, exists, err := repo.lookupRef("refs/heads/" + branch)
+	if err != nil || !exists {
+		return ObjectID{}, err
+	}
+	if len(parents) == 0 || !parents[0].Equal(ref.Id) {
+		return ObjectID{}, fmt.Errorf("branch %s is at %s, not at the first parent", branch, ref.Id)
+	}
+	return ref.Id, nil
+}
+
+func (repo *Repository) fillSignatures(opts *CommitOptions) error {
+	var err error
+	if opts.Author == nil {
+		if opts.Author, err = repo.DefaultSignature(); err != nil {
+			return err
+		}
+	}
+	if opts.Committer == nil {
+		if opts.Committer, err = repo.DefaultCommitter(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeCommit(opts *CommitOptions) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "tree %s\n", opts.Tree)
+	for _, p := range opts.Parents {
+		fmt.Fprintf(&buf, "parent %s\n", p)
+	}
+	fmt.Fprintf(&buf, "author %s\n", opts.Author.commitLine())
+	fmt.Fprintf(&buf, "committer %s\n", opts.Committer.commitLine())
+	buf.WriteByte('\n')
+	buf.WriteString(opts.Message)
+	return buf.Bytes()
+}
+
+// A MergeConflictError lists the paths that were changed differently on
+// the sides of a merge.
+type MergeConflictError struct {
+	Paths []string
+}
+
+func (e *MergeConflictError) Error() string {
+	return "merge conflict in " + strings.Join(e.Paths, ", ")
+}
+
+var (
+	ErrNothingToMerge = errors.New("nothing to merge")
+)
+
+// OctopusMerge creates a merge commit with all the given commits as
+// parents, like git merge with several branches. Like git-merge-octopus,
+// the commits are merged into the first one by one, each from its merge
+// base with the commits merged before it. The trees are merged path by
+// path; if a path was changed differently by two of the commits, a
+// *MergeConflictError is returned and nothing is written. Commits that are
+// ancestors of other given commits are dropped.
+//
+// Tree and Parents of opts are ignored. If opts.Message is empty, a
+// default message naming the branches at the merged commits is used.
+func (repo *Repository) OctopusMerge(commitIds []string, opts CommitOptions) (ObjectID, error) {
+	var heads []ObjectID
+	for _, idStr := range commitIds {
+		id, err := NewIdFromString(idStr)
+		if err != nil {
+			return ObjectID{}, err
+		}
+		heads = append(heads, id)
+	}
+
+	heads, err := repo.reduceHeads(heads)
+	if err != nil {
+		return ObjectID{}, err
+	}
+	if len(heads) < 2 {
+		return ObjectID{}, ErrNothingToMerge
+	}
+
+	first, err := repo.getCommit(heads[0])
+	if err != nil {
+		return ObjectID{}, err
+	}
+	result, err := repo.flattenTree(&first.Tree)
+	if err != nil {
+		return ObjectID{}, err
+	}
+
+	for i, head := range heads[1:] {
+		bases, err := repo.mergeBasesWith(head, heads[:i+1])
+		if err != nil {
+			return ObjectID{}, err
+		}
+		var baseFiles map[string]treeFile
+		if len(bases) == 0 {
+			baseFiles = make(map[string]treeFile)
+		} else {
+			base, err := repo.getCommit(bases[0])
+			if err != nil {
+				return ObjectID{}, err
+			}
+			if baseFiles, err = repo.flattenTree(&base.Tree); err != nil {
+				return ObjectID{}, err
+			}
+		}
+
+		theirs, err := repo.getCommit(head)
+		if err != nil {
+			return ObjectID{}, err
+		}
+		theirFiles, err := repo.flattenTree(&theirs.Tree)
+		if err != nil {
+			return ObjectID{}, err
+		}
+
+		var conflicts []string
+		result, conflicts = mergeFlatTrees(baseFiles, result, theirFiles)
+		if len(conflicts) > 0 {
+			return ObjectID{}, &MergeConflictError{Paths: conflicts}
+		}
+	}
+
+	opts.Tree, err = repo.writeTree(result)
+	if err != nil {
+		return ObjectID{}, err
+	}
+	opts.Parents = heads
+	if opts.Message == "" {
+		if opts.Message, err = repo.mergeMessage(heads[1:]); err != nil {
+			return ObjectID{}, err
+		}
+	}
+	return repo.CreateCommit(opts)
+}
+
+// Return the merge bases of id and the commits merged, like git merge-base
+// --all id merged...: the best common ancestors of id and a merge of them.
+func (repo *Repository) mergeBasesWith(id ObjectID, merged []ObjectID) ([]ObjectID, error) {
+	var bases []ObjectID
+	for _, m := range merged {
+		b, err := repo.mergeBases(id, m)
+		if err != nil {
+			return nil, err
+		}
+		bases = append(bases, b...)
+	}
+	return repo.reduceHeads(bases)
+}
+
+// Return the message of a merge of heads into the current branch, naming
+// them like git fmt-merge-msg: by the branches pointing at them, or as
+// commits with their subjects.
+func (repo *Repository) mergeMessage(heads []ObjectID) (string, error) {
+	tips := make(map[ObjectID]string)
+	err := repo.ForEachRef("refs/heads/", func(ref Ref) error {
+		if _, ok := tips[ref.Id]; !ok {
+			tips[ref.Id] = strings.TrimPrefix(ref.Name, "refs/heads/")
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	var branches, commits []string
+	for _, h := range heads {
+		if name, ok := tips[h]; ok {
+			branches = append(branches, "'"+name+"'")
+			continue
+		}
+		c, err := repo.getCommit(h)
+		if err != nil {
+			return "", err
+		}
+		commits = append(commits, fmt.Sprintf("%s (%s)", h.Short(7), c.Summary()))
+	}
+	var parts []string
+	if len(branches) > 0 {
+		parts = append(parts, plural("branch", "branches", len(branches))+" "+joinList(branches))
+	}
+	if len(commits) > 0 {
+		parts = append(parts, plural("commit", "commits", len(commits))+" "+joinList(commits))
+	}
+	return "Merge " + strings.Join(parts, "; ") + "\n", nil
+}
+
+func plural(one, many string, n int) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+// Join items like "a, b and c".
+func joinList(items []string) string {
+	if len(items) == 1 {
+		return items[0]
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " and " + items[len(items)-1]
+}
+
+// Drop heads that are reachable from other heads, and duplicates, keeping
+// the order.
+func (repo *Repository) reduceHeads(heads []ObjectID) ([]ObjectID, error) {
+	var reduced []ObjectID
+	for i, h := range heads {
+		redundant := false
+		for j, other := range heads {
+			if i == j {
+				continue
+			}
+			if h.Equal(other) {
+				redundant = j < i
+			} else {
+				anc, err := repo.isAncestor(h, other)
+				if err != nil {
+					return nil, err
+				}
+				redundant = anc
+			}
+			if redundant {
+				break
+			}
+		}
+		if !redundant {
+			reduced = append(reduced, h)
+		}
+	}
+	return reduced, nil
+}
+
+// Three-way merge of flattened trees at path granularity. Paths that were
+// changed on both sides in different ways are returned as conflicts.
+func mergeFlatTrees(base, ours, theirs map[string]treeFile) (map[string]treeFile, []string) {
+	result := make(map[string]treeFile, len(ours))
+	var conflicts []string
+
+	paths := make(map[string]struct{}, len(ours))
+	for _, m := range []map[string]treeFile{base, ours, theirs} {
+		for p := range m {
+			paths[p] = struct{}{}
+		}
+	}
+
+	for p := range paths {
+		b, inBase := base[p]
+		o, inOurs := ours[p]
+		t, inTheirs := theirs[p]
+
+		switch {
+		case inOurs == inTheirs && o == t:
+			// same on both sides
+		case inBase == inOurs && b == o:
+			// only changed by them
+			o, inOurs = t, inTheirs
+		case inBase == inTheirs && b == t:
+			// only changed by us
+		default:
+			conflicts = append(conflicts, p)
+			continue
+		}
+		if inOurs {
+			result[p] = o
+		}
+	}
+
+	// a file on one side may collide with a directory on the other
+	collisions := make(map[string]bool)
+	for p := range result {
+		for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+			if _, ok := result[dir]; ok && !collisions[dir] {
+				collisions[dir] = true
+				conflicts = append(conflicts, dir)
+			}
+		}
+	}
+
+	sort.Strings(conflicts)
+	return result, conflicts
+}
@@ -0,0 +1,82 @@
+package git
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Write a commit with the files and parents, all files ModeBlob.
+func writeTestCommit(t *testing.T, repo *Repository, files map[string]string, message string, parents ...ObjectID) ObjectID {
+	t.Helper()
+	id, err := repo.CreateCommit(CommitOptions{
+		Tree:    writeTestTree(t, repo, files),
+		Parents: parents,
+		Message: message + "\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestOctopusMerge(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	base := writeTestCommit(t, repo, map[string]string{"f": "base\n", "a": "a\n", "b": "b\n", "c": "c\n"}, "base")
+	a := writeTestCommit(t, repo, map[string]string{"f": "base\n", "a": "A\n", "b": "b\n", "c": "c\n"}, "a", base)
+	// b and c share x, which a lacks; b changes f again
+	x := writeTestCommit(t, repo, map[string]string{"f": "x\n", "a": "a\n", "b": "b\n", "c": "c\n"}, "x", base)
+	b := writeTestCommit(t, repo, map[string]string{"f": "b\n", "a": "a\n", "b": "B\n", "c": "c\n"}, "b", x)
+	c := writeTestCommit(t, repo, map[string]string{"f": "x\n", "a": "a\n", "b": "b\n", "c": "C\n"}, "c", x)
+	if err := repo.CreateBranch("topic-b", b.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := repo.OctopusMerge([]string{a.String(), b.String(), c.String()}, CommitOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	merge, err := repo.getCommit(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merge.ParentCount() != 3 {
+		t.Fatalf("merge has %d parents", merge.ParentCount())
+	}
+	for i, expected := range []ObjectID{a, b, c} {
+		if parent, err := merge.ParentId(i); err != nil || !parent.Equal(expected) {
+			t.Errorf("parent %d is %s, expected %s", i, parent, expected)
+		}
+	}
+	if parent, err := merge.Parent(2); err != nil || parent.Summary() != "c" {
+		t.Errorf("third parent: %v", err)
+	}
+	for p, expected := range map[string]string{"f": "b\n", "a": "A\n", "b": "B\n", "c": "C\n"} {
+		if data := readTestFile(t, repo, merge.Tree.Id, p); data != expected {
+			t.Errorf("%s is %q, expected %q", p, data, expected)
+		}
+	}
+	expected := "Merge branch 'topic-b'; commit " + c.Short(7) + " (c)\n"
+	if merge.CommitMessage != expected {
+		t.Errorf("expected message %q, got %q", expected, merge.CommitMessage)
+	}
+}
+
+func TestOctopusMergeConflicts(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	base := writeTestCommit(t, repo, map[string]string{"f": "base\n"}, "base")
+	a := writeTestCommit(t, repo, map[string]string{"f": "a\n"}, "a", base)
+	b := writeTestCommit(t, repo, map[string]string{"f": "base\n", "d": "file\n"}, "b", base)
+	c := writeTestCommit(t, repo, map[string]string{"f": "c\n", "d/1": "1\n", "d/2": "2\n"}, "c", base)
+
+	_, err := repo.OctopusMerge([]string{a.String(), b.String(), c.String()}, CommitOptions{})
+	cerr, ok := err.(*MergeConflictError)
+	if !ok {
+		t.Fatalf("expected a *MergeConflictError, got %v", err)
+	}
+	if expected := []string{"d", "f"}; !reflect.DeepEqual(cerr.Paths, expected) {
+		t.Errorf("expected conflicts in %v, got %v", expected, cerr.Paths)
+	}
+	if _, err := repo.OctopusMerge([]string{a.String(), base.String()}, CommitOptions{}); err != ErrNothingToMerge {
+		t.Errorf("merging an ancestor: expected ErrNothingToMerge, got %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package git
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format returns the commit formatted like git log --format does with
+// the placeholders of format: %H, %h, %T, %t, %P and %p for ids, %an,
+// %ae, %ad, %aD, %ai, %aI, %as and %at for the author and the same with
+// "c" for the committer, %s, %b and %B for the message, %d and %D for the
+// refs pointing at the commit, %e for the encoding, and %n, %% and %xNN
+// for a newline, a percent sign and a byte. Other placeholders are kept
+// as they are.
+func (c *Commit) Format(format string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			buf.WriteByte(format[i])
+			continue
+		}
+		n := c.formatPlaceholder(&buf, format[i+1:])
+		if n == 0 {
+			buf.WriteByte('%')
+			continue
+		}
+		i += n
+	}
+	return buf.String()
+}
+
+// Write the expansion of the placeholder p starts with, and return its
+// length, 0 if it's unknown.
+func (c *Commit) formatPlaceholder(buf *bytes.Buffer, p string) int {
+	switch p[0] {
+	case 'H':
+		buf.WriteString(c.Id.String())
+	case 'h':
+		buf.WriteString(c.Id.Short(7))
+	case 'T':
+		buf.WriteString(c.Tree.Id.String())
+	case 't':
+		buf.WriteString(c.Tree.Id.Short(7))
+	case 'P', 'p':
+		for i, id := range c.parents {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			if p[0] == 'P' {
+				buf.WriteString(id.String())
+			} else {
+				buf.WriteString(id.Short(7))
+			}
+		}
+	case 's':
+		subject, _ := splitMessage(c.CommitMessage)
+		buf.WriteString(subject)
+	case 'b':
+		_, body := splitMessage(c.CommitMessage)
+		buf.WriteString(body)
+	case 'B':
+		buf.WriteString(c.CommitMessage)
+	case 'd', 'D':
+		names := c.decorations()
+		if len(names) > 0 && p[0] == 'd' {
+			buf.WriteString(" (" + strings.Join(names, ", ") + ")")
+		} else {
+			buf.WriteString(strings.Join(names, ", "))
+		}
+	case 'e':
+		encoding, _ := c.ExtraHeader("encoding")
+		buf.WriteString(encoding)
+	case 'n':
+		buf.WriteByte('\n')
+	case '%':
+		buf.WriteByte('%')
+	case 'x':
+		if len(p) < 3 {
+			return 0
+		}
+		b, err := strconv.ParseUint(p[1:3], 16, 8)
+		if err != nil {
+			return 0
+		}
+		buf.WriteByte(byte(b))
+		return 3
+	case 'a', 'c':
+		sig := c.Author
+		if p[0] == 'c' {
+			sig = c.Committer
+		}
+		if len(p) < 2 || sig == nil || !formatSignature(buf, sig, p[1]) {
+			return 0
+		}
+		return 2
+	default:
+		return 0
+	}
+	return 1
+}
+
+// Write the part of sig the placeholder letter selects, and return whether
+// it's known.
+func formatSignature(buf *bytes.Buffer, sig *Signature, letter byte) bool {
+	switch letter {
+	case 'n':
+		buf.WriteString(sig.Name)
+	case 'e':
+		buf.WriteString(sig.Email)
+	case 'd':
+		buf.WriteString(sig.When.Format("Mon Jan 2 15:04:05 2006 -0700"))
+	case 'D':
+		buf.WriteString(sig.When.Format("Mon, 2 Jan 2006 15:04:05 -0700"))
+	case 'i':
+		buf.WriteString(sig.When.Format("2006-01-02 15:04:05 -0700"))
+	case 'I':
+		buf.WriteString(sig.When.Format(time.RFC3339))
+	case 's':
+		buf.WriteString(sig.When.Format("2006-01-02"))
+	case 't':
+		buf.WriteString(strconv.FormatInt(sig.When.Unix(), 10))
+	default:
+		return false
+	}
+	return true
+}
+
+// Split a commit message into its subject, the first paragraph joined into
+// one line, and its body.
+func splitMessage(msg string) (string, string) {
+	msg = strings.TrimLeft(msg, "\n")
+	subject, body := msg, ""
+	if i := strings.Index(msg, "\n\n"); i >= 0 {
+		subject, body = msg[:i], strings.TrimLeft(msg[i+2:], "\n")
+	}
+	lines := strings.Split(strings.TrimRight(subject, "\n"), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return strings.Join(lines, " "), body
+}
+
+// The names of the refs pointing at the commit, like %D shows them: HEAD
+// first, then branches, remote-tracking branches and tags.
+func (c *Commit) decorations() []string {
+	var names []string
+	head := ""
+	if target, err := c.repo.headTarget(); err == nil {
+		head = target
+		if id, err := c.repo.resolveRevision("HEAD"); err == nil && id.Equal(c.Id) && target == "" {
+			names = append(names, "HEAD")
+		}
+	}
+	c.repo.ForEachRef("refs/", func(ref Ref) error {
+		id := ref.Id
+		if strings.HasPrefix(ref.Name, "refs/tags/") {
+			if peeled, _, err := c.repo.peel(ref.Id); err == nil {
+				id = peeled
+			}
+		}
+		if !id.Equal(c.Id) {
+			return nil
+		}
+		switch {
+		case ref.Name == head:
+			names = append([]string{"HEAD -> " + strings.TrimPrefix(ref.Name, "refs/heads/")}, names...)
+		case strings.HasPrefix(ref.Name, "refs/heads/"):
+			names = append(names, strings.TrimPrefix(ref.Name, "refs/heads/"))
+		case strings.HasPrefix(ref.Name, "refs/remotes/"):
+			names = append(names, strings.TrimPrefix(ref.Name, "refs/remotes/"))
+		case strings.HasPrefix(ref.Name, "refs/tags/"):
+			names = append(names, "tag: "+strings.TrimPrefix(ref.Name, "refs/tags/"))
+		}
+		return nil
+	})
+	return names
+}
@@ -0,0 +1,241 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var errBadCommitGraph = errors.New("bad commit-graph file")
+
+// A commitGraph is the commit-graph file git writes with git commit-graph
+// write or gc, or a chain of them: the ids, parents, dates and generation
+// numbers of commits, which can be read without inflating the commits.
+type commitGraph struct {
+	// base layers first, positions of commits count through all layers
+	layers []*commitGraphLayer
+}
+
+type commitGraphLayer struct {
+	fanout []byte // 256 big endian counts
+	oids   []byte
+	data   []byte
+	edges  []byte
+	// number of commits in the layers below
+	base uint32
+	n    uint32
+}
+
+const (
+	graphParentNone  = 0x70000000
+	graphExtraEdges  = 0x80000000
+	graphLastEdge    = 0x80000000
+	graphCommitBytes = 20 + 16
+)
+
+// Return the commit-graph of the repository, read on first use, or nil if
+// it has none. A graph that can't be read is ignored, the commits are read
+// instead.
+func (repo *Repository) getCommitGraph() *commitGraph {
+	if repo.commitGraph == nil {
+		var graph *commitGraph
+		for _, dir := range repo.objectDirs() {
+			var err error
+			if graph, err = readCommitGraph(filepath.Join(dir, "info")); err != nil {
+				repo.log().Warn("ignoring commit-graph", "err", err)
+			}
+			if graph != nil {
+				break
+			}
+		}
+		if graph == nil {
+			graph = &commitGraph{}
+		}
+		repo.commitGraph = graph
+	}
+	if len(repo.commitGraph.layers) == 0 {
+		return nil
+	}
+	return repo.commitGraph
+}
+
+// Read the commit-graph file in the info directory of the object
+// database, or the chain of them in info/commit-graphs. It returns nil
+// without an error if there is neither.
+func readCommitGraph(infoDir string) (*commitGraph, error) {
+	var files []string
+	chain, err := ioutil.ReadFile(filepath.Join(infoDir, "commit-graphs", "commit-graph-chain"))
+	if err == nil {
+		scanner := bufio.NewScanner(bytes.NewReader(chain))
+		for scanner.Scan() {
+			if hash := strings.TrimSpace(scanner.Text()); hash != "" {
+				files = append(files, filepath.Join(infoDir, "commit-graphs", "graph-"+hash+".graph"))
+			}
+		}
+	} else if os.IsNotExist(err) {
+		files = []string{filepath.Join(infoDir, "commit-graph")}
+	} else {
+		return nil, err
+	}
+
+	graph := &commitGraph{}
+	var base uint32
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) && len(chain) == 0 {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		layer, err := parseCommitGraph(data)
+		if err != nil {
+			return nil, err
+		}
+		layer.base = base
+		base += layer.n
+		graph.layers = append(graph.layers, layer)
+	}
+	return graph, nil
+}
+
+func parseCommitGraph(data []byte) (*commitGraphLayer, error) {
+	// signature, version 1, sha1, number of chunks, number of base graphs
+	if len(data) < 8 || string(data[:4]) != "CGPH" || data[4] != 1 || data[5] != 1 {
+		return nil, errBadCommitGraph
+	}
+	numChunks := int(data[6])
+	if len(data) < 8+(numChunks+1)*12 {
+		return nil, errBadCommitGraph
+	}
+
+	layer := &commitGraphLayer{}
+	for i := 0; i < numChunks; i++ {
+		entry := data[8+i*12:]
+		id := string(entry[:4])
+		start := binary.BigEndian.Uint64(entry[4:12])
+		end := binary.BigEndian.Uint64(entry[16:24])
+		if start > end || end > uint64(len(data)) {
+			return nil, errBadCommitGraph
+		}
+		chunk := data[start:end]
+		switch id {
+		case "OIDF":
+			layer.fanout = chunk
+		case "OIDL":
+			layer.oids = chunk
+		case "CDAT":
+			layer.data = chunk
+		case "EDGE":
+			layer.edges = chunk
+		}
+	}
+	if len(layer.fanout) != 256*4 {
+		return nil, errBadCommitGraph
+	}
+	layer.n = binary.BigEndian.Uint32(layer.fanout[255*4:])
+	if uint64(len(layer.oids)) != uint64(layer.n)*20 || uint64(len(layer.data)) != uint64(layer.n)*graphCommitBytes {
+		return nil, errBadCommitGraph
+	}
+	return layer, nil
+}
+
+// Return the position of the commit in the graph.
+func (g *commitGraph) find(id ObjectID) (uint32, bool) {
+	for _, layer := range g.layers {
+		lo := uint32(0)
+		if id[0] > 0 {
+			lo = binary.BigEndian.Uint32(layer.fanout[(int(id[0])-1)*4:])
+		}
+		hi := binary.BigEndian.Uint32(layer.fanout[int(id[0])*4:])
+		for lo < hi {
+			mid := lo + (hi-lo)/2
+			switch bytes.Compare(layer.oids[mid*20:mid*20+20], id[:]) {
+			case 0:
+				return layer.base + mid, true
+			case -1:
+				lo = mid + 1
+			default:
+				hi = mid
+			}
+		}
+	}
+	return 0, false
+}
+
+// Return the layer holding the commit at pos and its position there.
+func (g *commitGraph) layer(pos uint32) (*commitGraphLayer, uint32, error) {
+	for _, layer := range g.layers {
+		if pos < layer.base+layer.n {
+			return layer, pos - layer.base, nil
+		}
+	}
+	return nil, 0, errBadCommitGraph
+}
+
+// Return the commit at pos.
+func (g *commitGraph) node(pos uint32) (CommitNode, error) {
+	var node CommitNode
+	if err := g.fillNode(pos, &node); err != nil {
+		return CommitNode{}, err
+	}
+	return node, nil
+}
+
+// Set node to the commit at pos. Its parents are appended to
+// node.Parents.
+func (g *commitGraph) fillNode(pos uint32, node *CommitNode) error {
+	layer, i, err := g.layer(pos)
+	if err != nil {
+		return err
+	}
+	copy(node.Id[:], layer.oids[i*20:])
+	data := layer.data[i*graphCommitBytes:]
+	copy(node.Tree[:], data[:20])
+
+	parents := []uint32{binary.BigEndian.Uint32(data[20:]), binary.BigEndian.Uint32(data[24:])}
+	for j, p := range parents {
+		if p == graphParentNone {
+			break
+		}
+		if j == 1 && p&graphExtraEdges != 0 {
+			// the second and further parents are in the edge list
+			for k := p &^ graphExtraEdges; ; k++ {
+				if int(k)*4+4 > len(layer.edges) {
+					return errBadCommitGraph
+				}
+				e := binary.BigEndian.Uint32(layer.edges[k*4:])
+				if err := g.appendParent(node, e&^graphLastEdge); err != nil {
+					return err
+				}
+				if e&graphLastEdge != 0 {
+					break
+				}
+			}
+			break
+		}
+		if err := g.appendParent(node, p); err != nil {
+			return err
+		}
+	}
+
+	genTime := binary.BigEndian.Uint64(data[28:])
+	node.Generation = genTime >> 34
+	node.Time = int64(genTime & (1<<34 - 1))
+	return nil
+}
+
+func (g *commitGraph) appendParent(node *CommitNode, pos uint32) error {
+	layer, i, err := g.layer(pos)
+	if err != nil {
+		return err
+	}
+	var id ObjectID
+	copy(id[:], layer.oids[i*20:])
+	node.Parents = append(node.Parents, id)
+	return nil
+}
@@ -0,0 +1,212 @@
+package git
+
+import (
+	"container/heap"
+	"container/list"
+	"errors"
+)
+
+// ErrNotIndexed can be returned by CommitIndexer.SearchCommits when it
+// can't answer a search, e.g. while it is still catching up. The history
+// is then searched by walking it.
+var ErrNotIndexed = errors.New("commits are not indexed")
+
+// An IndexedCommit is what a CommitIndexer is given about a commit.
+type IndexedCommit struct {
+	Id        ObjectID
+	Author    *Signature
+	Committer *Signature
+	Message   string
+	// The paths changed by the commit, compared to its first parent.
+	Paths []string
+}
+
+// A CommitIndexer keeps a full-text index of commits, e.g. in bleve or
+// Elasticsearch, so that searching doesn't have to walk the history.
+type CommitIndexer interface {
+	// IndexCommit is called after a ref was updated, for each commit
+	// that became reachable from it, newest first, up to
+	// IndexCommitLimit of them.
+	IndexCommit(ref string, c IndexedCommit) error
+	// SearchCommits returns the ids of the commits matching keyword,
+	// newest first. Commits not reachable from tip are left out of the
+	// results, so indexers needn't track which ref has which commits.
+	SearchCommits(tip ObjectID, keyword string, limit int) ([]ObjectID, error)
+}
+
+// SetCommitIndexer makes ref updates through the repository feed the new
+// commits to ix, and SearchCommits ask it before walking the history. A
+// nil ix removes the indexer.
+func (repo *Repository) SetCommitIndexer(ix CommitIndexer) {
+	repo.indexer = ix
+}
+
+// IndexCommitLimit bounds the number of commits fed to the CommitIndexer
+// for a ref update, so that the first push of a big history doesn't hold
+// up the update. Older commits are left for the indexer to catch up with
+// in the background; until then it should answer ErrNotIndexed.
+var IndexCommitLimit = 1000
+
+// Feed the commits ref updates made reachable to the indexer: for each
+// updated ref, those not reachable from its old value, from the old
+// values of the other updated refs, or from any other ref, newest first.
+// The refs were updated already, so failures are only logged.
+func (repo *Repository) indexRefUpdates(names []string, olds, tips []ObjectID) {
+	if repo.indexer == nil || len(names) == 0 {
+		return
+	}
+	refs, err := repo.listRefs()
+	if err != nil {
+		repo.log().Warn("indexing commits failed", "error", err)
+		return
+	}
+	for _, name := range names {
+		delete(refs, name)
+	}
+	var exclude []ObjectID
+	for _, id := range refs {
+		exclude = append(exclude, id)
+	}
+	exclude = append(exclude, olds...)
+	for i := range exclude {
+		if id, tp, err := repo.peel(exclude[i]); err == nil && tp == ObjectCommit {
+			exclude[i] = id
+		} else {
+			// e.g. a deleted object or a tag of a tree
+			exclude[i] = ObjectID{}
+		}
+	}
+
+	for i, name := range names {
+		if err := repo.indexNewCommits(name, tips[i], exclude); err != nil {
+			repo.log().Warn("indexing commits failed", "ref", name, "error", err)
+		}
+	}
+}
+
+func (repo *Repository) indexNewCommits(name string, tip ObjectID, exclude []ObjectID) error {
+	tip, tp, err := repo.peel(tip)
+	if err != nil || tp != ObjectCommit {
+		return err
+	}
+	var olds []ObjectID
+	for _, id := range exclude {
+		if !id.IsZero() {
+			olds = append(olds, id)
+		}
+	}
+	commits, err := repo.commitsExcluding([]ObjectID{tip}, olds, IndexCommitLimit)
+	if err != nil {
+		return err
+	}
+	if commits.Len() == IndexCommitLimit {
+		repo.log().Debug("indexing only the newest commits", "ref", name, "limit", IndexCommitLimit)
+	}
+	for e := commits.Front(); e != nil; e = e.Next() {
+		c := e.Value.(*Commit)
+		ic := IndexedCommit{
+			Id:        c.Id,
+			Author:    c.Author,
+			Committer: c.Committer,
+			Message:   c.CommitMessage,
+		}
+		ptree, err := firstParentTree(c)
+		if err != nil {
+			return err
+		}
+		changes, err := diffTrees(ptree, &c.Tree)
+		if err != nil {
+			return err
+		}
+		for _, change := range changes {
+			ic.Paths = append(ic.Paths, change.path)
+		}
+		if err := repo.indexer.IndexCommit(name, ic); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newCommits returns the commits reachable from tip but not from old,
+// newest first.
+func (repo *Repository) newCommits(old, tip ObjectID) ([]*Commit, error) {
+	var olds []ObjectID
+	if !old.IsZero() {
+		olds = append(olds, old)
+	}
+	return repo.commitsNotIn(tip, olds)
+}
+
+// commitsNotIn returns the commits reachable from tip but from none of
+// olds, newest first. Commits are visited by generation, so a commit is
+// known to be new once all commits that could reach it were seen, and the
+// walk ends when only commits reachable from olds are left.
+func (repo *Repository) commitsNotIn(tip ObjectID, olds []ObjectID) ([]*Commit, error) {
+	paint := make(map[ObjectID]int)
+	q := &commitQueue{}
+	paint[tip] = paintOne
+	if err := repo.pushQueue(q, tip); err != nil {
+		return nil, err
+	}
+	for _, old := range olds {
+		paint[old] |= paintStale
+		if err := repo.pushQueue(q, old); err != nil {
+			return nil, err
+		}
+	}
+
+	var commits []*Commit
+	done := make(map[ObjectID]bool)
+	for q.Len() > 0 && !allStale(q, paint) {
+		cur := heap.Pop(q).(*queuedCommit).commit
+		if done[cur.Id] {
+			continue
+		}
+		done[cur.Id] = true
+		flags := paint[cur.Id]
+		if flags&paintStale == 0 {
+			commits = append(commits, cur)
+		}
+		for _, p := range cur.parents {
+			if paint[p]&flags == flags {
+				continue
+			}
+			paint[p] |= flags
+			if err := repo.pushQueue(q, p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return commits, nil
+}
+
+// Search the commits reachable from id with the indexer, returning
+// ErrNotIndexed if it can't.
+func (repo *Repository) searchIndex(id ObjectID, keyword string) (*list.List, error) {
+	ids, err := repo.indexer.SearchCommits(id, keyword, ItemsPerSearch)
+	if err != nil {
+		return nil, err
+	}
+	results := list.New()
+	seen := make(map[ObjectID]bool)
+	for _, cid := range ids {
+		if results.Len() == ItemsPerSearch {
+			break
+		}
+		if seen[cid] {
+			continue
+		}
+		seen[cid] = true
+		if ok, err := repo.isAncestor(cid, id); err != nil || !ok {
+			// unknown here or on another branch
+			continue
+		}
+		commit, err := repo.getCommit(cid)
+		if err != nil {
+			return nil, err
+		}
+		results.PushBack(commit)
+	}
+	return results, nil
+}
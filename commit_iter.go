@@ -0,0 +1,132 @@
+package git
+
+import (
+	"context"
+	"io"
+)
+
+// LogOptions select the commits of Repository.Log.
+type LogOptions struct {
+	// The revision to start from, HEAD if empty.
+	From string
+	// Only commits changing the path, with the history simplified like
+	// git log -- path does.
+	Path string
+	// Follow the file at Path across renames, like git log --follow.
+	Follow bool
+	// Only commits whose message matches the regular expression.
+	Grep string
+	// Leave out the first Skip commits.
+	Skip int
+	// Stop after Limit commits, all commits if 0.
+	Limit int
+}
+
+// A CommitIter produces the commits of a walk of the history one at a
+// time, newest first, so that long histories don't need to be read at
+// once. Commits are only read as far as they are asked for.
+type CommitIter struct {
+	walk  *historyWalk
+	err   error
+	skip  int
+	limit int
+	count int
+}
+
+// Log returns an iterator over the history selected by opts, like git log.
+// Errors, like a revision that doesn't exist, are returned by the first
+// call to Next. The history of a branch without commits is empty.
+func (repo *Repository) Log(opts LogOptions) *CommitIter {
+	return repo.LogContext(context.Background(), opts)
+}
+
+// LogContext is like Log. Once ctx is done, Next returns the context's
+// error.
+func (repo *Repository) LogContext(ctx context.Context, opts LogOptions) *CommitIter {
+	it := &CommitIter{skip: opts.Skip, limit: opts.Limit}
+	rev := opts.From
+	if rev == "" {
+		rev = "HEAD"
+	}
+	id, err := repo.resolveRevision(rev)
+	if err == ErrUnbornBranch {
+		return it
+	} else if err != nil {
+		it.err = err
+		return it
+	}
+	commit, err := repo.getCommit(id)
+	if err != nil {
+		it.err = err
+		return it
+	}
+
+	callback, eq := nopCallback, nopComparator
+	if opts.Path != "" && opts.Follow {
+		callback, eq = makeFollower(opts.Path)
+	} else if opts.Path != "" {
+		callback, eq = makePathChecker(opts.Path), makePathComparator(opts.Path)
+	}
+	if opts.Grep != "" {
+		searcher, err := makeHistorySearcher(opts.Grep)
+		if err != nil {
+			it.err = err
+			return it
+		}
+		pathChecker := callback
+		callback = func(commit *Commit) (HistoryWalkerAction, error) {
+			action, err := pathChecker(commit)
+			if err != nil || action&HWTakeCommit == 0 {
+				return action, err
+			}
+			return searcher(commit)
+		}
+	}
+	it.walk = newHistoryWalk(ctx, []*Commit{commit}, callback, eq)
+	return it
+}
+
+// Next returns the next commit, or io.EOF at the end of the history.
+func (it *CommitIter) Next() (*Commit, error) {
+	if it.err != nil {
+		return nil, it.err
+	}
+	if it.walk == nil || it.limit > 0 && it.count >= it.limit {
+		return nil, io.EOF
+	}
+	for {
+		commit, err := it.walk.next()
+		if err != nil {
+			it.err = err
+			return nil, err
+		}
+		if commit == nil {
+			return nil, io.EOF
+		}
+		if it.skip > 0 {
+			it.skip--
+			continue
+		}
+		it.count++
+		return commit, nil
+	}
+}
+
+// ForEach calls fn for each of the remaining commits. If fn returns an
+// error, the iteration stops and ForEach returns the error, unless it is
+// StopIteration.
+func (it *CommitIter) ForEach(fn func(*Commit) error) error {
+	for {
+		commit, err := it.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(commit); err == StopIteration {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"context"
+	"fmt"
+)
+
+// A CommitNode is what walks over the history need of a commit: its id,
+// tree, parents and committer date, without the rest of the commit.
+type CommitNode struct {
+	Id      ObjectID
+	Tree    ObjectID
+	Parents []ObjectID
+	// The committer date as a unix time.
+	Time int64
+	// The generation number the commit-graph file records, 0 if the commit
+	// isn't in it.
+	Generation uint64
+}
+
+// commitNode returns the node of a commit: from the commit-graph file if
+// it has the commit, otherwise from the headers of the commit object,
+// without parsing the rest of it into a Commit.
+func (repo *Repository) commitNode(id ObjectID) (CommitNode, error) {
+	if graph := repo.getCommitGraph(); graph != nil {
+		if pos, ok := graph.find(id); ok {
+			return graph.node(pos)
+		}
+	}
+	if c, ok := repo.commitCache[id]; ok {
+		return CommitNode{Id: id, Tree: c.Tree.Id, Parents: c.parents, Time: c.Committer.When.Unix()}, nil
+	}
+
+	tp, _, rc, err := repo.GetRawObject(id, false)
+	if err != nil {
+		return CommitNode{}, err
+	}
+	defer rc.Close()
+	if tp != ObjectCommit {
+		return CommitNode{}, fmt.Errorf("%s is not a commit", id)
+	}
+
+	node := CommitNode{Id: id}
+	r := bufio.NewReader(rc)
+	for {
+		line, rerr := r.ReadSlice('\n')
+		if rerr != nil && rerr != bufio.ErrBufferFull {
+			return CommitNode{}, rerr
+		}
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		if len(line) == 0 {
+			// end of the headers
+			return node, nil
+		}
+		switch {
+		case bytes.HasPrefix(line, []byte("tree ")):
+			if node.Tree, err = NewIdFromString(string(line[5:])); err != nil {
+				return CommitNode{}, err
+			}
+		case bytes.HasPrefix(line, []byte("parent ")):
+			p, err := NewIdFromString(string(line[7:]))
+			if err != nil {
+				return CommitNode{}, err
+			}
+			node.Parents = append(node.Parents, p)
+		case bytes.HasPrefix(line, []byte("committer ")):
+			if sig, _ := parseSignature(line[10:], ParseLenient); sig != nil {
+				node.Time = sig.When.Unix()
+			}
+		}
+		for rerr == bufio.ErrBufferFull {
+			// the rest of a long header, like a signature
+			_, rerr = r.ReadSlice('\n')
+		}
+	}
+}
+
+// queue of commit nodes, newest first
+type nodeQueue []CommitNode
+
+func (q nodeQueue) Len() int            { return len(q) }
+func (q nodeQueue) Less(i, j int) bool  { return q[i].Time > q[j].Time }
+func (q nodeQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *nodeQueue) Push(x interface{}) { *q = append(*q, x.(CommitNode)) }
+func (q *nodeQueue) Pop() interface{} {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return x
+}
+
+// WalkCommitNodes calls fn with the node of each commit reachable from
+// the commit named by rev, newest first by committer date. No Commit is
+// built: nodes are read from the commit-graph file, or from the headers of
+// the commit objects for commits it doesn't have, and only the ids of the
+// commits seen are kept. This suits counting and reachability queries
+// over large histories. If fn returns an error, the walk stops and
+// WalkCommitNodes returns it, unless it is StopIteration.
+func (repo *Repository) WalkCommitNodes(ctx context.Context, rev string, fn func(CommitNode) error) error {
+	id, err := repo.resolveRevision(rev)
+	if err != nil {
+		return err
+	}
+	return repo.walkCommitNodes(ctx, id, fn)
+}
+
+func (repo *Repository) walkCommitNodes(ctx context.Context, id ObjectID, fn func(CommitNode) error) error {
+	seen := map[ObjectID]struct{}{id: {}}
+	node, err := repo.commitNode(id)
+	if err != nil {
+		return err
+	}
+	q := &nodeQueue{node}
+	for q.Len() > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		node := heap.Pop(q).(CommitNode)
+		if err := fn(node); err == StopIteration {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		for _, p := range node.Parents {
+			if _, ok := seen[p]; ok {
+				continue
+			}
+			seen[p] = struct{}{}
+			pnode, err := repo.commitNode(p)
+			if err != nil {
+				return err
+			}
+			heap.Push(q, pnode)
+		}
+	}
+	return nil
+}
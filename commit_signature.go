@@ -0,0 +1,53 @@
+package git
+
+import (
+	"bytes"
+)
+
+// Signature formats, as git calls them in gpg.format.
+const (
+	SignatureOpenPGP = "openpgp"
+	SignatureSSH     = "ssh"
+	SignatureX509    = "x509"
+)
+
+// Signature returns the signature of a signed commit, from its gpgsig
+// header, and the part of the commit object it signs: the object without
+// its signature headers. ok is false if the commit isn't signed.
+func (c *Commit) Signature() (payload, signature []byte, ok bool) {
+	if c.payload == nil {
+		return nil, nil, false
+	}
+	sig, ok := c.ExtraHeader("gpgsig")
+	if !ok {
+		// only signed in a SHA-256 version of the repository
+		return nil, nil, false
+	}
+	return c.payload, []byte(sig + "\n"), true
+}
+
+// Verify checks the signature of a signed commit with verify. It returns
+// ErrNotSigned if the commit isn't signed.
+func (c *Commit) Verify(verify SignatureVerifier) error {
+	payload, signature, ok := c.Signature()
+	if !ok {
+		return ErrNotSigned
+	}
+	return verify(payload, signature)
+}
+
+// SignatureFormat returns the format of a signature of a commit or tag,
+// SignatureOpenPGP, SignatureSSH or SignatureX509, to choose how to verify
+// it. It returns "" for other signatures.
+func SignatureFormat(signature []byte) string {
+	switch {
+	case bytes.HasPrefix(signature, []byte("-----BEGIN PGP SIGNATURE-----")),
+		bytes.HasPrefix(signature, []byte("-----BEGIN PGP MESSAGE-----")):
+		return SignatureOpenPGP
+	case bytes.HasPrefix(signature, []byte("-----BEGIN SSH SIGNATURE-----")):
+		return SignatureSSH
+	case bytes.HasPrefix(signature, []byte("-----BEGIN SIGNED MESSAGE-----")):
+		return SignatureX509
+	}
+	return ""
+}
@@ -0,0 +1,196 @@
+package git
+
+import (
+	"container/heap"
+	"container/list"
+	"context"
+	"time"
+)
+
+// SetMonotonicWalk makes walks in date order, like CommitsBefore and the
+// history walks, use corrected committer dates: the date of a commit, or
+// one second after the corrected date of its newest parent if that's
+// later. Commits with a clock running behind their parents then still come
+// before them. Corrected dates are computed down to the root commits once,
+// so the first walk reads the whole history.
+func (repo *Repository) SetMonotonicWalk(on bool) {
+	repo.monotonicWalk = on
+}
+
+// correctedDate returns the corrected committer date of a commit as a unix
+// time, never older than its parents. Like generation numbers, at most
+// GenerationCacheLimit dates are memoized.
+func (repo *Repository) correctedDate(id ObjectID) (int64, error) {
+	if date, ok := repo.correctedDates[id]; ok {
+		return date, nil
+	}
+	if repo.correctedDates == nil || len(repo.correctedDates) >= GenerationCacheLimit {
+		repo.correctedDates = make(map[ObjectID]int64)
+	}
+	// dates past the limit
+	var overflow map[ObjectID]int64
+	get := func(id ObjectID) (int64, bool) {
+		if date, ok := repo.correctedDates[id]; ok {
+			return date, true
+		}
+		date, ok := overflow[id]
+		return date, ok
+	}
+	set := func(id ObjectID, date int64) {
+		if len(repo.correctedDates) < GenerationCacheLimit {
+			repo.correctedDates[id] = date
+			return
+		}
+		if overflow == nil {
+			overflow = make(map[ObjectID]int64)
+		}
+		overflow[id] = date
+	}
+
+	stack := []ObjectID{id}
+	for len(stack) > 0 {
+		cur := stack[len(stack)-1]
+		if _, ok := get(cur); ok {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		commit, err := repo.getCommit(cur)
+		if err != nil {
+			return 0, err
+		}
+
+		date := commit.Committer.When.Unix()
+		pending := false
+		for _, p := range commit.parents {
+			pdate, ok := get(p)
+			if !ok {
+				stack = append(stack, p)
+				pending = true
+				continue
+			}
+			if pdate >= date {
+				date = pdate + 1
+			}
+		}
+		if pending {
+			continue
+		}
+
+		set(cur, date)
+		stack = stack[:len(stack)-1]
+	}
+
+	date, _ := get(id)
+	return date, nil
+}
+
+// Whether a comes before b in a walk in date order.
+func (repo *Repository) walksBefore(a, b *Commit) bool {
+	if repo.monotonicWalk {
+		da, errA := repo.correctedDate(a.Id)
+		db, errB := repo.correctedDate(b.Id)
+		// a commit that can't be read is found by the walk itself
+		if errA == nil && errB == nil {
+			return da > db
+		}
+	}
+	return a.Committer.When.After(b.Committer.When)
+}
+
+// queue of commits by corrected date, newest first
+type dateQueue []*datedCommit
+
+type datedCommit struct {
+	commit *Commit
+	date   int64
+}
+
+func (q dateQueue) Len() int            { return len(q) }
+func (q dateQueue) Less(i, j int) bool  { return q[i].date > q[j].date }
+func (q dateQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *dateQueue) Push(x interface{}) { *q = append(*q, x.(*datedCommit)) }
+func (q *dateQueue) Pop() interface{} {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return x
+}
+
+// The commits reachable from id by corrected date, for CommitsBefore in a
+// monotonic walk.
+func (repo *Repository) commitsByCorrectedDate(ctx context.Context, id ObjectID) (*list.List, error) {
+	l := list.New()
+	q := &dateQueue{}
+	seen := make(map[ObjectID]bool)
+	push := func(id ObjectID) error {
+		if seen[id] {
+			return nil
+		}
+		seen[id] = true
+		commit, err := repo.getCommit(id)
+		if err != nil {
+			return err
+		}
+		date, err := repo.correctedDate(id)
+		if err != nil {
+			return err
+		}
+		heap.Push(q, &datedCommit{commit, date})
+		return nil
+	}
+
+	if err := push(id); err != nil {
+		return nil, err
+	}
+	for q.Len() > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		commit := heap.Pop(q).(*datedCommit).commit
+		l.PushBack(commit)
+		for _, p := range commit.parents {
+			if err := push(p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return l, nil
+}
+
+// A SkewedCommit is a commit with a committer date older than that of one
+// of its parents, usually made on a machine with a wrong clock.
+type SkewedCommit struct {
+	Commit *Commit
+	Parent ObjectID
+	// How much older the commit is than the parent.
+	Skew time.Duration
+}
+
+// DetectTimeSkew returns the commits reachable from the commit named by rev
+// that are older than a parent, newest first. Walks in date order may list
+// them after their parents unless SetMonotonicWalk is used.
+func (repo *Repository) DetectTimeSkew(rev string) ([]SkewedCommit, error) {
+	tip, err := repo.resolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := repo.newCommits(ObjectID{}, tip)
+	if err != nil {
+		return nil, err
+	}
+
+	var skewed []SkewedCommit
+	for _, c := range commits {
+		for _, id := range c.parents {
+			p, err := repo.getCommit(id)
+			if err != nil {
+				return nil, err
+			}
+			if p.Committer.When.After(c.Committer.When) {
+				skewed = append(skewed, SkewedCommit{c, id, p.Committer.When.Sub(c.Committer.When)})
+			}
+		}
+	}
+	return skewed, nil
+}
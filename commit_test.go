@@ -1,9 +1,10 @@
 package git
 
 import (
+	"context"
 	"io"
 	"io/ioutil"
-
+	"reflect"
 	"testing"
 )
 
@@ -25,3 +26,57 @@ func TestBlob(t *testing.T) {
 		rc.Close()
 	}
 }
+
+func TestBulkWalk(t *testing.T) {
+	r, err := OpenRepository("testdata/test.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want, got []CommitNode
+	err = r.WalkCommitNodes(context.Background(), "master", func(n CommitNode) error {
+		want = append(want, n)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.BulkWalk(context.Background(), []string{"master"}, func(n CommitNode) error {
+		n.Parents = append([]ObjectID(nil), n.Parents...)
+		got = append(got, n)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("BulkWalk walked %v, want %v", got, want)
+	}
+}
+
+func BenchmarkWalkCommitNodes(b *testing.B) {
+	r, err := OpenRepository("testdata/test.git")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		err := r.WalkCommitNodes(context.Background(), "master", func(CommitNode) error { return nil })
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBulkWalk(b *testing.B) {
+	r, err := OpenRepository("testdata/test.git")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		err := r.BulkWalk(context.Background(), []string{"master"}, func(CommitNode) error { return nil })
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -7,53 +7,154 @@ import (
 // Parse commit information from the (uncompressed) raw
 // data from the commit object.
 // \n\n separate headers from message
-func parseCommitData(data []byte) (*Commit, error) {
+// In strict mode, the headers must be the ones git writes, in its order:
+// tree, parents, author, committer, then any others. Leniently, a missing
+// author or committer is taken from the other one.
+func parseCommitData(data []byte, mode ParseMode) (*Commit, error) {
+	strict := mode == ParseStrict
 	commit := new(Commit)
-	commit.parents = make([]sha1, 0, 1)
+	commit.parents = make([]ObjectID, 0, 1)
+	fail := func(line int, reason string) (*Commit, error) {
+		return nil, &ParseError{Type: ObjectCommit, Line: line, Reason: reason}
+	}
+
+	// the next header git writes: tree, parent, author, committer, others
+	const (
+		wantTree = iota
+		wantParent
+		wantCommitter
+		wantOther
+	)
+	want := wantTree
+	haveTree := false
+	// whether the last header was an extra one, which continuation lines
+	// belong to
+	extra := false
+	// the byte ranges of signature headers, which aren't part of what
+	// they sign
+	var sigRanges [][2]int
+	inSig := false
+
 	// we now have the contents of the commit object. Let's investigate...
 	nextline := 0
-l:
-	for {
+	for lineNo := 1; ; lineNo++ {
 		eol := bytes.IndexByte(data[nextline:], '\n')
-		switch {
-		case eol > 0:
-			line := data[nextline : nextline+eol]
-			spacepos := bytes.IndexByte(line, ' ')
-			reftype := line[:spacepos]
-			switch string(reftype) {
-			case "tree":
-				id, err := NewIdFromString(string(line[spacepos+1:]))
-				if err != nil {
-					return nil, err
-				}
-				commit.Tree.Id = id
-			case "parent":
-				// A commit can have one or more parents
-				oid, err := NewIdFromString(string(line[spacepos+1:]))
-				if err != nil {
-					return nil, err
-				}
-				commit.parents = append(commit.parents, oid)
-			case "author":
-				sig, err := newSignatureFromCommitline(line[spacepos+1:])
-				if err != nil {
-					return nil, err
-				}
-				commit.Author = sig
-			case "committer":
-				sig, err := newSignatureFromCommitline(line[spacepos+1:])
-				if err != nil {
-					return nil, err
-				}
-				commit.Committer = sig
-			}
-			nextline += eol + 1
-		case eol == 0:
+		if eol < 0 {
+			if strict {
+				return fail(lineNo, "unterminated header")
+			}
+			break
+		}
+		if eol == 0 {
 			commit.CommitMessage = string(data[nextline+1:])
-			break l
+			break
+		}
+		line := data[nextline : nextline+eol]
+		lineStart := nextline
+		nextline += eol + 1
+
+		if line[0] == ' ' {
+			// continuation of a multi-line header like gpgsig
+			if inSig {
+				sigRanges[len(sigRanges)-1][1] = nextline
+			}
+			if extra {
+				h := &commit.headers[len(commit.headers)-1]
+				h.Value += "\n" + string(line[1:])
+			} else if strict {
+				return fail(lineNo, "unexpected continuation line")
+			}
+			continue
+		}
+		extra, inSig = false, false
+		spacepos := bytes.IndexByte(line, ' ')
+		if spacepos < 0 {
+			if strict {
+				return fail(lineNo, "header without value")
+			}
+			continue
+		}
+		reftype, value := string(line[:spacepos]), line[spacepos+1:]
+		switch reftype {
+		case "tree":
+			if strict && want != wantTree {
+				return fail(lineNo, "unexpected tree header")
+			}
+			id, err := NewIdFromString(string(value))
+			if err != nil {
+				return fail(lineNo, "bad tree id")
+			}
+			commit.Tree.Id = id
+			haveTree = true
+			want = wantParent
+		case "parent":
+			// A commit can have one or more parents
+			if strict && want != wantParent {
+				return fail(lineNo, "unexpected parent header")
+			}
+			oid, err := NewIdFromString(string(value))
+			if err != nil {
+				return fail(lineNo, "bad parent id")
+			}
+			commit.parents = append(commit.parents, oid)
+		case "author":
+			if strict && want != wantParent {
+				return fail(lineNo, "unexpected author header")
+			}
+			sig, reason := parseSignature(value, mode)
+			if sig == nil {
+				return fail(lineNo, "author: "+reason)
+			}
+			commit.Author = sig
+			want = wantCommitter
+		case "committer":
+			if strict && want != wantCommitter {
+				return fail(lineNo, "unexpected committer header")
+			}
+			sig, reason := parseSignature(value, mode)
+			if sig == nil {
+				return fail(lineNo, "committer: "+reason)
+			}
+			commit.Committer = sig
+			want = wantOther
 		default:
-			break l
+			if strict && want != wantOther {
+				return fail(lineNo, "unexpected "+reftype+" header")
+			}
+			commit.headers = append(commit.headers, CommitHeader{reftype, string(value)})
+			extra = true
+			if reftype == "gpgsig" || reftype == "gpgsig-sha256" {
+				sigRanges = append(sigRanges, [2]int{lineStart, nextline})
+				inSig = true
+			}
 		}
 	}
+
+	switch {
+	case !haveTree:
+		return fail(0, "missing tree")
+	case strict && commit.Author == nil:
+		return fail(0, "missing author")
+	case strict && commit.Committer == nil:
+		return fail(0, "missing committer")
+	}
+	if len(sigRanges) > 0 {
+		prev := 0
+		for _, r := range sigRanges {
+			commit.payload = append(commit.payload, data[prev:r[0]]...)
+			prev = r[1]
+		}
+		commit.payload = append(commit.payload, data[prev:]...)
+	}
+	if commit.Author == nil {
+		commit.Author = commit.Committer
+	}
+	if commit.Committer == nil {
+		commit.Committer = commit.Author
+	}
+	if commit.Author == nil {
+		commit.Author = &Signature{When: unixEpoch}
+		commit.Committer = commit.Author
+	}
 	return commit, nil
 }
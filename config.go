@@ -0,0 +1,432 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrConfigSyntax = errors.New("bad config syntax")
+)
+
+// Config holds the variables of one or more git config files. Later
+// values of a variable override earlier ones.
+type Config struct {
+	entries []*configEntry
+}
+
+type configEntry struct {
+	// canonical name: lower case section and key, subsection as is
+	name   string
+	value  string
+	source string
+}
+
+// maximum nesting of include.path
+const maxConfigIncludeDepth = 10
+
+// ReadConfigFile reads a config file, following its include.path
+// directives. includeIf "gitdir:..." sections are honored if gitDir is
+// not empty.
+func ReadConfigFile(path, gitDir string) (*Config, error) {
+	c := new(Config)
+	if err := c.readFile(path, gitDir, 0); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Config) readFile(path, gitDir string, depth int) error {
+	if depth > maxConfigIncludeDepth {
+		return fmt.Errorf("%s: exceeded maximum include depth", path)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	entries, err := parseConfig(data, path)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		c.entries = append(c.entries, e)
+
+		var include string
+		switch {
+		case e.name == "include.path":
+			include = e.value
+		case strings.HasPrefix(e.name, "includeif.") && strings.HasSuffix(e.name, ".path"):
+			cond := strings.TrimSuffix(strings.TrimPrefix(e.name, "includeif."), ".path")
+			if gitDir != "" && includeIfMatches(cond, path, gitDir) {
+				include = e.value
+			}
+		}
+		if include == "" {
+			continue
+		}
+
+		include = expandHome(include)
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		// like git, missing include files are ignored
+		if err := c.readFile(include, gitDir, depth+1); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func includeIfMatches(cond, configPath, gitDir string) bool {
+	foldCase := false
+	switch {
+	case strings.HasPrefix(cond, "gitdir:"):
+		cond = cond[len("gitdir:"):]
+	case strings.HasPrefix(cond, "gitdir/i:"):
+		cond = cond[len("gitdir/i:"):]
+		foldCase = true
+	default:
+		return false
+	}
+
+	cond = expandHome(cond)
+	if strings.HasPrefix(cond, "./") {
+		cond = filepath.Join(filepath.Dir(configPath), cond[2:])
+	} else if !filepath.IsAbs(cond) {
+		cond = "**/" + cond
+	}
+	if strings.HasSuffix(cond, "/") {
+		cond += "**"
+	}
+
+	dir := filepath.ToSlash(gitDir)
+	cond = filepath.ToSlash(cond)
+	if foldCase {
+		dir, cond = strings.ToLower(dir), strings.ToLower(cond)
+	}
+	return matchComponents(strings.Split(strings.TrimPrefix(cond, "/"), "/"),
+		strings.Split(strings.TrimPrefix(dir, "/"), "/"))
+}
+
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	return path
+}
+
+func parseConfig(data []byte, source string) ([]*configEntry, error) {
+	var (
+		entries []*configEntry
+		section string
+	)
+
+	scan := bufio.NewScanner(bytes.NewReader(data))
+	lineNo := 0
+	for scan.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scan.Text())
+		// continuation lines
+		for strings.HasSuffix(line, `\`) && !strings.HasSuffix(line, `\\`) && scan.Scan() {
+			lineNo++
+			line = line[:len(line)-1] + scan.Text()
+		}
+
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if line[0] == '[' {
+			end := strings.LastIndexByte(line, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%s:%d: %v", source, lineNo, ErrConfigSyntax)
+			}
+			s, err := parseConfigSection(line[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", source, lineNo, err)
+			}
+			section = s
+			line = strings.TrimSpace(line[end+1:])
+			if line == "" || line[0] == '#' || line[0] == ';' {
+				continue
+			}
+		}
+
+		if section == "" {
+			return nil, fmt.Errorf("%s:%d: variable outside of a section", source, lineNo)
+		}
+
+		key, value := line, "true"
+		if i := strings.IndexByte(line, '='); i >= 0 {
+			key = strings.TrimSpace(line[:i])
+			v, err := parseConfigValue(line[i+1:])
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", source, lineNo, err)
+			}
+			value = v
+		} else if i := strings.IndexAny(line, "#;"); i >= 0 {
+			key = strings.TrimSpace(line[:i])
+		}
+
+		entries = append(entries, &configEntry{
+			name:   section + "." + strings.ToLower(key),
+			value:  value,
+			source: source,
+		})
+	}
+	return entries, scan.Err()
+}
+
+func parseConfigSection(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '"'); i >= 0 {
+		sub := strings.TrimSpace(s[i:])
+		if len(sub) < 2 || sub[len(sub)-1] != '"' {
+			return "", ErrConfigSyntax
+		}
+		sub = strings.Replace(strings.Replace(sub[1:len(sub)-1], `\"`, `"`, -1), `\\`, `\`, -1)
+		return strings.ToLower(strings.TrimSpace(s[:i])) + "." + sub, nil
+	}
+	// deprecated [section.subsection] syntax
+	return strings.ToLower(s), nil
+}
+
+func parseConfigValue(s string) (string, error) {
+	var (
+		buf     bytes.Buffer
+		quoted  bool
+		pending int // whitespace not yet known to be inside the value
+	)
+	s = strings.TrimLeft(s, " \t")
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case !quoted && (c == '#' || c == ';'):
+			buf.Truncate(buf.Len() - pending)
+			return buf.String(), nil
+		case c == '\\':
+			i++
+			if i >= len(s) {
+				return "", ErrConfigSyntax
+			}
+			switch s[i] {
+			case 'n':
+				buf.WriteByte('\n')
+			case 't':
+				buf.WriteByte('\t')
+			case 'b':
+				if buf.Len() > 0 {
+					buf.Truncate(buf.Len() - 1)
+				}
+			case '"', '\\':
+				buf.WriteByte(s[i])
+			default:
+				return "", ErrConfigSyntax
+			}
+			pending = 0
+			continue
+		default:
+			buf.WriteByte(c)
+		}
+		if !quoted && (c == ' ' || c == '\t') {
+			pending++
+		} else {
+			pending = 0
+		}
+	}
+	if quoted {
+		return "", ErrConfigSyntax
+	}
+	buf.Truncate(buf.Len() - pending)
+	return buf.String(), nil
+}
+
+func canonicalConfigName(name string) string {
+	first := strings.IndexByte(name, '.')
+	last := strings.LastIndexByte(name, '.')
+	if first < 0 {
+		return strings.ToLower(name)
+	}
+	return strings.ToLower(name[:first]) + name[first:last] + strings.ToLower(name[last:])
+}
+
+// Get returns the last value of a variable like "user.name" or
+// "remote.origin.url".
+func (c *Config) Get(name string) (string, bool) {
+	name = canonicalConfigName(name)
+	for i := len(c.entries) - 1; i >= 0; i-- {
+		if c.entries[i].name == name {
+			return c.entries[i].value, true
+		}
+	}
+	return "", false
+}
+
+// GetAll returns all values of a multi-valued variable, in order.
+func (c *Config) GetAll(name string) []string {
+	name = canonicalConfigName(name)
+	var values []string
+	for _, e := range c.entries {
+		if e.name == name {
+			values = append(values, e.value)
+		}
+	}
+	return values
+}
+
+// Bool returns a boolean variable, or def if it is not set or invalid.
+func (c *Config) Bool(name string, def bool) bool {
+	v, ok := c.Get(name)
+	if !ok {
+		return def
+	}
+	switch strings.ToLower(v) {
+	case "true", "yes", "on", "1":
+		return true
+	case "false", "no", "off", "0", "":
+		return false
+	}
+	return def
+}
+
+// Int returns an integer variable, which may have a k, m or g suffix, or
+// def if it is not set or invalid.
+func (c *Config) Int(name string, def int64) int64 {
+	v, ok := c.Get(name)
+	if !ok || v == "" {
+		return def
+	}
+	mult := int64(1)
+	switch v[len(v)-1] {
+	case 'k', 'K':
+		mult = 1 << 10
+	case 'm', 'M':
+		mult = 1 << 20
+	case 'g', 'G':
+		mult = 1 << 30
+	}
+	if mult != 1 {
+		v = v[:len(v)-1]
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return def
+	}
+	return n * mult
+}
+
+// Set adds a value for a variable, overriding earlier ones. It only
+// changes the in-memory config.
+func (c *Config) Set(name, value string) {
+	c.entries = append(c.entries, &configEntry{name: canonicalConfigName(name), value: value})
+}
+
+// Config returns the configuration of the repository: the system, global
+// and repository config files merged, in increasing precedence.
+//
+// As in git, GIT_CONFIG_NOSYSTEM, GIT_CONFIG_SYSTEM and GIT_CONFIG_GLOBAL
+// select the system and global files, and variables given with
+// GIT_CONFIG_COUNT, GIT_CONFIG_KEY_<n> and GIT_CONFIG_VALUE_<n> override
+// all files.
+func (repo *Repository) Config() (*Config, error) {
+	return readConfig(repo.Path, true)
+}
+
+// GlobalConfig returns the system and global configuration, without any
+// repository config.
+func GlobalConfig() (*Config, error) {
+	return readConfig("", false)
+}
+
+func readConfig(gitDir string, withRepo bool) (*Config, error) {
+	c := new(Config)
+
+	var files []string
+	if !envBool("GIT_CONFIG_NOSYSTEM") {
+		system := os.Getenv("GIT_CONFIG_SYSTEM")
+		if system == "" {
+			system = "/etc/gitconfig"
+		}
+		files = append(files, system)
+	}
+	if global := os.Getenv("GIT_CONFIG_GLOBAL"); global != "" {
+		files = append(files, global)
+	} else {
+		if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+			files = append(files, filepath.Join(xdg, "git", "config"))
+		} else if home, err := os.UserHomeDir(); err == nil {
+			files = append(files, filepath.Join(home, ".config", "git", "config"))
+		}
+		if home, err := os.UserHomeDir(); err == nil {
+			files = append(files, filepath.Join(home, ".gitconfig"))
+		}
+	}
+	if withRepo {
+		files = append(files, filepath.Join(gitDir, "config"))
+	}
+
+	for _, f := range files {
+		if f == os.DevNull {
+			continue
+		}
+		if err := c.readFile(f, gitDir, 0); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	if err := c.readEnv(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Read config variables from GIT_CONFIG_COUNT, GIT_CONFIG_KEY_<n> and
+// GIT_CONFIG_VALUE_<n>.
+func (c *Config) readEnv() error {
+	countStr := os.Getenv("GIT_CONFIG_COUNT")
+	if countStr == "" {
+		return nil
+	}
+	count, err := strconv.Atoi(countStr)
+	if err != nil || count < 0 {
+		return fmt.Errorf("bogus GIT_CONFIG_COUNT %q", countStr)
+	}
+	for i := 0; i < count; i++ {
+		key := os.Getenv("GIT_CONFIG_KEY_" + strconv.Itoa(i))
+		if key == "" {
+			return fmt.Errorf("missing config key GIT_CONFIG_KEY_%d", i)
+		}
+		value, ok := os.LookupEnv("GIT_CONFIG_VALUE_" + strconv.Itoa(i))
+		if !ok {
+			return fmt.Errorf("missing config value GIT_CONFIG_VALUE_%d", i)
+		}
+		c.entries = append(c.entries, &configEntry{
+			name:   canonicalConfigName(key),
+			value:  value,
+			source: "environment",
+		})
+	}
+	return nil
+}
+
+// Whether a boolean environment variable is set to a true value.
+func envBool(name string) bool {
+	switch strings.ToLower(os.Getenv(name)) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package git
+
+// A MissingObject is an object that is referenced but not in the
+// repository.
+type MissingObject struct {
+	Id   ObjectID
+	Type ObjectType
+	// The commit or tree referencing the object.
+	ReferencedBy ObjectID
+}
+
+// CheckConnectivity walks the history of the given commits, with all
+// trees and blobs, and returns the objects that are missing, like git
+// fsck --connectivity-only does. An empty result means the history is
+// complete, e.g. once all stages of an import arrived. Submodule commits
+// aren't followed.
+func (repo *Repository) CheckConnectivity(tips ...ObjectID) ([]MissingObject, error) {
+	var missing []MissingObject
+	seen := make(map[ObjectID]bool)
+	have := func(obj MissingObject) (bool, error) {
+		if seen[obj.Id] {
+			return false, nil
+		}
+		seen[obj.Id] = true
+		found, _, err := repo.haveObject(obj.Id)
+		if err != nil {
+			return false, err
+		}
+		if !found {
+			missing = append(missing, obj)
+		}
+		return found, nil
+	}
+
+	var commits, trees []MissingObject
+	for _, id := range tips {
+		commits = append(commits, MissingObject{Id: id, Type: ObjectCommit})
+	}
+	for len(commits) > 0 || len(trees) > 0 {
+		if n := len(trees); n > 0 {
+			obj := trees[n-1]
+			trees = trees[:n-1]
+			if ok, err := have(obj); err != nil {
+				return nil, err
+			} else if !ok {
+				continue
+			}
+			scanner, err := NewTree(repo, obj.Id).Scanner()
+			if err != nil {
+				return nil, err
+			}
+			for scanner.Scan() {
+				te := scanner.TreeEntry()
+				ref := MissingObject{Id: te.Id, Type: te.Type, ReferencedBy: obj.Id}
+				switch te.Type {
+				case ObjectTree:
+					trees = append(trees, ref)
+				case ObjectBlob:
+					if _, err := have(ref); err != nil {
+						return nil, err
+					}
+				}
+			}
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		obj := commits[len(commits)-1]
+		commits = commits[:len(commits)-1]
+		if ok, err := have(obj); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+		commit, err := repo.getCommit(obj.Id)
+		if err != nil {
+			return nil, err
+		}
+		trees = append(trees, MissingObject{Id: commit.Tree.Id, Type: ObjectTree, ReferencedBy: obj.Id})
+		for _, p := range commit.parents {
+			commits = append(commits, MissingObject{Id: p, Type: ObjectCommit, ReferencedBy: obj.Id})
+		}
+	}
+	return missing, nil
+}
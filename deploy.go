@@ -0,0 +1,284 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrCurrentBranch is returned when a push would update the branch
+	// checked out in a non-bare repository, and receive.denyCurrentBranch
+	// refuses it.
+	ErrCurrentBranch = errors.New("refusing to update the checked out branch")
+	// ErrNonFastForward is returned when a push would drop commits from a
+	// ref, and receive.denyNonFastForwards refuses it.
+	ErrNonFastForward = errors.New("refusing non-fast-forward update")
+)
+
+// A DirtyWorkTreeError lists the files of the working tree or the index
+// that differ from HEAD, or that aren't tracked and would be overwritten.
+type DirtyWorkTreeError struct {
+	Paths []string
+}
+
+func (e *DirtyWorkTreeError) Error() string {
+	return "working tree has changes in " + strings.Join(e.Paths, ", ")
+}
+
+// A DeployHook updates the working tree for a push to the checked out
+// branch, like git's push-to-checkout hook, instead of the check out done
+// for receive.denyCurrentBranch=updateInstead. It's called before the ref
+// is updated, with a zero old id if the branch has no commits yet; an error
+// refuses the push.
+type DeployHook func(ref string, old, new ObjectID) error
+
+// SetDeployHook sets the hook ReceiveRef calls for pushes to the checked
+// out branch when receive.denyCurrentBranch is updateInstead.
+func (repo *Repository) SetDeployHook(hook DeployHook) {
+	repo.deployHook = hook
+}
+
+// ReceiveRef points the ref name at id like a push does, or deletes it if
+// id is zero. Updating the branch checked out in a non-bare repository
+// depends on receive.denyCurrentBranch: "refuse", the default, fails with
+// ErrCurrentBranch; "ignore" and "warn" only update the ref; and
+// "updateInstead" also checks out the new commit, if the working tree and
+// the index have no changes, or calls the DeployHook if one is set. This
+// makes push-to-deploy targets possible. Like git, the checked out branch
+// can't be deleted. With receive.denyNonFastForwards set, updates that
+// drop commits fail with ErrNonFastForward. If an AccessControl is set, it
+// must let the principal of ctx update the ref. The ref is only updated if
+// it's still at the id these checks saw, otherwise a *RefChangedError is
+// returned.
+func (repo *Repository) ReceiveRef(ctx context.Context, name string, id ObjectID) error {
+	ref, _, err := repo.lookupRef(name)
+	if err != nil {
+		return err
+	}
+	old := ref.Id
+	if err := repo.checkWriteAccess(ctx, name, old, id); err != nil {
+		return err
+	}
+	settings := repo.settings()
+	if settings.DenyNonFastForwards && !id.IsZero() {
+		if err := repo.checkFastForward(old, id); err != nil {
+			return err
+		}
+	}
+	target, err := repo.headTarget()
+	if err != nil {
+		return err
+	}
+	if repo.WorkTree == "" || name != target {
+		return repo.receiveUpdate(name, id, old)
+	}
+	if id.IsZero() {
+		// receive.denyDeleteCurrent
+		return ErrCurrentBranch
+	}
+
+	switch settings.DenyCurrentBranch {
+	case "ignore", "false", "no", "off", "0":
+		return repo.receiveUpdate(name, id, old)
+	case "warn":
+		repo.log().Warn("updating the checked out branch", "ref", name)
+		return repo.receiveUpdate(name, id, old)
+	case "updateinstead":
+		return repo.updateInstead(ctx, name, id, old)
+	}
+	return ErrCurrentBranch
+}
+
+// Point the ref name at id, or delete it if id is zero, if it's still at
+// old.
+func (repo *Repository) receiveUpdate(name string, id, old ObjectID) error {
+	if !id.IsZero() {
+		return repo.UpdateRef(name, id, old)
+	}
+	if old.IsZero() {
+		return ErrNotExist
+	}
+	tx := repo.NewRefTransaction()
+	tx.Delete(name, old)
+	return tx.Commit()
+}
+
+// Check that old, the id of a ref, is an ancestor of id, if it's a commit.
+func (repo *Repository) checkFastForward(old, id ObjectID) error {
+	if old.IsZero() {
+		return nil
+	}
+	old, tp, err := repo.peel(old)
+	if err != nil || tp != ObjectCommit {
+		return err
+	}
+	tip, tp, err := repo.peel(id)
+	if err != nil {
+		return err
+	}
+	if tp != ObjectCommit {
+		return ErrNonFastForward
+	}
+	if ok, err := repo.isAncestor(old, tip); err != nil {
+		return err
+	} else if !ok {
+		return ErrNonFastForward
+	}
+	return nil
+}
+
+// Check out id and point the checked out branch name at it, if it's still
+// at old.
+func (repo *Repository) updateInstead(ctx context.Context, name string, id, old ObjectID) error {
+	if repo.deployHook != nil {
+		if err := repo.deployHook(name, old, id); err != nil {
+			return err
+		}
+		return repo.UpdateRef(name, id, old)
+	}
+
+	var oldFiles map[string]treeFile
+	if !old.IsZero() {
+		commit, err := repo.getCommit(old)
+		if err != nil {
+			return err
+		}
+		if oldFiles, err = repo.flattenTree(&commit.Tree); err != nil {
+			return err
+		}
+	}
+	commit, err := repo.getCommit(id)
+	if err != nil {
+		return err
+	}
+	newFiles, err := repo.flattenTree(&commit.Tree)
+	if err != nil {
+		return err
+	}
+	if err := repo.checkCheckout(newFiles, CheckoutOptions{}); err != nil {
+		return err
+	}
+	dirty, err := repo.dirtyFiles(oldFiles, newFiles)
+	if err != nil {
+		return err
+	}
+	if len(dirty) > 0 {
+		return &DirtyWorkTreeError{dirty}
+	}
+
+	if repo.dryRun != nil {
+		repo.recordCheckout(newFiles, oldFiles)
+		return repo.UpdateRef(name, id, old)
+	}
+	if repo.snapshot != nil {
+		return ErrReadOnlySnapshot
+	}
+	// the branch is updated first, HEAD keeps pointing at it; a concurrent
+	// update makes the push fail before the working tree is touched
+	if err := repo.UpdateRef(name, id, old); err != nil {
+		return err
+	}
+	return repo.switchFiles(ctx, newFiles, oldFiles, CheckoutOptions{})
+}
+
+// Return the files of the working tree or the index that differ from the
+// tracked files, and the untracked ones that the new files would overwrite.
+func (repo *Repository) dirtyFiles(tracked, newFiles map[string]treeFile) ([]string, error) {
+	entries, err := repo.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	var dirty []string
+	// staged changes
+	staged := make(map[string]bool)
+	inIndex := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		inIndex[e.Path] = true
+		f, ok := tracked[e.Path]
+		if !ok || e.Stage != 0 || !e.Id.Equal(f.id) || e.Mode != f.mode {
+			staged[e.Path] = true
+		}
+	}
+	for p := range tracked {
+		if !inIndex[p] {
+			staged[p] = true
+		}
+	}
+	for p := range staged {
+		dirty = append(dirty, p)
+	}
+
+	for p, f := range tracked {
+		if staged[p] {
+			continue
+		}
+		if f.mode == ModeCommit {
+			continue
+		}
+		same, err := repo.workTreeFileIs(p, f)
+		if err != nil {
+			return nil, err
+		}
+		if !same {
+			dirty = append(dirty, p)
+		}
+	}
+	for p := range newFiles {
+		if _, ok := tracked[p]; ok || staged[p] {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(repo.WorkTree, filepath.FromSlash(p))); err == nil {
+			dirty = append(dirty, p)
+		}
+	}
+	sort.Strings(dirty)
+	return dirty, nil
+}
+
+// Whether the file at p in the working tree has the content and type of f.
+func (repo *Repository) workTreeFileIs(p string, f treeFile) (bool, error) {
+	fpath := filepath.Join(repo.WorkTree, filepath.FromSlash(p))
+	fi, err := os.Lstat(fpath)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	var id ObjectID
+	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		if f.mode != ModeSymlink {
+			return false, nil
+		}
+		target, err := os.Readlink(fpath)
+		if err != nil {
+			return false, err
+		}
+		id, err = HashObject("blob", strings.NewReader(target))
+		if err != nil {
+			return false, err
+		}
+	case fi.Mode().IsRegular():
+		// without symlink support, symlinks are checked out as files
+		if f.mode == ModeBlob && fi.Mode()&0100 != 0 || f.mode == ModeExec && fi.Mode()&0100 == 0 {
+			return false, nil
+		}
+		file, err := os.Open(fpath)
+		if err != nil {
+			return false, err
+		}
+		id, err = HashObject("blob", file)
+		file.Close()
+		if err != nil {
+			return false, err
+		}
+	default:
+		return false, nil
+	}
+	return id.Equal(f.id), nil
+}
@@ -0,0 +1,108 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// An AccessControl letting everyone update refs, calling onWrite first.
+type testAccess struct {
+	onWrite func(ref string, old, new ObjectID)
+}
+
+func (a testAccess) CanRead(principal, ref string) bool { return true }
+
+func (a testAccess) CanWrite(principal, ref string, old, new ObjectID) bool {
+	a.onWrite(ref, old, new)
+	return true
+}
+
+func appendConfig(t *testing.T, repo *Repository, config string) {
+	t.Helper()
+	f, err := os.OpenFile(filepath.Join(repo.Path, "config"), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(config); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReceiveRefDelete(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	other := refId(t, repo, "refs/heads/main-bad")
+	var seen []ObjectID
+	repo.SetAccessControl(testAccess{func(ref string, old, new ObjectID) {
+		seen = append(seen, old, new)
+	}})
+
+	if err := repo.ReceiveRef(context.Background(), "refs/heads/main-bad", ObjectID{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.ResolveRef("refs/heads/main-bad"); err != ErrNotExist {
+		t.Errorf("main-bad wasn't deleted: %v", err)
+	}
+	if len(seen) != 2 || !seen[0].Equal(other) || !seen[1].IsZero() {
+		t.Errorf("AccessControl asked about %v", seen)
+	}
+	if err := repo.ReceiveRef(context.Background(), "refs/heads/main-bad", ObjectID{}); err != ErrNotExist {
+		t.Errorf("deleting a missing ref: expected ErrNotExist, got %v", err)
+	}
+}
+
+func TestReceiveRefConcurrentUpdate(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	master := refId(t, repo, "refs/heads/master")
+	other := refId(t, repo, "refs/heads/main-bad")
+	// another push gets in after the checks
+	repo.SetAccessControl(testAccess{func(ref string, old, new ObjectID) {
+		if err := repo.UpdateRef(ref, other, old); err != nil {
+			t.Fatal(err)
+		}
+	}})
+
+	_, ok := repo.ReceiveRef(context.Background(), "refs/heads/independent-branch", master).(*RefChangedError)
+	if !ok {
+		t.Error("update made after a concurrent one")
+	}
+	if id := refId(t, repo, "refs/heads/independent-branch"); !id.Equal(other) {
+		t.Errorf("concurrent update lost, ref at %s", id)
+	}
+}
+
+func TestReceiveRefDeployHook(t *testing.T) {
+	repo := openTestWorkTree(t)
+	appendConfig(t, repo, "[receive]\n\tdenyCurrentBranch = updateInstead\n")
+	master := refId(t, repo, "refs/heads/master")
+	other := refId(t, repo, "refs/heads/main-bad")
+
+	calls := 0
+	repo.SetDeployHook(func(ref string, old, new ObjectID) error {
+		calls++
+		if ref != "refs/heads/master" || !old.Equal(master) || !new.Equal(other) {
+			t.Errorf("hook called for %s from %s to %s", ref, old, new)
+		}
+		// the deployment takes long enough for another push to get in
+		return repo.UpdateRef(ref, new, old)
+	})
+	if _, ok := repo.ReceiveRef(context.Background(), "refs/heads/master", other).(*RefChangedError); !ok {
+		t.Error("update made after a concurrent one")
+	}
+	if calls != 1 {
+		t.Errorf("hook called %d times", calls)
+	}
+
+	repo.SetDeployHook(func(ref string, old, new ObjectID) error { return nil })
+	if err := repo.ReceiveRef(context.Background(), "refs/heads/master", master); err != nil {
+		t.Fatal(err)
+	}
+	if id := refId(t, repo, "refs/heads/master"); !id.Equal(master) {
+		t.Errorf("master is at %s, expected %s", id, master)
+	}
+	if err := repo.ReceiveRef(context.Background(), "refs/heads/master", ObjectID{}); err != ErrCurrentBranch {
+		t.Errorf("deleting the checked out branch: expected ErrCurrentBranch, got %v", err)
+	}
+}
@@ -0,0 +1,228 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultContextLines is the number of unchanged lines shown around
+// changes, like git diff -U3.
+const DefaultContextLines = 3
+
+type DiffLineType int
+
+const (
+	DiffLineContext DiffLineType = iota
+	DiffLineAdd
+	DiffLineDelete
+)
+
+// A DiffLine is one line of a hunk. OldLine and NewLine are 1-based line
+// numbers, 0 on the side the line doesn't exist on.
+type DiffLine struct {
+	Type    DiffLineType
+	Content string // without the line ending
+	OldLine int
+	NewLine int
+	// The line is the last of its file and has no line ending.
+	NoNewline bool
+}
+
+// A Hunk is a group of changed lines with their context, like a "@@" block
+// of a unified diff.
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Lines              []*DiffLine
+}
+
+// Header returns the "@@ -a,b +c,d @@" line of the hunk.
+func (h *Hunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+}
+
+func hunkRange(start, lines int) string {
+	if lines == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// A FilePatch is the change of one file. OldPath is empty for added files,
+// NewPath for deleted ones.
+type FilePatch struct {
+	Status           FileStatus
+	OldPath, NewPath string
+	// For renamed and copied files, how similar the old and new content
+	// are, in percent.
+	Similarity       int
+	OldMode, NewMode EntryMode
+	OldId, NewId     ObjectID
+	// Binary files have no hunks.
+	Binary bool
+	Hunks  []*Hunk
+
+	// the ids of the index line of a parsed patch, maybe abbreviated
+	oldIndex, newIndex string
+}
+
+// Path returns the path of the file, the new one unless it was deleted.
+func (fp *FilePatch) Path() string {
+	if fp.NewPath != "" {
+		return fp.NewPath
+	}
+	return fp.OldPath
+}
+
+// DiffTrees returns the patches turning from into to. A nil tree is
+// treated as empty.
+func DiffTrees(from, to *Tree, contextLines int) ([]*FilePatch, error) {
+	changes, err := diffTrees(from, to)
+	if err != nil {
+		return nil, err
+	}
+	var repo *Repository
+	if to != nil {
+		repo = to.repo
+	} else if from != nil {
+		repo = from.repo
+	}
+
+	patches := make([]*FilePatch, 0, len(changes))
+	for _, change := range changes {
+		fp, err := repo.filePatch(change, contextLines)
+		if err != nil {
+			return nil, err
+		}
+		patches = append(patches, fp)
+	}
+	return patches, nil
+}
+
+// Patches returns the changes of the commit against its first parent.
+func (c *Commit) Patches() ([]*FilePatch, error) {
+	ptree, err := firstParentTree(c)
+	if err != nil {
+		return nil, err
+	}
+	return DiffTrees(ptree, &c.Tree, DefaultContextLines)
+}
+
+func (repo *Repository) filePatch(change *treeChange, contextLines int) (*FilePatch, error) {
+	fp := &FilePatch{Status: change.status(), Similarity: change.similarity}
+	if change.from != nil {
+		fp.OldPath, fp.OldMode, fp.OldId = change.path, change.from.mode, change.from.Id
+		if change.oldPath != "" {
+			fp.OldPath = change.oldPath
+		}
+	}
+	if change.to != nil {
+		fp.NewPath, fp.NewMode, fp.NewId = change.path, change.to.mode, change.to.Id
+	}
+
+	from, err := repo.patchData(change.from)
+	if err != nil {
+		return nil, err
+	}
+	to, err := repo.patchData(change.to)
+	if err != nil {
+		return nil, err
+	}
+	if isBinaryData(from) || isBinaryData(to) {
+		fp.Binary = true
+		return fp, nil
+	}
+
+	a, b := splitLines(from), splitLines(to)
+	fp.Hunks = makeHunks(a, b, diffLines(a, b), contextLines)
+	return fp, nil
+}
+
+// Content of one side of a change as shown in a patch. Submodules are
+// shown as their commit id, like git does.
+func (repo *Repository) patchData(te *TreeEntry) ([]byte, error) {
+	if te != nil && te.mode == ModeCommit {
+		return []byte("Subproject commit " + te.Id.String() + "\n"), nil
+	}
+	return repo.readEntryData(te)
+}
+
+// Group an edit script into hunks with contextLines of unchanged lines
+// around the changes. Hunks whose context would overlap are merged.
+func makeHunks(a, b []string, ops []lineOp, contextLines int) []*Hunk {
+	var hunks []*Hunk
+	i := 0
+	for i < len(ops) {
+		for i < len(ops) && ops[i].typ == lineEqual {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		start := i - contextLines
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for {
+			for end < len(ops) && ops[end].typ != lineEqual {
+				end++
+			}
+			next := end
+			for next < len(ops) && ops[next].typ == lineEqual {
+				next++
+			}
+			if next == len(ops) || next-end > 2*contextLines {
+				if end+contextLines < next {
+					next = end + contextLines
+				}
+				end = next
+				break
+			}
+			end = next
+		}
+
+		hunks = append(hunks, makeHunk(a, b, ops[start:end]))
+		i = end
+	}
+	return hunks
+}
+
+func makeHunk(a, b []string, ops []lineOp) *Hunk {
+	h := &Hunk{Lines: make([]*DiffLine, 0, len(ops))}
+	for _, op := range ops {
+		var line *DiffLine
+		switch op.typ {
+		case lineEqual:
+			line = newDiffLine(DiffLineContext, a[op.a])
+			line.OldLine, line.NewLine = op.a+1, op.b+1
+			h.OldLines++
+			h.NewLines++
+		case lineDelete:
+			line = newDiffLine(DiffLineDelete, a[op.a])
+			line.OldLine = op.a + 1
+			h.OldLines++
+		case lineInsert:
+			line = newDiffLine(DiffLineAdd, b[op.b])
+			line.NewLine = op.b + 1
+			h.NewLines++
+		}
+		h.Lines = append(h.Lines, line)
+	}
+
+	// an empty side starts at the line before the hunk
+	h.OldStart, h.NewStart = ops[0].a, ops[0].b
+	if h.OldLines > 0 {
+		h.OldStart++
+	}
+	if h.NewLines > 0 {
+		h.NewStart++
+	}
+	return h
+}
+
+func newDiffLine(typ DiffLineType, raw string) *DiffLine {
+	content := strings.TrimSuffix(raw, "\n")
+	return &DiffLine{Type: typ, Content: content, NoNewline: content == raw}
+}
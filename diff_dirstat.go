@@ -0,0 +1,140 @@
+package git
+
+import (
+	"sort"
+	"strings"
+)
+
+// What DirStat counts for each file.
+type DirStatMode int
+
+const (
+	// Added and deleted lines. Binary files don't count.
+	DirStatLines DirStatMode = iota
+	// Changed files, each counting the same.
+	DirStatFiles
+)
+
+// DefaultDirStatLimit is the percentage of the changes a directory needs
+// to be reported, like git diff --dirstat.
+const DefaultDirStatLimit = 3.0
+
+type DirStatOptions struct {
+	Mode DirStatMode
+	// Directories with a smaller percentage of the changes are left out.
+	// Zero means DefaultDirStatLimit.
+	Limit float64
+	// Count the changes of reported directories for their parents too.
+	// Otherwise a parent only counts changes not reported below it.
+	Cumulative bool
+}
+
+// A DirStat is the share of the changes of a diff in a directory.
+type DirStat struct {
+	// The directory, with a trailing slash.
+	Dir     string  `json:"dir"`
+	Percent float64 `json:"percent"`
+}
+
+// DirStat sums up the changes by directory, like git diff --dirstat.
+// Directories are listed after their subdirectories. Files at the top are
+// counted for the total but not reported.
+func (ds *DiffStat) DirStat(opts DirStatOptions) []*DirStat {
+	if opts.Limit == 0 {
+		opts.Limit = DefaultDirStatLimit
+	}
+	files := make([]*FileStat, 0, len(ds.Files))
+	total := 0
+	for _, fs := range ds.Files {
+		if n := fs.dirStatDamage(opts.Mode); n > 0 {
+			files = append(files, fs)
+			total += n
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	g := &dirStatGatherer{files: files, total: total, opts: opts}
+	g.gather("")
+	return g.stats
+}
+
+func (fs *FileStat) dirStatDamage(mode DirStatMode) int {
+	if mode == DirStatFiles {
+		return 1
+	}
+	return fs.Added + fs.Deleted
+}
+
+type dirStatGatherer struct {
+	files []*FileStat
+	total int
+	opts  DirStatOptions
+	stats []*DirStat
+}
+
+// Sum up the files below base, which are next in the list, and report
+// base if its share is big enough. Returns what base adds to its parent.
+func (g *dirStatGatherer) gather(base string) int {
+	sum := 0
+	for len(g.files) > 0 && strings.HasPrefix(g.files[0].Path, base) {
+		rest := g.files[0].Path[len(base):]
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			sum += g.gather(base + rest[:i+1])
+			continue
+		}
+		sum += g.files[0].dirStatDamage(g.opts.Mode)
+		g.files = g.files[1:]
+	}
+
+	if base == "" || sum == 0 {
+		return sum
+	}
+	// compare in permille like git, so the rounded percentage decides
+	permille := sum * 1000 / g.total
+	if float64(permille) >= g.opts.Limit*10 {
+		g.stats = append(g.stats, &DirStat{Dir: base, Percent: float64(permille) / 10})
+		if !g.opts.Cumulative {
+			return 0
+		}
+	}
+	return sum
+}
+
+// DirStat sums up the changes of the commit against its first parent by
+// directory.
+func (c *Commit) DirStat(opts DirStatOptions) ([]*DirStat, error) {
+	ds, err := c.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return ds.DirStat(opts), nil
+}
+
+// StatRange returns the stat of the changes between the commits named by
+// revisions a and b, like git diff --numstat a b.
+func (repo *Repository) StatRange(a, b string) (*DiffStat, error) {
+	from, err := repo.resolveRevision(a)
+	if err != nil {
+		return nil, err
+	}
+	to, err := repo.resolveRevision(b)
+	if err != nil {
+		return nil, err
+	}
+	fromCommit, err := repo.getCommit(from)
+	if err != nil {
+		return nil, err
+	}
+	toCommit, err := repo.getCommit(to)
+	if err != nil {
+		return nil, err
+	}
+	patches, err := DiffTrees(&fromCommit.Tree, &toCommit.Tree, DefaultContextLines)
+	if err != nil {
+		return nil, err
+	}
+	return StatPatches(patches), nil
+}
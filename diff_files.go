@@ -0,0 +1,79 @@
+package git
+
+// How a file was changed, with the letters of git diff --name-status.
+type FileStatus string
+
+const (
+	FileAdded    FileStatus = "A"
+	FileModified FileStatus = "M"
+	FileDeleted  FileStatus = "D"
+	// A file became a symlink or submodule or the other way round.
+	FileTypeChanged FileStatus = "T"
+	FileRenamed     FileStatus = "R"
+	FileCopied      FileStatus = "C"
+)
+
+// A ChangedFile is a path changed between two trees, without the changes
+// of its content. The old side is zero for added files, the new one for
+// deleted files.
+type ChangedFile struct {
+	Path    string     `json:"path"`
+	Status  FileStatus `json:"status"`
+	OldMode EntryMode  `json:"old_mode,omitempty"`
+	NewMode EntryMode  `json:"new_mode,omitempty"`
+	OldId   ObjectID   `json:"old_id"`
+	NewId   ObjectID   `json:"new_id"`
+}
+
+// ChangedFiles returns the files the commit changed compared to its first
+// parent, like git diff --name-status. Only trees are read: subtrees that
+// are the same on both sides are skipped, and blobs aren't read at all.
+func (c *Commit) ChangedFiles() ([]ChangedFile, error) {
+	ptree, err := firstParentTree(c)
+	if err != nil {
+		return nil, err
+	}
+	return changedFiles(ptree, &c.Tree)
+}
+
+// ChangedFilesInRange returns the files that differ between the commits
+// named by revisions a and b, like git diff --name-status a b. Use the
+// merge base as a for the changes of a branch, like a...b.
+func (repo *Repository) ChangedFilesInRange(a, b string) ([]ChangedFile, error) {
+	from, err := repo.resolveRevision(a)
+	if err != nil {
+		return nil, err
+	}
+	to, err := repo.resolveRevision(b)
+	if err != nil {
+		return nil, err
+	}
+	fromCommit, err := repo.getCommit(from)
+	if err != nil {
+		return nil, err
+	}
+	toCommit, err := repo.getCommit(to)
+	if err != nil {
+		return nil, err
+	}
+	return changedFiles(&fromCommit.Tree, &toCommit.Tree)
+}
+
+func changedFiles(from, to *Tree) ([]ChangedFile, error) {
+	changes, err := diffTrees(from, to)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]ChangedFile, len(changes))
+	for i, change := range changes {
+		f := ChangedFile{Path: change.path, Status: change.status()}
+		if change.from != nil {
+			f.OldMode, f.OldId = change.from.mode, change.from.Id
+		}
+		if change.to != nil {
+			f.NewMode, f.NewId = change.to.mode, change.to.Id
+		}
+		files[i] = f
+	}
+	return files, nil
+}
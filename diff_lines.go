@@ -0,0 +1,160 @@
+package git
+
+import (
+	"bytes"
+)
+
+type lineOpType int
+
+const (
+	lineEqual lineOpType = iota
+	lineDelete
+	lineInsert
+)
+
+// A lineOp is one step of an edit script turning a into b. a and b are the
+// line indexes in the old and the new text; for inserts a is the position
+// in the old text before which the line is inserted, and likewise for
+// deletes.
+type lineOp struct {
+	typ  lineOpType
+	a, b int
+}
+
+// Split data into lines, keeping the line endings.
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := make([]string, 0, bytes.Count(data, []byte{'\n'})+1)
+	for len(data) > 0 {
+		eol := bytes.IndexByte(data, '\n')
+		if eol < 0 {
+			lines = append(lines, string(data))
+			break
+		}
+		lines = append(lines, string(data[:eol+1]))
+		data = data[eol+1:]
+	}
+	return lines
+}
+
+// diffLines computes a shortest edit script from a to b using the Myers
+// O(ND) algorithm.
+func diffLines(a, b []string) []lineOp {
+	// map lines to ints so that comparisons are cheap
+	ids := make(map[string]int, len(a)+len(b))
+	ai := make([]int, len(a))
+	bi := make([]int, len(b))
+	for i, l := range a {
+		id, ok := ids[l]
+		if !ok {
+			id = len(ids)
+			ids[l] = id
+		}
+		ai[i] = id
+	}
+	for i, l := range b {
+		id, ok := ids[l]
+		if !ok {
+			id = len(ids)
+			ids[l] = id
+		}
+		bi[i] = id
+	}
+
+	// strip common prefix and suffix, they are cheap to detect and
+	// make the quadratic part smaller
+	pre := 0
+	for pre < len(ai) && pre < len(bi) && ai[pre] == bi[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(ai)-pre && suf < len(bi)-pre && ai[len(ai)-1-suf] == bi[len(bi)-1-suf] {
+		suf++
+	}
+
+	ops := make([]lineOp, 0, len(a)+len(b))
+	for i := 0; i < pre; i++ {
+		ops = append(ops, lineOp{lineEqual, i, i})
+	}
+	ops = append(ops, myers(ai[pre:len(ai)-suf], bi[pre:len(bi)-suf], pre, pre)...)
+	for i := 0; i < suf; i++ {
+		ops = append(ops, lineOp{lineEqual, len(a) - suf + i, len(b) - suf + i})
+	}
+	return ops
+}
+
+func myers(a, b []int, aoff, boff int) []lineOp {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+
+	v := make([]int, 2*max+2)
+	var trace [][]int
+
+	var d int
+search:
+	for d = 0; d <= max; d++ {
+		vc := make([]int, len(v))
+		copy(vc, v)
+		trace = append(trace, vc)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[max+k-1] < v[max+k+1]) {
+				x = v[max+k+1]
+			} else {
+				x = v[max+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[max+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// backtrack
+	ops := make([]lineOp, 0, n+m)
+	x, y := n, m
+	for ; d > 0; d-- {
+		vd := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && vd[max+k-1] < vd[max+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := vd[max+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, lineOp{lineEqual, aoff + x, boff + y})
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, lineOp{lineInsert, aoff + x, boff + y})
+		} else {
+			x--
+			ops = append(ops, lineOp{lineDelete, aoff + x, boff + y})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		ops = append(ops, lineOp{lineEqual, aoff + x, boff + y})
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
@@ -0,0 +1,362 @@
+package git
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PatchesToParent returns the changes of the commit compared to its nth
+// parent, counting from 0. For a merge, Patches is the same as
+// PatchesToParent(0): the changes the merge brought into the branch.
+func (c *Commit) PatchesToParent(n int) ([]*FilePatch, error) {
+	p, err := c.Parent(n)
+	if err != nil {
+		return nil, err
+	}
+	return DiffTrees(&p.Tree, &c.Tree, DefaultContextLines)
+}
+
+// PatchesPerParent returns the changes of the commit compared to each of
+// its parents, in order, like git log -m. Root commits have none.
+func (c *Commit) PatchesPerParent() ([][]*FilePatch, error) {
+	patches := make([][]*FilePatch, c.ParentCount())
+	for i := range patches {
+		var err error
+		if patches[i], err = c.PatchesToParent(i); err != nil {
+			return nil, err
+		}
+	}
+	return patches, nil
+}
+
+// A CombinedLine is a line of a combined diff. Markers has a column per
+// parent: '+' if the line was added compared to that parent, '-' if it was
+// removed from it, ' ' if it's the same.
+type CombinedLine struct {
+	Markers string
+	Content string // without the line ending
+	// 1-based line numbers in each parent, 0 where the line doesn't exist
+	OldLines []int
+	// The line number in the merge, 0 for removed lines.
+	NewLine   int
+	NoNewline bool
+}
+
+// A CombinedHunk is a group of lines of a combined diff, like a "@@@"
+// block of git diff --cc.
+type CombinedHunk struct {
+	OldStarts, OldLines []int
+	NewStart, NewLines  int
+	Lines               []*CombinedLine
+}
+
+// Header returns the "@@@ -a,b -c,d +e,f @@@" line of the hunk, with an @
+// more than there are parents.
+func (h *CombinedHunk) Header() string {
+	at := strings.Repeat("@", len(h.OldStarts)+1)
+	parts := []string{at}
+	for i := range h.OldStarts {
+		parts = append(parts, fmt.Sprintf("-%d,%d", h.OldStarts[i], h.OldLines[i]))
+	}
+	parts = append(parts, fmt.Sprintf("+%d,%d", h.NewStart, h.NewLines), at)
+	return strings.Join(parts, " ")
+}
+
+// A CombinedFilePatch is the combined diff of a file of a merge against all
+// parents. NewMode and NewId are zero if the merge deleted the file.
+type CombinedFilePatch struct {
+	Path     string
+	OldModes []EntryMode
+	OldIds   []ObjectID
+	NewMode  EntryMode
+	NewId    ObjectID
+	Binary   bool
+	Hunks    []*CombinedHunk
+}
+
+// CombinedPatches returns the combined diff of a merge, like git diff --cc:
+// only files that differ from every parent, and of them only the hunks
+// where the merge differs from every parent, i.e. where the merge didn't
+// just take the side of one parent. Root commits have none.
+func (c *Commit) CombinedPatches() ([]*CombinedFilePatch, error) {
+	n := c.ParentCount()
+	if n == 0 {
+		return nil, nil
+	}
+
+	changed := make([]map[string]*treeChange, n)
+	for i := range changed {
+		p, err := c.Parent(i)
+		if err != nil {
+			return nil, err
+		}
+		changes, err := diffTrees(&p.Tree, &c.Tree)
+		if err != nil {
+			return nil, err
+		}
+		changed[i] = make(map[string]*treeChange, len(changes))
+		for _, change := range changes {
+			changed[i][change.path] = change
+		}
+	}
+
+	var paths []string
+	for p := range changed[0] {
+		inAll := true
+		for _, m := range changed[1:] {
+			if _, ok := m[p]; !ok {
+				inAll = false
+				break
+			}
+		}
+		if inAll {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	var patches []*CombinedFilePatch
+	for _, p := range paths {
+		fp, err := c.repo.combinedFilePatch(p, changed, DefaultContextLines)
+		if err != nil {
+			return nil, err
+		}
+		if fp != nil {
+			patches = append(patches, fp)
+		}
+	}
+	return patches, nil
+}
+
+// Make the combined patch of a path, nil if no hunk is interesting.
+func (repo *Repository) combinedFilePatch(p string, changed []map[string]*treeChange, contextLines int) (*CombinedFilePatch, error) {
+	n := len(changed)
+	fp := &CombinedFilePatch{Path: p, OldModes: make([]EntryMode, n), OldIds: make([]ObjectID, n)}
+	to := changed[0][p].to
+	if to != nil {
+		fp.NewMode, fp.NewId = to.mode, to.Id
+	}
+	result, err := repo.patchData(to)
+	if err != nil {
+		return nil, err
+	}
+	binary := isBinaryData(result)
+
+	parents := make([][]string, n)
+	for i, m := range changed {
+		from := m[p].from
+		if from != nil {
+			fp.OldModes[i], fp.OldIds[i] = from.mode, from.Id
+		}
+		data, err := repo.patchData(from)
+		if err != nil {
+			return nil, err
+		}
+		binary = binary || isBinaryData(data)
+		parents[i] = splitLines(data)
+	}
+	if binary {
+		fp.Binary = true
+		return fp, nil
+	}
+
+	lines := combineLines(parents, splitLines(result))
+	fp.Hunks = makeCombinedHunks(lines, n, contextLines)
+	if len(fp.Hunks) == 0 {
+		return nil, nil
+	}
+	return fp, nil
+}
+
+// Merge the diffs of each parent against the result into a list of lines
+// with a marker column per parent. Lines removed from several parents at
+// the same place are shown once.
+func combineLines(parents [][]string, result []string) []*CombinedLine {
+	n := len(parents)
+	markers := make([][]byte, len(result))
+	resultLines := make([]*CombinedLine, len(result))
+	for k, raw := range result {
+		markers[k] = []byte(strings.Repeat("+", n))
+		resultLines[k] = newCombinedLine(raw, n)
+		resultLines[k].NewLine = k + 1
+	}
+	// lines removed from a parent, by the result line they come before
+	lost := make([][]*CombinedLine, len(result)+1)
+	lostMarkers := make([][][]byte, len(result)+1)
+
+	for i, parent := range parents {
+		var removed []*CombinedLine
+		at := -1
+		flush := func() {
+			if len(removed) > 0 {
+				lost[at], lostMarkers[at] = coalesceLost(lost[at], lostMarkers[at], removed, i, n)
+				removed = nil
+			}
+		}
+		for _, op := range diffLines(parent, result) {
+			switch op.typ {
+			case lineEqual:
+				markers[op.b][i] = ' '
+				resultLines[op.b].OldLines[i] = op.a + 1
+			case lineDelete:
+				if op.b != at {
+					flush()
+					at = op.b
+				}
+				line := newCombinedLine(parent[op.a], n)
+				line.OldLines[i] = op.a + 1
+				removed = append(removed, line)
+			}
+		}
+		flush()
+	}
+
+	var lines []*CombinedLine
+	for k := 0; k <= len(result); k++ {
+		for j, line := range lost[k] {
+			line.Markers = string(lostMarkers[k][j])
+			lines = append(lines, line)
+		}
+		if k < len(result) {
+			resultLines[k].Markers = string(markers[k])
+			lines = append(lines, resultLines[k])
+		}
+	}
+	return lines
+}
+
+func newCombinedLine(raw string, parents int) *CombinedLine {
+	content := strings.TrimSuffix(raw, "\n")
+	return &CombinedLine{Content: content, NoNewline: content == raw, OldLines: make([]int, parents)}
+}
+
+// Add the lines removed from parent i at one place to the ones removed
+// from earlier parents there. The longest common subsequence of both is
+// shown once; other lines of parent i come after the earlier parents'
+// lines between two common ones, like git orders them.
+func coalesceLost(lines []*CombinedLine, markers [][]byte, removed []*CombinedLine, i, n int) ([]*CombinedLine, [][]byte) {
+	same := func(a, b int) bool {
+		return markers[a][i] == ' ' && lines[a].Content == removed[b].Content && lines[a].NoNewline == removed[b].NoNewline
+	}
+	// lcs[a][b] is the length of the LCS of lines[a:] and removed[b:]
+	lcs := make([][]int, len(lines)+1)
+	for a := range lcs {
+		lcs[a] = make([]int, len(removed)+1)
+	}
+	for a := len(lines) - 1; a >= 0; a-- {
+		for b := len(removed) - 1; b >= 0; b-- {
+			switch {
+			case same(a, b):
+				lcs[a][b] = lcs[a+1][b+1] + 1
+			case lcs[a+1][b] >= lcs[a][b+1]:
+				lcs[a][b] = lcs[a+1][b]
+			default:
+				lcs[a][b] = lcs[a][b+1]
+			}
+		}
+	}
+
+	var outLines []*CombinedLine
+	var outMarkers [][]byte
+	a, b := 0, 0
+	for a < len(lines) || b < len(removed) {
+		switch {
+		case a < len(lines) && b < len(removed) && same(a, b):
+			markers[a][i] = '-'
+			lines[a].OldLines[i] = removed[b].OldLines[i]
+			outLines, outMarkers = append(outLines, lines[a]), append(outMarkers, markers[a])
+			a++
+			b++
+		case a < len(lines) && (b == len(removed) || lcs[a+1][b] >= lcs[a][b+1]):
+			outLines, outMarkers = append(outLines, lines[a]), append(outMarkers, markers[a])
+			a++
+		default:
+			m := []byte(strings.Repeat(" ", n))
+			m[i] = '-'
+			outLines, outMarkers = append(outLines, removed[b]), append(outMarkers, m)
+			b++
+		}
+	}
+	return outLines, outMarkers
+}
+
+// Group the lines into hunks around the interesting changes: runs of
+// changed lines that differ from every parent.
+func makeCombinedHunks(lines []*CombinedLine, n, contextLines int) []*CombinedHunk {
+	changed := func(l *CombinedLine) bool { return strings.Trim(l.Markers, " ") != "" }
+
+	var runs [][2]int
+	for i := 0; i < len(lines); {
+		if !changed(lines[i]) {
+			i++
+			continue
+		}
+		start := i
+		touched := make([]bool, n)
+		for ; i < len(lines) && changed(lines[i]); i++ {
+			for p, m := range lines[i].Markers {
+				if m != ' ' {
+					touched[p] = true
+				}
+			}
+		}
+		interesting := true
+		for _, t := range touched {
+			interesting = interesting && t
+		}
+		if interesting {
+			runs = append(runs, [2]int{start, i})
+		}
+	}
+
+	var hunks []*CombinedHunk
+	for r := 0; r < len(runs); {
+		start, end := runs[r][0]-contextLines, runs[r][1]
+		for r++; r < len(runs) && runs[r][0]-end <= 2*contextLines; r++ {
+			end = runs[r][1]
+		}
+		if start < 0 {
+			start = 0
+		}
+		if end += contextLines; end > len(lines) {
+			end = len(lines)
+		}
+		hunks = append(hunks, makeCombinedHunk(lines, start, end, n))
+	}
+	return hunks
+}
+
+func makeCombinedHunk(lines []*CombinedLine, start, end, n int) *CombinedHunk {
+	h := &CombinedHunk{OldStarts: make([]int, n), OldLines: make([]int, n), Lines: lines[start:end]}
+	// an empty side starts at the line before the hunk
+	for _, l := range lines[:start] {
+		for i, ln := range l.OldLines {
+			if ln > 0 {
+				h.OldStarts[i] = ln
+			}
+		}
+		if l.NewLine > 0 {
+			h.NewStart = l.NewLine
+		}
+	}
+	for i := range h.OldStarts {
+		for _, l := range h.Lines {
+			if l.OldLines[i] > 0 {
+				if h.OldLines[i] == 0 {
+					h.OldStarts[i] = l.OldLines[i]
+				}
+				h.OldLines[i]++
+			}
+		}
+	}
+	for _, l := range h.Lines {
+		if l.NewLine > 0 {
+			if h.NewLines == 0 {
+				h.NewStart = l.NewLine
+			}
+			h.NewLines++
+		}
+	}
+	return h
+}
@@ -0,0 +1,78 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Raw returns the change in the format of git diff --raw, like
+// ":100644 100644 1a2b3c4 5d6e7f8 M\tpath". The ids are abbreviated to
+// abbrev hex digits, or written in full if abbrev is 0. Paths with special
+// characters are quoted like git does.
+func (f ChangedFile) Raw(abbrev int) string {
+	if abbrev <= 0 {
+		abbrev = -1
+	}
+	return fmt.Sprintf(":%06o %06o %s %s %s\t%s", f.OldMode, f.NewMode,
+		f.OldId.Short(abbrev), f.NewId.Short(abbrev), f.Status, quotePath(f.Path))
+}
+
+// WriteRawDiff writes the changed files to w in the format of git diff
+// --raw, which git whatchanged and git log --raw also use, one line per
+// file. See ChangedFile.Raw.
+func WriteRawDiff(w io.Writer, files []ChangedFile, abbrev int) error {
+	for _, f := range files {
+		if _, err := io.WriteString(w, f.Raw(abbrev)+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Quote p like git does with core.quotePath set if it has control
+// characters, quotes, backslashes or non-ASCII bytes.
+func quotePath(p string) string {
+	needsQuotes := false
+	for i := 0; i < len(p); i++ {
+		if c := p[i]; c < 0x20 || c == '"' || c == '\\' || c >= 0x7f {
+			needsQuotes = true
+			break
+		}
+	}
+	if !needsQuotes {
+		return p
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; c {
+		case '\a':
+			buf.WriteString(`\a`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\v':
+			buf.WriteString(`\v`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		default:
+			if c < 0x20 || c >= 0x7f {
+				fmt.Fprintf(&buf, `\%03o`, c)
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
@@ -0,0 +1,259 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultRenameThreshold is the similarity, in percent, above which a
+// deleted and an added file are a rename, like git diff -M50%.
+const DefaultRenameThreshold = 50
+
+// Above this many deleted or added files, only renames of files with
+// unchanged content are found, like git's diff.renameLimit.
+const renameLimit = 1000
+
+// RenameOptions configure the detection of renamed and copied files.
+type RenameOptions struct {
+	// The similarity in percent above which files are paired,
+	// DefaultRenameThreshold if 0.
+	Threshold int
+	// Also find added files that are copies of modified or deleted ones,
+	// like git diff -C.
+	Copies bool
+}
+
+// ParseRenameThreshold parses a similarity as given to git diff -M: a
+// percentage like "75%", or the digits of a fraction, "75" being 0.75.
+func ParseRenameThreshold(s string) (int, error) {
+	if strings.HasSuffix(s, "%") {
+		n, err := strconv.Atoi(strings.TrimSuffix(s, "%"))
+		if err != nil || n < 0 || n > 100 {
+			return 0, fmt.Errorf("invalid similarity %q", s)
+		}
+		return n, nil
+	}
+	if s == "" || strings.Trim(s, "0123456789") != "" {
+		return 0, fmt.Errorf("invalid similarity %q", s)
+	}
+	f, err := strconv.ParseFloat("0."+s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid similarity %q", s)
+	}
+	return int(f * 100), nil
+}
+
+// DiffTo returns the patches turning the commit into other, with renamed
+// files detected like git diff -M. A nil other is treated as an empty
+// tree.
+func (c *Commit) DiffTo(other *Commit) ([]*FilePatch, error) {
+	var to *Tree
+	if other != nil {
+		to = &other.Tree
+	}
+	return DiffTreesWithRenames(&c.Tree, to, DefaultContextLines, RenameOptions{})
+}
+
+// DiffTreesWithRenames is DiffTrees, with deleted and added files with
+// similar contents paired as renames, and with opts.Copies, added files
+// similar to modified or deleted ones marked as copies.
+func DiffTreesWithRenames(from, to *Tree, contextLines int, opts RenameOptions) ([]*FilePatch, error) {
+	changes, err := diffTrees(from, to)
+	if err != nil {
+		return nil, err
+	}
+	var repo *Repository
+	if to != nil {
+		repo = to.repo
+	} else if from != nil {
+		repo = from.repo
+	}
+	if changes, err = repo.detectRenames(changes, opts); err != nil {
+		return nil, err
+	}
+
+	patches := make([]*FilePatch, 0, len(changes))
+	for _, change := range changes {
+		fp, err := repo.filePatch(change, contextLines)
+		if err != nil {
+			return nil, err
+		}
+		patches = append(patches, fp)
+	}
+	return patches, nil
+}
+
+// Pair deleted and added files of changes into renames: files with the
+// same content first, then the most similar ones. With opts.Copies, added
+// files left over are paired with modified or deleted files as copies. The
+// result is sorted by path, renames and copies at their new path.
+func (repo *Repository) detectRenames(changes []*treeChange, opts RenameOptions) ([]*treeChange, error) {
+	threshold := opts.Threshold
+	if threshold == 0 {
+		threshold = DefaultRenameThreshold
+	}
+	var deleted, modified, added []*treeChange
+	for _, c := range changes {
+		switch {
+		case c.to == nil && c.from.Type == ObjectBlob:
+			deleted = append(deleted, c)
+		case c.from == nil && c.to.Type == ObjectBlob:
+			added = append(added, c)
+		case c.from != nil && c.to != nil && c.from.Type == ObjectBlob:
+			modified = append(modified, c)
+		}
+	}
+	if len(added) == 0 || len(deleted) == 0 && !opts.Copies {
+		return changes, nil
+	}
+
+	m := &renameMatcher{
+		repo:      repo,
+		threshold: threshold,
+		paired:    make(map[*treeChange]*treeChange),
+		used:      make(map[*treeChange]bool),
+		data:      make(map[*TreeEntry][]byte),
+	}
+	if err := m.match(deleted, added, false); err != nil {
+		return nil, err
+	}
+	if opts.Copies {
+		if err := m.match(append(modified, deleted...), added, true); err != nil {
+			return nil, err
+		}
+	}
+	if len(m.paired) == 0 {
+		return changes, nil
+	}
+
+	result := make([]*treeChange, 0, len(changes))
+	for _, c := range changes {
+		if r, ok := m.paired[c]; ok {
+			result = append(result, r)
+		} else if !m.used[c] {
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
+
+// Pairs sources and destinations of renames or copies.
+type renameMatcher struct {
+	repo      *Repository
+	threshold int
+	// the rename or copy replacing an added file
+	paired map[*treeChange]*treeChange
+	// files paired already, as a source of a rename or a destination
+	used map[*treeChange]bool
+	data map[*TreeEntry][]byte
+}
+
+// Pair the added files that aren't paired yet with sources. Sources of
+// copies can be used several times.
+func (m *renameMatcher) match(sources, added []*treeChange, copies bool) error {
+	free := func(src *treeChange) bool {
+		return copies || !m.used[src]
+	}
+	pair := func(src, dst *treeChange, score int) {
+		m.paired[dst] = &treeChange{path: dst.path, oldPath: src.path, from: src.from, to: dst.to, similarity: score, copy: copies}
+		m.used[dst] = true
+		if !copies {
+			m.used[src] = true
+		}
+	}
+
+	for _, dst := range added {
+		if m.used[dst] {
+			continue
+		}
+		for _, src := range sources {
+			if free(src) && src.from.Id.Equal(dst.to.Id) && sameFileType(src.from, dst.to) {
+				pair(src, dst, 100)
+				break
+			}
+		}
+	}
+	if len(sources) > renameLimit || len(added) > renameLimit {
+		return nil
+	}
+
+	type candidate struct {
+		src, dst *treeChange
+		score    int
+	}
+	var candidates []candidate
+	for _, dst := range added {
+		if m.used[dst] {
+			continue
+		}
+		for _, src := range sources {
+			if !free(src) || !sameFileType(src.from, dst.to) {
+				continue
+			}
+			a, err := m.read(src.from)
+			if err != nil {
+				return err
+			}
+			b, err := m.read(dst.to)
+			if err != nil {
+				return err
+			}
+			if score := similarity(a, b); score >= m.threshold {
+				candidates = append(candidates, candidate{src, dst, score})
+			}
+		}
+	}
+	// the best matches win, ties go to the first paths
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+	for _, c := range candidates {
+		if free(c.src) && !m.used[c.dst] {
+			pair(c.src, c.dst, c.score)
+		}
+	}
+	return nil
+}
+
+func (m *renameMatcher) read(te *TreeEntry) ([]byte, error) {
+	if data, ok := m.data[te]; ok {
+		return data, nil
+	}
+	data, err := m.repo.readEntryData(te)
+	m.data[te] = data
+	return data, err
+}
+
+func sameFileType(a, b *TreeEntry) bool {
+	return a.mode&0170000 == b.mode&0170000
+}
+
+// Return how similar two files are in percent: the share of the bytes of
+// the larger one that are lines both have, like git's similarity index.
+func similarity(a, b []byte) int {
+	max := len(a)
+	if len(b) > max {
+		max = len(b)
+	}
+	if max == 0 {
+		return 100
+	}
+	if isBinaryData(a) || isBinaryData(b) {
+		return 0
+	}
+	counts := make(map[string]int)
+	for _, line := range bytes.SplitAfter(a, []byte("\n")) {
+		counts[string(line)]++
+	}
+	common := 0
+	for _, line := range bytes.SplitAfter(b, []byte("\n")) {
+		if counts[string(line)] > 0 {
+			counts[string(line)]--
+			common += len(line)
+		}
+	}
+	return common * 100 / max
+}
@@ -0,0 +1,75 @@
+package git
+
+type DiffRowType int
+
+const (
+	DiffRowHunkHeader DiffRowType = iota
+	DiffRowContext
+	DiffRowAdd
+	DiffRowDelete
+	// The file is binary, Content says so.
+	DiffRowBinary
+)
+
+// A Token is a piece of a line with a highlighting class, e.g. "keyword"
+// or "string". The empty class means plain text.
+type Token struct {
+	Class string
+	Text  string
+}
+
+// A Highlighter splits a line of the file at path into tokens. The tokens
+// must concatenate to the line.
+type Highlighter func(path, line string) []Token
+
+// A DiffRow is one row of a rendered file patch, ready to be turned into
+// HTML. OldLine and NewLine are 0 on the side the row doesn't exist on.
+type DiffRow struct {
+	Type    DiffRowType
+	OldLine int
+	NewLine int
+	Content string
+	// Set if the renderer has a Highlighter.
+	Tokens    []Token
+	NoNewline bool
+}
+
+// A DiffRenderer turns file patches into rows for web UIs.
+type DiffRenderer struct {
+	// Optional syntax highlighting of context, added and deleted lines.
+	Highlight Highlighter
+}
+
+// Render returns the rows of a file patch: a header row for each hunk,
+// followed by its lines.
+func (r *DiffRenderer) Render(fp *FilePatch) []*DiffRow {
+	if fp.Binary {
+		return []*DiffRow{{Type: DiffRowBinary, Content: "Binary files differ"}}
+	}
+
+	var rows []*DiffRow
+	for _, h := range fp.Hunks {
+		rows = append(rows, &DiffRow{Type: DiffRowHunkHeader, Content: h.Header()})
+		for _, l := range h.Lines {
+			row := &DiffRow{
+				OldLine:   l.OldLine,
+				NewLine:   l.NewLine,
+				Content:   l.Content,
+				NoNewline: l.NoNewline,
+			}
+			switch l.Type {
+			case DiffLineContext:
+				row.Type = DiffRowContext
+			case DiffLineAdd:
+				row.Type = DiffRowAdd
+			case DiffLineDelete:
+				row.Type = DiffRowDelete
+			}
+			if r.Highlight != nil {
+				row.Tokens = r.Highlight(fp.Path(), l.Content)
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
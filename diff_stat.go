@@ -0,0 +1,59 @@
+package git
+
+// A FileStat is the number of added and deleted lines of a file, like a
+// line of git diff --numstat.
+type FileStat struct {
+	Path    string `json:"path"`
+	Added   int    `json:"added"`
+	Deleted int    `json:"deleted"`
+	Binary  bool   `json:"binary"`
+}
+
+// A DiffStat sums up the changes of a set of file patches.
+type DiffStat struct {
+	// The commit the stat is for, if any.
+	Commit  ObjectID    `json:"commit"`
+	Files   []*FileStat `json:"files"`
+	Added   int         `json:"added"`
+	Deleted int         `json:"deleted"`
+}
+
+// Stat counts the added and deleted lines of the patch.
+func (fp *FilePatch) Stat() *FileStat {
+	fs := &FileStat{Path: fp.Path(), Binary: fp.Binary}
+	for _, h := range fp.Hunks {
+		for _, l := range h.Lines {
+			switch l.Type {
+			case DiffLineAdd:
+				fs.Added++
+			case DiffLineDelete:
+				fs.Deleted++
+			}
+		}
+	}
+	return fs
+}
+
+// StatPatches returns the stat of a set of patches.
+func StatPatches(patches []*FilePatch) *DiffStat {
+	ds := &DiffStat{Files: make([]*FileStat, 0, len(patches))}
+	for _, fp := range patches {
+		fs := fp.Stat()
+		ds.Files = append(ds.Files, fs)
+		ds.Added += fs.Added
+		ds.Deleted += fs.Deleted
+	}
+	return ds
+}
+
+// Stat returns the stat of the changes of the commit against its first
+// parent.
+func (c *Commit) Stat() (*DiffStat, error) {
+	patches, err := c.Patches()
+	if err != nil {
+		return nil, err
+	}
+	ds := StatPatches(patches)
+	ds.Commit = c.Id
+	return ds, nil
+}
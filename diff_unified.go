@@ -0,0 +1,95 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Unified returns the patch in the format of git diff: a "diff --git"
+// header with the mode, rename and index lines, and the hunks of text
+// files, which git apply can apply. Binary files are only marked as
+// differing. The ids of the index line are abbreviated to abbrev hex
+// digits, or written in full if abbrev is 0.
+func (fp *FilePatch) Unified(abbrev int) string {
+	if abbrev <= 0 {
+		abbrev = -1
+	}
+	oldPath, newPath := fp.OldPath, fp.NewPath
+	if oldPath == "" {
+		oldPath = newPath
+	}
+	if newPath == "" {
+		newPath = oldPath
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "diff --git %s %s\n", quotePath("a/"+oldPath), quotePath("b/"+newPath))
+	switch {
+	case fp.Status == FileAdded:
+		fmt.Fprintf(&buf, "new file mode %06o\n", fp.NewMode)
+	case fp.Status == FileDeleted:
+		fmt.Fprintf(&buf, "deleted file mode %06o\n", fp.OldMode)
+	case fp.OldMode != fp.NewMode:
+		fmt.Fprintf(&buf, "old mode %06o\nnew mode %06o\n", fp.OldMode, fp.NewMode)
+	}
+	switch fp.Status {
+	case FileRenamed:
+		fmt.Fprintf(&buf, "similarity index %d%%\nrename from %s\nrename to %s\n", fp.Similarity, quotePath(oldPath), quotePath(newPath))
+	case FileCopied:
+		fmt.Fprintf(&buf, "similarity index %d%%\ncopy from %s\ncopy to %s\n", fp.Similarity, quotePath(oldPath), quotePath(newPath))
+	}
+	if fp.OldId.Equal(fp.NewId) {
+		return buf.String()
+	}
+	fmt.Fprintf(&buf, "index %s..%s", fp.OldId.Short(abbrev), fp.NewId.Short(abbrev))
+	if fp.OldMode == fp.NewMode {
+		fmt.Fprintf(&buf, " %06o", fp.OldMode)
+	}
+	buf.WriteByte('\n')
+
+	from, to := quotePath("a/"+oldPath), quotePath("b/"+newPath)
+	if fp.Status == FileAdded {
+		from = "/dev/null"
+	}
+	if fp.Status == FileDeleted {
+		to = "/dev/null"
+	}
+	if fp.Binary {
+		fmt.Fprintf(&buf, "Binary files %s and %s differ\n", from, to)
+		return buf.String()
+	}
+	if len(fp.Hunks) == 0 {
+		return buf.String()
+	}
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", from, to)
+	for _, h := range fp.Hunks {
+		buf.WriteString(h.Header() + "\n")
+		for _, l := range h.Lines {
+			switch l.Type {
+			case DiffLineAdd:
+				buf.WriteByte('+')
+			case DiffLineDelete:
+				buf.WriteByte('-')
+			default:
+				buf.WriteByte(' ')
+			}
+			buf.WriteString(l.Content + "\n")
+			if l.NoNewline {
+				buf.WriteString("\\ No newline at end of file\n")
+			}
+		}
+	}
+	return buf.String()
+}
+
+// WriteUnifiedDiff writes the patches to w in the format of git diff, see
+// FilePatch.Unified.
+func WriteUnifiedDiff(w io.Writer, patches []*FilePatch, abbrev int) error {
+	for _, fp := range patches {
+		if _, err := io.WriteString(w, fp.Unified(abbrev)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
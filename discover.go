@@ -0,0 +1,125 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrRepositoryNotFound = errors.New("not a git repository (or any of the parent directories)")
+)
+
+// Discover looks for a repository at start and in its parent directories,
+// like git does when run in a subdirectory of a working tree. It returns
+// the git directory, and the working tree root for non-bare repositories.
+//
+// The search does not go up into directories listed in
+// GIT_CEILING_DIRECTORIES, and stops at filesystem boundaries unless
+// GIT_DISCOVERY_ACROSS_FILESYSTEM is set.
+func Discover(start string) (gitDir, workTree string, err error) {
+	dir, err := filepath.Abs(start)
+	if err != nil {
+		return "", "", err
+	}
+
+	ceilings := ceilingDirectories()
+	acrossFS := envBool("GIT_DISCOVERY_ACROSS_FILESYSTEM")
+	startDev, haveDev := deviceOf(dir)
+
+	for {
+		gitDir, err := dotGitDir(filepath.Join(dir, ".git"))
+		if err != nil {
+			return "", "", err
+		}
+		if gitDir != "" {
+			return gitDir, dir, nil
+		}
+		if isGitDir(dir) {
+			return dir, "", nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", ErrRepositoryNotFound
+		}
+		for _, ceiling := range ceilings {
+			if parent == ceiling {
+				return "", "", ErrRepositoryNotFound
+			}
+		}
+		if haveDev && !acrossFS {
+			if dev, ok := deviceOf(parent); ok && dev != startDev {
+				return "", "", fmt.Errorf("%v (stopping at filesystem boundary %s)", ErrRepositoryNotFound, dir)
+			}
+		}
+		dir = parent
+	}
+}
+
+// If p is a .git directory or a gitfile pointing to one, return the git
+// directory.
+func dotGitDir(p string) (string, error) {
+	fi, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	if fi.IsDir() {
+		if isGitDir(p) {
+			return p, nil
+		}
+		return "", nil
+	}
+
+	// a gitfile, as used for submodules and linked worktrees
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return "", err
+	}
+	line := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(line, "gitdir: ") {
+		return "", fmt.Errorf("invalid gitfile format: %s", p)
+	}
+	dir := strings.TrimPrefix(line, "gitdir: ")
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(filepath.Dir(p), dir)
+	}
+	if !isGitDir(dir) {
+		return "", fmt.Errorf("not a git repository: %s", dir)
+	}
+	return dir, nil
+}
+
+// Whether dir looks like a git directory.
+func isGitDir(dir string) bool {
+	if !isFile(filepath.Join(dir, "HEAD")) {
+		return false
+	}
+	for _, sub := range []string{"objects", "refs"} {
+		fi, err := os.Stat(filepath.Join(dir, sub))
+		if err != nil || !fi.IsDir() {
+			return false
+		}
+	}
+	return true
+}
+
+func ceilingDirectories() []string {
+	var dirs []string
+	for _, dir := range filepath.SplitList(os.Getenv("GIT_CEILING_DIRECTORIES")) {
+		if dir == "" || !filepath.IsAbs(dir) {
+			continue
+		}
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = resolved
+		}
+		dirs = append(dirs, filepath.Clean(dir))
+	}
+	return dirs
+}
@@ -0,0 +1,9 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package git
+
+// Filesystem boundaries are not detected on this platform.
+func deviceOf(path string) (uint64, bool) {
+	return 0, false
+}
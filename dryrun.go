@@ -0,0 +1,156 @@
+package git
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// Kinds of changes recorded by a dry run.
+const (
+	ChangeWriteObject = "write-object"
+	ChangeCreateRef   = "create-ref"
+	ChangeUpdateRef   = "update-ref"
+	ChangeDeleteRef   = "delete-ref"
+	ChangeWriteFile   = "write-file"
+	ChangeDeleteFile  = "delete-file"
+)
+
+// A Change is a modification of the repository made by a mutating
+// operation on a dry run view.
+type Change struct {
+	Op string
+	// The ref name or the path relative to the repository.
+	Name string
+	// Old and new value of a ref, or the id of a written object in New.
+	Old, New ObjectID
+}
+
+type dryRunState struct {
+	mu      sync.Mutex
+	objects map[ObjectID]memObject
+	refs    map[string]dryRunRef
+	changes []Change
+}
+
+// A ref updated in a dry run: symbolic if target is set.
+type dryRunRef struct {
+	target  string
+	id      ObjectID
+	deleted bool
+}
+
+type memObject struct {
+	typ  ObjectType
+	data []byte
+}
+
+// DryRun returns a view of the repository in which mutating operations
+// (ref updates, PackRefs, creating commits, merges, history rewrites and
+// anything else writing objects) don't touch the disk. Objects written
+// and refs updated through the view are kept in memory and can be read
+// back through it, so multi-step operations work as usual; only
+// ForEachRef and the functions listing refs show the refs on disk.
+// Changes returns what the operations would have done.
+func (repo *Repository) DryRun() *Repository {
+	view := *repo
+	view.commitCache = nil
+	view.tagCache = nil
+	view.cacheKeys = nil
+	view.dryRun = &dryRunState{
+		objects: make(map[ObjectID]memObject),
+		refs:    make(map[string]dryRunRef),
+	}
+	return &view
+}
+
+// IsDryRun reports whether the repository is a view returned by DryRun.
+func (repo *Repository) IsDryRun() bool {
+	return repo.dryRun != nil
+}
+
+// Changes returns the changes made through a dry run view, in order. It
+// returns nil for other repositories.
+func (repo *Repository) Changes() []Change {
+	if repo.dryRun == nil {
+		return nil
+	}
+	repo.dryRun.mu.Lock()
+	defer repo.dryRun.mu.Unlock()
+	return append([]Change(nil), repo.dryRun.changes...)
+}
+
+func (repo *Repository) recordChange(c Change) {
+	repo.dryRun.mu.Lock()
+	defer repo.dryRun.mu.Unlock()
+	repo.dryRun.changes = append(repo.dryRun.changes, c)
+	repo.log().Debug("dry run", "op", c.Op, "name", c.Name, "new", c.New.String())
+}
+
+func (repo *Repository) memObject(id ObjectID) (memObject, bool) {
+	if repo.dryRun == nil {
+		return memObject{}, false
+	}
+	repo.dryRun.mu.Lock()
+	defer repo.dryRun.mu.Unlock()
+	obj, ok := repo.dryRun.objects[id]
+	return obj, ok
+}
+
+// Keep an object in memory instead of writing it.
+func (repo *Repository) storeMemObject(objectType ObjectType, r io.ReadSeeker) (ObjectID, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return ObjectID{}, err
+	}
+	id, err := StoreObjectSHA(objectType, ioutil.Discard, bytes.NewReader(data))
+	if err != nil {
+		return ObjectID{}, err
+	}
+	found, _, err := repo.haveObject(id)
+	if err != nil || found {
+		return id, err
+	}
+
+	repo.dryRun.mu.Lock()
+	repo.dryRun.objects[id] = memObject{objectType, data}
+	repo.dryRun.mu.Unlock()
+	repo.recordChange(Change{Op: ChangeWriteObject, Name: objectType.String(), New: id})
+	return id, nil
+}
+
+// Record a ref update, with the current value of the ref as the old one.
+func (repo *Repository) recordRefUpdate(op, name string, id ObjectID) {
+	var old ObjectID
+	if idStr, err := repo.getCommitIdOfRef(name); err == nil {
+		old, _ = NewIdFromString(idStr)
+	}
+	repo.recordChange(Change{Op: op, Name: name, Old: old, New: id})
+	repo.dryRun.mu.Lock()
+	repo.dryRun.refs[name] = dryRunRef{id: id, deleted: op == ChangeDeleteRef}
+	repo.dryRun.mu.Unlock()
+}
+
+// Record an update of HEAD to head, as setHead would write it, with id
+// the commit it points to.
+func (repo *Repository) recordHeadUpdate(head string, id ObjectID) {
+	repo.recordRefUpdate(ChangeUpdateRef, "HEAD", id)
+	if strings.HasPrefix(head, "ref: ") {
+		repo.dryRun.mu.Lock()
+		repo.dryRun.refs["HEAD"] = dryRunRef{target: head[5:]}
+		repo.dryRun.mu.Unlock()
+	}
+}
+
+// Return the ref name as a dry run updated it, if it did.
+func (repo *Repository) dryRunRef(name string) (dryRunRef, bool) {
+	if repo.dryRun == nil {
+		return dryRunRef{}, false
+	}
+	repo.dryRun.mu.Lock()
+	defer repo.dryRun.mu.Unlock()
+	ref, ok := repo.dryRun.refs[name]
+	return ref, ok
+}
@@ -0,0 +1,100 @@
+package git
+
+import (
+	libsha1 "crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// A CacheKey identifies what looking up a path at a revision found: the
+// commit the revision named and the object at the path. Objects never
+// change, so whatever is computed from them can be cached under the key,
+// e.g. as an ETag.
+type CacheKey struct {
+	Commit ObjectID
+	Path   string
+	// The blob, tree or submodule commit at Path, or the tree of the
+	// commit if Path is empty.
+	Object ObjectID
+	Mode   EntryMode
+}
+
+// CacheKeyLimit bounds the number of path lookups CacheKey remembers per
+// repository. When the limit is reached they are all forgotten.
+var CacheKeyLimit = 1 << 16
+
+type pathLookup struct {
+	commit ObjectID
+	path   string
+}
+
+// CacheKey resolves rev to a commit and finds the object at path in it.
+// Lookups are remembered per commit, so asking again after the ref moved
+// only reads the ref; they are forgotten by DropCaches, or once there are
+// CacheKeyLimit of them.
+func (repo *Repository) CacheKey(rev, path string) (CacheKey, error) {
+	id, err := repo.resolveRevision(rev)
+	if err != nil {
+		return CacheKey{}, err
+	}
+	path = strings.Trim(path, "/")
+	lookup := pathLookup{id, path}
+	if key, ok := repo.cacheKeys[lookup]; ok {
+		return key, nil
+	}
+
+	commit, err := repo.getCommit(id)
+	if err != nil {
+		return CacheKey{}, err
+	}
+	key := CacheKey{Commit: id, Path: path, Object: commit.Tree.Id, Mode: ModeTree}
+	if path != "" {
+		entry, err := commit.Tree.GetTreeEntryByPath(path)
+		if err != nil {
+			return CacheKey{}, err
+		}
+		key.Object, key.Mode = entry.Id, entry.EntryMode()
+	}
+
+	if repo.cacheKeys == nil || len(repo.cacheKeys) >= CacheKeyLimit {
+		repo.cacheKeys = make(map[pathLookup]CacheKey)
+	}
+	repo.cacheKeys[lookup] = key
+	return key, nil
+}
+
+// String returns the key as 40 hex digits, which change if the commit, the
+// path or the object does.
+func (k CacheKey) String() string {
+	h := libsha1.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%o", k.Commit, k.Path, k.Object, k.Mode)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ETag returns a strong ETag for a response about the path at the commit,
+// like a page that also shows the commit.
+func (k CacheKey) ETag() string {
+	return `"` + k.String() + `"`
+}
+
+// ContentETag returns a strong ETag for a response made only of the
+// object, like a raw file download. It stays the same across commits
+// that don't change the path.
+func (k CacheKey) ContentETag() string {
+	return fmt.Sprintf(`"%s-%o"`, k.Object, k.Mode)
+}
+
+// ETagMatches reports whether the value of an If-None-Match header matches
+// etag, so that a 304 Not Modified can be sent instead of the response.
+// Like HTTP asks for, weak and strong tags compare equal.
+func ETagMatches(ifNoneMatch, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package git
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fields of a commit that can be exported with WriteCommitsJSON and
+// WriteCommitsCSV.
+const (
+	FieldId             = "id"
+	FieldTree           = "tree"
+	FieldParents        = "parents"
+	FieldAuthorName     = "author_name"
+	FieldAuthorEmail    = "author_email"
+	FieldAuthorDate     = "author_date"
+	FieldCommitterName  = "committer_name"
+	FieldCommitterEmail = "committer_email"
+	FieldCommitterDate  = "committer_date"
+	FieldSummary        = "summary"
+	FieldMessage        = "message"
+	// The diff stat against the first parent. Computing it reads the
+	// changed blobs, so it is not part of the default fields.
+	FieldStat = "stat"
+)
+
+// DefaultCommitFields are exported if no fields are given.
+var DefaultCommitFields = []string{
+	FieldId, FieldParents, FieldAuthorName, FieldAuthorEmail, FieldAuthorDate,
+	FieldCommitterName, FieldCommitterEmail, FieldCommitterDate, FieldSummary,
+}
+
+func commitField(c *Commit, field string) (interface{}, error) {
+	switch field {
+	case FieldId:
+		return c.Id, nil
+	case FieldTree:
+		return c.Tree.Id, nil
+	case FieldParents:
+		parents := make([]ObjectID, len(c.parents))
+		copy(parents, c.parents)
+		return parents, nil
+	case FieldAuthorName:
+		return c.Author.Name, nil
+	case FieldAuthorEmail:
+		return c.Author.Email, nil
+	case FieldAuthorDate:
+		return c.Author.When.Format(time.RFC3339), nil
+	case FieldCommitterName:
+		return c.Committer.Name, nil
+	case FieldCommitterEmail:
+		return c.Committer.Email, nil
+	case FieldCommitterDate:
+		return c.Committer.When.Format(time.RFC3339), nil
+	case FieldSummary:
+		return c.Summary(), nil
+	case FieldMessage:
+		return c.CommitMessage, nil
+	case FieldStat:
+		return c.Stat()
+	}
+	return nil, fmt.Errorf("unknown commit field %q", field)
+}
+
+// WriteCommitsJSON writes the commits as a JSON array of objects with the
+// given fields, in the given order. Ids are hex strings and dates RFC 3339.
+func WriteCommitsJSON(w io.Writer, commits []*Commit, fields []string) error {
+	if len(fields) == 0 {
+		fields = DefaultCommitFields
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("[")
+	for i, c := range commits {
+		if i > 0 {
+			bw.WriteString(",")
+		}
+		bw.WriteString("\n  {")
+		for j, field := range fields {
+			v, err := commitField(c, field)
+			if err != nil {
+				return err
+			}
+			value, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			if j > 0 {
+				bw.WriteString(", ")
+			}
+			bw.WriteString(strconv.Quote(field))
+			bw.WriteString(": ")
+			bw.Write(value)
+		}
+		bw.WriteString("}")
+	}
+	bw.WriteString("\n]\n")
+	return bw.Flush()
+}
+
+// WriteCommitsCSV writes the commits as CSV with a header row of field
+// names. Parents are separated by spaces; the stat field is written as
+// added and deleted line counts, "+a -d".
+func WriteCommitsCSV(w io.Writer, commits []*Commit, fields []string) error {
+	if len(fields) == 0 {
+		fields = DefaultCommitFields
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(fields); err != nil {
+		return err
+	}
+	record := make([]string, len(fields))
+	for _, c := range commits {
+		for i, field := range fields {
+			v, err := commitField(c, field)
+			if err != nil {
+				return err
+			}
+			switch v := v.(type) {
+			case []ObjectID:
+				ids := make([]string, len(v))
+				for j, id := range v {
+					ids[j] = id.String()
+				}
+				record[i] = strings.Join(ids, " ")
+			case *DiffStat:
+				record[i] = fmt.Sprintf("+%d -%d", v.Added, v.Deleted)
+			default:
+				record[i] = fmt.Sprint(v)
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteDiffStatsJSON writes the stats as a JSON array.
+func WriteDiffStatsJSON(w io.Writer, stats []*DiffStat) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(stats)
+}
+
+// WriteDiffStatsCSV writes one row per changed file with the columns
+// commit, path, added, deleted and binary. Binary files have empty line
+// counts.
+func WriteDiffStatsCSV(w io.Writer, stats []*DiffStat) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"commit", "path", "added", "deleted", "binary"}); err != nil {
+		return err
+	}
+	for _, ds := range stats {
+		var commit string
+		if !ds.Commit.IsZero() {
+			commit = ds.Commit.String()
+		}
+		for _, fs := range ds.Files {
+			added, deleted := strconv.Itoa(fs.Added), strconv.Itoa(fs.Deleted)
+			if fs.Binary {
+				added, deleted = "", ""
+			}
+			record := []string{commit, fs.Path, added, deleted, strconv.FormatBool(fs.Binary)}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,110 @@
+package git
+
+import (
+	"strings"
+)
+
+// FsyncComponents are the kinds of files that are flushed to disk before
+// they are put in place, like git's core.fsync, so that they survive a
+// crash of the machine and not only of the process.
+type FsyncComponents uint
+
+const (
+	FsyncLooseObject FsyncComponents = 1 << iota
+	FsyncPack
+	FsyncPackMetadata
+	FsyncCommitGraph
+	FsyncIndex
+	// refs, HEAD and the packed-refs file
+	FsyncReference
+
+	FsyncNone            FsyncComponents = 0
+	FsyncObjects                         = FsyncLooseObject | FsyncPack
+	FsyncDerivedMetadata                 = FsyncPackMetadata | FsyncCommitGraph
+	// what history is made of: objects and refs
+	FsyncCommitted = FsyncObjects | FsyncReference
+	// FsyncCommitted and what git add changes
+	FsyncAdded = FsyncCommitted | FsyncIndex
+	FsyncAll   = FsyncAdded | FsyncDerivedMetadata
+)
+
+// FsyncDefault is what is synced if core.fsync is unset: everything that
+// can't be rebuilt, which is the safe choice on servers. Ephemeral
+// checkouts, like those of CI jobs, can set core.fsync to "none" or use
+// SetFsync(FsyncNone) to skip syncing.
+const FsyncDefault = FsyncAdded
+
+var fsyncComponentNames = map[string]FsyncComponents{
+	"loose-object":     FsyncLooseObject,
+	"pack":             FsyncPack,
+	"pack-metadata":    FsyncPackMetadata,
+	"commit-graph":     FsyncCommitGraph,
+	"index":            FsyncIndex,
+	"reference":        FsyncReference,
+	"objects":          FsyncObjects,
+	"derived-metadata": FsyncDerivedMetadata,
+	"committed":        FsyncCommitted,
+	"added":            FsyncAdded,
+	"all":              FsyncAll,
+}
+
+// ParseFsyncComponents parses a core.fsync value: a comma separated list of
+// component names. Like in git, the list starts from FsyncDefault, names
+// prefixed with "-" are removed from it and the other names added, and
+// "none" drops FsyncDefault. Unknown names are ignored.
+func ParseFsyncComponents(s string) FsyncComponents {
+	c := FsyncDefault
+	var added, removed FsyncComponents
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "none" {
+			c = FsyncNone
+			continue
+		}
+		remove := strings.HasPrefix(name, "-")
+		v, ok := fsyncComponentNames[strings.TrimPrefix(name, "-")]
+		switch {
+		case !ok:
+		case remove:
+			removed |= v
+		default:
+			added |= v
+		}
+	}
+	return c&^removed | added
+}
+
+// SetFsync overrides core.fsync: the repository syncs the given components
+// whatever its config says.
+func (repo *Repository) SetFsync(c FsyncComponents) {
+	repo.fsync = &c
+}
+
+// Return whether files of one of the components are synced.
+func (repo *Repository) fsyncs(c FsyncComponents) bool {
+	if repo.fsync != nil {
+		return *repo.fsync&c != 0
+	}
+	return repo.settings().Fsync&c != 0
+}
+
+// Return whether loose objects are synced one by one as they are written.
+// With core.fsyncMethod=batch, the objects of a TempObjectDir are synced
+// all together when it is migrated instead.
+func (repo *Repository) fsyncLooseObject() bool {
+	if !repo.fsyncs(FsyncLooseObject) {
+		return false
+	}
+	return !repo.batchFsync
+}
+
+// Lock a file of one of the components, synced on commit if that
+// component is.
+func (repo *Repository) lock(path string, c FsyncComponents) (*lockFile, error) {
+	l, err := lockPath(path)
+	if err != nil {
+		return nil, err
+	}
+	l.sync = repo.fsyncs(c)
+	return l, nil
+}
@@ -0,0 +1,32 @@
+package git
+
+import (
+	"testing"
+)
+
+func TestParseFsyncComponents(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected FsyncComponents
+	}{
+		{"", FsyncDefault},
+		{"none", FsyncNone},
+		{"all", FsyncAll},
+		{"committed", FsyncCommitted | FsyncDefault},
+		{"none,pack,index", FsyncPack | FsyncIndex},
+		{"none, Pack-Metadata ,reference", FsyncPackMetadata | FsyncReference},
+		{"-index", FsyncDefault &^ FsyncIndex},
+		{"-index,-pack", FsyncDefault &^ (FsyncIndex | FsyncPack)},
+		// removals only apply to the default, additions win over them
+		{"-loose-object,objects", FsyncDefault},
+		{"all,-loose-object", FsyncAll},
+		{"none,objects,-pack", FsyncObjects},
+		{"none,unknown", FsyncNone},
+		{"pack,none", FsyncPack},
+	}
+	for _, test := range tests {
+		if c := ParseFsyncComponents(test.value); c != test.expected {
+			t.Errorf("%q: expected %b, got %b", test.value, test.expected, c)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoIdentity = errors.New("user.name and user.email are not configured")
+)
+
+// DefaultSignature returns the author signature for new commits, like
+// git var GIT_AUTHOR_IDENT: GIT_AUTHOR_NAME, GIT_AUTHOR_EMAIL and
+// GIT_AUTHOR_DATE override the author.* and user.* config variables.
+func (repo *Repository) DefaultSignature() (*Signature, error) {
+	return repo.identity("AUTHOR", "author")
+}
+
+// DefaultCommitter returns the committer signature for new commits, like
+// git var GIT_COMMITTER_IDENT.
+func (repo *Repository) DefaultCommitter() (*Signature, error) {
+	return repo.identity("COMMITTER", "committer")
+}
+
+func (repo *Repository) identity(env, section string) (*Signature, error) {
+	config, err := repo.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	lookup := func(key string) string {
+		if v := os.Getenv("GIT_" + env + "_" + strings.ToUpper(key)); v != "" {
+			return v
+		}
+		if v, ok := config.Get(section + "." + key); ok && v != "" {
+			return v
+		}
+		v, _ := config.Get("user." + key)
+		return v
+	}
+
+	sig := &Signature{
+		Name:  lookup("name"),
+		Email: lookup("email"),
+		When:  time.Now(),
+	}
+
+	if sig.Email == "" {
+		sig.Email = os.Getenv("EMAIL")
+	}
+	if (sig.Name == "" || sig.Email == "") && !config.Bool("user.useConfigOnly", false) {
+		// like git, fall back to the system's idea of the user
+		if u, err := user.Current(); err == nil {
+			if sig.Name == "" {
+				sig.Name = u.Name
+				if sig.Name == "" {
+					sig.Name = u.Username
+				}
+			}
+			if sig.Email == "" {
+				if host, err := os.Hostname(); err == nil {
+					sig.Email = u.Username + "@" + host
+				}
+			}
+		}
+	}
+	if sig.Name == "" || sig.Email == "" {
+		return nil, ErrNoIdentity
+	}
+
+	if date := os.Getenv("GIT_" + env + "_DATE"); date != "" {
+		when, err := parseGitDate(date)
+		if err != nil {
+			return nil, err
+		}
+		sig.When = when
+	}
+	return sig, nil
+}
+
+// Parse a date as accepted by GIT_AUTHOR_DATE: git's internal format
+// ("<unix seconds> <+hhmm>", optionally prefixed with @), RFC 2822 or
+// ISO 8601.
+func parseGitDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+
+	fields := strings.Fields(strings.TrimPrefix(s, "@"))
+	if len(fields) >= 1 && len(fields) <= 2 {
+		if secs, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+			t := time.Unix(secs, 0)
+			if len(fields) == 2 {
+				loc, err := parseTimezone(fields[1])
+				if err != nil {
+					return time.Time{}, err
+				}
+				t = t.In(loc)
+			}
+			return t, nil
+		}
+	}
+
+	if t, err := mail.ParseDate(s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05 -0700", "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+// Parse a "+hhmm" timezone offset.
+func parseTimezone(tz string) (*time.Location, error) {
+	if len(tz) != 5 || (tz[0] != '+' && tz[0] != '-') {
+		return nil, fmt.Errorf("invalid timezone %q", tz)
+	}
+	hours, err := strconv.Atoi(tz[1:3])
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q", tz)
+	}
+	minutes, err := strconv.Atoi(tz[3:5])
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q", tz)
+	}
+	offset := hours*3600 + minutes*60
+	if tz[0] == '-' {
+		offset = -offset
+	}
+	return time.FixedZone(tz, offset), nil
+}
@@ -0,0 +1,214 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// An IgnoreMatch tells which pattern decided whether a path is ignored,
+// like the output of git check-ignore -v.
+type IgnoreMatch struct {
+	Path string
+	// File the pattern is from, e.g. ".gitignore", "docs/.gitignore" or
+	// "info/exclude" for the repository's exclude file.
+	Source  string
+	Line    int
+	Pattern string
+	// False if the matching pattern is a negated one ("!pattern").
+	Ignored bool
+}
+
+type sourcedPattern struct {
+	*pathPattern
+	source string
+	line   int
+}
+
+// Reads pattern files (.gitignore, .gitattributes) from a tree, or from
+// the working tree if tree is nil, caching them per directory.
+type treePatternReader struct {
+	tree     *Tree
+	workTree string
+	name     string
+	cache    map[string][]string
+}
+
+func newTreePatternReader(t *Tree, name string) *treePatternReader {
+	return &treePatternReader{tree: t, name: name, cache: make(map[string][]string)}
+}
+
+func newWorkTreePatternReader(workTree, name string) *treePatternReader {
+	return &treePatternReader{workTree: workTree, name: name, cache: make(map[string][]string)}
+}
+
+func (r *treePatternReader) lines(dir string) ([]string, error) {
+	if lines, ok := r.cache[dir]; ok {
+		return lines, nil
+	}
+
+	var lines []string
+	if r.tree == nil {
+		data, err := ioutil.ReadFile(filepath.Join(r.workTree, filepath.FromSlash(dir), r.name))
+		if err == nil {
+			lines = patternLines(data)
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		r.cache[dir] = lines
+		return lines, nil
+	}
+	blob, err := r.tree.GetBlobByPath(path.Join(dir, r.name))
+	if err == nil {
+		data, err := r.tree.repo.readBlob(blob.Id)
+		if err != nil {
+			return nil, err
+		}
+		lines = patternLines(data)
+	} else if err != ErrNotExist {
+		return nil, err
+	}
+	r.cache[dir] = lines
+	return lines, nil
+}
+
+// Patterns of a pattern file in a directory, ready to be matched.
+func (r *treePatternReader) patterns(dir string) ([]*sourcedPattern, error) {
+	lines, err := r.lines(dir)
+	if err != nil {
+		return nil, err
+	}
+	return parsePatternLines(lines, dir, path.Join(dir, r.name)), nil
+}
+
+func parsePatternLines(lines []string, base, source string) []*sourcedPattern {
+	var patterns []*sourcedPattern
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+		patterns = append(patterns, &sourcedPattern{
+			pathPattern: parsePathPattern(line, base),
+			source:      source,
+			line:        i + 1,
+		})
+	}
+	return patterns
+}
+
+func (repo *Repository) infoPatterns(name string) ([]*sourcedPattern, error) {
+	data, err := ioutil.ReadFile(filepath.Join(repo.Path, "info", name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return parsePatternLines(patternLines(data), "", "info/"+name), nil
+}
+
+// Return the tree of the commit HEAD points to.
+func (repo *Repository) headTree() (*Tree, error) {
+	id, err := repo.getCommitIdOfRef("HEAD")
+	if err != nil {
+		return nil, repo.unbornError("HEAD", err)
+	}
+	commit, err := repo.GetCommit(id)
+	if err != nil {
+		return nil, err
+	}
+	return &commit.Tree, nil
+}
+
+// CheckIgnore reports for each path whether it is ignored by the .gitignore
+// files of the HEAD commit or the repository's info/exclude file. The
+// result has one entry per path, nil if no pattern matched.
+func (repo *Repository) CheckIgnore(paths []string) ([]*IgnoreMatch, error) {
+	tree, err := repo.headTree()
+	if err != nil {
+		return nil, err
+	}
+	return tree.CheckIgnore(paths)
+}
+
+// CheckIgnore is like Repository.CheckIgnore, with the .gitignore files
+// read from this tree.
+func (t *Tree) CheckIgnore(paths []string) ([]*IgnoreMatch, error) {
+	exclude, err := t.repo.infoPatterns("exclude")
+	if err != nil {
+		return nil, err
+	}
+	reader := newTreePatternReader(t, ".gitignore")
+
+	matches := make([]*IgnoreMatch, len(paths))
+	for i, p := range paths {
+		isDir := strings.HasSuffix(p, "/")
+		p = strings.Trim(path.Clean("/"+p), "/")
+		if !isDir {
+			if te, err := t.GetTreeEntryByPath(p); err == nil {
+				isDir = te.IsDir()
+			}
+		}
+
+		// a path inside an ignored directory is ignored, whatever the
+		// patterns for the path itself say
+		dirs := parentDirs(p)
+		for _, dir := range dirs[1:] {
+			m, err := matchIgnore(reader, exclude, dir, true)
+			if err != nil {
+				return nil, err
+			}
+			if m != nil && m.Ignored {
+				m.Path = p
+				matches[i] = m
+				break
+			}
+		}
+		if matches[i] != nil {
+			continue
+		}
+
+		m, err := matchIgnore(reader, exclude, p, isDir)
+		if err != nil {
+			return nil, err
+		}
+		if m != nil {
+			m.Path = p
+		}
+		matches[i] = m
+	}
+	return matches, nil
+}
+
+// Find the pattern deciding about name. .gitignore files in deeper
+// directories take precedence, then info/exclude; within a file the last
+// matching line wins.
+func matchIgnore(reader *treePatternReader, exclude []*sourcedPattern, name string, isDir bool) (*IgnoreMatch, error) {
+	dirs := parentDirs(name)
+	for i := len(dirs) - 1; i >= 0; i-- {
+		patterns, err := reader.patterns(dirs[i])
+		if err != nil {
+			return nil, err
+		}
+		if m := lastMatch(patterns, name, isDir); m != nil {
+			return m, nil
+		}
+	}
+	return lastMatch(exclude, name, isDir), nil
+}
+
+func lastMatch(patterns []*sourcedPattern, name string, isDir bool) *IgnoreMatch {
+	for i := len(patterns) - 1; i >= 0; i-- {
+		p := patterns[i]
+		if p.match(name, isDir) {
+			return &IgnoreMatch{
+				Source:  p.source,
+				Line:    p.line,
+				Pattern: p.pattern,
+				Ignored: !p.negate,
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package git
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// A SnapshotImporter turns a sequence of snapshots of a project, e.g. its
+// release archives, into a linear history with a commit per snapshot.
+type SnapshotImporter struct {
+	repo *Repository
+	// The last commit, the parent of the next one. Zero until the first
+	// snapshot is imported into a new history.
+	Tip ObjectID
+	// If set, the branch is updated to each new commit.
+	Branch string
+	// Leading path components removed from the paths of the files, like
+	// the "project-1.0/" directory release archives usually contain.
+	// Files with fewer components are left out.
+	StripComponents int
+	// Don't create commits for snapshots that don't change anything.
+	SkipUnchanged bool
+
+	tree ObjectID
+}
+
+// NewSnapshotImporter returns an importer that continues the history at
+// parent, or starts a new one if parent is zero.
+func (repo *Repository) NewSnapshotImporter(parent ObjectID) (*SnapshotImporter, error) {
+	im := &SnapshotImporter{repo: repo, Tip: parent}
+	if !parent.IsZero() {
+		commit, err := repo.getCommit(parent)
+		if err != nil {
+			return nil, err
+		}
+		im.tree = commit.Tree.Id
+	}
+	return im, nil
+}
+
+// ImportDir commits the files below dir. The tree and parents of opts are
+// set by the importer. A .git directory at the top is left out.
+func (im *SnapshotImporter) ImportDir(dir string, opts CommitOptions) (ObjectID, error) {
+	files := make(map[string]treeFile)
+	err := filepath.Walk(dir, func(fpath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, fpath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if fi.IsDir() {
+			if rel == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		p, ok := im.stripPath(rel)
+		if !ok {
+			return nil
+		}
+
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(fpath)
+			if err != nil {
+				return err
+			}
+			return im.addFile(files, p, ModeSymlink, strings.NewReader(filepath.ToSlash(target)))
+		case fi.Mode().IsRegular():
+			f, err := os.Open(fpath)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			mode := ModeBlob
+			if fi.Mode()&0100 != 0 {
+				mode = ModeExec
+			}
+			return im.addFile(files, p, mode, f)
+		}
+		// sockets, devices and the like aren't content
+		return nil
+	})
+	if err != nil {
+		return ObjectID{}, err
+	}
+	return im.commit(files, opts)
+}
+
+// ImportTar commits the files of a tar stream. Compressed archives have to
+// be decompressed by the caller, e.g. with gzip.NewReader. The tree and
+// parents of opts are set by the importer.
+func (im *SnapshotImporter) ImportTar(r io.Reader, opts CommitOptions) (ObjectID, error) {
+	files := make(map[string]treeFile)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return ObjectID{}, err
+		}
+		p, ok := im.stripPath(hdr.Name)
+		if !ok {
+			continue
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return ObjectID{}, err
+			}
+			mode := ModeBlob
+			if hdr.Mode&0100 != 0 {
+				mode = ModeExec
+			}
+			err = im.addFile(files, p, mode, bytes.NewReader(data))
+			if err != nil {
+				return ObjectID{}, err
+			}
+		case tar.TypeSymlink:
+			if err := im.addFile(files, p, ModeSymlink, strings.NewReader(hdr.Linkname)); err != nil {
+				return ObjectID{}, err
+			}
+		case tar.TypeLink:
+			// hard links name a file that came before them
+			target, ok := im.stripPath(hdr.Linkname)
+			if f, found := files[target]; ok && found {
+				files[p] = f
+			}
+		}
+	}
+	return im.commit(files, opts)
+}
+
+// Clean a path of the snapshot and remove the leading components from it.
+func (im *SnapshotImporter) stripPath(p string) (string, bool) {
+	// ".." components are kept to be refused later
+	p = strings.TrimPrefix(path.Clean(p), "/")
+	if p == "." {
+		return "", false
+	}
+	elems := strings.Split(p, "/")
+	if len(elems) <= im.StripComponents {
+		return "", false
+	}
+	return strings.Join(elems[im.StripComponents:], "/"), true
+}
+
+func (im *SnapshotImporter) addFile(files map[string]treeFile, p string, mode EntryMode, r io.ReadSeeker) error {
+	if err := ValidatePath(p); err != nil {
+		return err
+	}
+	id, err := im.repo.StoreObjectLoose(ObjectBlob, r)
+	if err != nil {
+		return err
+	}
+	files[p] = treeFile{mode, id}
+	return nil
+}
+
+// Write the tree of the snapshot and commit it on top of the tip.
+func (im *SnapshotImporter) commit(files map[string]treeFile, opts CommitOptions) (ObjectID, error) {
+	tree, err := im.repo.writeTree(files)
+	if err != nil {
+		return ObjectID{}, err
+	}
+	if im.SkipUnchanged && !im.Tip.IsZero() && tree == im.tree {
+		return im.Tip, nil
+	}
+
+	opts.Tree = tree
+	opts.Parents = nil
+	if !im.Tip.IsZero() {
+		opts.Parents = []ObjectID{im.Tip}
+	}
+	id, err := im.repo.CreateCommit(opts)
+	if err != nil {
+		return ObjectID{}, err
+	}
+	if im.Branch != "" {
+		if err := im.repo.setRef("refs/heads/"+im.Branch, id); err != nil {
+			return ObjectID{}, err
+		}
+	}
+	im.Tip, im.tree = id, tree
+	return id, nil
+}
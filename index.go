@@ -0,0 +1,147 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// An Index is the index file of a repository, the staging area git
+// commits from and compares the working tree to.
+type Index struct {
+	// 2, 3 or 4. Version 3 is needed by entries with SkipWorktree or
+	// IntentToAdd and is used for them when writing a version 2 index;
+	// version 4 compresses the paths.
+	Version uint32
+	// Sorted by path, then stage, when the index is written.
+	Entries []*IndexEntry
+	// The TREE extension: the trees of the directories of the index, nil
+	// if the index has none. Entries must be invalidated for the
+	// directories of changed paths, see InvalidateTree.
+	Tree *IndexTree
+	// The REUC extension: the conflicting versions of resolved paths,
+	// which git checkout -m brings back.
+	ResolveUndo []*ResolveUndo
+	// The index has the sdir extension: sparse directories are entries
+	// with ModeTree.
+	Sparse bool
+}
+
+// An IndexEntry is a file of the index with the stat data git uses to
+// tell whether the file in the working tree changed.
+type IndexEntry struct {
+	Path string
+	Id   ObjectID
+	Mode EntryMode
+	// 0, or 1 to 3 for the base, ours and theirs of a conflicted file
+	Stage        int
+	Ctime, Mtime IndexTime
+	Dev, Ino     uint32
+	Uid, Gid     uint32
+	// the size of the file, truncated to 32 bits
+	Size uint32
+	// Flags: git assumes the file is unchanged, leaves it out of the
+	// working tree, or only knows it will be added (git add -N).
+	AssumeValid, SkipWorktree, IntentToAdd bool
+}
+
+// An IndexTime is a time in the index, in seconds and nanoseconds.
+type IndexTime struct {
+	Sec, Nsec uint32
+}
+
+// Time returns t as a time.Time.
+func (t IndexTime) Time() time.Time {
+	return time.Unix(int64(t.Sec), int64(t.Nsec))
+}
+
+// An IndexTree is a directory of the TREE extension of the index.
+type IndexTree struct {
+	// The name of the directory in its parent, empty for the root.
+	Name string
+	// The number of index entries the tree covers, or -1 if it changed
+	// since the tree was written, in which case Id is zero.
+	Entries  int
+	Id       ObjectID
+	Subtrees []*IndexTree
+}
+
+// InvalidateTree marks the trees of the directories of path as changed.
+func (idx *Index) InvalidateTree(path string) {
+	t := idx.Tree
+	for t != nil {
+		t.Entries, t.Id = -1, ObjectID{}
+		dir, rest := splitFirst(path)
+		if rest == "" {
+			return
+		}
+		var next *IndexTree
+		for _, sub := range t.Subtrees {
+			if sub.Name == dir {
+				next = sub
+			}
+		}
+		t, path = next, rest
+	}
+}
+
+// Split a path into its first component and the rest.
+func splitFirst(path string) (string, string) {
+	for i := 0; i < len(path); i++ {
+		if path[i] == '/' {
+			return path[:i], path[i+1:]
+		}
+	}
+	return path, ""
+}
+
+// A ResolveUndo is a path whose conflict was resolved, with the modes and
+// ids of its stages 1 to 3, zero for missing ones.
+type ResolveUndo struct {
+	Path  string
+	Modes [3]EntryMode
+	Ids   [3]ObjectID
+}
+
+// Entry returns the entry of path at a stage, nil if there is none.
+func (idx *Index) Entry(path string, stage int) *IndexEntry {
+	for _, e := range idx.Entries {
+		if e.Path == path && e.Stage == stage {
+			return e
+		}
+	}
+	return nil
+}
+
+// Index reads the index file of the repository. A repository without one
+// has an empty index.
+func (repo *Repository) Index() (*Index, error) {
+	f, err := os.Open(filepath.Join(repo.Path, "index"))
+	if os.IsNotExist(err) {
+		return &Index{Version: 2}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadIndex(f)
+}
+
+// WriteIndex replaces the index file of the repository.
+func (repo *Repository) WriteIndex(idx *Index) error {
+	if repo.dryRun != nil {
+		repo.recordChange(Change{Op: ChangeWriteFile, Name: "index"})
+		return nil
+	}
+	if repo.snapshot != nil {
+		return ErrReadOnlySnapshot
+	}
+	lock, err := repo.lock(filepath.Join(repo.Path, "index"), FsyncIndex)
+	if err != nil {
+		return err
+	}
+	if err := idx.Write(lock); err != nil {
+		lock.rollback()
+		return err
+	}
+	return lock.commit()
+}
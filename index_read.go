@@ -0,0 +1,262 @@
+package git
+
+import (
+	"bytes"
+	libsha1 "crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+)
+
+var errBadIndex = errors.New("bad index file")
+
+// readIndex reads the entries of the index file of the repository, in the
+// order they are in the file. A missing index has no entries.
+func (repo *Repository) readIndex() ([]*IndexEntry, error) {
+	idx, err := repo.Index()
+	if err != nil {
+		return nil, err
+	}
+	return idx.Entries, nil
+}
+
+// ReadIndex reads an index file of version 2 to 4, with its TREE, REUC
+// and sdir extensions. Other optional extensions are skipped; indexes with
+// required extensions it doesn't know, like the link of a split index,
+// can't be read.
+func ReadIndex(r io.Reader) (*Index, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parseIndex(data)
+}
+
+func parseIndex(data []byte) (*Index, error) {
+	if len(data) < 12+libsha1.Size || !bytes.Equal(data[:4], []byte("DIRC")) {
+		return nil, errBadIndex
+	}
+	body, sum := data[:len(data)-libsha1.Size], data[len(data)-libsha1.Size:]
+	// index.skipHash writes a null checksum
+	if !bytes.Equal(sum, make([]byte, libsha1.Size)) {
+		if h := libsha1.Sum(body); !bytes.Equal(h[:], sum) {
+			return nil, fmt.Errorf("%v: checksum mismatch", errBadIndex)
+		}
+	}
+
+	be := binary.BigEndian
+	idx := &Index{Version: be.Uint32(data[4:])}
+	if idx.Version < 2 || idx.Version > 4 {
+		return nil, fmt.Errorf("%v: unsupported version %d", errBadIndex, idx.Version)
+	}
+	count := be.Uint32(data[8:])
+
+	// don't trust the count for the allocation: an entry takes at least
+	// 62 bytes
+	capacity := int(count)
+	if limit := len(body) / 62; capacity > limit {
+		capacity = limit
+	}
+	idx.Entries = make([]*IndexEntry, 0, capacity)
+	pos := 12
+	prev := ""
+	for i := uint32(0); i < count; i++ {
+		start := pos
+		if pos+62 > len(body) {
+			return nil, errBadIndex
+		}
+		e := &IndexEntry{}
+		e.Ctime.Sec, e.Ctime.Nsec = be.Uint32(body[pos:]), be.Uint32(body[pos+4:])
+		e.Mtime.Sec, e.Mtime.Nsec = be.Uint32(body[pos+8:]), be.Uint32(body[pos+12:])
+		e.Dev, e.Ino = be.Uint32(body[pos+16:]), be.Uint32(body[pos+20:])
+		e.Mode = EntryMode(be.Uint32(body[pos+24:]))
+		e.Uid, e.Gid = be.Uint32(body[pos+28:]), be.Uint32(body[pos+32:])
+		e.Size = be.Uint32(body[pos+36:])
+		copy(e.Id[:], body[pos+40:pos+60])
+		flags := be.Uint16(body[pos+60:])
+		e.AssumeValid = flags&0x8000 != 0
+		e.Stage = int(flags>>12) & 3
+		pos += 62
+		if flags&0x4000 != 0 {
+			if idx.Version < 3 || pos+2 > len(body) {
+				return nil, errBadIndex
+			}
+			extended := be.Uint16(body[pos:])
+			e.SkipWorktree = extended&0x4000 != 0
+			e.IntentToAdd = extended&0x2000 != 0
+			pos += 2
+		}
+
+		if idx.Version == 4 {
+			// the path is the previous one with some bytes removed from
+			// its end and others appended
+			strip, n := indexVarint(body[pos:])
+			if n == 0 || strip < 0 || strip > len(prev) {
+				return nil, errBadIndex
+			}
+			pos += n
+			end := bytes.IndexByte(body[pos:], 0)
+			if end < 0 {
+				return nil, errBadIndex
+			}
+			e.Path = prev[:len(prev)-strip] + string(body[pos:pos+end])
+			pos += end + 1
+		} else {
+			end := bytes.IndexByte(body[pos:], 0)
+			if end < 0 {
+				return nil, errBadIndex
+			}
+			e.Path = string(body[pos : pos+end])
+			// entries are padded with NULs to a multiple of 8 bytes
+			pos = start + (pos-start+end+8)&^7
+		}
+		prev = e.Path
+		idx.Entries = append(idx.Entries, e)
+	}
+	if pos > len(body) {
+		return nil, errBadIndex
+	}
+
+	for pos < len(body) {
+		if pos+8 > len(body) {
+			return nil, errBadIndex
+		}
+		sig := string(body[pos : pos+4])
+		size := int(be.Uint32(body[pos+4:]))
+		pos += 8
+		if size < 0 || pos+size > len(body) {
+			return nil, errBadIndex
+		}
+		ext := body[pos : pos+size]
+		pos += size
+
+		var err error
+		switch {
+		case sig == "TREE":
+			idx.Tree, err = parseIndexTree(ext)
+		case sig == "REUC":
+			idx.ResolveUndo, err = parseResolveUndo(ext)
+		case sig == "sdir":
+			idx.Sparse = true
+		case sig[0] < 'A' || sig[0] > 'Z':
+			return nil, fmt.Errorf("%v: unsupported extension %q", errBadIndex, sig)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return idx, nil
+}
+
+// Decode the offset encoding of version 4 indexes, returning the value and
+// the number of bytes read, 0 if data ends early or the value overflows.
+func indexVarint(data []byte) (int, int) {
+	val := 0
+	for i, c := range data {
+		// 8 bytes hold more than 56 bits, longer than any path
+		if i >= 8 {
+			return 0, 0
+		}
+		if i > 0 {
+			val++
+		}
+		val = val<<7 | int(c&0x7f)
+		if c&0x80 == 0 {
+			return val, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// Parse the TREE extension: each directory, root first, as its name, the
+// number of entries and of subtrees, and its id if it's valid, followed
+// by its subtrees.
+func parseIndexTree(data []byte) (*IndexTree, error) {
+	var parse func() (*IndexTree, error)
+	parse = func() (*IndexTree, error) {
+		end := bytes.IndexByte(data, 0)
+		if end < 0 {
+			return nil, errBadIndex
+		}
+		t := &IndexTree{Name: string(data[:end])}
+		data = data[end+1:]
+		nl := bytes.IndexByte(data, '\n')
+		if nl < 0 {
+			return nil, errBadIndex
+		}
+		var entries, subtrees int
+		_, err := fmt.Sscanf(string(data[:nl]), "%d %d", &entries, &subtrees)
+		if err != nil || subtrees < 0 {
+			return nil, fmt.Errorf("%v: bad TREE extension", errBadIndex)
+		}
+		data = data[nl+1:]
+		t.Entries = entries
+		if entries >= 0 {
+			if len(data) < libsha1.Size {
+				return nil, errBadIndex
+			}
+			copy(t.Id[:], data)
+			data = data[libsha1.Size:]
+		}
+		for i := 0; i < subtrees; i++ {
+			sub, err := parse()
+			if err != nil {
+				return nil, err
+			}
+			t.Subtrees = append(t.Subtrees, sub)
+		}
+		return t, nil
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return parse()
+}
+
+// Parse the REUC extension: each path with the octal modes of its three
+// stages and the ids of those that exist.
+func parseResolveUndo(data []byte) ([]*ResolveUndo, error) {
+	var undo []*ResolveUndo
+	next := func() (string, error) {
+		end := bytes.IndexByte(data, 0)
+		if end < 0 {
+			return "", fmt.Errorf("%v: bad REUC extension", errBadIndex)
+		}
+		s := string(data[:end])
+		data = data[end+1:]
+		return s, nil
+	}
+	for len(data) > 0 {
+		path, err := next()
+		if err != nil {
+			return nil, err
+		}
+		u := &ResolveUndo{Path: path}
+		for i := range u.Modes {
+			s, err := next()
+			if err != nil {
+				return nil, err
+			}
+			mode, err := strconv.ParseUint(s, 8, 32)
+			if err != nil {
+				return nil, fmt.Errorf("%v: bad REUC extension", errBadIndex)
+			}
+			u.Modes[i] = EntryMode(mode)
+		}
+		for i := range u.Ids {
+			if u.Modes[i] == 0 {
+				continue
+			}
+			if len(data) < libsha1.Size {
+				return nil, fmt.Errorf("%v: bad REUC extension", errBadIndex)
+			}
+			copy(u.Ids[i][:], data)
+			data = data[libsha1.Size:]
+		}
+		undo = append(undo, u)
+	}
+	return undo, nil
+}
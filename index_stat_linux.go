@@ -0,0 +1,19 @@
+//go:build linux
+// +build linux
+
+package git
+
+import (
+	"os"
+	"syscall"
+)
+
+func fillStatData(e *IndexEntry, fi os.FileInfo) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	e.Ctime.Sec, e.Ctime.Nsec = uint32(st.Ctim.Sec), uint32(st.Ctim.Nsec)
+	e.Dev, e.Ino = uint32(st.Dev), uint32(st.Ino)
+	e.Uid, e.Gid = st.Uid, st.Gid
+}
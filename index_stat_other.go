@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package git
+
+import (
+	"os"
+)
+
+// Only the modification time and size are recorded on this platform, git
+// refreshes the rest when it looks at the file.
+func fillStatData(e *IndexEntry, fi os.FileInfo) {
+}
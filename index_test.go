@@ -0,0 +1,125 @@
+package git
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func testIndex(t *testing.T, version uint32) *Index {
+	t.Helper()
+	data := mustIdFromString(t, "28c7f98408356c823d0247f3ee40746e24e3a78b")
+	empty := mustIdFromString(t, "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391")
+	tree := mustIdFromString(t, "3653a91b9cb7fd42c00609855aba0c25e83df287")
+	entry := func(path string, id ObjectID, mode EntryMode, stage int) *IndexEntry {
+		return &IndexEntry{
+			Path: path, Id: id, Mode: mode, Stage: stage,
+			Ctime: IndexTime{1500000000, 1}, Mtime: IndexTime{1500000001, 2},
+			Dev: 3, Ino: 4, Uid: 1000, Gid: 1000, Size: uint32(len(path)),
+		}
+	}
+	idx := &Index{
+		Version: version,
+		Entries: []*IndexEntry{
+			entry("README", data, ModeBlob, 0),
+			entry("dir/a", empty, ModeExec, 0),
+			// shares a prefix with the entry before it, for version 4
+			entry("dir/ab", data, ModeSymlink, 0),
+			entry("dir/sub/file", empty, ModeBlob, 0),
+			entry("conflict", data, ModeBlob, 1),
+			entry("conflict", empty, ModeBlob, 2),
+		},
+		Tree: &IndexTree{Entries: -1, Subtrees: []*IndexTree{
+			{Name: "dir", Entries: 3, Id: tree, Subtrees: []*IndexTree{
+				{Name: "sub", Entries: 1, Id: tree},
+			}},
+		}},
+		ResolveUndo: []*ResolveUndo{{
+			Path:  "resolved",
+			Modes: [3]EntryMode{ModeBlob, 0, ModeExec},
+			Ids:   [3]ObjectID{data, {}, empty},
+		}},
+	}
+	idx.Entries[0].AssumeValid = true
+	if version >= 3 {
+		idx.Entries[1].SkipWorktree = true
+		idx.Entries[2].IntentToAdd = true
+	}
+	return idx
+}
+
+func TestIndexRoundTrip(t *testing.T) {
+	for _, version := range []uint32{2, 3, 4} {
+		idx := testIndex(t, version)
+		var buf bytes.Buffer
+		if err := idx.Write(&buf); err != nil {
+			t.Fatalf("version %d: %v", version, err)
+		}
+		read, err := ReadIndex(&buf)
+		if err != nil {
+			t.Fatalf("version %d: %v", version, err)
+		}
+		if !reflect.DeepEqual(read, idx) {
+			t.Errorf("version %d: read back\n%+v\nexpected\n%+v", version, read, idx)
+		}
+	}
+}
+
+func TestIndexExtendedFlagsVersion(t *testing.T) {
+	idx := testIndex(t, 2)
+	idx.Entries[1].SkipWorktree = true
+	var buf bytes.Buffer
+	if err := idx.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadIndex(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Version != 3 {
+		t.Errorf("index with extended flags written as version %d", read.Version)
+	}
+	if e := read.Entry("dir/a", 0); e == nil || !e.SkipWorktree {
+		t.Error("skip-worktree flag lost")
+	}
+}
+
+func TestSparseIndexRoundTrip(t *testing.T) {
+	idx := testIndex(t, 3)
+	idx.Sparse = true
+	idx.Entries = append(idx.Entries, &IndexEntry{
+		Path:         "sparse/",
+		Id:           mustIdFromString(t, "3653a91b9cb7fd42c00609855aba0c25e83df287"),
+		Mode:         ModeTree,
+		SkipWorktree: true,
+	})
+	var buf bytes.Buffer
+	if err := idx.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadIndex(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, idx) {
+		t.Errorf("read back\n%+v\nexpected\n%+v", read, idx)
+	}
+}
+
+func TestReadCorruptIndex(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testIndex(t, 4).Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	for _, n := range []int{0, 11, 12, 40, len(data) / 2, len(data) - 1} {
+		if _, err := ReadIndex(bytes.NewReader(data[:n])); err == nil {
+			t.Errorf("index truncated to %d bytes read", n)
+		}
+	}
+	corrupt := append([]byte(nil), data...)
+	corrupt[len(corrupt)/2] ^= 0xff
+	if _, err := ReadIndex(bytes.NewReader(corrupt)); err == nil {
+		t.Error("index with a wrong checksum read")
+	}
+}
@@ -0,0 +1,190 @@
+package git
+
+import (
+	"bytes"
+	libsha1 "crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// newIndexEntry returns the entry for a file that was just written.
+func newIndexEntry(path string, id ObjectID, mode EntryMode, fi os.FileInfo) *IndexEntry {
+	e := &IndexEntry{Path: path, Id: id, Mode: mode, Size: uint32(fi.Size())}
+	mtime := fi.ModTime()
+	e.Mtime.Sec, e.Mtime.Nsec = uint32(mtime.Unix()), uint32(mtime.Nanosecond())
+	e.Ctime = e.Mtime
+	fillStatData(e, fi)
+	return e
+}
+
+// writeIndex writes a version 2 index file with the given entries.
+func writeIndex(w io.Writer, entries []*IndexEntry) error {
+	return (&Index{Version: 2, Entries: entries}).Write(w)
+}
+
+// Write writes the index file, with its entries sorted.
+func (idx *Index) Write(w io.Writer) error {
+	version := idx.Version
+	if version == 0 {
+		version = 2
+	}
+	if version < 2 || version > 4 {
+		return fmt.Errorf("unsupported index version %d", version)
+	}
+	sort.SliceStable(idx.Entries, func(i, j int) bool {
+		a, b := idx.Entries[i], idx.Entries[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Stage < b.Stage
+	})
+	for _, e := range idx.Entries {
+		if version == 2 && (e.SkipWorktree || e.IntentToAdd) {
+			version = 3
+		}
+	}
+
+	h := libsha1.New()
+	out := io.MultiWriter(w, h)
+
+	be := binary.BigEndian
+	header := make([]byte, 12)
+	copy(header, "DIRC")
+	be.PutUint32(header[4:], version)
+	be.PutUint32(header[8:], uint32(len(idx.Entries)))
+	if _, err := out.Write(header); err != nil {
+		return err
+	}
+
+	prev := ""
+	for _, e := range idx.Entries {
+		// 62 bytes of fixed fields, 2 of extended flags, and the path,
+		// padded with 1 to 8 NULs to a multiple of 8 bytes, or prefix
+		// compressed in version 4
+		buf := make([]byte, 62, 64+len(e.Path)+8)
+		be.PutUint32(buf[0:], e.Ctime.Sec)
+		be.PutUint32(buf[4:], e.Ctime.Nsec)
+		be.PutUint32(buf[8:], e.Mtime.Sec)
+		be.PutUint32(buf[12:], e.Mtime.Nsec)
+		be.PutUint32(buf[16:], e.Dev)
+		be.PutUint32(buf[20:], e.Ino)
+		be.PutUint32(buf[24:], uint32(e.Mode))
+		be.PutUint32(buf[28:], e.Uid)
+		be.PutUint32(buf[32:], e.Gid)
+		be.PutUint32(buf[36:], e.Size)
+		copy(buf[40:], e.Id[:])
+		flags := uint16(e.Stage&3) << 12
+		if n := len(e.Path); n < 0xfff {
+			flags |= uint16(n)
+		} else {
+			flags |= 0xfff
+		}
+		if e.AssumeValid {
+			flags |= 0x8000
+		}
+		var extended uint16
+		if e.SkipWorktree {
+			extended |= 0x4000
+		}
+		if e.IntentToAdd {
+			extended |= 0x2000
+		}
+		if extended != 0 {
+			flags |= 0x4000
+		}
+		be.PutUint16(buf[60:], flags)
+		if extended != 0 {
+			buf = be.AppendUint16(buf, extended)
+		}
+
+		if version == 4 {
+			common := 0
+			for common < len(prev) && common < len(e.Path) && prev[common] == e.Path[common] {
+				common++
+			}
+			buf = appendIndexVarint(buf, len(prev)-common)
+			buf = append(buf, e.Path[common:]...)
+			buf = append(buf, 0)
+		} else {
+			buf = append(buf, e.Path...)
+			buf = append(buf, make([]byte, 8-len(buf)%8)...)
+		}
+		prev = e.Path
+		if _, err := out.Write(buf); err != nil {
+			return err
+		}
+	}
+
+	if idx.Tree != nil {
+		var ext bytes.Buffer
+		writeIndexTree(&ext, idx.Tree)
+		if err := writeIndexExtension(out, "TREE", ext.Bytes()); err != nil {
+			return err
+		}
+	}
+	if len(idx.ResolveUndo) > 0 {
+		var ext bytes.Buffer
+		for _, u := range idx.ResolveUndo {
+			ext.WriteString(u.Path)
+			ext.WriteByte(0)
+			for _, mode := range u.Modes {
+				ext.WriteString(strconv.FormatInt(int64(mode), 8))
+				ext.WriteByte(0)
+			}
+			for i, id := range u.Ids {
+				if u.Modes[i] != 0 {
+					ext.Write(id[:])
+				}
+			}
+		}
+		if err := writeIndexExtension(out, "REUC", ext.Bytes()); err != nil {
+			return err
+		}
+	}
+	if idx.Sparse {
+		if err := writeIndexExtension(out, "sdir", nil); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.Write(h.Sum(nil))
+	return err
+}
+
+// Encode a number like indexVarint decodes it.
+func appendIndexVarint(buf []byte, n int) []byte {
+	var tmp [16]byte
+	i := len(tmp) - 1
+	tmp[i] = byte(n & 0x7f)
+	for n >>= 7; n > 0; n >>= 7 {
+		n--
+		i--
+		tmp[i] = 0x80 | byte(n&0x7f)
+	}
+	return append(buf, tmp[i:]...)
+}
+
+func writeIndexTree(buf *bytes.Buffer, t *IndexTree) {
+	fmt.Fprintf(buf, "%s\x00%d %d\n", t.Name, t.Entries, len(t.Subtrees))
+	if t.Entries >= 0 {
+		buf.Write(t.Id[:])
+	}
+	for _, sub := range t.Subtrees {
+		writeIndexTree(buf, sub)
+	}
+}
+
+func writeIndexExtension(w io.Writer, sig string, data []byte) error {
+	hdr := make([]byte, 8)
+	copy(hdr, sig)
+	binary.BigEndian.PutUint32(hdr[4:], uint32(len(data)))
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
@@ -0,0 +1,32 @@
+//go:build klauspost
+// +build klauspost
+
+package git
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/zlib"
+)
+
+// Built with the klauspost tag, objects are inflated with
+// github.com/klauspost/compress, which is considerably faster than
+// compress/zlib on pack-heavy work like clones, fsck and log walks.
+
+func newZlibReader(r io.Reader) (io.ReadCloser, error) {
+	return zlib.NewReader(r)
+}
+
+func resetZlibReader(zr io.ReadCloser, r io.Reader) error {
+	return zr.(zlib.Resetter).Reset(r, nil)
+}
+
+// Whether err is an error of the inflater about corrupt data.
+func isCorruptZlib(err error) bool {
+	if err == zlib.ErrChecksum || err == zlib.ErrHeader {
+		return true
+	}
+	_, ok := err.(flate.CorruptInputError)
+	return ok
+}
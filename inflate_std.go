@@ -0,0 +1,30 @@
+//go:build !klauspost
+// +build !klauspost
+
+package git
+
+import (
+	"compress/flate"
+	"compress/zlib"
+	"io"
+)
+
+// Objects are inflated with compress/zlib, unless built with the
+// klauspost tag.
+
+func newZlibReader(r io.Reader) (io.ReadCloser, error) {
+	return zlib.NewReader(r)
+}
+
+func resetZlibReader(zr io.ReadCloser, r io.Reader) error {
+	return zr.(zlib.Resetter).Reset(r, nil)
+}
+
+// Whether err is an error of the inflater about corrupt data.
+func isCorruptZlib(err error) bool {
+	if err == zlib.ErrChecksum || err == zlib.ErrHeader {
+		return true
+	}
+	_, ok := err.(flate.CorruptInputError)
+	return ok
+}
@@ -0,0 +1,61 @@
+package git
+
+import (
+	"fmt"
+	"os"
+)
+
+// A LockError is returned when a file is locked by someone else, i.e. its
+// ".lock" file exists.
+type LockError struct {
+	Path string
+}
+
+func (e *LockError) Error() string {
+	return fmt.Sprintf("unable to lock %s: %s.lock exists", e.Path, e.Path)
+}
+
+// A lockFile is git's way of updating a file: the new content is written
+// to "<path>.lock", which is created exclusively, and renamed over the file
+// when done. Other writers following the protocol fail to lock meanwhile.
+type lockFile struct {
+	path string
+	// flush the content to disk before renaming it, see SetFsync
+	sync bool
+	*os.File
+}
+
+func lockPath(path string) (*lockFile, error) {
+	f, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if os.IsExist(err) {
+		return nil, &LockError{Path: path}
+	} else if err != nil {
+		return nil, err
+	}
+	return &lockFile{path: path, File: f}, nil
+}
+
+// commit replaces the file with what was written to the lock.
+func (l *lockFile) commit() error {
+	if l.sync {
+		if err := l.File.Sync(); err != nil {
+			l.rollback()
+			return err
+		}
+	}
+	if err := l.File.Close(); err != nil {
+		os.Remove(l.Name())
+		return err
+	}
+	if err := os.Rename(l.Name(), l.path); err != nil {
+		os.Remove(l.Name())
+		return err
+	}
+	return nil
+}
+
+// rollback releases the lock, leaving the file unchanged.
+func (l *lockFile) rollback() {
+	l.File.Close()
+	os.Remove(l.Name())
+}
@@ -0,0 +1,30 @@
+package git
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SetLogger sets the logger the repository reports details to, like ref
+// updates, maintenance actions and skipped broken refs. Everything is
+// logged at debug level, except problems that are otherwise ignored,
+// which are logged as warnings. nil, the default, disables logging.
+func (repo *Repository) SetLogger(l *slog.Logger) {
+	repo.logger = l
+}
+
+func (repo *Repository) log() *slog.Logger {
+	if repo.logger != nil {
+		return repo.logger
+	}
+	return discardLogger
+}
+
+var discardLogger = slog.New(discardHandler{})
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
@@ -0,0 +1,369 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrNoPatch = errors.New("no patch found in mail")
+)
+
+// A MailPatch is a patch extracted from an email, like the output of
+// git mailinfo. It is what an am implementation needs to create the commit.
+type MailPatch struct {
+	Author  *Signature
+	Subject string
+	// Commit message body, without the subject line.
+	Message string
+	Patch   string
+
+	MessageId  string
+	InReplyTo  string
+	References []string
+}
+
+// CommitMessage returns the subject and message as a commit message.
+func (mp *MailPatch) CommitMessage() string {
+	if mp.Message == "" {
+		return mp.Subject + "\n"
+	}
+	return mp.Subject + "\n\n" + mp.Message
+}
+
+var (
+	mboxFromRe   = regexp.MustCompile(`^From \S+ .*\d{4}$|^From [0-9a-f]{40} `)
+	subjectRe    = regexp.MustCompile(`^\s*((?i:re|aw|fwd?)\s*:\s*|\[[^\]]*\]\s*)+`)
+	scissorsRe   = regexp.MustCompile(`^[-\s]*(>8|8<|>%|%<)[-\s]*$`)
+	inBodyHdrRe  = regexp.MustCompile(`^(From|Subject|Date):\s*(.*)$`)
+	patchStartRe = regexp.MustCompile(`^(---\s*$|diff -|Index: )`)
+)
+
+// SplitMailbox splits an mbox stream into its individual messages, like
+// git mailsplit.
+func SplitMailbox(r io.Reader) ([][]byte, error) {
+	var (
+		msgs [][]byte
+		cur  *bytes.Buffer
+	)
+
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if len(line) > 0 {
+			if mboxFromRe.MatchString(strings.TrimRight(line, "\r\n")) {
+				if cur != nil && cur.Len() > 0 {
+					msgs = append(msgs, cur.Bytes())
+				}
+				cur = new(bytes.Buffer)
+			} else {
+				if cur == nil {
+					// not an mbox, treat the whole stream as one mail
+					cur = new(bytes.Buffer)
+				}
+				// undo mboxrd quoting
+				if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") && line[0] == '>' {
+					line = line[1:]
+				}
+				cur.WriteString(line)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cur != nil && cur.Len() > 0 {
+		msgs = append(msgs, cur.Bytes())
+	}
+	return msgs, nil
+}
+
+// ParseMailPatch parses a single email into a MailPatch. Multipart
+// messages, quoted-printable and base64 transfer encodings and non UTF-8
+// charsets are decoded. Everything above a scissors line ("-- >8 --") is
+// discarded, and From/Subject/Date lines at the start of the body override
+// the mail headers.
+func ParseMailPatch(r io.Reader) (*MailPatch, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := &mime.WordDecoder{CharsetReader: charsetReader}
+	header := func(key string) string {
+		v := msg.Header.Get(key)
+		if d, err := dec.DecodeHeader(v); err == nil {
+			return d
+		}
+		return v
+	}
+
+	mp := &MailPatch{
+		MessageId: strings.Trim(header("Message-Id"), "<> \t"),
+		InReplyTo: strings.Trim(header("In-Reply-To"), "<> \t"),
+	}
+	for _, ref := range strings.Fields(header("References")) {
+		mp.References = append(mp.References, strings.Trim(ref, "<>"))
+	}
+
+	author, err := parseMailAddress(dec, header("From"))
+	if err != nil {
+		return nil, err
+	}
+	mp.Author = author
+	if date, err := msg.Header.Date(); err == nil {
+		mp.Author.When = date
+	}
+	mp.Subject = cleanMailSubject(header("Subject"))
+
+	body, err := readMailBody(msg.Header.Get("Content-Type"),
+		msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mp.parseBody(dec, body); err != nil {
+		return nil, err
+	}
+	return mp, nil
+}
+
+func (mp *MailPatch) parseBody(dec *mime.WordDecoder, body string) error {
+	lines := strings.SplitAfter(strings.Replace(body, "\r\n", "\n", -1), "\n")
+
+	// scissors: drop everything above the last scissors line
+	for i := len(lines) - 1; i >= 0; i-- {
+		if scissorsRe.MatchString(strings.TrimRight(lines[i], "\n")) &&
+			strings.Count(lines[i], "-") >= 2 {
+			lines = lines[i+1:]
+			break
+		}
+	}
+
+	// in-body headers
+	for len(lines) > 0 {
+		l := strings.TrimRight(lines[0], "\n")
+		if strings.TrimSpace(l) == "" {
+			lines = lines[1:]
+			continue
+		}
+		m := inBodyHdrRe.FindStringSubmatch(l)
+		if m == nil {
+			break
+		}
+		switch m[1] {
+		case "From":
+			sig, err := parseMailAddress(dec, m[2])
+			if err != nil {
+				return err
+			}
+			sig.When = mp.Author.When
+			mp.Author = sig
+		case "Subject":
+			mp.Subject = cleanMailSubject(m[2])
+		case "Date":
+			if t, err := mail.ParseDate(m[2]); err == nil {
+				mp.Author.When = t
+			}
+		}
+		lines = lines[1:]
+	}
+
+	var message bytes.Buffer
+	for i, l := range lines {
+		if patchStartRe.MatchString(l) {
+			mp.Patch = strings.Join(lines[i:], "")
+			if strings.HasPrefix(l, "---") {
+				mp.Patch = strings.Join(lines[i+1:], "")
+			}
+			break
+		}
+		message.WriteString(l)
+	}
+	mp.Message = strings.TrimSpace(message.String())
+	if mp.Message != "" {
+		mp.Message += "\n"
+	}
+
+	if mp.Patch == "" {
+		return ErrNoPatch
+	}
+	return nil
+}
+
+func parseMailAddress(dec *mime.WordDecoder, s string) (*Signature, error) {
+	p := &mail.AddressParser{WordDecoder: dec}
+	addr, err := p.Parse(s)
+	if err != nil {
+		// some clients send bare addresses, or names with unquoted specials
+		if i := strings.IndexByte(s, '<'); i > 0 && strings.HasSuffix(s, ">") {
+			return &Signature{
+				Name:  strings.Trim(strings.TrimSpace(s[:i]), `"`),
+				Email: s[i+1 : len(s)-1],
+				When:  time.Now(),
+			}, nil
+		}
+		return nil, fmt.Errorf("invalid From address %q: %v", s, err)
+	}
+	sig := &Signature{Name: addr.Name, Email: addr.Address, When: time.Now()}
+	if sig.Name == "" {
+		sig.Name = addr.Address
+	}
+	return sig, nil
+}
+
+func cleanMailSubject(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	return subjectRe.ReplaceAllString(s, "")
+}
+
+// Decode the body of a mail (or of a mime part) to UTF-8 text. For
+// multipart messages, the text parts are concatenated; attachments with a
+// text or patch type are included as well, which is how some mail clients
+// send patches.
+func readMailBody(contentType, encoding string, r io.Reader) (string, error) {
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		r = quotedprintable.NewReader(r)
+	case "base64":
+		r = base64.NewDecoder(base64.StdEncoding, newBase64Cleaner(r))
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		var out bytes.Buffer
+		mr := multipart.NewReader(r, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			pt := part.Header.Get("Content-Type")
+			if pt != "" {
+				t, _, _ := mime.ParseMediaType(pt)
+				if !strings.HasPrefix(t, "text/") && !strings.HasPrefix(t, "multipart/") &&
+					!strings.Contains(t, "patch") && !strings.Contains(t, "diff") {
+					continue
+				}
+				if t == "text/html" {
+					continue
+				}
+			}
+			// multipart.Part decodes quoted-printable on its own
+			enc := part.Header.Get("Content-Transfer-Encoding")
+			if strings.EqualFold(enc, "quoted-printable") {
+				enc = ""
+			}
+			s, err := readMailBody(pt, enc, part)
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(s)
+		}
+		return out.String(), nil
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	return decodeCharset(params["charset"], data)
+}
+
+// strips the line breaks from base64 content
+type base64Cleaner struct {
+	r io.Reader
+}
+
+func newBase64Cleaner(r io.Reader) io.Reader {
+	return &base64Cleaner{r}
+}
+
+func (b *base64Cleaner) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	j := 0
+	for _, c := range p[:n] {
+		if c != '\r' && c != '\n' && c != ' ' && c != '\t' {
+			p[j] = c
+			j++
+		}
+	}
+	if j == 0 && n > 0 && err == nil {
+		return b.Read(p)
+	}
+	return j, err
+}
+
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	data, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	s, err := decodeCharset(charset, data)
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(s), nil
+}
+
+// windows-1252 code points for 0x80-0x9f, the only range in which it
+// differs from iso-8859-1.
+var cp1252 = [32]rune{
+	0x20ac, 0xfffd, 0x201a, 0x0192, 0x201e, 0x2026, 0x2020, 0x2021,
+	0x02c6, 0x2030, 0x0160, 0x2039, 0x0152, 0xfffd, 0x017d, 0xfffd,
+	0xfffd, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014,
+	0x02dc, 0x2122, 0x0161, 0x203a, 0x0153, 0xfffd, 0x017e, 0x0178,
+}
+
+// Convert data in the given charset to UTF-8. Only the charsets commonly
+// used by mail clients sending patches are supported.
+func decodeCharset(charset string, data []byte) (string, error) {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return string(data), nil
+	case "iso-8859-1", "latin1", "iso8859-1", "windows-1252", "cp1252":
+		windows := strings.Contains(charset, "1252")
+		buf := make([]byte, 0, len(data))
+		for _, c := range data {
+			r := rune(c)
+			if windows && c >= 0x80 && c < 0xa0 {
+				r = cp1252[c-0x80]
+			}
+			buf = append(buf, string(r)...)
+		}
+		return string(buf), nil
+	}
+
+	if utf8.Valid(data) {
+		return string(data), nil
+	}
+	return "", fmt.Errorf("unsupported charset %q", charset)
+}
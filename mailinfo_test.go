@@ -0,0 +1,58 @@
+package git
+
+import (
+	"strings"
+	"testing"
+)
+
+const testMail = `From 1234567890abcdef1234567890abcdef12345678 Mon Sep 17 00:00:00 2001
+From: =?iso-8859-1?q?J=F6rg_Doe?= <jorg@example.com>
+Date: Tue, 10 Sep 2013 16:34:14 +0200
+Subject: [PATCH 1/2] Re: old subject
+Message-Id: <1.patch@example.com>
+In-Reply-To: <0.cover@example.com>
+Content-Type: text/plain; charset=iso-8859-1
+Content-Transfer-Encoding: quoted-printable
+
+Some discussion that is not part of the commit.
+
+-- >8 --
+Subject: Fix the =E9l=E9ment parser
+
+It was broken.
+
+---
+ a.txt | 2 +-
+diff --git a/a.txt b/a.txt
+`
+
+func TestParseMailPatch(t *testing.T) {
+	mails, err := SplitMailbox(strings.NewReader(testMail))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mails) != 1 {
+		t.Fatalf("expected 1 mail, got %d", len(mails))
+	}
+
+	mp, err := ParseMailPatch(strings.NewReader(string(mails[0])))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mp.Author.Name != "Jörg Doe" || mp.Author.Email != "jorg@example.com" {
+		t.Errorf("wrong author %q", mp.Author)
+	}
+	if mp.Subject != "Fix the élément parser" {
+		t.Errorf("wrong subject %q", mp.Subject)
+	}
+	if mp.Message != "It was broken.\n" {
+		t.Errorf("wrong message %q", mp.Message)
+	}
+	if !strings.HasPrefix(mp.Patch, " a.txt | 2 +-\n") {
+		t.Errorf("wrong patch %q", mp.Patch)
+	}
+	if mp.InReplyTo != "0.cover@example.com" {
+		t.Errorf("wrong In-Reply-To %q", mp.InReplyTo)
+	}
+}
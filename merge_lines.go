@@ -0,0 +1,118 @@
+package git
+
+import (
+	"strings"
+)
+
+// A mergeHunk is a conflict of merge3Lines: the lines of each side, and
+// where they start in it, counting from 0.
+type mergeHunk struct {
+	baseStart, oursStart, theirsStart int
+	base, ours, theirs                []string
+}
+
+// merge3Lines merges the changes from base to ours and from base to theirs,
+// lines with their line endings, like git merge-file. Changes of both sides
+// to the same lines are a conflict: the result has both sides there between
+// conflict markers naming them ours and theirs, and the conflicts are
+// returned. Lines both sides changed the same way at the start or end of a
+// conflict are left out of it.
+func merge3Lines(base, ours, theirs []string, oursLabel, theirsLabel string) ([]string, []mergeHunk) {
+	matchOurs, matchTheirs := matchLines(base, ours), matchLines(base, theirs)
+	var result []string
+	var conflicts []mergeHunk
+	i, j, k := 0, 0, 0
+	for i < len(base) || j < len(ours) || k < len(theirs) {
+		if i < len(base) && matchOurs[i] == j && matchTheirs[i] == k {
+			// unchanged on both sides
+			result = append(result, base[i])
+			i, j, k = i+1, j+1, k+1
+			continue
+		}
+		// the next line both sides kept ends the changed chunk
+		next := i
+		for next < len(base) && (matchOurs[next] < 0 || matchTheirs[next] < 0) {
+			next++
+		}
+		nextOurs, nextTheirs := len(ours), len(theirs)
+		if next < len(base) {
+			nextOurs, nextTheirs = matchOurs[next], matchTheirs[next]
+		}
+		h := mergeHunk{i, j, k, base[i:next], ours[j:nextOurs], theirs[k:nextTheirs]}
+		i, j, k = next, nextOurs, nextTheirs
+
+		switch {
+		case equalLines(h.ours, h.base):
+			result = append(result, h.theirs...)
+		case equalLines(h.theirs, h.base), equalLines(h.ours, h.theirs):
+			result = append(result, h.ours...)
+		default:
+			result, h = appendConflict(result, h, oursLabel, theirsLabel)
+			conflicts = append(conflicts, h)
+		}
+	}
+	return result, conflicts
+}
+
+// For each line of a, the index of the line of b it is kept as, or -1 if
+// it was removed.
+func matchLines(a, b []string) []int {
+	match := make([]int, len(a))
+	for i := range match {
+		match[i] = -1
+	}
+	for _, op := range diffLines(a, b) {
+		if op.typ == lineEqual {
+			match[op.a] = op.b
+		}
+	}
+	return match
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Append a conflict between the sides of h, with the lines they share at
+// the start and end outside of it, and return h without them.
+func appendConflict(result []string, h mergeHunk, oursLabel, theirsLabel string) ([]string, mergeHunk) {
+	ours, theirs := h.ours, h.theirs
+	prefix := 0
+	for prefix < len(ours) && prefix < len(theirs) && ours[prefix] == theirs[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(ours)-prefix && suffix < len(theirs)-prefix &&
+		ours[len(ours)-1-suffix] == theirs[len(theirs)-1-suffix] {
+		suffix++
+	}
+	h.ours, h.theirs = ours[prefix:len(ours)-suffix], theirs[prefix:len(theirs)-suffix]
+	h.oursStart += prefix
+	h.theirsStart += prefix
+
+	result = append(result, ours[:prefix]...)
+	result = append(result, "<<<<<<< "+oursLabel+"\n")
+	result = appendTerminated(result, h.ours)
+	result = append(result, "=======\n")
+	result = appendTerminated(result, h.theirs)
+	result = append(result, ">>>>>>> "+theirsLabel+"\n")
+	return append(result, ours[len(ours)-suffix:]...), h
+}
+
+// Append lines, ending the last one with a newline so that a conflict
+// marker can follow.
+func appendTerminated(result, lines []string) []string {
+	result = append(result, lines...)
+	if n := len(result); len(lines) > 0 && !strings.HasSuffix(result[n-1], "\n") {
+		result[n-1] += "\n"
+	}
+	return result
+}
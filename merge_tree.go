@@ -0,0 +1,330 @@
+package git
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// A MergeConflictKind tells why a path couldn't be merged.
+type MergeConflictKind string
+
+const (
+	// Both sides changed the same lines of the file, or changed a file
+	// that can't be merged line by line, like a binary file, a symlink or
+	// a submodule, in different ways.
+	ConflictContent MergeConflictKind = "content"
+	// Both sides added the file with different contents.
+	ConflictAddAdd MergeConflictKind = "add/add"
+	// One side changed the file, the other deleted it.
+	ConflictModifyDelete MergeConflictKind = "modify/delete"
+	// The contents merged, but both sides changed the mode differently.
+	ConflictMode MergeConflictKind = "mode"
+	// One side has a file where the other has a directory.
+	ConflictFileDirectory MergeConflictKind = "file/directory"
+)
+
+// MergeOptions configure Repository.MergeCommits.
+type MergeOptions struct {
+	// The names of the sides in conflict markers, the revisions given to
+	// MergeCommits if empty.
+	OursLabel, TheirsLabel string
+}
+
+// A MergeResult is the outcome of Repository.MergeCommits.
+type MergeResult struct {
+	// The merged tree. Files with conflicts are in it as git merge leaves
+	// them in the working tree: with conflict markers, or our version if
+	// they can't be merged line by line.
+	Tree ObjectID
+	// The merge bases of the commits.
+	Bases     []ObjectID
+	Conflicts []*MergeConflict
+}
+
+// Clean reports whether the commits merged without conflicts.
+func (r *MergeResult) Clean() bool {
+	return len(r.Conflicts) == 0
+}
+
+// A MergeConflict is a path that couldn't be merged.
+type MergeConflict struct {
+	Path string
+	Kind MergeConflictKind
+	// The file in the merge base and on both sides, like the stages 1 to
+	// 3 of the index, nil where there is none.
+	Base, Ours, Theirs *MergeStage
+	// The conflicting lines of content conflicts.
+	Hunks []*ConflictHunk
+}
+
+// A MergeStage is a version of a conflicting file.
+type MergeStage struct {
+	Mode EntryMode
+	Id   ObjectID
+}
+
+// A ConflictHunk is a range of lines both sides changed differently, with
+// the lines of each side, without line endings.
+type ConflictHunk struct {
+	// Where the lines start in each version of the file, counting from 1.
+	BaseStart, OursStart, TheirsStart int
+	Base, Ours, Theirs                []string
+}
+
+// MergeCommits merges the commits theirs names into the one ours names,
+// like git merge-tree --write-tree: the changes of both since their merge
+// base are combined into a tree without touching the working tree, the
+// index or any ref. If the commits have several merge bases, they are
+// merged first into a virtual base, like git's recursive strategy does.
+// Files are merged by path, renames aren't detected.
+//
+// The merged blobs and trees are written to the object database, use a
+// DryRun view to keep them in memory.
+func (repo *Repository) MergeCommits(ours, theirs string, opts MergeOptions) (*MergeResult, error) {
+	oursId, err := repo.resolveRevision(ours)
+	if err != nil {
+		return nil, err
+	}
+	theirsId, err := repo.resolveRevision(theirs)
+	if err != nil {
+		return nil, err
+	}
+	if opts.OursLabel == "" {
+		opts.OursLabel = ours
+	}
+	if opts.TheirsLabel == "" {
+		opts.TheirsLabel = theirs
+	}
+
+	bases, err := repo.mergeBases(oursId, theirsId)
+	if err != nil {
+		return nil, err
+	}
+	baseFiles, err := repo.mergeBaseFiles(bases)
+	if err != nil {
+		return nil, err
+	}
+	oursFiles, err := repo.commitFiles(oursId)
+	if err != nil {
+		return nil, err
+	}
+	theirsFiles, err := repo.commitFiles(theirsId)
+	if err != nil {
+		return nil, err
+	}
+	files, conflicts, err := repo.mergeFiles(baseFiles, oursFiles, theirsFiles, opts.OursLabel, opts.TheirsLabel)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := repo.writeTree(files)
+	if err != nil {
+		return nil, err
+	}
+	return &MergeResult{Tree: tree, Bases: bases, Conflicts: conflicts}, nil
+}
+
+// Return the files of the tree of a commit.
+func (repo *Repository) commitFiles(id ObjectID) (map[string]treeFile, error) {
+	commit, err := repo.getCommit(id)
+	if err != nil {
+		return nil, err
+	}
+	return repo.flattenTree(&commit.Tree)
+}
+
+// Return the files of the merge base of two commits with the given merge
+// bases: none for unrelated histories, or all of them merged with their
+// own merge bases, conflicts included.
+func (repo *Repository) mergeBaseFiles(bases []ObjectID) (map[string]treeFile, error) {
+	if len(bases) == 0 {
+		return make(map[string]treeFile), nil
+	}
+	files, err := repo.commitFiles(bases[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, next := range bases[1:] {
+		ancestors, err := repo.mergeBases(bases[0], next)
+		if err != nil {
+			return nil, err
+		}
+		ancestorFiles, err := repo.mergeBaseFiles(ancestors)
+		if err != nil {
+			return nil, err
+		}
+		nextFiles, err := repo.commitFiles(next)
+		if err != nil {
+			return nil, err
+		}
+		files, _, err = repo.mergeFiles(ancestorFiles, files, nextFiles, "Temporary merge branch 1", "Temporary merge branch 2")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// Three-way merge of flattened trees, merging files changed on both sides
+// line by line. Merged files are written as blobs.
+func (repo *Repository) mergeFiles(base, ours, theirs map[string]treeFile, oursLabel, theirsLabel string) (map[string]treeFile, []*MergeConflict, error) {
+	result := make(map[string]treeFile, len(ours))
+	var conflicts []*MergeConflict
+
+	paths := make(map[string]struct{}, len(ours))
+	for _, m := range []map[string]treeFile{base, ours, theirs} {
+		for p := range m {
+			paths[p] = struct{}{}
+		}
+	}
+	for p := range paths {
+		b, inBase := base[p]
+		o, inOurs := ours[p]
+		t, inTheirs := theirs[p]
+
+		switch {
+		case inOurs == inTheirs && o == t:
+			// same on both sides
+		case inBase == inOurs && b == o:
+			// only changed by them
+			o, inOurs = t, inTheirs
+		case inBase == inTheirs && b == t:
+			// only changed by us
+		default:
+			c := &MergeConflict{Path: p, Base: mergeStage(b, inBase), Ours: mergeStage(o, inOurs), Theirs: mergeStage(t, inTheirs)}
+			merged, err := repo.mergeFile(c, oursLabel, theirsLabel)
+			if err != nil {
+				return nil, nil, err
+			}
+			o, inOurs = merged, true
+			if c.Kind != "" {
+				conflicts = append(conflicts, c)
+			}
+		}
+		if inOurs {
+			result[p] = o
+		}
+	}
+
+	// a file on one side may collide with a directory on the other, the
+	// file is moved aside like git does
+	var collisions []string
+	for p := range result {
+		for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+			if _, ok := result[dir]; ok {
+				collisions = append(collisions, dir)
+			}
+		}
+	}
+	sort.Strings(collisions)
+	for i, dir := range collisions {
+		if i > 0 && collisions[i-1] == dir {
+			continue
+		}
+		f := result[dir]
+		label := theirsLabel
+		if o, ok := ours[dir]; ok && o == f {
+			label = oursLabel
+		}
+		delete(result, dir)
+		result[dir+"~"+strings.Replace(label, "/", "_", -1)] = f
+		b, inBase := base[dir]
+		o, inOurs := ours[dir]
+		t, inTheirs := theirs[dir]
+		conflicts = append(conflicts, &MergeConflict{Path: dir, Kind: ConflictFileDirectory,
+			Base: mergeStage(b, inBase), Ours: mergeStage(o, inOurs), Theirs: mergeStage(t, inTheirs)})
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Path < conflicts[j].Path })
+	return result, conflicts, nil
+}
+
+func mergeStage(f treeFile, ok bool) *MergeStage {
+	if !ok {
+		return nil
+	}
+	return &MergeStage{f.mode, f.id}
+}
+
+// Merge a file both sides changed, setting the kind of c if it conflicts,
+// and return what goes into the merged tree.
+func (repo *Repository) mergeFile(c *MergeConflict, oursLabel, theirsLabel string) (treeFile, error) {
+	if c.Ours == nil || c.Theirs == nil {
+		c.Kind = ConflictModifyDelete
+		if c.Ours != nil {
+			return treeFile{c.Ours.Mode, c.Ours.Id}, nil
+		}
+		return treeFile{c.Theirs.Mode, c.Theirs.Id}, nil
+	}
+	ours := treeFile{c.Ours.Mode, c.Ours.Id}
+	if !isRegularMode(c.Ours.Mode) || !isRegularMode(c.Theirs.Mode) {
+		c.Kind = ConflictContent
+		return ours, nil
+	}
+
+	var baseData []byte
+	var err error
+	mode := c.Ours.Mode
+	modeClean := true
+	if c.Base != nil && isRegularMode(c.Base.Mode) {
+		if baseData, err = repo.readBlob(c.Base.Id); err != nil {
+			return ours, err
+		}
+		if c.Ours.Mode == c.Base.Mode {
+			mode = c.Theirs.Mode
+		} else if c.Theirs.Mode != c.Base.Mode && c.Theirs.Mode != c.Ours.Mode {
+			modeClean = false
+		}
+	} else if c.Ours.Mode != c.Theirs.Mode {
+		modeClean = false
+	}
+	oursData, err := repo.readBlob(c.Ours.Id)
+	if err != nil {
+		return ours, err
+	}
+	theirsData, err := repo.readBlob(c.Theirs.Id)
+	if err != nil {
+		return ours, err
+	}
+	if isBinaryData(baseData) || isBinaryData(oursData) || isBinaryData(theirsData) {
+		c.Kind = ConflictContent
+		return ours, nil
+	}
+
+	merged, hunks := merge3Lines(splitLines(baseData), splitLines(oursData), splitLines(theirsData), oursLabel, theirsLabel)
+	id, err := repo.WriteObject(ObjectBlob, []byte(strings.Join(merged, "")))
+	if err != nil {
+		return ours, err
+	}
+	switch {
+	case len(hunks) > 0 && c.Base == nil:
+		c.Kind = ConflictAddAdd
+	case len(hunks) > 0:
+		c.Kind = ConflictContent
+	case !modeClean:
+		c.Kind = ConflictMode
+	}
+	for _, h := range hunks {
+		c.Hunks = append(c.Hunks, &ConflictHunk{
+			BaseStart:   h.baseStart + 1,
+			OursStart:   h.oursStart + 1,
+			TheirsStart: h.theirsStart + 1,
+			Base:        trimLineEndings(h.base),
+			Ours:        trimLineEndings(h.ours),
+			Theirs:      trimLineEndings(h.theirs),
+		})
+	}
+	return treeFile{mode, id}, nil
+}
+
+func isRegularMode(mode EntryMode) bool {
+	return mode == ModeBlob || mode == ModeExec
+}
+
+func trimLineEndings(lines []string) []string {
+	trimmed := make([]string, len(lines))
+	for i, l := range lines {
+		trimmed[i] = strings.TrimSuffix(l, "\n")
+	}
+	return trimmed
+}
@@ -0,0 +1,89 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+)
+
+var ErrNotSigned = errors.New("object is not signed")
+
+// A SignatureVerifier checks a detached signature (an armored OpenPGP,
+// SSH or X.509 signature, as git writes them) of payload, e.g. by calling
+// gpg or with an OpenPGP library, and returns an error if it isn't valid.
+type SignatureVerifier func(payload, signature []byte) error
+
+// The starts of the signatures git appends to signed tags.
+var signatureStarts = [][]byte{
+	[]byte("-----BEGIN PGP SIGNATURE-----"),
+	[]byte("-----BEGIN PGP MESSAGE-----"),
+	[]byte("-----BEGIN SSH SIGNATURE-----"),
+	[]byte("-----BEGIN SIGNED MESSAGE-----"),
+}
+
+// Split a signed object into the signed payload and the signature that
+// starts at the beginning of a line at its end.
+func splitSignature(data []byte) (payload, signature []byte, ok bool) {
+	start := -1
+	for _, marker := range signatureStarts {
+		for i := 0; ; {
+			j := bytes.Index(data[i:], marker)
+			if j < 0 {
+				break
+			}
+			if i+j == 0 || data[i+j-1] == '\n' {
+				if i+j > start {
+					start = i + j
+				}
+			}
+			i += j + len(marker)
+		}
+	}
+	if start < 0 {
+		return nil, nil, false
+	}
+	return data[:start], data[start:], true
+}
+
+// Signature returns the signature of a signed tag and the part of the tag
+// object it signs. ok is false if the tag isn't signed.
+func (tag *Tag) Signature() (payload, signature []byte, ok bool) {
+	return splitSignature(tag.raw)
+}
+
+// Verify checks the signature of a signed tag with verify. It returns
+// ErrNotSigned if the tag isn't signed.
+func (tag *Tag) Verify(verify SignatureVerifier) error {
+	payload, signature, ok := tag.Signature()
+	if !ok {
+		return ErrNotSigned
+	}
+	return verify(payload, signature)
+}
+
+// MergeTags returns the tags embedded in the mergetag headers of a merge
+// commit, which git adds when merging a signed tag, e.g. a signed release.
+// The tags are parsed like other objects of the repository, and their
+// signatures can be checked with Verify; the tag objects themselves
+// usually don't exist in the repository.
+func (c *Commit) MergeTags() ([]*Tag, error) {
+	var tags []*Tag
+	for _, h := range c.headers {
+		if h.Key != "mergetag" {
+			continue
+		}
+		data := []byte(h.Value + "\n")
+		id, err := StoreObjectSHA(ObjectTag, ioutil.Discard, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		tag, err := parseTagData(data, c.repo.ParseMode())
+		if err != nil {
+			return nil, withObjectId(err, id)
+		}
+		tag.Id = id
+		tag.repo = c.repo
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
@@ -0,0 +1,88 @@
+package git
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Names of the metrics reported to a Metrics implementation. They follow
+// the Prometheus naming conventions.
+const (
+	// Objects read, labeled by "kind": "loose" or "packed".
+	MetricObjectReads = "git_object_reads_total"
+	// Bytes of object content read.
+	MetricObjectBytes = "git_object_read_bytes_total"
+	// Lookups in the parsed commit cache.
+	MetricCommitCacheHits   = "git_commit_cache_hits_total"
+	MetricCommitCacheMisses = "git_commit_cache_misses_total"
+	// Pack files opened to read an object.
+	MetricPackOpens = "git_pack_opens_total"
+	// Duration of history walks.
+	MetricTraversalSeconds = "git_traversal_duration_seconds"
+)
+
+// Metrics receives measurements from this package. Labels are given as
+// name, value pairs. Implementations must be safe for concurrent use; an
+// adapter to a Prometheus registry maps Add to counters and Observe to
+// histograms.
+type Metrics interface {
+	// Add adds delta to a counter.
+	Add(name string, delta float64, labels ...string)
+	// Observe records a value, e.g. a duration in seconds, in a histogram.
+	Observe(name string, value float64, labels ...string)
+}
+
+type metricsHolder struct {
+	m Metrics
+}
+
+var globalMetrics atomic.Value
+
+// SetMetrics sets the Metrics used by repositories that have none set with
+// Repository.SetMetrics. nil disables reporting.
+func SetMetrics(m Metrics) {
+	globalMetrics.Store(metricsHolder{m})
+}
+
+// SetMetrics sets the Metrics of this repository, overriding the global
+// one. nil reverts to the global one.
+func (repo *Repository) SetMetrics(m Metrics) {
+	repo.metrics = m
+}
+
+// The Metrics to report to, nil if there are none.
+func (repo *Repository) getMetrics() Metrics {
+	if repo.metrics != nil {
+		return repo.metrics
+	}
+	h, _ := globalMetrics.Load().(metricsHolder)
+	return h.m
+}
+
+func (repo *Repository) countMetric(name string, delta float64, labels ...string) {
+	if m := repo.getMetrics(); m != nil {
+		m.Add(name, delta, labels...)
+	}
+}
+
+func (repo *Repository) observeSince(name string, start time.Time) {
+	if m := repo.getMetrics(); m != nil {
+		m.Observe(name, time.Since(start).Seconds())
+	}
+}
+
+// Reports the bytes read through it to a counter.
+type meteredReader struct {
+	io.ReadCloser
+	metrics Metrics
+	name    string
+}
+
+func (r *meteredReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.metrics.Add(r.name, float64(n))
+	}
+	return n, err
+}
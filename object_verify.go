@@ -0,0 +1,70 @@
+package git
+
+import (
+	"bytes"
+	libsha1 "crypto/sha1"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// SetVerifyObjects makes the repository check that the content of every
+// object it reads hashes to the object's id, like git fsck does, so that
+// damaged objects are found when they are used. The content is hashed as
+// it is read, which costs little next to inflating it; a mismatch is
+// reported by the read reaching the end of the content, as a
+// *CorruptObjectError instead of io.EOF. Readers closed early aren't
+// checked.
+func (repo *Repository) SetVerifyObjects(on bool) {
+	repo.verifyObjects = on
+}
+
+// A CorruptObjectError reports an object whose content doesn't hash to
+// its id.
+type CorruptObjectError struct {
+	Id     ObjectID
+	Reason string
+}
+
+func (e *CorruptObjectError) Error() string {
+	return fmt.Sprintf("corrupt object %s: %s", e.Id, e.Reason)
+}
+
+// Hashes the content of an object while it is read, and checks it against
+// the id at its end.
+type verifyingReader struct {
+	rc        io.ReadCloser
+	id        ObjectID
+	h         hash.Hash
+	remaining int64
+}
+
+func newVerifyingReader(rc io.ReadCloser, id ObjectID, tp ObjectType, size int64) io.ReadCloser {
+	h := libsha1.New()
+	fmt.Fprintf(h, "%s %d\x00", tp, size)
+	return &verifyingReader{rc, id, h, size}
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	r.h.Write(p[:n])
+	r.remaining -= int64(n)
+	if err != io.EOF {
+		return n, err
+	}
+	switch {
+	case r.remaining > 0:
+		err = &CorruptObjectError{r.id, "content is truncated"}
+	case r.remaining < 0:
+		err = &CorruptObjectError{r.id, "content is longer than its size"}
+	default:
+		if sum := r.h.Sum(nil); !bytes.Equal(sum, r.id[:]) {
+			err = &CorruptObjectError{r.id, fmt.Sprintf("content hashes to %x", sum)}
+		}
+	}
+	return n, err
+}
+
+func (r *verifyingReader) Close() error {
+	return r.rc.Close()
+}
@@ -0,0 +1,102 @@
+package git
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// OpenOptions control how OpenRepositoryWithOptions opens a repository.
+type OpenOptions struct {
+	// Refuse to open repositories owned by another user, like git does
+	// since the safe.directory protection was introduced.
+	CheckOwnership bool
+
+	// Called with the path and owner of a repository that is not owned by
+	// the current user. Returning true trusts it anyway. If nil, the
+	// safe.directory entries of the system and global config decide.
+	TrustRepository func(path string, owner int) bool
+}
+
+// An UnsafeRepositoryError is returned when opening a repository owned by
+// another user that has not been trusted explicitly.
+type UnsafeRepositoryError struct {
+	Path  string
+	Owner int
+}
+
+func (e *UnsafeRepositoryError) Error() string {
+	return fmt.Sprintf("detected dubious ownership in repository at %q (owned by uid %d)", e.Path, e.Owner)
+}
+
+// OpenRepositoryWithOptions opens the repository at path like
+// OpenRepository, applying the checks selected by opts. The ownership of
+// the git directory and the working tree is checked before anything, like
+// alternates or pack indexes, is read from them.
+func OpenRepositoryWithOptions(path string, opts OpenOptions) (*Repository, error) {
+	var check func(*Repository) error
+	if opts.CheckOwnership {
+		check = func(repo *Repository) error {
+			return checkOwnership(repo, opts.TrustRepository)
+		}
+	}
+	return openRepository(path, check)
+}
+
+func checkOwnership(repo *Repository, trust func(string, int) bool) error {
+	// like git, the working tree is checked as well
+	for _, dir := range []string{repo.Path, repo.WorkTree} {
+		if dir == "" {
+			continue
+		}
+		owner, ok := ownerOf(dir)
+		if !ok || isCurrentUser(owner) {
+			continue
+		}
+
+		trusted := false
+		if trust != nil {
+			trusted = trust(dir, owner)
+		} else {
+			var err error
+			trusted, err = safeDirectory(dir)
+			if err != nil {
+				return err
+			}
+		}
+		if !trusted {
+			return &UnsafeRepositoryError{Path: dir, Owner: owner}
+		}
+	}
+	return nil
+}
+
+// Whether dir is trusted by a safe.directory entry. Entries are only read
+// from the system and global config, since a repository must not be able
+// to mark itself as safe.
+func safeDirectory(dir string) (bool, error) {
+	config, err := GlobalConfig()
+	if err != nil {
+		return false, err
+	}
+
+	safe := false
+	dir = filepath.ToSlash(filepath.Clean(dir))
+	for _, entry := range config.GetAll("safe.directory") {
+		entry = filepath.ToSlash(expandHome(entry))
+		switch {
+		case entry == "":
+			// an empty value resets the list
+			safe = false
+		case entry == "*":
+			safe = true
+		case strings.HasSuffix(entry, "/*"):
+			if strings.HasPrefix(dir+"/", strings.TrimSuffix(entry, "*")) {
+				safe = true
+			}
+		case filepath.ToSlash(filepath.Clean(entry)) == dir:
+			safe = true
+		}
+	}
+	return safe, nil
+}
@@ -0,0 +1,13 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package git
+
+// Ownership is not checked on this platform.
+func ownerOf(path string) (int, bool) {
+	return 0, false
+}
+
+func isCurrentUser(uid int) bool {
+	return true
+}
@@ -0,0 +1,32 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package git
+
+import (
+	"os"
+	"syscall"
+)
+
+func ownerOf(path string) (int, bool) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, false
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int(st.Uid), true
+}
+
+func isCurrentUser(uid int) bool {
+	euid := os.Geteuid()
+	// like git, root may use repositories of the user it runs sudo for
+	if euid == 0 {
+		if sudoUid, err := StrToInt(os.Getenv("SUDO_UID")); err == nil {
+			return uid == sudoUid || uid == 0
+		}
+	}
+	return uid == euid
+}
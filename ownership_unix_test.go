@@ -0,0 +1,54 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOwnershipCheckedFirst(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	// a pack index that fails to load
+	pack := filepath.Join(repo.ObjectsDir, "pack", "pack-0000000000000000000000000000000000000000")
+	if err := os.MkdirAll(filepath.Dir(pack), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, ext := range []string{".idx", ".pack"} {
+		if err := ioutil.WriteFile(pack+ext, []byte("garbage"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := OpenRepository(repo.Path); err == nil {
+		t.Fatal("corrupt pack index loaded")
+	}
+	if err := os.Chown(repo.Path, os.Getuid()+1, -1); err != nil {
+		t.Skip("can't give the repository to another user:", err)
+	}
+
+	var asked []string
+	opts := OpenOptions{
+		CheckOwnership: true,
+		TrustRepository: func(path string, owner int) bool {
+			asked = append(asked, path)
+			return false
+		},
+	}
+	_, err := OpenRepositoryWithOptions(repo.Path, opts)
+	if _, ok := err.(*UnsafeRepositoryError); !ok {
+		t.Errorf("expected an *UnsafeRepositoryError, got %v", err)
+	}
+	if len(asked) != 1 || asked[0] != repo.Path {
+		t.Errorf("asked to trust %v", asked)
+	}
+
+	opts.TrustRepository = func(string, int) bool { return true }
+	if _, err := OpenRepositoryWithOptions(repo.Path, opts); err == nil {
+		t.Error("corrupt pack index loaded from a trusted repository")
+	} else if _, ok := err.(*UnsafeRepositoryError); ok {
+		t.Error("trusted repository refused")
+	}
+}
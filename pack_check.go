@@ -0,0 +1,143 @@
+package git
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// A CorruptPackError reports damage found in a pack file: a truncated
+// pack, a delta chain that loops or points nowhere, data that doesn't
+// inflate or a CRC that doesn't match the index.
+type CorruptPackError struct {
+	Pack   string
+	Offset uint64
+	Reason string
+}
+
+func (e *CorruptPackError) Error() string {
+	return fmt.Sprintf("corrupt pack %s at offset %d: %s", e.Pack, e.Offset, e.Reason)
+}
+
+// Reads the inflated data of a packed object, reporting early ends and
+// broken compressed data as corruption.
+type packDataReader struct {
+	rc        io.ReadCloser
+	remaining int64
+	corrupt   func(string) error
+}
+
+func newPackDataReader(rc io.ReadCloser, length int64, corrupt func(string) error) io.ReadCloser {
+	return &packDataReader{rc, length, corrupt}
+}
+
+func (r *packDataReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.rc.Read(p)
+	r.remaining -= int64(n)
+	switch {
+	case err == io.EOF && r.remaining > 0, err == io.ErrUnexpectedEOF:
+		err = r.corrupt("object data is truncated")
+	case isCorruptZlib(err):
+		err = r.corrupt(err.Error())
+	}
+	return n, err
+}
+
+func (r *packDataReader) Close() error {
+	return r.rc.Close()
+}
+
+// CheckObjectCRC checks the CRC32 of a packed object's data in its pack
+// against the one recorded in the pack index, and returns a
+// *CorruptPackError if they differ. Loose objects aren't checked.
+func (repo *Repository) CheckObjectCRC(id ObjectID) error {
+	pack, offset := repo.findObjectPack(id)
+	if pack == nil {
+		found, _, err := repo.haveObject(id)
+		if err == nil && !found {
+			err = fmt.Errorf("Object not found %s", id)
+		}
+		return err
+	}
+	return pack.checkCRC(id, offset)
+}
+
+func (f *idxFile) checkCRC(id ObjectID, offset uint64) error {
+	f.crcOnce.Do(func() { f.crcErr = f.loadCRCs() })
+	if f.crcErr != nil {
+		return f.crcErr
+	}
+
+	end := f.ends[offset]
+	pack, err := os.Open(f.packpath)
+	if err != nil {
+		return err
+	}
+	defer pack.Close()
+	data, err := ioutil.ReadAll(io.NewSectionReader(pack, int64(offset), int64(end-offset)))
+	if err != nil {
+		return err
+	}
+	if uint64(len(data)) != end-offset {
+		return &CorruptPackError{Pack: f.packpath, Offset: offset, Reason: "pack is truncated"}
+	}
+	if crc32.ChecksumIEEE(data) != f.crcs[id] {
+		return &CorruptPackError{Pack: f.packpath, Offset: offset, Reason: "CRC mismatch for " + id.String()}
+	}
+	return nil
+}
+
+// Read the CRC table of the index, and find where each object ends: where
+// the next one starts, or the trailing checksum of the pack.
+func (f *idxFile) loadCRCs() error {
+	idx, err := ioutil.ReadFile(f.indexpath)
+	if err != nil {
+		return err
+	}
+	n := len(f.offsetValues)
+	idsStart := 8 + 256*4
+	crcStart := idsStart + 20*n
+	if len(idx) < crcStart+4*n {
+		return fmt.Errorf("index file %s is truncated", f.indexpath)
+	}
+	f.crcs = make(map[ObjectID]uint32, n)
+	for i := 0; i < n; i++ {
+		id, err := NewId(idx[idsStart+20*i : idsStart+20*i+20])
+		if err != nil {
+			return err
+		}
+		f.crcs[id] = binary.BigEndian.Uint32(idx[crcStart+4*i:])
+	}
+
+	fi, err := os.Stat(f.packpath)
+	if err != nil {
+		return err
+	}
+	offsets := make([]uint64, 0, n)
+	for _, o := range f.offsetValues {
+		offsets = append(offsets, o)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	f.ends = make(map[uint64]uint64, n)
+	for i, o := range offsets {
+		end := uint64(fi.Size()) - 20
+		if i+1 < len(offsets) {
+			end = offsets[i+1]
+		}
+		if end < o {
+			return &CorruptPackError{Pack: f.packpath, Offset: o, Reason: "object beyond the end of the pack"}
+		}
+		f.ends[o] = end
+	}
+	return nil
+}
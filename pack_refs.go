@@ -0,0 +1,186 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PackRefs moves loose refs into the packed-refs file, like git pack-refs.
+// Tags are always packed, other refs only if all is set; refs that are
+// already packed stay packed. Annotated tags are written with the object
+// they peel to. Symbolic refs are never packed.
+//
+// packed-refs and each removed loose ref are locked like git does, so
+// concurrent ref updates by git or this package are safe: a loose ref that
+// changes while it is being packed is kept.
+func (repo *Repository) PackRefs(all bool) error {
+	if repo.dryRun != nil {
+		packedLoose, err := repo.writePackedRefs(ioutil.Discard, all)
+		if err != nil {
+			return err
+		}
+		repo.recordChange(Change{Op: ChangeWriteFile, Name: "packed-refs"})
+		for _, ref := range packedLoose {
+			repo.recordChange(Change{Op: ChangeDeleteFile, Name: ref.Name, Old: ref.Id})
+		}
+		return nil
+	}
+	if repo.snapshot != nil {
+		return ErrReadOnlySnapshot
+	}
+
+	packedPath := filepath.Join(repo.Path, "packed-refs")
+	lock, err := repo.lock(packedPath, FsyncReference)
+	if err != nil {
+		return err
+	}
+	packedLoose, err := repo.writePackedRefs(lock, all)
+	if err != nil {
+		lock.rollback()
+		return err
+	}
+	if err := lock.commit(); err != nil {
+		return err
+	}
+	repo.log().Debug("packed refs", "all", all, "loose", len(packedLoose))
+
+	for _, ref := range packedLoose {
+		if err := repo.pruneLooseRef(ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write the new content of packed-refs, and return the loose refs that
+// are included.
+func (repo *Repository) writePackedRefs(out io.Writer, all bool) ([]Ref, error) {
+	w := bufio.NewWriter(out)
+	w.WriteString("# pack-refs with: peeled fully-peeled sorted \n")
+	var packedLoose []Ref
+	err := repo.ForEachRef("refs/", func(ref Ref) error {
+		if ref.Target != "" {
+			return nil
+		}
+		if ref.loose && !all && !strings.HasPrefix(ref.Name, "refs/tags/") {
+			return nil
+		}
+
+		w.WriteString(ref.Id.String() + " " + ref.Name + "\n")
+		peeled, err := repo.peelRef(ref)
+		if err != nil {
+			return err
+		}
+		if !peeled.Equal(ref.Id) {
+			w.WriteString("^" + peeled.String() + "\n")
+		}
+		if ref.loose {
+			packedLoose = append(packedLoose, ref)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return packedLoose, w.Flush()
+}
+
+// The object a ref peels to, using the peeled value recorded in
+// packed-refs if there is one.
+func (repo *Repository) peelRef(ref Ref) (ObjectID, error) {
+	if !ref.Peeled.IsZero() {
+		return ref.Peeled, nil
+	}
+	id, _, err := repo.peel(ref.Id)
+	return id, err
+}
+
+// Remove a loose ref that was packed, unless it changed meanwhile.
+func (repo *Repository) pruneLooseRef(ref Ref) error {
+	refPath := filepath.Join(repo.Path, filepath.FromSlash(ref.Name))
+	lock, err := lockPath(refPath)
+	if _, ok := err.(*LockError); ok {
+		// someone is updating it, the loose ref wins anyway
+		repo.log().Debug("not pruning locked ref", "ref", ref.Name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(refPath)
+	if err == nil && bytes.Equal(bytes.TrimSpace(data), []byte(ref.Id.String())) {
+		err = os.Remove(refPath)
+	} else if err == nil {
+		repo.log().Debug("not pruning changed ref", "ref", ref.Name)
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+	lock.rollback()
+	if err != nil {
+		return err
+	}
+	repo.removeEmptyRefDirs(refPath)
+	return nil
+}
+
+// Remove the directories of the loose ref at refPath that are left empty,
+// but not refs/heads and the like.
+func (repo *Repository) removeEmptyRefDirs(refPath string) {
+	refsDir := filepath.Join(repo.Path, "refs")
+	for dir := filepath.Dir(refPath); filepath.Dir(dir) != refsDir && dir != refsDir; dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+}
+
+// Lock packed-refs and write it to the lock without the refs in names and
+// the lines of their peeled values, for the caller to commit. It returns a
+// nil lock if packed-refs has none of the refs.
+func (repo *Repository) lockPackedRefsWithout(names map[string]bool) (*lockFile, error) {
+	packedPath := filepath.Join(repo.Path, "packed-refs")
+	lock, err := repo.lock(packedPath, FsyncReference)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(packedPath)
+	if os.IsNotExist(err) {
+		lock.rollback()
+		return nil, nil
+	} else if err != nil {
+		lock.rollback()
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	found, skipping := false, false
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if len(line) > 0 && line[0] == '^' {
+			if !skipping {
+				buf.Write(line)
+			}
+			continue
+		}
+		skipping = false
+		fields := bytes.Fields(line)
+		if len(fields) == 2 && line[0] != '#' && names[string(fields[1])] {
+			found, skipping = true, true
+			continue
+		}
+		buf.Write(line)
+	}
+	if !found {
+		lock.rollback()
+		return nil, nil
+	}
+	if _, err := lock.Write(buf.Bytes()); err != nil {
+		lock.rollback()
+		return nil, err
+	}
+	return lock, nil
+}
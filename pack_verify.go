@@ -0,0 +1,215 @@
+package git
+
+import (
+	"bytes"
+	libsha1 "crypto/sha1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// A PackVerification is the result of checking a pack with VerifyPack.
+type PackVerification struct {
+	Pack    string
+	Objects int
+	// The number of objects by the length of their delta chain, 0 for
+	// objects that aren't deltas.
+	ChainLengths map[int]int
+	// What is wrong with the pack, usually *CorruptPackErrors.
+	Problems []error
+}
+
+// OK reports whether no problems were found.
+func (v *PackVerification) OK() bool {
+	return len(v.Problems) == 0
+}
+
+// MaxChainLength returns the length of the longest delta chain.
+func (v *PackVerification) MaxChainLength() int {
+	max := 0
+	for n := range v.ChainLengths {
+		if n > max {
+			max = n
+		}
+	}
+	return max
+}
+
+// VerifyPack checks a pack like git verify-pack: the checksum of the pack
+// and of the index, the CRC of every object, and that every object can be
+// read and has the id the index says. packPath is the .pack or .idx file,
+// which needn't belong to the repository. Damage is reported in the
+// result; an error is only returned if the pack can't be checked at all.
+func (repo *Repository) VerifyPack(packPath string) (*PackVerification, error) {
+	base := strings.TrimSuffix(strings.TrimSuffix(packPath, ".pack"), ".idx")
+	idxPath := base + ".idx"
+
+	indexfiles := make(map[string]*idxFile, len(repo.indexfiles)+1)
+	for k, f := range repo.indexfiles {
+		indexfiles[k] = f
+	}
+	idx, ok := indexfiles[idxPath]
+	if !ok {
+		var err error
+		if idx, err = readIdxFile(idxPath); err != nil {
+			return nil, err
+		}
+		indexfiles[idxPath] = idx
+	}
+
+	v := &PackVerification{
+		Pack:         idx.packpath,
+		Objects:      len(idx.offsetValues),
+		ChainLengths: make(map[int]int),
+	}
+	if err := v.checkChecksums(idx); err != nil {
+		return nil, err
+	}
+
+	ids := make([]ObjectID, 0, len(idx.offsetValues))
+	for id := range idx.offsetValues {
+		ids = append(ids, id)
+	}
+	// in pack order, like git verify-pack
+	sort.Slice(ids, func(i, j int) bool { return idx.offsetValues[ids[i]] < idx.offsetValues[ids[j]] })
+
+	pack, err := os.Open(idx.packpath)
+	if err != nil {
+		return nil, err
+	}
+	defer pack.Close()
+	depths := make(map[uint64]int)
+
+	for _, id := range ids {
+		offset := idx.offsetValues[id]
+		if err := idx.checkCRC(id, offset); err != nil {
+			v.Problems = append(v.Problems, err)
+			continue
+		}
+		if err := verifyPackedObject(idx, &indexfiles, id, offset); err != nil {
+			v.Problems = append(v.Problems, err)
+			continue
+		}
+		v.ChainLengths[chainLength(pack, idx, offset, depths, 0)]++
+	}
+	return v, nil
+}
+
+// Compare the trailing checksum of the pack with its content and with the
+// copy in the index, and the one of the index with its content.
+func (v *PackVerification) checkChecksums(idx *idxFile) error {
+	sum, trailer, err := fileChecksum(idx.packpath)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(sum, trailer) {
+		v.Problems = append(v.Problems, &CorruptPackError{Pack: idx.packpath, Reason: "pack checksum mismatch"})
+	}
+
+	data, err := ioutil.ReadFile(idx.indexpath)
+	if err != nil {
+		return err
+	}
+	if len(data) < 40 {
+		return fmt.Errorf("index file %s is truncated", idx.indexpath)
+	}
+	if !bytes.Equal(data[len(data)-40:len(data)-20], trailer) {
+		v.Problems = append(v.Problems, &CorruptPackError{Pack: idx.packpath, Reason: "index is for another pack"})
+	}
+	if h := libsha1.Sum(data[:len(data)-20]); !bytes.Equal(h[:], data[len(data)-20:]) {
+		v.Problems = append(v.Problems, fmt.Errorf("index file %s: checksum mismatch", idx.indexpath))
+	}
+	return nil
+}
+
+// Return the SHA-1 of a file without its last 20 bytes, and those bytes.
+func fileChecksum(path string) (sum, trailer []byte, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if fi.Size() < 20 {
+		return nil, nil, &CorruptPackError{Pack: path, Reason: "pack is truncated"}
+	}
+	h := libsha1.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, fi.Size()-20)); err != nil {
+		return nil, nil, err
+	}
+	trailer = make([]byte, 20)
+	if _, err := f.ReadAt(trailer, fi.Size()-20); err != nil {
+		return nil, nil, err
+	}
+	return h.Sum(nil), trailer, nil
+}
+
+// Read an object from the pack and check that it hashes to its id.
+func verifyPackedObject(idx *idxFile, indexfiles *map[string]*idxFile, id ObjectID, offset uint64) error {
+	tp, size, rc, err := readObjectBytes(idx.packpath, indexfiles, offset, false)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	h := libsha1.New()
+	fmt.Fprintf(h, "%s %d\x00", tp, size)
+	n, err := io.Copy(h, rc)
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return &CorruptPackError{Pack: idx.packpath, Offset: offset, Reason: "object data is truncated"}
+	}
+	if !bytes.Equal(h.Sum(nil), id[:]) {
+		return &CorruptPackError{Pack: idx.packpath, Offset: offset, Reason: "object does not hash to " + id.String()}
+	}
+	return nil
+}
+
+// Return the number of deltas leading to the object at offset. Bases in
+// other packs count as the end of the chain.
+func chainLength(pack io.ReaderAt, idx *idxFile, offset uint64, depths map[uint64]int, seen int) int {
+	if d, ok := depths[offset]; ok {
+		return d
+	}
+	if seen > len(idx.offsetValues) {
+		// a cycle, which reading the object reports
+		return 0
+	}
+
+	buf := make([]byte, 32)
+	n, _ := pack.ReadAt(buf, int64(offset))
+	buf = buf[:n]
+	_, pos, ok := readLenInPackFile(buf)
+	if !ok || pos >= len(buf) {
+		return 0
+	}
+
+	depth := 0
+	switch ObjectType(buf[0] & 0x70) {
+	case 0x60:
+		num := int64(buf[pos]) & 0x7f
+		for pos < len(buf)-1 && buf[pos]&0x80 > 0 {
+			pos++
+			num = ((num + 1) << 7) | int64(buf[pos]&0x7f)
+		}
+		depth = 1 + chainLength(pack, idx, offset-uint64(num), depths, seen+1)
+	case 0x70:
+		depth = 1
+		if pos+20 <= len(buf) {
+			if id, err := NewId(buf[pos : pos+20]); err == nil {
+				if base, ok := idx.offsetValues[id]; ok {
+					depth += chainLength(pack, idx, base, depths, seen+1)
+				}
+			}
+		}
+	}
+	depths[offset] = depth
+	return depth
+}
@@ -0,0 +1,142 @@
+package git
+
+import (
+	"compress/zlib"
+	libsha1 "crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+)
+
+// A packEntry is where an object was written to a pack, for its index.
+type packEntry struct {
+	id     ObjectID
+	offset uint64
+	crc    uint32
+}
+
+// Write a version 2 pack of the given objects to w. Objects are stored
+// whole, without deltas, and streamed one at a time. read returns the
+// content of an object and defaults to GetRawObject. The checksum of the
+// pack is returned, with where each object was written.
+func (repo *Repository) writePack(w io.Writer, ids []ObjectID, read func(ObjectID) (ObjectType, int64, io.ReadCloser, error)) ([]byte, []packEntry, error) {
+	if read == nil {
+		read = func(id ObjectID) (ObjectType, int64, io.ReadCloser, error) {
+			return repo.GetRawObject(id, false)
+		}
+	}
+	hash := libsha1.New()
+	cw := &countingWriter{w: io.MultiWriter(w, hash)}
+
+	hdr := make([]byte, 12)
+	copy(hdr, "PACK")
+	binary.BigEndian.PutUint32(hdr[4:], 2)
+	binary.BigEndian.PutUint32(hdr[8:], uint32(len(ids)))
+	if _, err := cw.Write(hdr); err != nil {
+		return nil, nil, err
+	}
+
+	entries := make([]packEntry, len(ids))
+	for i, id := range ids {
+		tp, size, rc, err := read(id)
+		if err != nil {
+			return nil, nil, err
+		}
+		crc := crc32.NewIEEE()
+		entries[i] = packEntry{id: id, offset: uint64(cw.n)}
+		err = writePackObject(io.MultiWriter(cw, crc), tp, size, rc)
+		rc.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("writing %s to pack: %v", id, err)
+		}
+		entries[i].crc = crc.Sum32()
+	}
+
+	sum := hash.Sum(nil)
+	if _, err := w.Write(sum); err != nil {
+		return nil, nil, err
+	}
+	return sum, entries, nil
+}
+
+// Write the version 2 index of a pack with the entries and checksum
+// writePack returned.
+func writePackIndex(w io.Writer, entries []packEntry, packSum []byte) error {
+	sorted := append([]packEntry(nil), entries...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].id.Compare(sorted[j].id) < 0 })
+
+	hash := libsha1.New()
+	out := io.MultiWriter(w, hash)
+	buf := make([]byte, 0, 8+256*4)
+	buf = append(buf, 255, 't', 'O', 'c', 0, 0, 0, 2)
+	var fanout [256]uint32
+	for _, e := range sorted {
+		fanout[e.id[0]]++
+	}
+	total := uint32(0)
+	for _, n := range fanout {
+		total += n
+		buf = binary.BigEndian.AppendUint32(buf, total)
+	}
+	for _, e := range sorted {
+		buf = append(buf, e.id[:]...)
+	}
+	for _, e := range sorted {
+		buf = binary.BigEndian.AppendUint32(buf, e.crc)
+	}
+	var large []uint64
+	for _, e := range sorted {
+		if e.offset < 0x80000000 {
+			buf = binary.BigEndian.AppendUint32(buf, uint32(e.offset))
+		} else {
+			buf = binary.BigEndian.AppendUint32(buf, 0x80000000|uint32(len(large)))
+			large = append(large, e.offset)
+		}
+	}
+	for _, off := range large {
+		buf = binary.BigEndian.AppendUint64(buf, off)
+	}
+	buf = append(buf, packSum...)
+	if _, err := out.Write(buf); err != nil {
+		return err
+	}
+	_, err := w.Write(hash.Sum(nil))
+	return err
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Write the header and compressed data of a single undeltified object.
+func writePackObject(w io.Writer, tp ObjectType, size int64, r io.Reader) error {
+	// type and the low 4 bits of the size, then 7 bits at a time
+	hdr := []byte{byte(tp) | byte(size&0x0f)}
+	for rest := size >> 4; rest > 0; rest >>= 7 {
+		hdr[len(hdr)-1] |= 0x80
+		hdr = append(hdr, byte(rest&0x7f))
+	}
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+
+	zw := zlib.NewWriter(w)
+	n, err := io.Copy(zw, io.LimitReader(r, size+1))
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("object has %d bytes, expected %d", n, size)
+	}
+	return zw.Close()
+}
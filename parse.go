@@ -0,0 +1,94 @@
+package git
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// A ParseMode tells how picky the parsing of commit, tag and tree objects
+// is.
+type ParseMode int
+
+const (
+	// Quirks of objects written by old or buggy tools are tolerated, as
+	// long as the object can be shown: missing or garbled author and
+	// committer lines, bad timezones, unusual file modes. Meant for
+	// read-only browsing, and the default.
+	ParseLenient ParseMode = iota
+	// Objects git fsck would complain about are rejected with a
+	// *ParseError, e.g. to check objects before accepting them.
+	ParseStrict
+)
+
+// SetParseMode sets how the repository parses objects. Objects already
+// cached aren't parsed again, so it should be set right after opening the
+// repository.
+func (repo *Repository) SetParseMode(mode ParseMode) {
+	repo.parseMode = mode
+}
+
+// ParseMode returns how the repository parses objects.
+func (repo *Repository) ParseMode() ParseMode {
+	if repo == nil {
+		return ParseLenient
+	}
+	return repo.parseMode
+}
+
+// A ParseError describes a malformed object.
+type ParseError struct {
+	Type ObjectType
+	Id   ObjectID
+	// The line of a commit or tag header, or the entry of a tree
+	// counting from 1; 0 if the problem isn't with a single one.
+	Line   int
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	if e.Line > 0 {
+		what := "line"
+		if e.Type == ObjectTree {
+			what = "entry"
+		}
+		return fmt.Sprintf("malformed %s %s: %s %d: %s", e.Type, e.Id, what, e.Line, e.Reason)
+	}
+	return fmt.Sprintf("malformed %s %s: %s", e.Type, e.Id, e.Reason)
+}
+
+// Fill in the id of a ParseError returned while parsing an object.
+func withObjectId(err error, id ObjectID) error {
+	if perr, ok := err.(*ParseError); ok {
+		perr.Id = id
+	}
+	return err
+}
+
+// Parse the mode of a tree entry. Strictly, only the modes git writes are
+// accepted; leniently, modes are canonicalized like git does, so zero
+// padded "040000" is a tree and the "100664" of early git versions a blob.
+func parseEntryMode(modeString string, mode ParseMode) (EntryMode, ObjectType, error) {
+	entryMode, objectType, err := ParseModeType(modeString)
+	if err == nil || mode == ParseStrict {
+		return entryMode, objectType, err
+	}
+
+	m, perr := strconv.ParseUint(modeString, 8, 32)
+	if perr != nil {
+		return 0, 0, err
+	}
+	switch m & 0170000 {
+	case 0040000:
+		return ModeTree, ObjectTree, nil
+	case 0100000:
+		if m&0100 != 0 {
+			return ModeExec, ObjectBlob, nil
+		}
+		return ModeBlob, ObjectBlob, nil
+	case 0120000:
+		return ModeSymlink, ObjectBlob, nil
+	case 0160000:
+		return ModeCommit, ObjectCommit, nil
+	}
+	return 0, 0, err
+}
@@ -0,0 +1,111 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+)
+
+// The raw commits of testdata/test.git, to seed the fuzzers with.
+func testCommitData(f *testing.F) [][]byte {
+	f.Helper()
+	repo, err := OpenRepository("testdata/test.git")
+	if err != nil {
+		f.Fatal(err)
+	}
+	seen := make(map[ObjectID]bool)
+	var commits [][]byte
+	for _, branch := range []string{"master", "main-bad", "main-alternate", "main-conflict", "independent-branch"} {
+		err := repo.WalkCommitNodes(context.Background(), branch, func(n CommitNode) error {
+			if seen[n.Id] {
+				return nil
+			}
+			seen[n.Id] = true
+			_, _, rc, err := repo.GetRawObject(n.Id, false)
+			if err != nil {
+				return err
+			}
+			defer rc.Close()
+			data, err := ioutil.ReadAll(rc)
+			commits = append(commits, data)
+			return err
+		})
+		if err != nil {
+			f.Fatal(err)
+		}
+	}
+	return commits
+}
+
+// The value of the header name of raw commit or tag data.
+func headerValue(data []byte, name string) []byte {
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			break
+		}
+		if bytes.HasPrefix(line, []byte(name+" ")) {
+			return line[len(name)+1:]
+		}
+	}
+	return nil
+}
+
+func FuzzParseCommitData(f *testing.F) {
+	for _, data := range testCommitData(f) {
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		strict, err := parseCommitData(data, ParseStrict)
+		if err != nil {
+			if _, ok := err.(*ParseError); !ok {
+				t.Fatalf("strict parsing failed with %T, not a *ParseError", err)
+			}
+		}
+		_, lerr := parseCommitData(data, ParseLenient)
+		if strict != nil && lerr != nil {
+			t.Fatalf("accepted strictly but not leniently: %v", lerr)
+		}
+	})
+}
+
+func FuzzParseTagData(f *testing.F) {
+	for _, data := range testCommitData(f) {
+		// a tag of each commit, signed by its committer
+		id, err := HashObject("commit", bytes.NewReader(data))
+		if err != nil {
+			f.Fatal(err)
+		}
+		tag := "object " + id.String() + "\ntype commit\ntag v1.0\ntagger " +
+			string(headerValue(data, "committer")) + "\n\nVersion 1.0\n"
+		f.Add([]byte(tag))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		strict, err := parseTagData(data, ParseStrict)
+		if err != nil {
+			if _, ok := err.(*ParseError); !ok {
+				t.Fatalf("strict parsing failed with %T, not a *ParseError", err)
+			}
+		}
+		_, lerr := parseTagData(data, ParseLenient)
+		if strict != nil && lerr != nil {
+			t.Fatalf("accepted strictly but not leniently: %v", lerr)
+		}
+	})
+}
+
+func FuzzParseSignature(f *testing.F) {
+	for _, data := range testCommitData(f) {
+		f.Add(headerValue(data, "author"))
+		f.Add(headerValue(data, "committer"))
+	}
+	f.Fuzz(func(t *testing.T, line []byte) {
+		strict, reason := parseSignature(line, ParseStrict)
+		if (strict == nil) == (reason == "") {
+			t.Fatalf("strict parsing returned %v with reason %q", strict, reason)
+		}
+		if sig, reason := parseSignature(line, ParseLenient); sig == nil || reason != "" {
+			t.Fatalf("lenient parsing failed: %q", reason)
+		}
+	})
+}
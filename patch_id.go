@@ -0,0 +1,95 @@
+package git
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"hash"
+	"strings"
+	"unicode"
+)
+
+// PatchId returns the patch id of the commit's changes against its first
+// parent, like git patch-id: a hash of the patch without line numbers and
+// whitespace, which stays the same when the commit is cherry-picked or
+// rebased. It returns a zero id for commits without changes and merges.
+func (c *Commit) PatchId() (ObjectID, error) {
+	if c.ParentCount() > 1 {
+		return ObjectID{}, nil
+	}
+	patches, err := c.Patches()
+	if err != nil || len(patches) == 0 {
+		return ObjectID{}, err
+	}
+	return PatchesId(patches), nil
+}
+
+// PatchesId returns the patch id of a set of patches.
+func PatchesId(patches []*FilePatch) ObjectID {
+	h := sha1.New()
+	for _, fp := range patches {
+		writePatchId(h, fp)
+	}
+	var id ObjectID
+	copy(id[:], h.Sum(nil))
+	return id
+}
+
+// Hash the lines git diff would show for the patch, except the index line
+// and hunk headers.
+func writePatchId(h hash.Hash, fp *FilePatch) {
+	oldPath, newPath := fp.OldPath, fp.NewPath
+	if oldPath == "" {
+		oldPath = newPath
+	} else if newPath == "" {
+		newPath = oldPath
+	}
+	addPatchIdLine(h, "diff --git a/"+oldPath+" b/"+newPath)
+	switch {
+	case fp.OldPath == "":
+		addPatchIdLine(h, fmt.Sprintf("new file mode %06o", fp.NewMode))
+	case fp.NewPath == "":
+		addPatchIdLine(h, fmt.Sprintf("deleted file mode %06o", fp.OldMode))
+	case fp.OldMode != fp.NewMode:
+		addPatchIdLine(h, fmt.Sprintf("old mode %06o", fp.OldMode))
+		addPatchIdLine(h, fmt.Sprintf("new mode %06o", fp.NewMode))
+	}
+	if fp.Binary {
+		h.Write([]byte(fp.OldId.String()))
+		h.Write([]byte(fp.NewId.String()))
+		return
+	}
+	if len(fp.Hunks) == 0 {
+		return
+	}
+	if fp.OldPath == "" {
+		addPatchIdLine(h, "--- /dev/null")
+	} else {
+		addPatchIdLine(h, "--- a/"+fp.OldPath)
+	}
+	if fp.NewPath == "" {
+		addPatchIdLine(h, "+++ /dev/null")
+	} else {
+		addPatchIdLine(h, "+++ b/"+fp.NewPath)
+	}
+	for _, hunk := range fp.Hunks {
+		for _, l := range hunk.Lines {
+			switch l.Type {
+			case DiffLineContext:
+				addPatchIdLine(h, " "+l.Content)
+			case DiffLineAdd:
+				addPatchIdLine(h, "+"+l.Content)
+			case DiffLineDelete:
+				addPatchIdLine(h, "-"+l.Content)
+			}
+		}
+	}
+}
+
+func addPatchIdLine(h hash.Hash, line string) {
+	h.Write([]byte(strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, line)))
+}
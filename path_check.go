@@ -0,0 +1,354 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Kinds of PathWarning.
+const (
+	// Two paths differing only in case, which end up as the same file on
+	// case-insensitive filesystems (macOS, Windows).
+	PathCaseCollision = "case-collision"
+	// A path Windows can't create: a reserved device name like CON or
+	// LPT1, a component ending in a dot or space, or a character Windows
+	// doesn't allow in file names.
+	PathWindowsReserved = "windows-reserved"
+)
+
+// A PathWarning is a path of a tree that can't be checked out as is on
+// some filesystems.
+type PathWarning struct {
+	Kind string
+	Path string
+	// The path Path collides with, for case collisions.
+	Other string
+}
+
+func (w PathWarning) String() string {
+	if w.Other != "" {
+		return fmt.Sprintf("%s: %s and %s", w.Kind, w.Other, w.Path)
+	}
+	return fmt.Sprintf("%s: %s", w.Kind, w.Path)
+}
+
+// An UnsafePathsError is returned when paths can't be checked out on this
+// system.
+type UnsafePathsError struct {
+	Warnings []PathWarning
+}
+
+func (e *UnsafePathsError) Error() string {
+	if len(e.Warnings) == 1 {
+		return "unsafe path " + e.Warnings[0].String()
+	}
+	return fmt.Sprintf("%d unsafe paths, first %s", len(e.Warnings), e.Warnings[0])
+}
+
+// CheckPaths returns the problems of the slash separated file paths on
+// case-insensitive filesystems and on Windows, sorted by path.
+func CheckPaths(paths []string) []PathWarning {
+	type seenPath struct {
+		path  string
+		isDir bool
+	}
+	var warnings []PathWarning
+	seen := make(map[string]seenPath)
+	reserved := make(map[string]bool)
+	add := func(p string, isDir bool) {
+		folded := strings.ToLower(p)
+		prev, ok := seen[folded]
+		if !ok {
+			seen[folded] = seenPath{p, isDir}
+			return
+		}
+		// directories differing in case are merged, which is fine unless
+		// a file collides with them
+		if prev.path != p && !(prev.isDir && isDir) {
+			warnings = append(warnings, PathWarning{Kind: PathCaseCollision, Path: p, Other: prev.path})
+		}
+	}
+
+	sorted := append([]string(nil), paths...)
+	sort.Strings(sorted)
+	for _, p := range sorted {
+		for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+			add(dir, true)
+		}
+		add(p, false)
+
+		for _, elem := range strings.Split(p, "/") {
+			if isWindowsReserved(elem) {
+				if !reserved[p] {
+					warnings = append(warnings, PathWarning{Kind: PathWindowsReserved, Path: p})
+					reserved[p] = true
+				}
+				break
+			}
+		}
+	}
+
+	sort.SliceStable(warnings, func(i, j int) bool { return warnings[i].Path < warnings[j].Path })
+	return warnings
+}
+
+// CheckPaths returns the problems of the tree's files on case-insensitive
+// filesystems and on Windows, e.g. to refuse such trees when they are
+// received.
+func (t *Tree) CheckPaths() ([]PathWarning, error) {
+	files, err := t.repo.flattenTree(t)
+	if err != nil {
+		return nil, err
+	}
+	return checkTreePaths(files), nil
+}
+
+func checkTreePaths(files map[string]treeFile) []PathWarning {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	return CheckPaths(paths)
+}
+
+// Split warnings into the ones that make a checkout on this system fail
+// and the others.
+func (repo *Repository) unsafePaths(warnings []PathWarning) (unsafe, others []PathWarning) {
+	ignoreCase := repo.settings().IgnoreCase
+	for _, w := range warnings {
+		switch {
+		case w.Kind == PathCaseCollision && ignoreCase,
+			w.Kind == PathWindowsReserved && runtime.GOOS == "windows":
+			unsafe = append(unsafe, w)
+		default:
+			others = append(others, w)
+		}
+	}
+	return unsafe, others
+}
+
+var windowsDeviceNames = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true, "conin$": true, "conout$": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true,
+	"com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true,
+	"lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+// Reports whether Windows refuses or mangles a file name.
+func isWindowsReserved(name string) bool {
+	if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+		return true
+	}
+	if strings.ContainsAny(name, `<>:"\|?*`) {
+		return true
+	}
+	for _, r := range name {
+		if r < 32 {
+			return true
+		}
+	}
+	// device names are reserved with any extension, "nul.txt" too
+	base := name
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	return windowsDeviceNames[strings.ToLower(strings.TrimRight(base, " "))]
+}
+
+// Kinds of problems that make a path unsafe to write anywhere.
+const (
+	// A path inside a .git directory, including names file systems treat
+	// as ".git": ".GIT", ".git." or the short name "git~1".
+	PathGitDir = "git-dir"
+	// An absolute path, one with empty, "." or ".." components, or one
+	// with a backslash or colon, which Windows takes for a separator, a
+	// drive or an NTFS stream.
+	PathTraversal = "traversal"
+	// A symlink pointing outside the directory the tree is written to.
+	PathSymlinkEscape = "symlink-escape"
+	// A file whose name is also used by a directory.
+	PathFileDirConflict = "file-dir-conflict"
+)
+
+// ValidatePath returns an UnsafePathsError if writing a file at the slash
+// separated path p below a directory could write outside of it or into
+// its .git directory.
+func ValidatePath(p string) error {
+	if kind := pathProblem(p); kind != "" {
+		return &UnsafePathsError{[]PathWarning{{Kind: kind, Path: p}}}
+	}
+	return nil
+}
+
+func pathProblem(p string) string {
+	problem := ""
+	for _, elem := range strings.FieldsFunc(p, isPathSeparator) {
+		if isGitDirName(elem) {
+			return PathGitDir
+		}
+		if elem == "." || elem == ".." || strings.Contains(elem, ":") {
+			problem = PathTraversal
+		}
+	}
+	// empty components, or backslashes Windows splits at
+	if p == "" || strings.HasPrefix(p, "/") || strings.HasSuffix(p, "/") ||
+		strings.Contains(p, "//") || strings.Contains(p, `\`) {
+		problem = PathTraversal
+	}
+	return problem
+}
+
+// Windows takes both slashes and backslashes for separators.
+func isPathSeparator(r rune) bool {
+	return r == '/' || r == '\\'
+}
+
+// Characters HFS+ ignores in file names.
+var hfsIgnorable = strings.NewReplacer(
+	"\u200c", "", "\u200d", "", "\u200e", "", "\u200f", "",
+	"\u202a", "", "\u202b", "", "\u202c", "", "\u202d", "", "\u202e", "",
+	"\u206a", "", "\u206b", "", "\u206c", "", "\u206d", "", "\u206e", "", "\u206f", "",
+	"\ufeff", "",
+)
+
+// Reports whether a file system might treat name as ".git". Like git's
+// is_ntfs_dotgit, an NTFS stream suffix like "::$INDEX_ALLOCATION" is
+// dropped first.
+func isGitDirName(name string) bool {
+	name = strings.ToLower(hfsIgnorable.Replace(name))
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.TrimRight(name, ". ")
+	return name == ".git" || name == "git~1"
+}
+
+// ValidateSymlink returns an UnsafePathsError if a symlink at the slash
+// separated path p with the given target points outside the directory it
+// is written to. links maps the paths of the other symlinks that are
+// written to their targets, which are followed while resolving target.
+func ValidateSymlink(p, target string, links map[string]string) error {
+	if symlinkEscapes(p, target, links) {
+		return &UnsafePathsError{[]PathWarning{{Kind: PathSymlinkEscape, Path: p}}}
+	}
+	return nil
+}
+
+func symlinkEscapes(p, target string, links map[string]string) bool {
+	var resolved []string
+	if dir := path.Dir(p); dir != "." {
+		resolved = strings.Split(dir, "/")
+	}
+	if isAbsLink(target) {
+		return true
+	}
+	todo := strings.FieldsFunc(target, isPathSeparator)
+	for hops := 0; len(todo) > 0; {
+		elem := todo[0]
+		todo = todo[1:]
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			if len(resolved) == 0 {
+				return true
+			}
+			resolved = resolved[:len(resolved)-1]
+			continue
+		}
+		resolved = append(resolved, elem)
+		next, ok := links[strings.Join(resolved, "/")]
+		if !ok {
+			continue
+		}
+		// like the kernel, give up on long chains, which are loops
+		// most of the time
+		if hops++; hops > 40 || isAbsLink(next) {
+			return true
+		}
+		resolved = resolved[:len(resolved)-1]
+		todo = append(strings.FieldsFunc(next, isPathSeparator), todo...)
+	}
+	return false
+}
+
+func isAbsLink(target string) bool {
+	return strings.HasPrefix(target, "/") || strings.HasPrefix(target, `\`) ||
+		len(target) >= 2 && target[1] == ':'
+}
+
+// validateTree checks that the files of a flattened tree can be written
+// below a directory without writing outside of it or into its .git
+// directory, and returns an UnsafePathsError listing all problems.
+func (repo *Repository) validateTree(files map[string]treeFile) error {
+	var warnings []PathWarning
+	links := make(map[string]string)
+	for p, f := range files {
+		if kind := pathProblem(p); kind != "" {
+			warnings = append(warnings, PathWarning{Kind: kind, Path: p})
+			continue
+		}
+		for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+			if _, ok := files[dir]; ok {
+				warnings = append(warnings, PathWarning{Kind: PathFileDirConflict, Path: dir, Other: p})
+			}
+		}
+		if f.mode != ModeSymlink {
+			continue
+		}
+		_, _, rc, err := repo.GetRawObject(f.id, false)
+		if err != nil {
+			return err
+		}
+		target, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		links[p] = string(target)
+	}
+	for p, target := range links {
+		if symlinkEscapes(p, target, links) {
+			warnings = append(warnings, PathWarning{Kind: PathSymlinkEscape, Path: p})
+		}
+	}
+
+	if len(warnings) == 0 {
+		return nil
+	}
+	sort.Slice(warnings, func(i, j int) bool {
+		if warnings[i].Path != warnings[j].Path {
+			return warnings[i].Path < warnings[j].Path
+		}
+		return warnings[i].Other < warnings[j].Other
+	})
+	return &UnsafePathsError{warnings}
+}
+
+// checkNoSymlinkParents makes sure none of the directories leading to the
+// slash separated path p below root is a symlink, which writing p would
+// follow.
+func checkNoSymlinkParents(root, p string) error {
+	dir := root
+	elems := strings.Split(p, "/")
+	for _, elem := range elems[:len(elems)-1] {
+		dir = filepath.Join(dir, elem)
+		fi, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return &UnsafePathsError{[]PathWarning{{Kind: PathSymlinkEscape, Path: p, Other: filepath.ToSlash(dir[len(root)+1:])}}}
+		}
+	}
+	return nil
+}
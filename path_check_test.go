@@ -0,0 +1,135 @@
+package git
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidatePath(t *testing.T) {
+	tests := []struct {
+		path string
+		kind string
+	}{
+		{"file", ""},
+		{"dir/sub/file.txt", ""},
+		{".gitignore", ""},
+		{"dir/.github/workflow", ""},
+		{"...", ""},
+		{"", PathTraversal},
+		{"/etc/passwd", PathTraversal},
+		{"dir/", PathTraversal},
+		{"dir//file", PathTraversal},
+		{"./file", PathTraversal},
+		{"../escaped", PathTraversal},
+		{"dir/../../escaped", PathTraversal},
+		{`a\..\..\evil`, PathTraversal},
+		{`dir\file`, PathTraversal},
+		{"c:/windows", PathTraversal},
+		{"file:stream", PathTraversal},
+		{".git/hooks/post-checkout", PathGitDir},
+		{"dir/.git/config", PathGitDir},
+		{".GIT/config", PathGitDir},
+		{".git./config", PathGitDir},
+		{".git . /config", PathGitDir},
+		{"git~1/config", PathGitDir},
+		{"GIT~1/config", PathGitDir},
+		{".g\u200cit/config", PathGitDir},
+		{".git\ufeff/config", PathGitDir},
+		{`.git\hooks\post-checkout`, PathGitDir},
+		{".git::$INDEX_ALLOCATION/hooks/x", PathGitDir},
+		{".git:$DATA", PathGitDir},
+	}
+	for _, test := range tests {
+		err := ValidatePath(test.path)
+		kind := ""
+		if uerr, ok := err.(*UnsafePathsError); ok {
+			kind = uerr.Warnings[0].Kind
+		} else if err != nil {
+			t.Errorf("%q: unexpected error %v", test.path, err)
+		}
+		if kind != test.kind {
+			t.Errorf("%q: expected %q, got %q", test.path, test.kind, kind)
+		}
+	}
+}
+
+func TestValidateSymlink(t *testing.T) {
+	tests := []struct {
+		path, target string
+		links        map[string]string
+		escapes      bool
+	}{
+		{"link", "file", nil, false},
+		{"dir/link", "../file", nil, false},
+		{"dir/link", "sub/../../file", nil, false},
+		{"link", "../file", nil, true},
+		{"dir/link", "../../file", nil, true},
+		{"link", "/etc/passwd", nil, true},
+		{"link", `\windows`, nil, true},
+		{"link", "c:/windows", nil, true},
+		{"dir/link", `..\..\file`, nil, true},
+		{"dir/link", `sub\..\file`, nil, false},
+		// through other symlinks
+		{"link", "up/file", map[string]string{"up": ".."}, true},
+		{"link", "up/file", map[string]string{"up": "dir/.."}, false},
+		{"link", "abs/file", map[string]string{"abs": "/tmp"}, true},
+		{"link", "loop/file", map[string]string{"loop": "loop"}, true},
+	}
+	for _, test := range tests {
+		err := ValidateSymlink(test.path, test.target, test.links)
+		if escapes := err != nil; escapes != test.escapes {
+			t.Errorf("%s -> %s: expected escape %v, got %v", test.path, test.target, test.escapes, err)
+		}
+	}
+}
+
+func TestCheckPaths(t *testing.T) {
+	warnings := CheckPaths([]string{
+		"README", "readme", "Dir/a", "dir/b", "dir", "aux.txt", "file.", "ok",
+	})
+	expected := []PathWarning{
+		{Kind: PathWindowsReserved, Path: "aux.txt"},
+		{Kind: PathCaseCollision, Path: "dir", Other: "Dir"},
+		{Kind: PathWindowsReserved, Path: "file."},
+		{Kind: PathCaseCollision, Path: "readme", Other: "README"},
+	}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("expected\n%v\ngot\n%v", expected, warnings)
+	}
+}
+
+func TestValidateTree(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	blob := func(data string) ObjectID {
+		id, err := repo.WriteObject(ObjectBlob, []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	file := blob("file\n")
+	files := map[string]treeFile{
+		"ok":                       {ModeBlob, file},
+		".git/hooks/post-checkout": {ModeExec, file},
+		"dir/../../escaped":        {ModeBlob, file},
+		"conflict":                 {ModeBlob, file},
+		"conflict/file":            {ModeBlob, file},
+		"dir/up":                   {ModeSymlink, blob("..")},
+		"dir/escape":               {ModeSymlink, blob("up/..")},
+		"inside":                   {ModeSymlink, blob("dir/up/ok")},
+	}
+	err := repo.validateTree(files)
+	uerr, ok := err.(*UnsafePathsError)
+	if !ok {
+		t.Fatalf("expected an *UnsafePathsError, got %v", err)
+	}
+	expected := []PathWarning{
+		{Kind: PathGitDir, Path: ".git/hooks/post-checkout"},
+		{Kind: PathFileDirConflict, Path: "conflict", Other: "conflict/file"},
+		{Kind: PathTraversal, Path: "dir/../../escaped"},
+		{Kind: PathSymlinkEscape, Path: "dir/escape"},
+	}
+	if !reflect.DeepEqual(uerr.Warnings, expected) {
+		t.Errorf("expected\n%v\ngot\n%v", expected, uerr.Warnings)
+	}
+}
@@ -0,0 +1,202 @@
+package git
+
+import (
+	"path"
+	"strings"
+)
+
+// A pathPattern is one pattern line of a .gitignore or .gitattributes
+// file.
+type pathPattern struct {
+	pattern string
+	comps   []string
+	// directory of the file the pattern was read from, "" for the root
+	base     string
+	negate   bool
+	dirOnly  bool
+	basename bool
+}
+
+// Parse a gitignore style pattern read from a file in directory base.
+func parsePathPattern(pattern, base string) *pathPattern {
+	p := &pathPattern{pattern: pattern, base: base}
+
+	if strings.HasPrefix(pattern, "!") {
+		p.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, `\!`) || strings.HasPrefix(pattern, `\#`) {
+		pattern = pattern[1:]
+	}
+
+	if strings.HasSuffix(pattern, "/") {
+		p.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+
+	if !strings.Contains(pattern, "/") {
+		p.basename = true
+	}
+	pattern = strings.TrimPrefix(pattern, "/")
+	p.comps = strings.Split(pattern, "/")
+	return p
+}
+
+// match reports whether the slash separated path, relative to the root of
+// the repository, matches the pattern.
+func (p *pathPattern) match(name string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+
+	if p.base != "" {
+		if !strings.HasPrefix(name, p.base+"/") {
+			return false
+		}
+		name = name[len(p.base)+1:]
+	}
+
+	if p.basename {
+		return globMatch(p.comps[0], path.Base(name))
+	}
+	return matchComponents(p.comps, strings.Split(name, "/"))
+}
+
+func matchComponents(pc, nc []string) bool {
+	if len(pc) == 0 {
+		return len(nc) == 0
+	}
+
+	if pc[0] == "**" {
+		// a trailing "/**" matches everything inside, but not the
+		// directory itself
+		min := 0
+		if len(pc) == 1 {
+			min = 1
+		}
+		for i := min; i <= len(nc); i++ {
+			if matchComponents(pc[1:], nc[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(nc) == 0 || !globMatch(pc[0], nc[0]) {
+		return false
+	}
+	return matchComponents(pc[1:], nc[1:])
+}
+
+// globMatch matches a single path component against a glob with *, ? and
+// bracket expressions, which may be negated with ! or ^.
+func globMatch(pattern, name string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			pattern = strings.TrimLeft(pattern, "*")
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if globMatch(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if name == "" {
+				return false
+			}
+			pattern, name = pattern[1:], name[1:]
+		case '[':
+			if name == "" {
+				return false
+			}
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 {
+				// no closing bracket, match literally
+				if name[0] != '[' {
+					return false
+				}
+				pattern, name = pattern[1:], name[1:]
+				continue
+			}
+			class := pattern[1 : end+1]
+			if end == 0 {
+				// "[]...]" contains a literal ]
+				end2 := strings.IndexByte(pattern[2:], ']')
+				if end2 < 0 {
+					return false
+				}
+				end = end2 + 1
+				class = pattern[1 : end+1]
+			}
+			if !matchClass(class, name[0]) {
+				return false
+			}
+			pattern, name = pattern[end+2:], name[1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if name == "" || pattern[0] != name[0] {
+				return false
+			}
+			pattern, name = pattern[1:], name[1:]
+		}
+	}
+	return name == ""
+}
+
+func matchClass(class string, c byte) bool {
+	negate := false
+	if len(class) > 0 && (class[0] == '!' || class[0] == '^') {
+		negate = true
+		class = class[1:]
+	}
+
+	matched := false
+	for i := 0; i < len(class); i++ {
+		if i+2 < len(class) && class[i+1] == '-' {
+			if class[i] <= c && c <= class[i+2] {
+				matched = true
+			}
+			i += 2
+			continue
+		}
+		if class[i] == c {
+			matched = true
+		}
+	}
+	return matched != negate
+}
+
+// Read the lines of a pattern file, dropping comments, blank lines and
+// unescaped trailing spaces.
+func patternLines(data []byte) []string {
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		if strings.HasPrefix(line, "#") {
+			line = ""
+		}
+		for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+			line = line[:len(line)-1]
+		}
+		lines[i] = line
+	}
+	return lines
+}
+
+// The directories above a path, outermost first, "" being the root.
+func parentDirs(name string) []string {
+	dirs := []string{""}
+	for i := 0; i < len(name); i++ {
+		if name[i] == '/' {
+			dirs = append(dirs, name[:i])
+		}
+	}
+	return dirs
+}
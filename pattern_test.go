@@ -0,0 +1,32 @@
+package git
+
+import (
+	"testing"
+)
+
+func TestPathPatternMatch(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		match         bool
+	}{
+		{"*.o", "a/b.o", true},
+		{"/build", "build", true},
+		{"/build", "x/build", false},
+		{"doc/**/x", "doc/x", true},
+		{"doc/**/x", "doc/a/b/x", true},
+		{"a/**", "a", false},
+		{"a/**", "a/b/c", true},
+		{"**/foo", "a/foo", true},
+		{"[!a]x", "bx", true},
+		{"[!a]x", "ax", false},
+		{`f\*`, "f*", true},
+		{`f\*`, "fo", false},
+	}
+
+	for _, test := range tests {
+		p := parsePathPattern(test.pattern, "")
+		if m := p.match(test.path, false); m != test.match {
+			t.Errorf("%q on %q: expected %v, got %v", test.pattern, test.path, test.match, m)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package git
+
+type PushEventOptions struct {
+	// Who pushed, e.g. the authenticated user. Optional.
+	Pusher *Signature
+	// List at most this many commits per ref, the newest ones. 0 lists
+	// all.
+	MaxCommits int
+}
+
+// A PushEvent describes the ref updates of a push, for post-receive
+// notifications like webhooks. It marshals to JSON as is.
+type PushEvent struct {
+	Pusher *Signature   `json:"pusher,omitempty"`
+	Refs   []*PushedRef `json:"refs"`
+}
+
+// A PushedRef is an updated ref of a push. Before is zero for a created
+// ref, After is zero for a deleted one.
+type PushedRef struct {
+	Ref     string   `json:"ref"`
+	Before  ObjectID `json:"before"`
+	After   ObjectID `json:"after"`
+	Created bool     `json:"created"`
+	Deleted bool     `json:"deleted"`
+	// Set if Before is not an ancestor of After, i.e. commits were
+	// dropped from the ref.
+	Forced bool `json:"forced"`
+	// The pushed commits, oldest first.
+	Commits []*PushedCommit `json:"commits"`
+	// The number of pushed commits, more than len(Commits) if MaxCommits
+	// left some out.
+	TotalCommits int `json:"total_commits"`
+}
+
+type PushedCommit struct {
+	Id        ObjectID   `json:"id"`
+	Summary   string     `json:"summary"`
+	Message   string     `json:"message"`
+	Author    *Signature `json:"author"`
+	Committer *Signature `json:"committer"`
+}
+
+// NewPushEvent builds the event of a push that made the given ref
+// updates; call it once they are applied. The commits of an updated ref
+// are those reachable from its new id but not from its old one. For a
+// created ref, or one whose old id isn't a commit anymore, they are the
+// commits not on any branch left alone by the push, so pushing a branch
+// or tag of commits that are already on a branch lists none.
+func (repo *Repository) NewPushEvent(updates []RefEvent, opts PushEventOptions) (*PushEvent, error) {
+	event := &PushEvent{Pusher: opts.Pusher, Refs: make([]*PushedRef, 0, len(updates))}
+	var others []ObjectID
+	for _, u := range updates {
+		ref := &PushedRef{
+			Ref:     u.Name,
+			Before:  u.Old,
+			After:   u.New,
+			Created: u.Old.IsZero(),
+			Deleted: u.New.IsZero(),
+			Commits: []*PushedCommit{},
+		}
+		event.Refs = append(event.Refs, ref)
+		if ref.Deleted {
+			continue
+		}
+		tip, tp, err := repo.peel(u.New)
+		if err != nil {
+			return nil, err
+		}
+		if tp != ObjectCommit {
+			continue
+		}
+
+		var exclude []ObjectID
+		if !ref.Created {
+			if old, tp, err := repo.peel(u.Old); err == nil && tp == ObjectCommit {
+				exclude = []ObjectID{old}
+				isAncestor, err := repo.isAncestor(old, tip)
+				if err != nil {
+					return nil, err
+				}
+				ref.Forced = !isAncestor
+			}
+		}
+		if exclude == nil {
+			if others == nil {
+				if others, err = repo.untouchedBranchTips(updates); err != nil {
+					return nil, err
+				}
+			}
+			exclude = others
+		}
+
+		commits, err := repo.commitsNotIn(tip, exclude)
+		if err != nil {
+			return nil, err
+		}
+		ref.TotalCommits = len(commits)
+		if opts.MaxCommits > 0 && len(commits) > opts.MaxCommits {
+			commits = commits[:opts.MaxCommits]
+		}
+		for i := len(commits) - 1; i >= 0; i-- {
+			c := commits[i]
+			ref.Commits = append(ref.Commits, &PushedCommit{
+				Id:        c.Id,
+				Summary:   c.Summary(),
+				Message:   c.CommitMessage,
+				Author:    c.Author,
+				Committer: c.Committer,
+			})
+		}
+	}
+	return event, nil
+}
+
+// Return the commits the branches not in updates point at.
+func (repo *Repository) untouchedBranchTips(updates []RefEvent) ([]ObjectID, error) {
+	updated := make(map[string]bool, len(updates))
+	for _, u := range updates {
+		updated[u.Name] = true
+	}
+	tips := []ObjectID{}
+	err := repo.ForEachRef("refs/heads/", func(ref Ref) error {
+		if updated[ref.Name] {
+			return nil
+		}
+		id, tp, err := repo.peel(ref.Id)
+		if err != nil {
+			return err
+		}
+		if tp == ObjectCommit {
+			tips = append(tips, id)
+		}
+		return nil
+	})
+	return tips, err
+}
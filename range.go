@@ -0,0 +1,80 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Resolve a range like "a..b", the commits reachable from b but not from
+// a, or a single revision, all commits reachable from it. An empty side of
+// ".." is HEAD. old is zero for a single revision.
+func (repo *Repository) parseRange(spec string) (old, tip ObjectID, err error) {
+	from, to := "", spec
+	if i := strings.Index(spec, ".."); i >= 0 {
+		from, to = spec[:i], spec[i+2:]
+		if strings.HasPrefix(to, ".") {
+			return old, tip, fmt.Errorf("symmetric range %q isn't supported", spec)
+		}
+		if from == "" {
+			from = "HEAD"
+		}
+		if to == "" {
+			to = "HEAD"
+		}
+	}
+	if tip, err = repo.resolveRevision(to); err != nil {
+		return old, tip, err
+	}
+	if from != "" {
+		old, err = repo.resolveRevision(from)
+	}
+	return old, tip, err
+}
+
+// RangeCommits returns the commits in a range like "a..b", newest first.
+// A single revision is a range of all commits reachable from it. Ranges
+// ending at a branch without commits are empty.
+func (repo *Repository) RangeCommits(rangeSpec string) ([]*Commit, error) {
+	old, tip, err := repo.parseRange(rangeSpec)
+	if err == ErrUnbornBranch {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return repo.newCommits(old, tip)
+}
+
+// A RangeClassification splits the commits of a range into merges and
+// other commits, both newest first.
+type RangeClassification struct {
+	Merges    []*Commit
+	NonMerges []*Commit
+}
+
+// ClassifyRange sorts the commits in a range into merges and non-merges,
+// e.g. to leave merges out of release notes.
+func (repo *Repository) ClassifyRange(rangeSpec string) (*RangeClassification, error) {
+	commits, err := repo.RangeCommits(rangeSpec)
+	if err != nil {
+		return nil, err
+	}
+	rc := new(RangeClassification)
+	for _, c := range commits {
+		if c.ParentCount() > 1 {
+			rc.Merges = append(rc.Merges, c)
+		} else {
+			rc.NonMerges = append(rc.NonMerges, c)
+		}
+	}
+	return rc, nil
+}
+
+// IsLinear reports whether there are no merges in a range, as a "require
+// linear history" rule asks for.
+func (repo *Repository) IsLinear(rangeSpec string) (bool, error) {
+	rc, err := repo.ClassifyRange(rangeSpec)
+	if err != nil {
+		return false, err
+	}
+	return len(rc.Merges) == 0, nil
+}
@@ -0,0 +1,443 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrRebaseEdit is returned by Rebase.Run when it stops after an edit
+	// step, for the commit to be amended.
+	ErrRebaseEdit = errors.New("rebase stopped for editing")
+	ErrRebaseDone = errors.New("rebase already done")
+)
+
+// A RebaseAction is what a step of an interactive rebase does with its
+// commit, like the commands of a git rebase -i todo list.
+type RebaseAction string
+
+const (
+	// Replay the commit.
+	RebasePick RebaseAction = "pick"
+	// Replay the commit with the message of the step.
+	RebaseReword RebaseAction = "reword"
+	// Replay the commit and stop for it to be amended.
+	RebaseEdit RebaseAction = "edit"
+	// Meld the commit into the previous one, with both messages or the
+	// message of the step.
+	RebaseSquash RebaseAction = "squash"
+	// Meld the commit into the previous one, keeping its message.
+	RebaseFixup RebaseAction = "fixup"
+	// Leave the commit out.
+	RebaseDrop RebaseAction = "drop"
+)
+
+// A RebaseStep is an entry of a RebasePlan.
+type RebaseStep struct {
+	Action RebaseAction
+	Commit ObjectID
+	// The message for reword and squash steps. A squash without one
+	// joins the messages of the melded commits.
+	Message string
+}
+
+// A RebasePlan is the todo list of an interactive rebase: the commits to
+// replay on Onto, in order. Build one with NewRebasePlan and reorder or
+// change its steps, or from scratch.
+type RebasePlan struct {
+	Onto  ObjectID
+	Steps []RebaseStep
+	// If set, the branch is pointed at the result once all steps are
+	// done.
+	Branch string
+}
+
+type RebasePlanOptions struct {
+	// Move commits made with CreateFixupCommit and CreateSquashCommit
+	// after the commits they fix, as fixup and squash steps, like git
+	// rebase --autosquash.
+	Autosquash bool
+}
+
+// NewRebasePlan returns the plan of git rebase -i upstream branch before
+// editing: a pick step for each commit reachable from branch but not from
+// upstream, oldest first, to be replayed on upstream. Merges are left out.
+// If branch names a branch, the plan updates it.
+func (repo *Repository) NewRebasePlan(upstream, branch string) (*RebasePlan, error) {
+	return repo.NewRebasePlanWithOptions(upstream, branch, RebasePlanOptions{})
+}
+
+// NewRebasePlanWithOptions is like NewRebasePlan, with options.
+func (repo *Repository) NewRebasePlanWithOptions(upstream, branch string, opts RebasePlanOptions) (*RebasePlan, error) {
+	onto, err := repo.resolveRevision(upstream)
+	if err != nil {
+		return nil, err
+	}
+	tip, err := repo.resolveRevision(branch)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := repo.commitsNotIn(tip, []ObjectID{onto})
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &RebasePlan{Onto: onto}
+	if _, exists, err := repo.lookupRef("refs/heads/" + branch); err != nil {
+		return nil, err
+	} else if exists {
+		plan.Branch = branch
+	}
+	var picked []*Commit
+	for i := len(commits) - 1; i >= 0; i-- {
+		if commits[i].ParentCount() > 1 {
+			continue
+		}
+		picked = append(picked, commits[i])
+		plan.Steps = append(plan.Steps, RebaseStep{Action: RebasePick, Commit: commits[i].Id})
+	}
+	if opts.Autosquash {
+		plan.Steps = autosquash(picked)
+	}
+	return plan, nil
+}
+
+// Order the commits, oldest first, for git rebase --autosquash: a commit
+// whose subject is "fixup! " or "squash! " and the subject of an earlier
+// commit, or the start of its id or subject, is moved after that commit
+// and the ones already moved there, as a fixup or squash step.
+func autosquash(commits []*Commit) []RebaseStep {
+	// the steps to put after each commit
+	melded := make(map[int][]RebaseStep)
+	isMelded := make([]bool, len(commits))
+	for i, c := range commits {
+		subject := c.Summary()
+		action := RebaseAction("")
+		// "fixup! fixup! x" fixes the commit x as well
+		for {
+			if s := strings.TrimPrefix(subject, "fixup! "); s != subject {
+				subject = s
+				if action == "" {
+					action = RebaseFixup
+				}
+			} else if s := strings.TrimPrefix(subject, "squash! "); s != subject {
+				subject = s
+				if action == "" {
+					action = RebaseSquash
+				}
+			} else {
+				break
+			}
+		}
+		if action == "" {
+			continue
+		}
+		target := findFixupTarget(commits[:i], isMelded[:i], subject)
+		if target < 0 {
+			continue
+		}
+		isMelded[i] = true
+		melded[target] = append(melded[target], RebaseStep{Action: action, Commit: c.Id})
+	}
+
+	steps := make([]RebaseStep, 0, len(commits))
+	for i, c := range commits {
+		if isMelded[i] {
+			continue
+		}
+		steps = append(steps, RebaseStep{Action: RebasePick, Commit: c.Id})
+		steps = append(steps, melded[i]...)
+	}
+	return steps
+}
+
+// Return the index of the commit a fixup of subject is for, -1 if there
+// is none. Commits that are fixups themselves don't count.
+func findFixupTarget(commits []*Commit, isMelded []bool, subject string) int {
+	for i, c := range commits {
+		if !isMelded[i] && c.Summary() == subject {
+			return i
+		}
+	}
+	if hex := strings.ToLower(subject); len(hex) >= 4 && strings.Trim(hex, "0123456789abcdef") == "" {
+		for i, c := range commits {
+			if !isMelded[i] && strings.HasPrefix(c.Id.String(), hex) {
+				return i
+			}
+		}
+	}
+	for i, c := range commits {
+		if !isMelded[i] && strings.HasPrefix(c.Summary(), subject) {
+			return i
+		}
+	}
+	return -1
+}
+
+// A RebaseStepResult is the outcome of a step of a rebase.
+type RebaseStepResult struct {
+	Step RebaseStep
+	// The commit the step made, or the replayed commit itself if it could
+	// be kept as is. Zero for dropped commits, and for picked commits that
+	// don't change anything anymore, which are dropped too.
+	Commit ObjectID
+}
+
+// A Rebase executes a RebasePlan. Commits are replayed in the object
+// database, the working tree and HEAD aren't touched; nothing but the
+// branch of the plan, at the end, is updated.
+type Rebase struct {
+	repo *Repository
+	plan *RebasePlan
+	// where plan.Branch was at the start
+	branchTip ObjectID
+	head      ObjectID
+	next      int
+	// the step stopped by conflicts, until it's resolved
+	conflicted *RebaseStep
+	conflicts  []string
+	// stopped after an edit step
+	editing  bool
+	finished bool
+	results  []RebaseStepResult
+}
+
+// StartRebase checks the plan and returns a Rebase to execute it with Run.
+func (repo *Repository) StartRebase(plan *RebasePlan) (*Rebase, error) {
+	melded := false
+	for i, step := range plan.Steps {
+		switch step.Action {
+		case RebasePick, RebaseReword, RebaseEdit:
+			melded = true
+		case RebaseSquash, RebaseFixup:
+			if !melded {
+				return nil, fmt.Errorf("step %d: cannot %s without a previous commit", i+1, step.Action)
+			}
+		case RebaseDrop:
+		default:
+			return nil, fmt.Errorf("step %d: unknown action %q", i+1, step.Action)
+		}
+	}
+
+	r := &Rebase{repo: repo, plan: plan, head: plan.Onto}
+	if plan.Branch != "" {
+		ref, exists, err := repo.lookupRef("refs/heads/" + plan.Branch)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrNotExist
+		}
+		r.branchTip = ref.Id
+	}
+	return r, nil
+}
+
+// Head returns the commit the rebase is at: the result of the last step
+// done, or Onto before the first.
+func (r *Rebase) Head() ObjectID {
+	return r.head
+}
+
+// Results returns the outcome of the steps done so far.
+func (r *Rebase) Results() []RebaseStepResult {
+	return r.results
+}
+
+// Done tells whether all steps are done and the branch is updated.
+func (r *Rebase) Done() bool {
+	return r.finished
+}
+
+// Run executes the steps that are left. It returns nil once all are done
+// and the branch is updated; if the branch was updated meanwhile, a
+// *RefChangedError is returned and the result is left at Head. Run stops
+// early with ErrRebaseEdit after an edit step, for Amend, and with a
+// *MergeConflictError if a commit doesn't apply, for Resolve; call Run
+// again to go on.
+func (r *Rebase) Run() error {
+	if r.finished {
+		return ErrRebaseDone
+	}
+	if r.conflicted != nil {
+		return &MergeConflictError{Paths: r.conflicts}
+	}
+	r.editing = false
+	for r.next < len(r.plan.Steps) {
+		step := r.plan.Steps[r.next]
+		r.next++
+		if step.Action == RebaseDrop {
+			r.results = append(r.results, RebaseStepResult{Step: step})
+			continue
+		}
+
+		c, err := r.repo.getCommit(step.Commit)
+		if err != nil {
+			return err
+		}
+		if (step.Action == RebasePick || step.Action == RebaseEdit) && c.ParentCount() > 0 && c.parents[0].Equal(r.head) {
+			// already in place
+			r.head = c.Id
+			r.results = append(r.results, RebaseStepResult{Step: step, Commit: c.Id})
+		} else {
+			tree, conflicts, err := r.apply(c)
+			if err != nil {
+				return err
+			}
+			if len(conflicts) > 0 {
+				r.conflicted, r.conflicts = &step, conflicts
+				return &MergeConflictError{Paths: conflicts}
+			}
+			if err := r.commit(step, c, tree); err != nil {
+				return err
+			}
+		}
+		if step.Action == RebaseEdit {
+			r.editing = true
+			return ErrRebaseEdit
+		}
+	}
+
+	if r.plan.Branch != "" {
+		if err := r.repo.UpdateRef("refs/heads/"+r.plan.Branch, r.head, r.branchTip); err != nil {
+			return err
+		}
+	}
+	r.finished = true
+	return nil
+}
+
+// Resolve finishes the step stopped by conflicts with tree, the tree the
+// commit should have after the conflicts are resolved. An edit step is
+// then stopped for editing.
+func (r *Rebase) Resolve(tree ObjectID) error {
+	if r.conflicted == nil {
+		return errors.New("no conflicts to resolve")
+	}
+	c, err := r.repo.getCommit(r.conflicted.Commit)
+	if err != nil {
+		return err
+	}
+	if err := r.commit(*r.conflicted, c, tree); err != nil {
+		return err
+	}
+	r.editing = r.conflicted.Action == RebaseEdit
+	r.conflicted, r.conflicts = nil, nil
+	return nil
+}
+
+// Amend replaces the commit of the edit step Run stopped at with one with
+// tree and message. A zero tree or empty message keeps the one of the
+// commit.
+func (r *Rebase) Amend(tree ObjectID, message string) error {
+	if !r.editing {
+		return errors.New("rebase is not stopped for editing")
+	}
+	if r.results[len(r.results)-1].Commit.IsZero() {
+		return errors.New("the commit to edit was dropped, it changes nothing")
+	}
+	c, err := r.repo.getCommit(r.head)
+	if err != nil {
+		return err
+	}
+	opts := CommitOptions{Tree: tree, Parents: c.parents, Author: c.Author, Message: message}
+	if tree.IsZero() {
+		opts.Tree = c.Tree.Id
+	}
+	if message == "" {
+		opts.Message = c.CommitMessage
+	}
+	id, err := r.repo.CreateCommit(opts)
+	if err != nil {
+		return err
+	}
+	r.head = id
+	r.results[len(r.results)-1].Commit = id
+	return nil
+}
+
+// Apply the changes of c, against its first parent, to the tree of the
+// head. Returns the merged tree, or the conflicting paths.
+func (r *Rebase) apply(c *Commit) (ObjectID, []string, error) {
+	base := make(map[string]treeFile)
+	if c.ParentCount() > 0 {
+		parent, err := c.Parent(0)
+		if err != nil {
+			return ObjectID{}, nil, err
+		}
+		if base, err = r.repo.flattenTree(&parent.Tree); err != nil {
+			return ObjectID{}, nil, err
+		}
+	}
+	head, err := r.repo.getCommit(r.head)
+	if err != nil {
+		return ObjectID{}, nil, err
+	}
+	ours, err := r.repo.flattenTree(&head.Tree)
+	if err != nil {
+		return ObjectID{}, nil, err
+	}
+	theirs, err := r.repo.flattenTree(&c.Tree)
+	if err != nil {
+		return ObjectID{}, nil, err
+	}
+	merged, conflicts := mergeFlatTrees(base, ours, theirs)
+	if len(conflicts) > 0 {
+		return ObjectID{}, conflicts, nil
+	}
+	tree, err := r.repo.writeTree(merged)
+	return tree, nil, err
+}
+
+// Write the commit of the step replaying c with tree, and move the head to
+// it.
+func (r *Rebase) commit(step RebaseStep, c *Commit, tree ObjectID) error {
+	head, err := r.repo.getCommit(r.head)
+	if err != nil {
+		return err
+	}
+	opts := CommitOptions{Tree: tree, Parents: []ObjectID{r.head}, Author: c.Author, Message: c.CommitMessage}
+	switch step.Action {
+	case RebasePick, RebaseEdit:
+		if tree.Equal(head.Tree.Id) {
+			// nothing left to change
+			r.results = append(r.results, RebaseStepResult{Step: step})
+			return nil
+		}
+	case RebaseReword:
+		if step.Message != "" {
+			opts.Message = step.Message
+		}
+	case RebaseSquash, RebaseFixup:
+		opts.Parents = head.parents
+		opts.Author = head.Author
+		opts.Message = head.CommitMessage
+		if step.Action == RebaseSquash {
+			if step.Message != "" {
+				opts.Message = step.Message
+			} else {
+				opts.Message = head.CommitMessage + "\n" + squashMessage(c.CommitMessage)
+			}
+		}
+	}
+	id, err := r.repo.CreateCommit(opts)
+	if err != nil {
+		return err
+	}
+	r.head = id
+	r.results = append(r.results, RebaseStepResult{Step: step, Commit: id})
+	return nil
+}
+
+// Return the message of a squashed commit to add to the one it's melded
+// into, without the subject of a commit made by CreateSquashCommit.
+func squashMessage(msg string) string {
+	if !strings.HasPrefix(msg, "squash! ") {
+		return msg
+	}
+	if i := strings.Index(msg, "\n\n"); i >= 0 {
+		return strings.TrimLeft(msg[i+2:], "\n")
+	}
+	return ""
+}
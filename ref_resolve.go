@@ -0,0 +1,109 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrRefLoop is returned for symbolic refs that point to each other,
+	// or nest deeper than git follows them.
+	ErrRefLoop = errors.New("symbolic refs loop or nest too deep")
+)
+
+// git reads at most this many refs, symbolic or not, resolving one
+const maxSymrefDepth = 5
+
+// ResolveRef follows the ref name, e.g. "HEAD" or
+// "refs/remotes/origin/HEAD", through the symbolic refs it points to. The
+// returned ref has the id the chain ends at, and, if name is symbolic, the
+// name of the last ref of the chain as Target. It returns ErrNotExist if a
+// ref of the chain doesn't exist, and ErrRefLoop if the chain loops.
+func (repo *Repository) ResolveRef(name string) (Ref, error) {
+	if repo.snapshot != nil {
+		if ref, ok := repo.snapshot.refs[name]; ok {
+			return ref, nil
+		}
+		return Ref{}, ErrNotExist
+	}
+
+	ref := Ref{Name: name}
+	seen := make(map[string]bool)
+	for {
+		if seen[name] || len(seen) >= maxSymrefDepth {
+			return Ref{}, ErrRefLoop
+		}
+		seen[name] = true
+		target, id, err := repo.readRef(name)
+		if err != nil {
+			return Ref{}, err
+		}
+		if target == "" {
+			ref.Id = id
+			return ref, nil
+		}
+		ref.Target, name = target, target
+	}
+}
+
+// Read the ref name, loose or packed, without following it. Returns the
+// ref it points to if it's symbolic, its id otherwise.
+func (repo *Repository) readRef(name string) (string, ObjectID, error) {
+	if ref, ok := repo.dryRunRef(name); ok {
+		if ref.deleted {
+			return "", ObjectID{}, ErrNotExist
+		}
+		return ref.target, ref.id, nil
+	}
+	refPath := filepath.Join(repo.Path, filepath.FromSlash(name))
+	data, err := ioutil.ReadFile(refPath)
+	if err != nil && !isFile(refPath) {
+		// missing, a directory, or below a ref in the way
+		ref, ok, err := repo.findPackedRef(name)
+		if err != nil {
+			return "", ObjectID{}, err
+		}
+		if !ok {
+			return "", ObjectID{}, ErrNotExist
+		}
+		return "", ref.Id, nil
+	} else if err != nil {
+		return "", ObjectID{}, err
+	}
+
+	if bytes.HasPrefix(data, []byte("ref: ")) {
+		return strings.TrimSpace(string(data[5:])), ObjectID{}, nil
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) < 40 {
+		return "", ObjectID{}, errors.New("sha1 hash too short")
+	}
+	id, err := NewIdFromString(string(data[:40]))
+	return "", id, err
+}
+
+// Head returns HEAD resolved: with the branch it points to as Target, or
+// no Target if it's detached. It returns ErrUnbornBranch if the branch has
+// no commits yet.
+func (repo *Repository) Head() (Ref, error) {
+	ref, err := repo.ResolveRef("HEAD")
+	if err == ErrNotExist {
+		if unborn, uerr := repo.IsUnborn(); uerr == nil && unborn {
+			return Ref{}, ErrUnbornBranch
+		}
+	}
+	return ref, err
+}
+
+// IsHeadDetached reports whether HEAD points directly at a commit rather
+// than at a branch.
+func (repo *Repository) IsHeadDetached() (bool, error) {
+	target, err := repo.headTarget()
+	if err != nil {
+		return false, err
+	}
+	return target == "", nil
+}
@@ -0,0 +1,71 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func writeSymref(t *testing.T, repo *Repository, name, target string) {
+	t.Helper()
+	err := ioutil.WriteFile(filepath.Join(repo.Path, filepath.FromSlash(name)), []byte("ref: "+target+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolveRef(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	master := refId(t, repo, "refs/heads/master")
+
+	ref, err := repo.ResolveRef("HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref.Target != "refs/heads/master" || !ref.Id.Equal(master) {
+		t.Errorf("HEAD resolved to %s at %s", ref.Target, ref.Id)
+	}
+	if _, err := repo.ResolveRef("refs/heads/missing"); err != ErrNotExist {
+		t.Errorf("expected ErrNotExist, got %v", err)
+	}
+	writeSymref(t, repo, "refs/heads/dangling", "refs/heads/missing")
+	if _, err := repo.ResolveRef("refs/heads/dangling"); err != ErrNotExist {
+		t.Errorf("dangling symref: expected ErrNotExist, got %v", err)
+	}
+}
+
+func TestResolveRefLoop(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	master := refId(t, repo, "refs/heads/master")
+
+	writeSymref(t, repo, "refs/heads/a", "refs/heads/b")
+	writeSymref(t, repo, "refs/heads/b", "refs/heads/a")
+	if _, err := repo.ResolveRef("refs/heads/a"); err != ErrRefLoop {
+		t.Errorf("symrefs pointing at each other: expected ErrRefLoop, got %v", err)
+	}
+	writeSymref(t, repo, "refs/heads/self", "refs/heads/self")
+	if _, err := repo.ResolveRef("refs/heads/self"); err != ErrRefLoop {
+		t.Errorf("symref pointing at itself: expected ErrRefLoop, got %v", err)
+	}
+
+	// s1 -> s2 -> ... -> s6 -> master
+	for i := 1; i <= 6; i++ {
+		target := fmt.Sprintf("refs/heads/s%d", i+1)
+		if i == 6 {
+			target = "refs/heads/master"
+		}
+		writeSymref(t, repo, fmt.Sprintf("refs/heads/s%d", i), target)
+	}
+	// git reads at most five refs: four symrefs and the ref they end at
+	ref, err := repo.ResolveRef("refs/heads/s3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ref.Id.Equal(master) {
+		t.Errorf("s3 resolved to %s, expected %s", ref.Id, master)
+	}
+	if _, err := repo.ResolveRef("refs/heads/s2"); err != ErrRefLoop {
+		t.Errorf("five symrefs deep: expected ErrRefLoop, got %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+var errTransactionDone = errors.New("ref transaction already committed")
+
+// A RefTransaction updates several refs at once, like git update-ref
+// --stdin: either all updates are made, or none is. Updates are staged with
+// Create, Update and Delete and made by Commit, which locks all the refs
+// first, so that concurrent writers following git's locking protocol can
+// neither see nor cause a partial update.
+type RefTransaction struct {
+	repo    *Repository
+	updates []refUpdate
+	done    bool
+}
+
+type refUpdate struct {
+	name   string
+	id     ObjectID
+	delete bool
+	// the id the ref must be at, zero if it must not exist; nil if it
+	// isn't checked
+	old *ObjectID
+}
+
+// NewRefTransaction returns an empty RefTransaction.
+func (repo *Repository) NewRefTransaction() *RefTransaction {
+	return &RefTransaction{repo: repo}
+}
+
+// Create stages creating the ref name at id. The ref must not exist.
+func (tx *RefTransaction) Create(name string, id ObjectID) {
+	tx.Update(name, id, ObjectID{})
+}
+
+// Update stages pointing the ref name at id. The ref must be at old, or
+// not exist if old is zero.
+func (tx *RefTransaction) Update(name string, id, old ObjectID) {
+	tx.updates = append(tx.updates, refUpdate{name: name, id: id, old: &old})
+}
+
+// Delete stages deleting the ref name, loose and packed, with its reflog.
+// The ref must be at old unless old is zero; deleting a ref that doesn't
+// exist does nothing.
+func (tx *RefTransaction) Delete(name string, old ObjectID) {
+	u := refUpdate{name: name, delete: true}
+	if !old.IsZero() {
+		u.old = &old
+	}
+	tx.updates = append(tx.updates, u)
+}
+
+// set stages pointing the ref name at id whatever it is at.
+func (tx *RefTransaction) set(name string, id ObjectID) {
+	tx.updates = append(tx.updates, refUpdate{name: name, id: id})
+}
+
+// Commit makes the staged updates. The refs are locked and checked
+// against their expected ids first; if a ref is locked by someone else it
+// fails with a *LockError, if it isn't at its expected id with a
+// *RefChangedError, and no ref is changed. A transaction can only be
+// committed once.
+func (tx *RefTransaction) Commit() error {
+	if tx.done {
+		return errTransactionDone
+	}
+	tx.done = true
+	repo := tx.repo
+
+	// locked in name order, so that transactions can't deadlock
+	updates := append([]refUpdate(nil), tx.updates...)
+	sort.SliceStable(updates, func(i, j int) bool { return updates[i].name < updates[j].name })
+	for i, u := range updates {
+		if err := checkRefName(u.name); err != nil {
+			return err
+		}
+		if i > 0 && updates[i-1].name == u.name {
+			return fmt.Errorf("ref %s is updated twice", u.name)
+		}
+	}
+	if repo.dryRun != nil {
+		exist := make([]bool, len(updates))
+		for i, u := range updates {
+			ref, exists, err := repo.lookupRef(u.name)
+			if err != nil {
+				return err
+			}
+			if u.old != nil && !ref.Id.Equal(*u.old) {
+				return &RefChangedError{Name: u.name, Expected: *u.old, Actual: ref.Id}
+			}
+			exist[i] = exists
+		}
+		for i, u := range updates {
+			if u.delete {
+				if !exist[i] {
+					continue
+				}
+				repo.recordRefUpdate(ChangeDeleteRef, u.name, ObjectID{})
+			} else {
+				repo.recordRefUpdate(ChangeUpdateRef, u.name, u.id)
+			}
+		}
+		return nil
+	}
+	if repo.snapshot != nil {
+		return ErrReadOnlySnapshot
+	}
+
+	locks := make([]*lockFile, len(updates))
+	refPaths := make([]string, len(updates))
+	defer func() {
+		for i, lock := range locks {
+			if lock != nil {
+				lock.rollback()
+				// directories made for the lock
+				repo.removeEmptyRefDirs(refPaths[i])
+			}
+		}
+	}()
+	for i, u := range updates {
+		refPaths[i] = filepath.Join(repo.Path, filepath.FromSlash(u.name))
+		if err := os.MkdirAll(filepath.Dir(refPaths[i]), os.ModePerm); err != nil {
+			return err
+		}
+		lock, err := repo.lock(refPaths[i], FsyncReference)
+		if err != nil {
+			return err
+		}
+		locks[i] = lock
+	}
+
+	olds := make([]ObjectID, len(updates))
+	pruned := make(map[string]bool)
+	for i, u := range updates {
+		ref, exists, err := repo.lookupRef(u.name)
+		if err != nil {
+			return err
+		}
+		olds[i] = ref.Id
+		if u.old != nil && !ref.Id.Equal(*u.old) {
+			return &RefChangedError{Name: u.name, Expected: *u.old, Actual: ref.Id}
+		}
+		if u.delete {
+			if exists {
+				pruned[u.name] = true
+			}
+			continue
+		}
+		if _, err := locks[i].WriteString(u.id.String() + "\n"); err != nil {
+			return err
+		}
+	}
+
+	// packed-refs goes first, if it can't be rewritten no ref is changed
+	if len(pruned) > 0 {
+		lock, err := repo.lockPackedRefsWithout(pruned)
+		if err != nil {
+			return err
+		}
+		if lock != nil {
+			if err := lock.commit(); err != nil {
+				return err
+			}
+		}
+	}
+	for i, u := range updates {
+		if u.delete {
+			if err := os.Remove(refPaths[i]); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			logPath := filepath.Join(repo.Path, "logs", filepath.FromSlash(u.name))
+			if err := os.Remove(logPath); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			locks[i].rollback()
+			locks[i] = nil
+			repo.removeEmptyRefDirs(refPaths[i])
+			continue
+		}
+		err := locks[i].commit()
+		locks[i] = nil
+		if err != nil {
+			return err
+		}
+	}
+
+	var indexNames []string
+	var indexOlds, indexTips []ObjectID
+	for i, u := range updates {
+		if u.delete {
+			if pruned[u.name] {
+				repo.log().Debug("deleted ref", "ref", u.name, "id", olds[i].String())
+			}
+			continue
+		}
+		repo.log().Debug("updated ref", "ref", u.name, "id", u.id.String())
+		indexNames = append(indexNames, u.name)
+		indexOlds = append(indexOlds, olds[i])
+		indexTips = append(indexTips, u.id)
+		repo.adoptFirstBranch(u.name)
+	}
+	repo.indexRefUpdates(indexNames, indexOlds, indexTips)
+	return nil
+}
@@ -0,0 +1,175 @@
+package git
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Open a copy of testdata/test.git that the test may change.
+func openTestRepoCopy(t *testing.T) *Repository {
+	t.Helper()
+	return openTestRepoAt(t, filepath.Join(t.TempDir(), "test.git"))
+}
+
+// Open a copy of testdata/test.git as the .git directory of an empty
+// working tree.
+func openTestWorkTree(t *testing.T) *Repository {
+	t.Helper()
+	return openTestRepoAt(t, filepath.Join(t.TempDir(), ".git"))
+}
+
+func openTestRepoAt(t *testing.T, dir string) *Repository {
+	t.Helper()
+	err := filepath.Walk("testdata/test.git", func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel("testdata/test.git", p)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(dir, rel)
+		if fi.IsDir() {
+			return os.MkdirAll(dst, 0755)
+		}
+		in, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.Create(dst)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := OpenRepository(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func refId(t *testing.T, repo *Repository, name string) ObjectID {
+	t.Helper()
+	ref, err := repo.ResolveRef(name)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return ref.Id
+}
+
+func TestRefTransaction(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	master := refId(t, repo, "refs/heads/master")
+	other := refId(t, repo, "refs/heads/main-bad")
+
+	tx := repo.NewRefTransaction()
+	tx.Create("refs/heads/new", master)
+	tx.Update("refs/heads/master", other, master)
+	tx.Delete("refs/heads/main-bad", other)
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if id := refId(t, repo, "refs/heads/new"); !id.Equal(master) {
+		t.Errorf("new is at %s, expected %s", id, master)
+	}
+	if id := refId(t, repo, "refs/heads/master"); !id.Equal(other) {
+		t.Errorf("master is at %s, expected %s", id, other)
+	}
+	if _, err := repo.ResolveRef("refs/heads/main-bad"); err != ErrNotExist {
+		t.Errorf("main-bad wasn't deleted: %v", err)
+	}
+	if err := tx.Commit(); err != errTransactionDone {
+		t.Errorf("second commit: expected errTransactionDone, got %v", err)
+	}
+}
+
+func TestRefTransactionAllOrNothing(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	master := refId(t, repo, "refs/heads/master")
+	other := refId(t, repo, "refs/heads/main-bad")
+
+	tx := repo.NewRefTransaction()
+	tx.Update("refs/heads/independent-branch", master, refId(t, repo, "refs/heads/independent-branch"))
+	// master isn't at other
+	tx.Update("refs/heads/master", master, other)
+	err := tx.Commit()
+	changed, ok := err.(*RefChangedError)
+	if !ok {
+		t.Fatalf("expected a *RefChangedError, got %v", err)
+	}
+	if changed.Name != "refs/heads/master" || !changed.Actual.Equal(master) {
+		t.Errorf("wrong error %v", changed)
+	}
+	if id := refId(t, repo, "refs/heads/independent-branch"); id.Equal(master) {
+		t.Error("independent-branch was updated by a failed transaction")
+	}
+	if _, err := os.Stat(filepath.Join(repo.Path, "refs/heads/master.lock")); !os.IsNotExist(err) {
+		t.Errorf("lock file left behind: %v", err)
+	}
+}
+
+func TestRefTransactionChecks(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	master := refId(t, repo, "refs/heads/master")
+
+	tests := []struct {
+		name   string
+		update func(tx *RefTransaction)
+	}{
+		{"existing ref created", func(tx *RefTransaction) {
+			tx.Create("refs/heads/master", master)
+		}},
+		{"invalid name", func(tx *RefTransaction) {
+			tx.Create("refs/heads/a..b", master)
+		}},
+		{"ref updated twice", func(tx *RefTransaction) {
+			tx.Create("refs/heads/x", master)
+			tx.Create("refs/heads/x", master)
+		}},
+	}
+	for _, test := range tests {
+		tx := repo.NewRefTransaction()
+		test.update(tx)
+		if err := tx.Commit(); err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+	}
+	if _, err := repo.ResolveRef("refs/heads/x"); err != ErrNotExist {
+		t.Errorf("refs/heads/x was created: %v", err)
+	}
+}
+
+func TestRefTransactionDryRun(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	master := refId(t, repo, "refs/heads/master")
+	other := refId(t, repo, "refs/heads/main-bad")
+	dry := repo.DryRun()
+
+	if _, ok := dry.UpdateRef("refs/heads/master", other, other).(*RefChangedError); !ok {
+		t.Error("dry run updated a ref that isn't at the expected id")
+	}
+	if err := dry.UpdateRef("refs/heads/master", other, master); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := dry.UpdateRef("refs/heads/master", master, master).(*RefChangedError); !ok {
+		t.Error("dry run didn't see its own update")
+	}
+	changes := dry.Changes()
+	if len(changes) != 1 || changes[0].Name != "refs/heads/master" || !changes[0].New.Equal(other) {
+		t.Errorf("unexpected changes %+v", changes)
+	}
+	if id := refId(t, repo, "refs/heads/master"); !id.Equal(master) {
+		t.Error("dry run changed master")
+	}
+}
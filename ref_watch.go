@@ -0,0 +1,117 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrReftableUnsupported = errors.New("reftable repositories are not supported")
+)
+
+// RefWatchInterval is how often WatchRefs looks for changes.
+var RefWatchInterval = time.Second
+
+// A RefEvent tells that a ref changed. Old is zero for a created ref, New
+// is zero for a deleted one.
+type RefEvent struct {
+	Name string
+	Old  ObjectID
+	New  ObjectID
+}
+
+// WatchRefs sends an event on the returned channel for each ref below
+// refs/ that changes on disk, e.g. by a push or another process, until ctx
+// is done; then the channel is closed. The refs directories and
+// packed-refs are looked at every RefWatchInterval, and the refs are only
+// read again when one of them was modified, so watching is cheap for
+// repositories with many refs. A ref that changes and changes back between
+// two looks is not reported. Events for the same look are sorted by ref
+// name.
+func (repo *Repository) WatchRefs(ctx context.Context) (<-chan RefEvent, error) {
+	if isDir(filepath.Join(repo.Path, "reftable")) {
+		return nil, ErrReftableUnsupported
+	}
+	refs, err := repo.listRefs()
+	if err != nil {
+		return nil, err
+	}
+	stamp := repo.refsStamp()
+
+	events := make(chan RefEvent)
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(RefWatchInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			newStamp := repo.refsStamp()
+			if newStamp == stamp {
+				continue
+			}
+			newRefs, err := repo.listRefs()
+			if err != nil {
+				// e.g. a ref being written; looked at again next time
+				repo.log().Warn("can't read refs", "err", err)
+				continue
+			}
+			for _, ev := range diffRefs(refs, newRefs) {
+				select {
+				case events <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+			refs, stamp = newRefs, newStamp
+		}
+	}()
+	return events, nil
+}
+
+// Return the changes from the refs old to the refs new, sorted by name.
+func diffRefs(old, new map[string]ObjectID) []RefEvent {
+	var events []RefEvent
+	for name, id := range new {
+		if oldId, ok := old[name]; !ok || !oldId.Equal(id) {
+			events = append(events, RefEvent{Name: name, Old: oldId, New: id})
+		}
+	}
+	for name, id := range old {
+		if _, ok := new[name]; !ok {
+			events = append(events, RefEvent{Name: name, Old: id})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Name < events[j].Name })
+	return events
+}
+
+// Return a string that changes when a ref is written: the modification
+// times of the directories below refs/, which change when a ref is
+// renamed into place or removed, and the size and modification time of
+// packed-refs.
+func (repo *Repository) refsStamp() string {
+	var b strings.Builder
+	filepath.Walk(filepath.Join(repo.Path, "refs"), func(path string, fi os.FileInfo, err error) error {
+		if err == nil && fi.IsDir() {
+			b.WriteString(path)
+			b.WriteString(strconv.FormatInt(fi.ModTime().UnixNano(), 10))
+			b.WriteByte('\n')
+		}
+		return nil
+	})
+	if fi, err := os.Stat(filepath.Join(repo.Path, "packed-refs")); err == nil {
+		b.WriteString(strconv.FormatInt(fi.Size(), 10))
+		b.WriteString(strconv.FormatInt(fi.ModTime().UnixNano(), 10))
+	}
+	return b.String()
+}
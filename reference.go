@@ -1,13 +1,59 @@
 package git
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
+// StopIteration can be returned by a ForEachRef or CommitIter.ForEach
+// callback to end the iteration early without an error.
+var StopIteration = errors.New("stop iteration")
+
+// A Ref is a named reference to an object.
+type Ref struct {
+	// Full name, e.g. "refs/heads/master".
+	Name string
+	// The object the ref points to. Symbolic refs are resolved.
+	Id ObjectID
+	// For annotated tags, the object the tag points to if packed-refs
+	// records it. Zero otherwise.
+	Peeled ObjectID
+	// For symbolic refs, the name of the ref they point to.
+	Target string
+
+	loose bool
+}
+
+// IsSymbolic tells whether the ref points to another ref, like HEAD or
+// refs/remotes/origin/HEAD usually do.
+func (r Ref) IsSymbolic() bool {
+	return r.Target != ""
+}
+
+// GetRefs returns the refs whose name starts with prefix, e.g.
+// "refs/heads/", or all refs if prefix is empty, sorted by name, like git
+// for-each-ref. Symbolic refs have their Target set and the id of the ref
+// they point to. See ForEachRef to iterate without collecting them.
+func (repo *Repository) GetRefs(prefix string) ([]Ref, error) {
+	var refs []Ref
+	err := repo.ForEachRef(prefix, func(ref Ref) error {
+		refs = append(refs, ref)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
 // UnpackRefs unpacks 'packed-refs' to git repository.
 func UnpackRefs(repoPath string) error {
 	refs, err := ioutil.ReadFile(filepath.Join(repoPath, "packed-refs"))
@@ -32,3 +78,457 @@ func UnpackRefs(repoPath string) error {
 	}
 	return nil
 }
+
+// listRefs returns the ids of all loose and packed refs below refs/.
+// Symbolic refs are resolved, loose refs take precedence over packed ones.
+func (repo *Repository) listRefs() (map[string]ObjectID, error) {
+	refs := make(map[string]ObjectID)
+	err := repo.ForEachRef("refs/", func(ref Ref) error {
+		refs[ref.Name] = ref.Id
+		return nil
+	})
+	return refs, err
+}
+
+// lookupRef returns the ref with the full name, loose or packed, and
+// whether it exists.
+func (repo *Repository) lookupRef(name string) (Ref, bool, error) {
+	if ref, ok := repo.dryRunRef(name); ok {
+		if ref.deleted {
+			return Ref{}, false, nil
+		}
+		resolved, err := repo.ResolveRef(name)
+		if err == ErrNotExist {
+			return Ref{}, false, nil
+		}
+		return resolved, err == nil, err
+	}
+	var found Ref
+	ok := false
+	err := repo.ForEachRef(name, func(ref Ref) error {
+		if ref.Name == name {
+			found, ok = ref, true
+			return StopIteration
+		}
+		return nil
+	})
+	return found, ok, err
+}
+
+// A RefChangedError is returned when a ref isn't at the id an update
+// expects anymore, e.g. because it was updated concurrently. A zero id
+// stands for a ref that doesn't exist.
+type RefChangedError struct {
+	Name     string
+	Expected ObjectID
+	Actual   ObjectID
+}
+
+func (e *RefChangedError) Error() string {
+	return fmt.Sprintf("ref %s is at %s, expected %s", e.Name, e.Actual, e.Expected)
+}
+
+// setRef points the loose ref name (e.g. "refs/heads/master") at id. The
+// ref is locked while it is replaced.
+func (repo *Repository) setRef(name string, id ObjectID) error {
+	return repo.writeRef(name, id, nil)
+}
+
+// UpdateRef points the ref name at id if it's still at old, like git
+// update-ref name id old, or fails with a *RefChangedError. A zero old
+// means that the ref must not exist yet. The ref is locked while it is
+// compared and replaced, so concurrent updates can't be lost.
+func (repo *Repository) UpdateRef(name string, id, old ObjectID) error {
+	return repo.writeRef(name, id, &old)
+}
+
+// Write the loose ref name, checking that it's at old first unless old is
+// nil.
+func (repo *Repository) writeRef(name string, id ObjectID, old *ObjectID) error {
+	tx := repo.NewRefTransaction()
+	if old != nil {
+		tx.Update(name, id, *old)
+	} else {
+		tx.set(name, id)
+	}
+	return tx.Commit()
+}
+
+// deleteRef removes the ref name, loose and packed, and its reflog, and
+// returns the id it was at. It returns ErrNotExist if there is no such
+// ref.
+func (repo *Repository) deleteRef(name string) (ObjectID, error) {
+	ref, exists, err := repo.lookupRef(name)
+	if err != nil {
+		return ObjectID{}, err
+	}
+	if !exists {
+		return ObjectID{}, ErrNotExist
+	}
+	tx := repo.NewRefTransaction()
+	tx.Delete(name, ref.Id)
+	return ref.Id, tx.Commit()
+}
+
+// Check that name is a valid ref name, like git check-ref-format does.
+func checkRefName(name string) error {
+	invalid := name == "" || name == "@" || strings.HasSuffix(name, "/") ||
+		strings.HasSuffix(name, ".") || strings.Contains(name, "..") ||
+		strings.Contains(name, "//") || strings.Contains(name, "@{") ||
+		strings.ContainsAny(name, " ~^:?*[\\\x7f")
+	for _, c := range name {
+		invalid = invalid || c < 0x20
+	}
+	for _, elem := range strings.Split(name, "/") {
+		invalid = invalid || strings.HasPrefix(elem, ".") || strings.HasSuffix(elem, ".lock")
+	}
+	if invalid {
+		return fmt.Errorf("invalid ref name %q", name)
+	}
+	return nil
+}
+
+// ForEachRef calls fn for each ref whose name starts with prefix, sorted by
+// name. Loose and packed refs are merged while they are read, without
+// loading all refs at once; a loose ref takes precedence over a packed one
+// with the same name. Symbolic refs pointing at missing refs are skipped.
+// If fn returns an error, the iteration stops and ForEachRef returns the
+// error, unless it is StopIteration.
+func (repo *Repository) ForEachRef(prefix string, fn func(Ref) error) error {
+	if repo.snapshot != nil {
+		return repo.snapshot.forEachRef(prefix, fn)
+	}
+	loose, err := repo.newLooseRefIter(prefix)
+	if err != nil {
+		return err
+	}
+	packed, err := repo.newPackedRefIter(prefix)
+	if err != nil {
+		return err
+	}
+	defer packed.close()
+
+	l, lok, err := loose.next()
+	if err != nil {
+		return err
+	}
+	p, pok, err := packed.next()
+	if err != nil {
+		return err
+	}
+	for lok || pok {
+		var ref Ref
+		switch {
+		case lok && (!pok || l.Name <= p.Name):
+			if pok && l.Name == p.Name {
+				if p, pok, err = packed.next(); err != nil {
+					return err
+				}
+			}
+			ref = l
+			if l, lok, err = loose.next(); err != nil {
+				return err
+			}
+		default:
+			ref = p
+			if p, pok, err = packed.next(); err != nil {
+				return err
+			}
+		}
+
+		if err := fn(ref); err == StopIteration {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Iterates over loose refs in sorted order. Directories are listed lazily;
+// sorting each listing with directories suffixed by a slash gives the
+// order of the full names.
+type looseRefIter struct {
+	repo   *Repository
+	prefix string
+	stack  []*refDir
+}
+
+type refDir struct {
+	dir   string // slash separated, relative to the repository
+	names []string
+}
+
+func (repo *Repository) newLooseRefIter(prefix string) (*looseRefIter, error) {
+	it := &looseRefIter{repo: repo, prefix: prefix}
+	if !strings.HasPrefix(prefix, "refs/") && !strings.HasPrefix("refs/", prefix) {
+		// loose refs are only looked for below refs/
+		return it, nil
+	}
+	dir := "refs"
+	if i := strings.LastIndexByte(prefix, '/'); i > len(dir) {
+		dir = prefix[:i]
+	}
+	err := it.push(dir)
+	// a ref can be in the way, like refs/heads/a of refs/heads/a/b
+	if err != nil && !os.IsNotExist(err) && !isFile(filepath.Join(repo.Path, filepath.FromSlash(dir))) {
+		return nil, err
+	}
+	return it, nil
+}
+
+func (it *looseRefIter) push(dir string) error {
+	fis, err := ioutil.ReadDir(filepath.Join(it.repo.Path, filepath.FromSlash(dir)))
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(fis))
+	for _, fi := range fis {
+		name := fi.Name()
+		if strings.HasSuffix(name, ".lock") || name == ".DS_Store" {
+			continue
+		}
+		if fi.IsDir() {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	it.stack = append(it.stack, &refDir{dir: dir, names: names})
+	return nil
+}
+
+func (it *looseRefIter) next() (Ref, bool, error) {
+	for len(it.stack) > 0 {
+		top := it.stack[len(it.stack)-1]
+		if len(top.names) == 0 {
+			it.stack = it.stack[:len(it.stack)-1]
+			continue
+		}
+		name := top.dir + "/" + top.names[0]
+		top.names = top.names[1:]
+
+		if strings.HasSuffix(name, "/") {
+			// only descend into directories that can contain matches
+			if strings.HasPrefix(name, it.prefix) || strings.HasPrefix(it.prefix, name) {
+				if err := it.push(strings.TrimSuffix(name, "/")); err != nil {
+					return Ref{}, false, err
+				}
+			}
+			continue
+		}
+		if !strings.HasPrefix(name, it.prefix) {
+			continue
+		}
+
+		ref, ok, err := it.repo.readLooseRef(name)
+		if err != nil {
+			return Ref{}, false, err
+		}
+		if ok {
+			return ref, true, nil
+		}
+	}
+	return Ref{}, false, nil
+}
+
+// Read a loose ref file. Files that aren't refs and dangling symbolic refs
+// are reported as not ok.
+func (repo *Repository) readLooseRef(name string) (Ref, bool, error) {
+	if repo.snapshot != nil {
+		ref, ok := repo.snapshot.refs[name]
+		return ref, ok, nil
+	}
+	data, err := ioutil.ReadFile(filepath.Join(repo.Path, filepath.FromSlash(name)))
+	if os.IsNotExist(err) {
+		// deleted while we were iterating
+		return Ref{}, false, nil
+	} else if err != nil {
+		return Ref{}, false, err
+	}
+
+	ref := Ref{Name: name, loose: true}
+	if bytes.HasPrefix(data, []byte("ref: ")) {
+		ref.Target = strings.TrimSpace(string(data[5:]))
+		idStr, err := repo.getCommitIdOfRef(name)
+		if err != nil {
+			repo.log().Debug("skipping dangling symbolic ref", "ref", name, "target", ref.Target)
+			return Ref{}, false, nil
+		}
+		data = []byte(idStr)
+	}
+	var id ObjectID
+	if len(data) >= 40 {
+		id, err = NewIdFromString(string(data[:40]))
+	}
+	if len(data) < 40 || err != nil {
+		repo.log().Warn("skipping broken ref", "ref", name)
+		return Ref{}, false, nil
+	}
+	ref.Id = id
+	return ref, true, nil
+}
+
+// GetPackedRefs returns the refs of the packed-refs file, sorted by name,
+// with the peeled ids of annotated tags the file records. Loose refs that
+// override them are not taken into account, see ForEachRef for that.
+func (repo *Repository) GetPackedRefs() ([]Ref, error) {
+	it, err := repo.newPackedRefIter("")
+	if err != nil {
+		return nil, err
+	}
+	defer it.close()
+	var refs []Ref
+	for {
+		ref, ok, err := it.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return refs, nil
+		}
+		refs = append(refs, ref)
+	}
+}
+
+// Find the ref name in packed-refs.
+func (repo *Repository) findPackedRef(name string) (Ref, bool, error) {
+	it, err := repo.newPackedRefIter(name)
+	if err != nil {
+		return Ref{}, false, err
+	}
+	defer it.close()
+	for {
+		ref, ok, err := it.next()
+		if err != nil || !ok {
+			return Ref{}, false, err
+		}
+		if ref.Name == name {
+			return ref, true, nil
+		}
+	}
+}
+
+// Iterates over the refs of the packed-refs file. git writes the file
+// sorted and says so in its header; files without the "sorted" trait are
+// read completely and sorted first.
+type packedRefIter struct {
+	prefix  string
+	f       *os.File
+	scanner *bufio.Scanner
+	// the next line, already read to look for a peeled line
+	pending string
+	// used for unsorted files
+	refs []Ref
+	// sorted files end early once past the prefix
+	sorted bool
+}
+
+func (repo *Repository) newPackedRefIter(prefix string) (*packedRefIter, error) {
+	it := &packedRefIter{prefix: prefix}
+	f, err := os.Open(filepath.Join(repo.Path, "packed-refs"))
+	if os.IsNotExist(err) {
+		return it, nil
+	} else if err != nil {
+		return nil, err
+	}
+	it.f = f
+	it.scanner = bufio.NewScanner(f)
+	if it.scanner.Scan() {
+		it.pending = it.scanner.Text()
+		if strings.HasPrefix(it.pending, "# pack-refs with:") {
+			it.sorted = strings.Contains(it.pending+" ", " sorted ")
+		}
+	}
+
+	if !it.sorted {
+		var refs []Ref
+		for {
+			ref, ok, err := it.read()
+			if err != nil {
+				it.close()
+				return nil, err
+			}
+			if !ok {
+				break
+			}
+			refs = append(refs, ref)
+		}
+		sort.Slice(refs, func(i, j int) bool { return refs[i].Name < refs[j].Name })
+		it.close()
+		it.refs = refs
+	}
+	return it, nil
+}
+
+func (it *packedRefIter) close() {
+	if it.f != nil {
+		it.f.Close()
+		it.f = nil
+	}
+}
+
+func (it *packedRefIter) next() (Ref, bool, error) {
+	if !it.sorted {
+		for len(it.refs) > 0 {
+			ref := it.refs[0]
+			it.refs = it.refs[1:]
+			if strings.HasPrefix(ref.Name, it.prefix) {
+				return ref, true, nil
+			}
+		}
+		return Ref{}, false, nil
+	}
+
+	for {
+		ref, ok, err := it.read()
+		if err != nil || !ok {
+			return Ref{}, false, err
+		}
+		if strings.HasPrefix(ref.Name, it.prefix) {
+			return ref, true, nil
+		}
+		if ref.Name > it.prefix {
+			// sorted, nothing after this can match
+			it.close()
+			return Ref{}, false, nil
+		}
+	}
+}
+
+// Read the next ref of the file, with its peeled line if any.
+func (it *packedRefIter) read() (Ref, bool, error) {
+	if it.f == nil {
+		return Ref{}, false, nil
+	}
+	for {
+		line := it.pending
+		it.pending = ""
+		if line == "" {
+			if !it.scanner.Scan() {
+				return Ref{}, false, it.scanner.Err()
+			}
+			line = it.scanner.Text()
+		}
+		if len(line) < 42 || line[0] == '#' || line[0] == '^' {
+			continue
+		}
+
+		id, err := NewIdFromString(line[:40])
+		if err != nil {
+			return Ref{}, false, err
+		}
+		ref := Ref{Name: strings.TrimSpace(line[41:]), Id: id}
+		if it.scanner.Scan() {
+			next := it.scanner.Text()
+			if strings.HasPrefix(next, "^") {
+				if ref.Peeled, err = NewIdFromString(next[1:]); err != nil {
+					return Ref{}, false, err
+				}
+			} else {
+				it.pending = next
+			}
+		}
+		return ref, true, nil
+	}
+}
@@ -0,0 +1,59 @@
+package git
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestPackedRefExactMatch(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	master := refId(t, repo, "refs/heads/master")
+	other := refId(t, repo, "refs/heads/main-bad")
+
+	if err := repo.CreateBranch("foo-bar", other.String()); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.PackRefs(true); err != nil {
+		t.Fatal(err)
+	}
+	// foo is a prefix of foo-bar, but no ref of its own
+	if _, ok, err := repo.lookupRef("refs/heads/foo"); err != nil || ok {
+		t.Errorf("foo found in packed-refs (%v)", err)
+	}
+	if _, err := repo.ResolveRef("refs/heads/foo"); err != ErrNotExist {
+		t.Errorf("expected ErrNotExist, got %v", err)
+	}
+	if err := repo.CreateBranch("foo", master.String()); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.PackRefs(true); err != nil {
+		t.Fatal(err)
+	}
+	if id := refId(t, repo, "refs/heads/foo"); !id.Equal(master) {
+		t.Errorf("foo is at %s, expected %s", id, master)
+	}
+	if id := refId(t, repo, "refs/heads/foo-bar"); !id.Equal(other) {
+		t.Errorf("foo-bar is at %s, expected %s", id, other)
+	}
+}
+
+func TestUnsortedPackedRefs(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	master := refId(t, repo, "refs/heads/master")
+	other := refId(t, repo, "refs/heads/main-bad")
+
+	// no "sorted" trait, as written by old versions of git
+	packed := "# pack-refs with: peeled\n" +
+		master.String() + " refs/heads/foo-bar\n" +
+		other.String() + " refs/heads/foo\n"
+	if err := ioutil.WriteFile(filepath.Join(repo.Path, "packed-refs"), []byte(packed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if id := refId(t, repo, "refs/heads/foo"); !id.Equal(other) {
+		t.Errorf("foo is at %s, expected %s", id, other)
+	}
+	if id := refId(t, repo, "refs/heads/foo-bar"); !id.Equal(master) {
+		t.Errorf("foo-bar is at %s, expected %s", id, master)
+	}
+}
@@ -0,0 +1,59 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Append an entry for an update of the ref name from old to new to its
+// reflog, like git does when core.logAllRefUpdates asks for it or the ref
+// has a reflog already.
+func (repo *Repository) appendReflog(name string, old, new ObjectID, committer *Signature, msg string) error {
+	if err := committer.check(); err != nil {
+		return err
+	}
+	if repo.dryRun != nil {
+		repo.recordChange(Change{Op: ChangeWriteFile, Name: "logs/" + name})
+		return nil
+	}
+	if repo.snapshot != nil {
+		return ErrReadOnlySnapshot
+	}
+	logPath := filepath.Join(repo.Path, "logs", filepath.FromSlash(name))
+	if !isFile(logPath) && !repo.logsRefUpdates(name) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(logPath), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	// a single write, so that concurrent appends don't interleave
+	line := old.String() + " " + new.String() + " " + committer.commitLine() + "\t" +
+		strings.Replace(strings.TrimRight(msg, "\n"), "\n", " ", -1) + "\n"
+	if _, err := f.WriteString(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Tell whether core.logAllRefUpdates asks for a new reflog for the ref
+// name.
+func (repo *Repository) logsRefUpdates(name string) bool {
+	switch repo.settings().LogAllRefUpdates {
+	case "always":
+		return true
+	case "false":
+		return false
+	case "":
+		if repo.WorkTree == "" {
+			return false
+		}
+	}
+	return name == "HEAD" || strings.HasPrefix(name, "refs/heads/") ||
+		strings.HasPrefix(name, "refs/remotes/") || strings.HasPrefix(name, "refs/notes/")
+}
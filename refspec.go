@@ -0,0 +1,129 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A RefSpec maps refs of a remote to local refs, like the
+// remote.<name>.fetch config variable and the arguments of git fetch.
+type RefSpec struct {
+	// The remote refs, a full name or a pattern with one "*".
+	Src string
+	// The local refs they are stored as, with a "*" if Src has one. Empty
+	// if they are only fetched, not stored.
+	Dst string
+	// "+": update the local refs even if it isn't a fast-forward.
+	Force bool
+	// "^": refs matching Src are left out, whatever other specs say.
+	Negative bool
+}
+
+// ParseRefSpec parses a fetch refspec: "[+]<src>[:<dst>]", or "^<src>" to
+// exclude refs.
+func ParseRefSpec(s string) (*RefSpec, error) {
+	spec := &RefSpec{}
+	rest := s
+	if strings.HasPrefix(rest, "^") {
+		spec.Negative = true
+		rest = rest[1:]
+	} else if strings.HasPrefix(rest, "+") {
+		spec.Force = true
+		rest = rest[1:]
+	}
+	if i := strings.IndexByte(rest, ':'); i >= 0 {
+		spec.Src, spec.Dst = rest[:i], rest[i+1:]
+	} else {
+		spec.Src = rest
+	}
+
+	srcStars, dstStars := strings.Count(spec.Src, "*"), strings.Count(spec.Dst, "*")
+	switch {
+	case spec.Src == "":
+		return nil, fmt.Errorf("invalid refspec %q: no source", s)
+	case spec.Negative && spec.Dst != "":
+		return nil, fmt.Errorf("invalid refspec %q: negative refspecs have no destination", s)
+	case srcStars > 1 || dstStars > 1:
+		return nil, fmt.Errorf("invalid refspec %q: more than one *", s)
+	case spec.Dst != "" && srcStars != dstStars:
+		return nil, fmt.Errorf("invalid refspec %q: * on one side only", s)
+	}
+	return spec, nil
+}
+
+// String formats the refspec like ParseRefSpec reads it.
+func (r *RefSpec) String() string {
+	s := r.Src
+	if r.Dst != "" {
+		s += ":" + r.Dst
+	}
+	if r.Negative {
+		return "^" + s
+	} else if r.Force {
+		return "+" + s
+	}
+	return s
+}
+
+// Match reports whether the remote ref name matches Src, and returns the
+// local ref it is stored as, empty if Dst is.
+func (r *RefSpec) Match(name string) (string, bool) {
+	i := strings.IndexByte(r.Src, '*')
+	if i < 0 {
+		return r.Dst, name == r.Src
+	}
+	prefix, suffix := r.Src[:i], r.Src[i+1:]
+	if len(name) < len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return "", false
+	}
+	if r.Dst == "" {
+		return "", true
+	}
+	return strings.Replace(r.Dst, "*", name[len(prefix):len(name)-len(suffix)], 1), true
+}
+
+// MatchRefSpecs returns the local ref the remote ref name is stored as by
+// the first of specs matching it, and whether it is fetched at all: a ref
+// is only fetched if a spec matches it and no negative one does.
+func MatchRefSpecs(specs []*RefSpec, name string) (string, bool) {
+	dst, matched := "", false
+	for _, spec := range specs {
+		d, ok := spec.Match(name)
+		switch {
+		case !ok:
+		case spec.Negative:
+			return "", false
+		case !matched:
+			dst, matched = d, true
+		}
+	}
+	return dst, matched
+}
+
+// SingleBranchRefSpec returns the refspec git clone --single-branch
+// configures for a branch, which keeps later fetches to that branch.
+func SingleBranchRefSpec(remote, branch string) *RefSpec {
+	return &RefSpec{
+		Src:   "refs/heads/" + branch,
+		Dst:   "refs/remotes/" + remote + "/" + branch,
+		Force: true,
+	}
+}
+
+// RemoteRefSpecs returns the fetch refspecs of a remote, from its
+// remote.<name>.fetch config variables.
+func (repo *Repository) RemoteRefSpecs(remote string) ([]*RefSpec, error) {
+	config, err := repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	var specs []*RefSpec
+	for _, v := range config.GetAll("remote." + remote + ".fetch") {
+		spec, err := ParseRefSpec(v)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
@@ -18,8 +18,11 @@ package git
 import (
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"sync"
 )
 
 // idx-file
@@ -27,22 +30,89 @@ type idxFile struct {
 	indexpath    string
 	packpath     string
 	packversion  uint32
-	offsetValues map[sha1]uint64
+	offsetValues map[ObjectID]uint64
+
+	// loaded when CRCs are checked
+	crcOnce sync.Once
+	crcs    map[ObjectID]uint32
+	ends    map[uint64]uint64
+	crcErr  error
+
+	// the open pack of a snapshot
+	pinned *io.SectionReader
 }
 
 // A Repository is the base of all other actions. If you need to lookup a
 // commit, tree or blob, you do it from here.
 type Repository struct {
-	Path       string
+	Path string
+	// The object database, usually the objects directory in Path.
+	ObjectsDir string
+	// The working tree of a non-bare repository, empty if bare.
+	WorkTree string
+	// other object directories objects are read from, after ObjectsDir
+	alternates []string
+	// found through GIT_DIR or discovery, so the GIT_* variables apply
+	fromEnv bool
+
 	indexfiles map[string]*idxFile
 
-	commitCache map[sha1]*Commit
-	tagCache    map[sha1]*Tag
+	commitCache map[ObjectID]*Commit
+	tagCache    map[ObjectID]*Tag
+	generations map[ObjectID]uint64
+	// corrected committer dates, see SetMonotonicWalk
+	correctedDates map[ObjectID]int64
+	cacheKeys      map[pathLookup]CacheKey
+	commitGraph    *commitGraph
+
+	budget  *Budget
+	closed  bool
+	metrics Metrics
+	logger  *slog.Logger
+	dryRun  *dryRunState
+
+	snapshot      *snapshotState
+	indexer       CommitIndexer
+	deployHook    DeployHook
+	accessControl AccessControl
+	monotonicWalk bool
+	verifyObjects bool
+	// nil to follow core.fsync, see SetFsync
+	fsync *FsyncComponents
+	// loose objects are synced by TempObjectDir.Migrate
+	batchFsync bool
+
+	parseMode ParseMode
 }
 
-// Open the repository at the given path.
+// Open the repository at the given path. If path is empty, GIT_DIR is used,
+// or if that is not set either, the repository is discovered from the
+// current directory. In that case, like git, GIT_OBJECT_DIRECTORY and
+// GIT_WORK_TREE override the location of the object database and the
+// working tree; they are ignored for a repository opened by its path.
+// Objects are also read from the alternates of the object database, see
+// Alternates.
 func OpenRepository(path string) (*Repository, error) {
+	return openRepository(path, nil)
+}
+
+// Open the repository at path, calling check, unless it's nil, once the
+// git directory and the working tree are known and before anything is read
+// from them.
+func openRepository(path string, check func(*Repository) error) (*Repository, error) {
 	repo := new(Repository)
+	if path == "" {
+		repo.fromEnv = true
+		path = os.Getenv("GIT_DIR")
+	}
+	if path == "" {
+		gitDir, workTree, err := Discover(".")
+		if err != nil {
+			return nil, err
+		}
+		path = gitDir
+		repo.WorkTree = workTree
+	}
 	path, err := filepath.Abs(path)
 	if err != nil {
 		return nil, err
@@ -56,18 +126,29 @@ func OpenRepository(path string) (*Repository, error) {
 		return nil, errors.New(fmt.Sprintf("%q is not a directory.", fm.Name()))
 	}
 
-	indexfiles, err := filepath.Glob(filepath.Join(path, "objects/pack/*idx"))
-	if err != nil {
-		return nil, err
+	repo.ObjectsDir = filepath.Join(path, "objects")
+	if dir := os.Getenv("GIT_OBJECT_DIRECTORY"); dir != "" && repo.fromEnv {
+		if repo.ObjectsDir, err = filepath.Abs(dir); err != nil {
+			return nil, err
+		}
 	}
-	repo.indexfiles = make(map[string]*idxFile, len(indexfiles))
-	for _, indexfile := range indexfiles {
-		idx, err := readIdxFile(indexfile)
-		if err != nil {
+
+	if dir := os.Getenv("GIT_WORK_TREE"); dir != "" && repo.fromEnv {
+		if repo.WorkTree, err = filepath.Abs(dir); err != nil {
+			return nil, err
+		}
+	} else if repo.WorkTree == "" && filepath.Base(path) == ".git" {
+		repo.WorkTree = filepath.Dir(path)
+	}
+	if check != nil {
+		if err := check(repo); err != nil {
 			return nil, err
 		}
-		repo.indexfiles[indexfile] = idx
 	}
 
+	repo.alternates = repo.readAlternates()
+	if err := repo.loadPacks(); err != nil {
+		return nil, err
+	}
 	return repo, nil
 }
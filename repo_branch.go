@@ -3,6 +3,7 @@ package git
 import (
 	"errors"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
@@ -17,42 +18,221 @@ func IsBranchExist(repoPath, branchName string) bool {
 	return isFile(branchPath)
 }
 
+// IsBranchExist reports whether the branch exists, loose or packed.
 func (repo *Repository) IsBranchExist(branchName string) bool {
-	branchPath := filepath.Join(repo.Path, "refs/heads", branchName)
-	return isFile(branchPath)
+	_, ok, err := repo.lookupRef("refs/heads/" + branchName)
+	return err == nil && ok
 }
 
 func (repo *Repository) GetBranches() ([]string, error) {
 	return repo.readRefDir("refs/heads", "")
 }
 
+// CreateBranch creates the branch branchName at the commit idStr. It
+// returns ErrBranchExisted if the branch exists, loose or packed.
 func (repo *Repository) CreateBranch(branchName, idStr string) error {
 	return repo.createRef("heads", branchName, idStr)
 }
 
-func (repo *Repository) createRef(head, branchName, idStr string) error {
+// ForceCreateBranch is like CreateBranch, but an existing branch is moved
+// to idStr, like git branch -f. The branch HEAD points to can't be moved
+// in a repository with a working tree.
+func (repo *Repository) ForceCreateBranch(branchName, idStr string) error {
 	id, err := NewIdFromString(idStr)
 	if err != nil {
 		return err
 	}
+	name := "refs/heads/" + branchName
+	if err := checkRefName(name); err != nil {
+		return err
+	}
+	if err := repo.checkNotCurrentBranch(name); err != nil {
+		return err
+	}
+	return repo.setRef(name, id)
+}
 
-	branchPath := filepath.Join(repo.Path, "refs/"+head, branchName)
-	if isFile(branchPath) {
+// DeleteBranch deletes the branch branchName, loose and packed, like git
+// branch -D. It returns ErrNotExist if there is no such branch. The branch
+// HEAD points to can't be deleted in a repository with a working tree.
+func (repo *Repository) DeleteBranch(branchName string) error {
+	name := "refs/heads/" + branchName
+	if err := repo.checkNotCurrentBranch(name); err != nil {
+		return err
+	}
+	_, err := repo.deleteRef(name)
+	return err
+}
+
+// RenameBranch renames the branch oldName to newName, like git branch -m,
+// and points HEAD at newName if it pointed at oldName. If newName exists,
+// ErrBranchExisted is returned unless force is set; then it's replaced.
+// Both refs are changed in one RefTransaction, so a failed rename leaves
+// the branch as it was.
+func (repo *Repository) RenameBranch(oldName, newName string, force bool) error {
+	oldRef, newRef := "refs/heads/"+oldName, "refs/heads/"+newName
+	if err := checkRefName(newRef); err != nil {
+		return err
+	}
+	ref, exists, err := repo.lookupRef(oldRef)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotExist
+	}
+	if oldRef == newRef {
+		return nil
+	}
+	replaced, exists, err := repo.lookupRef(newRef)
+	if err != nil {
+		return err
+	}
+	if exists && !force {
 		return ErrBranchExisted
 	}
+	if exists {
+		if err := repo.checkNotCurrentBranch(newRef); err != nil {
+			return err
+		}
+	}
+	head, err := repo.headTarget()
+	if err != nil {
+		return err
+	}
+	// the reflog git may have written moves with the branch
+	reflog, err := ioutil.ReadFile(filepath.Join(repo.Path, "logs", filepath.FromSlash(oldRef)))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
 
-	f, err := os.Create(branchPath)
+	if strings.HasPrefix(newRef, oldRef+"/") || strings.HasPrefix(oldRef, newRef+"/") {
+		// a loose ref is in the way of the other one's lock, like git the
+		// old ref is deleted first and restored if the new one can't be
+		// created
+		if _, err := repo.deleteRef(oldRef); err != nil {
+			return err
+		}
+		if exists {
+			if _, err := repo.deleteRef(newRef); err != nil {
+				return err
+			}
+		}
+		if err := repo.UpdateRef(newRef, ref.Id, ObjectID{}); err != nil {
+			if repo.UpdateRef(oldRef, ref.Id, ObjectID{}) == nil && reflog != nil {
+				repo.writeReflog(oldRef, reflog)
+			}
+			return err
+		}
+	} else {
+		tx := repo.NewRefTransaction()
+		tx.Delete(oldRef, ref.Id)
+		tx.Update(newRef, ref.Id, replaced.Id)
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	if reflog != nil {
+		if err := repo.writeReflog(newRef, reflog); err != nil {
+			return err
+		}
+	}
+	if head != oldRef {
+		return nil
+	}
+	if repo.dryRun != nil {
+		repo.recordHeadUpdate("ref: "+newRef, ref.Id)
+		return nil
+	}
+	return repo.setHead("ref: " + newRef)
+}
+
+func (repo *Repository) writeReflog(name string, data []byte) error {
+	if repo.dryRun != nil {
+		repo.recordChange(Change{Op: ChangeWriteFile, Name: "logs/" + name})
+		return nil
+	}
+	logPath := filepath.Join(repo.Path, "logs", filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(logPath), os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(logPath, data, 0666)
+}
+
+// Return ErrCurrentBranch if name is the branch checked out in the working
+// tree.
+func (repo *Repository) checkNotCurrentBranch(name string) error {
+	if repo.WorkTree == "" {
+		return nil
+	}
+	head, err := repo.headTarget()
 	if err != nil {
 		return err
 	}
+	if head == name {
+		return ErrCurrentBranch
+	}
+	return nil
+}
 
-	defer f.Close()
+// CreateOrphanBranch points HEAD at the branch name without creating it,
+// like git checkout --orphan, so that the next commit starts a new
+// history. Make it with CreateCommit, no parents and CommitOptions.Branch
+// set to name. The index and working tree are left alone.
+func (repo *Repository) CreateOrphanBranch(name string) error {
+	if err := checkRefName("refs/heads/" + name); err != nil {
+		return err
+	}
+	_, exists, err := repo.lookupRef("refs/heads/" + name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrBranchExisted
+	}
+	if repo.dryRun != nil {
+		repo.recordHeadUpdate("ref: refs/heads/"+name, ObjectID{})
+		return nil
+	}
+	if repo.snapshot != nil {
+		return ErrReadOnlySnapshot
+	}
+	return repo.setHead("ref: refs/heads/" + name)
+}
 
-	_, err = io.WriteString(f, id.String())
-	return err
+func (repo *Repository) createRef(head, branchName, idStr string) error {
+	id, err := NewIdFromString(idStr)
+	if err != nil {
+		return err
+	}
+	name := "refs/" + head + "/" + branchName
+	if err := checkRefName(name); err != nil {
+		return err
+	}
+
+	_, exists, err := repo.lookupRef(name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrBranchExisted
+	}
+	if repo.dryRun != nil {
+		repo.recordRefUpdate(ChangeCreateRef, name, id)
+		return nil
+	}
+	if repo.snapshot != nil {
+		return ErrReadOnlySnapshot
+	}
+
+	// fails if the ref was created meanwhile
+	return repo.UpdateRef(name, id, ObjectID{})
 }
 
 func (repo *Repository) readRefDir(prefix, relPath string) ([]string, error) {
+	if repo.snapshot != nil {
+		return repo.snapshot.refNames(filepath.ToSlash(filepath.Join(prefix, relPath))), nil
+	}
 	dirPath := filepath.Join(repo.Path, prefix, relPath)
 	f, err := os.Open(dirPath)
 	if err != nil {
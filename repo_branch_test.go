@@ -0,0 +1,114 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Branches of testdata/test.git, after PackRefs moved them to packed-refs.
+func openPackedTestRepo(t *testing.T) *Repository {
+	t.Helper()
+	repo := openTestRepoCopy(t)
+	if err := repo.PackRefs(true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(repo.Path, "refs/heads/master")); !os.IsNotExist(err) {
+		t.Fatalf("master is still loose after PackRefs: %v", err)
+	}
+	return repo
+}
+
+func TestBranchesWithPackedRefs(t *testing.T) {
+	repo := openPackedTestRepo(t)
+	master := refId(t, repo, "refs/heads/master")
+
+	if err := repo.CreateBranch("main-bad", master.String()); err != ErrBranchExisted {
+		t.Errorf("creating a packed branch again: expected ErrBranchExisted, got %v", err)
+	}
+	if err := repo.CreateBranch("topic", master.String()); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteBranch("main-bad"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteBranch("main-bad"); err != ErrNotExist {
+		t.Errorf("deleting a deleted branch: expected ErrNotExist, got %v", err)
+	}
+	packed, err := ioutil.ReadFile(filepath.Join(repo.Path, "packed-refs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(packed), "refs/heads/main-bad") {
+		t.Error("deleted branch still in packed-refs")
+	}
+
+	for _, branch := range []string{"master", "main-alternate", "topic"} {
+		if !repo.IsBranchExist(branch) {
+			t.Errorf("branch %s is missing", branch)
+		}
+	}
+}
+
+func TestRenamePackedBranch(t *testing.T) {
+	repo := openPackedTestRepo(t)
+	master := refId(t, repo, "refs/heads/master")
+	conflict := refId(t, repo, "refs/heads/main-conflict")
+
+	if err := repo.RenameBranch("master", "main", false); err != nil {
+		t.Fatal(err)
+	}
+	if id := refId(t, repo, "refs/heads/main"); !id.Equal(master) {
+		t.Errorf("main is at %s, expected %s", id, master)
+	}
+	if _, err := repo.ResolveRef("refs/heads/master"); err != ErrNotExist {
+		t.Errorf("master still exists: %v", err)
+	}
+	if branch, err := repo.HeadBranch(); err != nil || branch != "main" {
+		t.Errorf("HEAD points to %q (%v), expected main", branch, err)
+	}
+
+	if err := repo.RenameBranch("main", "main-conflict", false); err != ErrBranchExisted {
+		t.Errorf("renaming over a packed branch: expected ErrBranchExisted, got %v", err)
+	}
+	if err := repo.RenameBranch("main-conflict", "main-alternate", true); err != nil {
+		t.Fatal(err)
+	}
+	if id := refId(t, repo, "refs/heads/main-alternate"); !id.Equal(conflict) {
+		t.Errorf("main-alternate is at %s, expected %s", id, conflict)
+	}
+}
+
+func TestRenameBranchAllOrNothing(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	branch := refId(t, repo, "refs/heads/main-bad")
+
+	// someone else is writing the new branch
+	lock := filepath.Join(repo.Path, "refs/heads/renamed.lock")
+	if err := ioutil.WriteFile(lock, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := repo.RenameBranch("main-bad", "renamed", false).(*LockError); !ok {
+		t.Error("expected a *LockError")
+	}
+	if id := refId(t, repo, "refs/heads/main-bad"); !id.Equal(branch) {
+		t.Errorf("main-bad is at %s after a failed rename", id)
+	}
+	os.Remove(lock)
+
+	// renaming into a directory of the same name
+	if err := repo.RenameBranch("main-bad", "main-bad/sub", false); err != nil {
+		t.Fatal(err)
+	}
+	if id := refId(t, repo, "refs/heads/main-bad/sub"); !id.Equal(branch) {
+		t.Errorf("main-bad/sub is at %s, expected %s", id, branch)
+	}
+	if err := repo.RenameBranch("main-bad/sub", "main-bad", false); err != nil {
+		t.Fatal(err)
+	}
+	if id := refId(t, repo, "refs/heads/main-bad"); !id.Equal(branch) {
+		t.Errorf("main-bad is at %s, expected %s", id, branch)
+	}
+}
@@ -0,0 +1,72 @@
+package git
+
+import (
+	"errors"
+)
+
+var (
+	ErrRepositoryClosed = errors.New("repository is closed")
+)
+
+// Close releases the pack indexes and caches of the repository. Reading
+// objects from a closed repository fails with ErrRepositoryClosed.
+func (repo *Repository) Close() error {
+	repo.log().Debug("closing repository", "path", repo.Path)
+	repo.DropCaches()
+	if repo.snapshot != nil {
+		repo.snapshot.close()
+	}
+	repo.indexfiles = nil
+	repo.closed = true
+	return nil
+}
+
+// DropCaches empties the caches of parsed commits and tags, generation
+// numbers, corrected dates and path lookups, and forgets the commit-graph
+// file, which is read again when needed. Objects never change, so this is
+// only needed to bound memory use or to pick up a new commit-graph file.
+func (repo *Repository) DropCaches() {
+	repo.commitCache = nil
+	repo.tagCache = nil
+	repo.generations = nil
+	repo.correctedDates = nil
+	repo.cacheKeys = nil
+	repo.commitGraph = nil
+}
+
+// ReloadPacks rescans the pack directory, so that packs written since the
+// repository was opened are found and packs removed by a repack are
+// forgotten. Indexes of packs that are still there are not read again.
+// A snapshot keeps its packs and only adds the new ones.
+func (repo *Repository) ReloadPacks() error {
+	if repo.closed {
+		return ErrRepositoryClosed
+	}
+	if repo.snapshot != nil {
+		_, err := repo.pinNewPacks()
+		return err
+	}
+	return repo.loadPacks()
+}
+
+func (repo *Repository) loadPacks() error {
+	indexfiles, err := repo.packIndexPaths()
+	if err != nil {
+		return err
+	}
+	loaded := make(map[string]*idxFile, len(indexfiles))
+	for _, indexfile := range indexfiles {
+		if idx, ok := repo.indexfiles[indexfile]; ok {
+			loaded[indexfile] = idx
+			continue
+		}
+		idx, err := readIdxFile(indexfile)
+		if err != nil {
+			return err
+		}
+		repo.log().Debug("loaded pack index", "index", indexfile)
+		loaded[indexfile] = idx
+	}
+	repo.indexfiles = loaded
+	return nil
+}
@@ -1,15 +1,10 @@
 package git
 
 import (
-	"bufio"
 	"container/list"
+	"context"
 	"errors"
-	"fmt"
 	"io/ioutil"
-	"os"
-	"path/filepath"
-	"regexp"
-	"strings"
 	"sync"
 )
 
@@ -18,10 +13,6 @@ const (
 	ItemsPerSearch = 100
 )
 
-var (
-	refRexp = regexp.MustCompile("ref: (.*)\n")
-)
-
 // get branch's last commit or a special commit by id string
 func (repo *Repository) GetCommitOfBranch(branchName string) (*Commit, error) {
 	commitId, err := repo.GetCommitIdOfBranch(branchName)
@@ -32,70 +23,42 @@ func (repo *Repository) GetCommitOfBranch(branchName string) (*Commit, error) {
 	return repo.GetCommit(commitId)
 }
 
+// GetCommitIdOfBranch returns the id of the commit at the tip of the
+// branch, or ErrUnbornBranch if it's the branch of HEAD and has no commits.
 func (repo *Repository) GetCommitIdOfBranch(branchName string) (string, error) {
-	return repo.getCommitIdOfRef("refs/heads/" + branchName)
+	id, err := repo.getCommitIdOfRef("refs/heads/" + branchName)
+	if err != nil {
+		return "", repo.unbornError("refs/heads/"+branchName, err)
+	}
+	return id, nil
 }
 
+// GetCommitOfTag returns the commit a tag points to, through the tag
+// object for annotated tags.
 func (repo *Repository) GetCommitOfTag(tagName string) (*Commit, error) {
-	commitId, err := repo.GetCommitIdOfTag(tagName)
+	tag, err := repo.GetTag(tagName)
 	if err != nil {
 		return nil, err
 	}
-
-	return repo.GetCommit(commitId)
+	return tag.Commit()
 }
 
+// GetCommitIdOfTag returns the id of the commit a tag points to, through
+// the tag object for annotated tags.
 func (repo *Repository) GetCommitIdOfTag(tagName string) (string, error) {
-	return repo.getCommitIdOfRef("refs/tags/" + tagName)
-}
-
-func (repo *Repository) getCommitIdOfRef(refpath string) (string, error) {
-start:
-	f, err := ioutil.ReadFile(filepath.Join(repo.Path, refpath))
-	if err != nil {
-		f, err = repo.getCommitIdOfPackedRef(refpath)
-	}
+	c, err := repo.GetCommitOfTag(tagName)
 	if err != nil {
 		return "", err
 	}
-
-	allMatches := refRexp.FindAllStringSubmatch(string(f), 1)
-	if allMatches == nil {
-		// let's assume this is a sha1
-		if len(f) < 40 {
-			return "", errors.New("sha1 hash too short")
-		}
-		sha1 := string(f[:40])
-		if !IsSha1(sha1) {
-			return "", fmt.Errorf("heads file wrong sha1 string %s", sha1)
-		}
-		return sha1, nil
-	}
-	// yes, it's "ref: something". Now let's lookup "something"
-	refpath = allMatches[0][1]
-	goto start
+	return c.Id.String(), nil
 }
 
-func (repo *Repository) getCommitIdOfPackedRef(refpath string) ([]byte, error) {
-	f, err := os.Open(filepath.Join(repo.Path, "packed-refs"))
+func (repo *Repository) getCommitIdOfRef(refpath string) (string, error) {
+	ref, err := repo.ResolveRef(refpath)
 	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
-	scan := bufio.NewScanner(f)
-
-	for scan.Scan() {
-		if strings.Contains(scan.Text(), refpath) {
-			return scan.Bytes(), nil
-		}
-	}
-
-	if err := scan.Err(); err != nil {
-		return nil, err
+		return "", err
 	}
-
-	return nil, errors.New("Ref not found in packed-refs")
+	return ref.Id.String(), nil
 }
 
 // Find the commit object in the repository.
@@ -108,14 +71,21 @@ func (repo *Repository) GetCommit(commitId string) (*Commit, error) {
 	return repo.getCommit(id)
 }
 
-func (repo *Repository) getCommit(id sha1) (*Commit, error) {
+// GetCommitById is like GetCommit, without parsing a hex string.
+func (repo *Repository) GetCommitById(id ObjectID) (*Commit, error) {
+	return repo.getCommit(id)
+}
+
+func (repo *Repository) getCommit(id ObjectID) (*Commit, error) {
 	if repo.commitCache != nil {
 		if c, ok := repo.commitCache[id]; ok {
+			repo.countMetric(MetricCommitCacheHits, 1)
 			return c, nil
 		}
 	} else {
-		repo.commitCache = make(map[sha1]*Commit, 10)
+		repo.commitCache = make(map[ObjectID]*Commit, 10)
 	}
+	repo.countMetric(MetricCommitCacheMisses, 1)
 
 	_, _, dataRc, err := repo.GetRawObject(id, false)
 	if err != nil {
@@ -132,9 +102,9 @@ func (repo *Repository) getCommit(id sha1) (*Commit, error) {
 		return nil, err
 	}
 
-	commit, err := parseCommitData(data)
+	commit, err := parseCommitData(data, repo.parseMode)
 	if err != nil {
-		return nil, err
+		return nil, withObjectId(err, id)
 	}
 	commit.repo = repo
 	commit.Id = id
@@ -145,16 +115,30 @@ func (repo *Repository) getCommit(id sha1) (*Commit, error) {
 }
 
 func (repo *Repository) CommitsCount(commitId string) (int, error) {
+	return repo.CommitsCountContext(context.Background(), commitId)
+}
+
+// CommitsCountContext is like CommitsCount, but gives up with the context's
+// error once ctx is done.
+func (repo *Repository) CommitsCountContext(ctx context.Context, commitId string) (int, error) {
 	id, err := NewIdFromString(commitId)
 	if err != nil {
 		return 0, err
 	}
-	return repo.commitsCount(id)
+	return repo.commitsCount(ctx, id)
 }
 
 func (repo *Repository) FileCommitsCount(branch, file string) (int, error) {
+	return repo.FileCommitsCountContext(context.Background(), branch, file)
+}
+
+// FileCommitsCountContext is like FileCommitsCount, but gives up with the
+// context's error once ctx is done.
+func (repo *Repository) FileCommitsCountContext(ctx context.Context, branch, file string) (int, error) {
 	strId, err := repo.GetCommitIdOfBranch(branch)
-	if err != nil {
+	if err == ErrUnbornBranch {
+		return 0, nil
+	} else if err != nil {
 		return 0, err
 	}
 
@@ -163,26 +147,23 @@ func (repo *Repository) FileCommitsCount(branch, file string) (int, error) {
 		return 0, err
 	}
 
-	return repo.fileCommitsCount(id, file)
+	return repo.fileCommitsCount(ctx, id, file)
 }
 
-func (repo *Repository) commitsCount(id sha1) (int, error) {
-	commit, err := repo.getCommit(id)
+// Commits are counted without parsing them, see WalkCommitNodes.
+func (repo *Repository) commitsCount(ctx context.Context, id ObjectID) (int, error) {
+	count := 0
+	err := repo.walkCommitNodes(ctx, id, func(CommitNode) error {
+		count++
+		return nil
+	})
 	if err != nil {
 		return 0, err
 	}
-
-	counter, getter := makeCounter(nil)
-
-	_, err = walkHistory(commit, counter)
-	if err != nil {
-		return 0, err
-	}
-
-	return getter(), nil
+	return count, nil
 }
 
-func (repo *Repository) fileCommitsCount(id sha1, file string) (int, error) {
+func (repo *Repository) fileCommitsCount(ctx context.Context, id ObjectID, file string) (int, error) {
 	commit, err := repo.getCommit(id)
 	if err != nil {
 		return 0, err
@@ -192,7 +173,7 @@ func (repo *Repository) fileCommitsCount(id sha1, file string) (int, error) {
 	comparator := makePathComparator(file)
 	counter, getter := makeCounter(checker)
 
-	_, err = walkFilteredHistory(commit, counter, comparator)
+	_, err = walkFilteredHistory(ctx, commit, counter, comparator)
 	if err != nil {
 		return 0, err
 	}
@@ -226,22 +207,35 @@ func (repo *Repository) CommitsBetween(last *Commit, before *Commit) (*list.List
 }
 
 func (repo *Repository) CommitsBefore(commitId string) (*list.List, error) {
+	return repo.CommitsBeforeContext(context.Background(), commitId)
+}
+
+// CommitsBeforeContext is like CommitsBefore, but gives up with the
+// context's error once ctx is done.
+func (repo *Repository) CommitsBeforeContext(ctx context.Context, commitId string) (*list.List, error) {
 	id, err := NewIdFromString(commitId)
 	if err != nil {
 		return nil, err
 	}
 
-	return repo.getCommitsBefore(id)
+	return repo.getCommitsBefore(ctx, id)
 }
 
-func (repo *Repository) getCommitsBefore(id sha1) (*list.List, error) {
+func (repo *Repository) getCommitsBefore(ctx context.Context, id ObjectID) (*list.List, error) {
+	if repo.monotonicWalk {
+		return repo.commitsByCorrectedDate(ctx, id)
+	}
 	l := list.New()
 	lock := new(sync.Mutex)
-	err := repo.commitsBefore(lock, l, nil, id, 0)
+	err := repo.commitsBefore(ctx, lock, l, nil, id, 0)
 	return l, err
 }
 
-func (repo *Repository) commitsBefore(lock *sync.Mutex, l *list.List, parent *list.Element, id sha1, limit int) error {
+func (repo *Repository) commitsBefore(ctx context.Context, lock *sync.Mutex, l *list.List, parent *list.Element, id ObjectID, limit int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	commit, err := repo.getCommit(id)
 	if err != nil {
 		return err
@@ -289,7 +283,7 @@ func (repo *Repository) commitsBefore(lock *sync.Mutex, l *list.List, parent *li
 		if err != nil {
 			return err
 		}
-		err = repo.commitsBefore(lock, l, pr, id, 0)
+		err = repo.commitsBefore(ctx, lock, l, pr, id, 0)
 		if err != nil {
 			return err
 		}
@@ -299,16 +293,31 @@ func (repo *Repository) commitsBefore(lock *sync.Mutex, l *list.List, parent *li
 }
 
 // SearchCommits searches commits in given commitId and keyword of repository.
+// If the repository has a CommitIndexer, it is searched instead of the
+// history, unless it returns ErrNotIndexed.
 func (repo *Repository) SearchCommits(commitId, keyword string) (*list.List, error) {
+	return repo.SearchCommitsContext(context.Background(), commitId, keyword)
+}
+
+// SearchCommitsContext is like SearchCommits, but gives up with the
+// context's error once ctx is done.
+func (repo *Repository) SearchCommitsContext(ctx context.Context, commitId, keyword string) (*list.List, error) {
 	id, err := NewIdFromString(commitId)
 	if err != nil {
 		return nil, err
 	}
 
-	return repo.searchCommits(id, keyword)
+	return repo.searchCommits(ctx, id, keyword)
 }
 
-func (repo *Repository) searchCommits(id sha1, keyword string) (*list.List, error) {
+func (repo *Repository) searchCommits(ctx context.Context, id ObjectID, keyword string) (*list.List, error) {
+	if repo.indexer != nil {
+		results, err := repo.searchIndex(id, keyword)
+		if err != ErrNotIndexed {
+			return results, err
+		}
+	}
+
 	commit, err := repo.getCommit(id)
 	if err != nil {
 		return nil, err
@@ -321,20 +330,26 @@ func (repo *Repository) searchCommits(id sha1, keyword string) (*list.List, erro
 
 	pager := makePager(searcher, 0, ItemsPerSearch)
 
-	return walkHistory(commit, pager)
+	return walkHistory(ctx, commit, pager)
 }
 
 // GetCommitsByRange returns certain number of commits with given page of repository.
 func (repo *Repository) CommitsByRange(commitId string, page int) (*list.List, error) {
+	return repo.CommitsByRangeContext(context.Background(), commitId, page)
+}
+
+// CommitsByRangeContext is like CommitsByRange, but gives up with the
+// context's error once ctx is done.
+func (repo *Repository) CommitsByRangeContext(ctx context.Context, commitId string, page int) (*list.List, error) {
 	id, err := NewIdFromString(commitId)
 	if err != nil {
 		return nil, err
 	}
 
-	return repo.commitsByRange(id, page)
+	return repo.commitsByRange(ctx, id, page)
 }
 
-func (repo *Repository) commitsByRange(id sha1, page int) (*list.List, error) {
+func (repo *Repository) commitsByRange(ctx context.Context, id ObjectID, page int) (*list.List, error) {
 	commit, err := repo.getCommit(id)
 	if err != nil {
 		return nil, err
@@ -342,12 +357,20 @@ func (repo *Repository) commitsByRange(id sha1, page int) (*list.List, error) {
 
 	pager := makePager(nil, (page-1)*ItemsPerPage, ItemsPerPage)
 
-	return walkHistory(commit, pager)
+	return walkHistory(ctx, commit, pager)
 }
 
 func (repo *Repository) CommitsByFileAndRange(branch, file string, page int) (*list.List, error) {
+	return repo.CommitsByFileAndRangeContext(context.Background(), branch, file, page)
+}
+
+// CommitsByFileAndRangeContext is like CommitsByFileAndRange, but gives up
+// with the context's error once ctx is done.
+func (repo *Repository) CommitsByFileAndRangeContext(ctx context.Context, branch, file string, page int) (*list.List, error) {
 	strId, err := repo.GetCommitIdOfBranch(branch)
-	if err != nil {
+	if err == ErrUnbornBranch {
+		return list.New(), nil
+	} else if err != nil {
 		return nil, err
 	}
 
@@ -356,10 +379,10 @@ func (repo *Repository) CommitsByFileAndRange(branch, file string, page int) (*l
 		return nil, err
 	}
 
-	return repo.commitsByFileAndRange(id, file, page)
+	return repo.commitsByFileAndRange(ctx, id, file, page)
 }
 
-func (repo *Repository) commitsByFileAndRange(id sha1, path string, page int) (*list.List, error) {
+func (repo *Repository) commitsByFileAndRange(ctx context.Context, id ObjectID, path string, page int) (*list.List, error) {
 	commit, err := repo.getCommit(id)
 	if err != nil {
 		return nil, err
@@ -369,19 +392,25 @@ func (repo *Repository) commitsByFileAndRange(id sha1, path string, page int) (*
 	pager := makePager(checker, (page-1)*ItemsPerPage, ItemsPerPage)
 	comparator := makePathComparator(path)
 
-	return walkFilteredHistory(commit, pager, comparator)
+	return walkFilteredHistory(ctx, commit, pager, comparator)
 }
 
 func (repo *Repository) GetCommitOfRelPath(commitId, relPath string) (*Commit, error) {
+	return repo.GetCommitOfRelPathContext(context.Background(), commitId, relPath)
+}
+
+// GetCommitOfRelPathContext is like GetCommitOfRelPath, but gives up with
+// the context's error once ctx is done.
+func (repo *Repository) GetCommitOfRelPathContext(ctx context.Context, commitId, relPath string) (*Commit, error) {
 	id, err := NewIdFromString(commitId)
 	if err != nil {
 		return nil, err
 	}
 
-	return repo.getCommitOfRelPath(id, relPath)
+	return repo.getCommitOfRelPath(ctx, id, relPath)
 }
 
-func (repo *Repository) getCommitOfRelPath(id sha1, path string) (*Commit, error) {
+func (repo *Repository) getCommitOfRelPath(ctx context.Context, id ObjectID, path string) (*Commit, error) {
 	commit, err := repo.getCommit(id)
 	if err != nil {
 		return nil, err
@@ -391,7 +420,7 @@ func (repo *Repository) getCommitOfRelPath(id sha1, path string) (*Commit, error
 	pager := makePager(checker, 0, 1)
 	comparator := makePathComparator(path)
 
-	res, err := walkFilteredHistory(commit, pager, comparator)
+	res, err := walkFilteredHistory(ctx, commit, pager, comparator)
 	if err != nil {
 		return nil, err
 	}
@@ -402,3 +431,66 @@ func (repo *Repository) getCommitOfRelPath(id sha1, path string) (*Commit, error
 
 	return res.Front().Value.(*Commit), nil
 }
+
+// SearchCommitsByContent searches commits in given commitId that change
+// file content as selected by opts, see PickaxeOptions.
+func (repo *Repository) SearchCommitsByContent(commitId string, opts PickaxeOptions) (*list.List, error) {
+	return repo.SearchCommitsByContentContext(context.Background(), commitId, opts)
+}
+
+// SearchCommitsByContentContext is like SearchCommitsByContent, but gives up
+// with the context's error once ctx is done.
+func (repo *Repository) SearchCommitsByContentContext(ctx context.Context, commitId string, opts PickaxeOptions) (*list.List, error) {
+	id, err := NewIdFromString(commitId)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.searchCommitsByContent(ctx, id, opts)
+}
+
+func (repo *Repository) searchCommitsByContent(ctx context.Context, id ObjectID, opts PickaxeOptions) (*list.List, error) {
+	commit, err := repo.getCommit(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.String == "" && opts.Regexp == "" {
+		return nil, errors.New("empty pickaxe options")
+	}
+
+	checker, err := makePickaxeChecker(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	pager := makePager(checker, 0, ItemsPerSearch)
+
+	return walkHistory(ctx, commit, pager)
+}
+
+// CommitsByTimeWindow returns the commits reachable from commitId with a
+// committer date inside the given window.
+func (repo *Repository) CommitsByTimeWindow(commitId string, w TimeWindow) (*list.List, error) {
+	return repo.CommitsByTimeWindowContext(context.Background(), commitId, w)
+}
+
+// CommitsByTimeWindowContext is like CommitsByTimeWindow, but gives up with
+// the context's error once ctx is done.
+func (repo *Repository) CommitsByTimeWindowContext(ctx context.Context, commitId string, w TimeWindow) (*list.List, error) {
+	id, err := NewIdFromString(commitId)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.commitsByTimeWindow(ctx, id, w)
+}
+
+func (repo *Repository) commitsByTimeWindow(ctx context.Context, id ObjectID, w TimeWindow) (*list.List, error) {
+	commit, err := repo.getCommit(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return walkHistory(ctx, commit, makeTimeWindowFilter(nil, w))
+}
@@ -0,0 +1,393 @@
+package git
+
+import (
+	"container/heap"
+	"errors"
+)
+
+var (
+	ErrNoMergeBase = errors.New("no merge base found")
+)
+
+// GenerationCacheLimit bounds the number of generation numbers memoized per
+// repository. When the limit is reached, the numbers computed by a walk are
+// only kept until it ends, and the memo is dropped before the next one.
+var GenerationCacheLimit = 1 << 20
+
+// generation returns the generation number of a commit: 1 for root commits,
+// otherwise one more than the maximum generation of its parents. Commits
+// with a lower generation can never be descendants of a commit with a
+// higher one, which lets graph queries stop early.
+func (repo *Repository) generation(id ObjectID) (uint64, error) {
+	if gen, ok := repo.generations[id]; ok {
+		return gen, nil
+	}
+	if repo.generations == nil || len(repo.generations) >= GenerationCacheLimit {
+		repo.generations = make(map[ObjectID]uint64)
+	}
+	// numbers past the limit
+	var overflow map[ObjectID]uint64
+	get := func(id ObjectID) (uint64, bool) {
+		if gen, ok := repo.generations[id]; ok {
+			return gen, true
+		}
+		gen, ok := overflow[id]
+		return gen, ok
+	}
+	set := func(id ObjectID, gen uint64) {
+		if len(repo.generations) < GenerationCacheLimit {
+			repo.generations[id] = gen
+			return
+		}
+		if overflow == nil {
+			overflow = make(map[ObjectID]uint64)
+		}
+		overflow[id] = gen
+	}
+
+	// iterative, histories are too deep for recursion
+	stack := []ObjectID{id}
+	for len(stack) > 0 {
+		cur := stack[len(stack)-1]
+		if _, ok := get(cur); ok {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		node, err := repo.commitNode(cur)
+		if err != nil {
+			return 0, err
+		}
+		if node.Generation > 0 {
+			// the commit-graph file has it
+			set(cur, node.Generation)
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		var max uint64
+		pending := false
+		for _, p := range node.Parents {
+			gen, ok := get(p)
+			if !ok {
+				stack = append(stack, p)
+				pending = true
+				continue
+			}
+			if gen > max {
+				max = gen
+			}
+		}
+		if pending {
+			continue
+		}
+
+		set(cur, max+1)
+		stack = stack[:len(stack)-1]
+	}
+
+	gen, _ := get(id)
+	return gen, nil
+}
+
+// queue of commits, highest generation first, then newest first
+type commitQueue []*queuedCommit
+
+type queuedCommit struct {
+	commit *Commit
+	gen    uint64
+}
+
+func (q commitQueue) Len() int { return len(q) }
+func (q commitQueue) Less(i, j int) bool {
+	if q[i].gen != q[j].gen {
+		return q[i].gen > q[j].gen
+	}
+	return q[i].commit.Committer.When.After(q[j].commit.Committer.When)
+}
+func (q commitQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *commitQueue) Push(x interface{}) { *q = append(*q, x.(*queuedCommit)) }
+func (q *commitQueue) Pop() interface{} {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return x
+}
+
+func (repo *Repository) pushQueue(q *commitQueue, id ObjectID) error {
+	commit, err := repo.getCommit(id)
+	if err != nil {
+		return err
+	}
+	gen, err := repo.generation(id)
+	if err != nil {
+		return err
+	}
+	heap.Push(q, &queuedCommit{commit, gen})
+	return nil
+}
+
+const (
+	paintOne = 1 << iota
+	paintTwo
+	paintStale
+	paintResult
+)
+
+// MergeBase returns the best common ancestor of two commits, like
+// git merge-base.
+func (repo *Repository) MergeBase(commitId1, commitId2 string) (string, error) {
+	id1, err := NewIdFromString(commitId1)
+	if err != nil {
+		return "", err
+	}
+	id2, err := NewIdFromString(commitId2)
+	if err != nil {
+		return "", err
+	}
+
+	bases, err := repo.mergeBases(id1, id2)
+	if err != nil {
+		return "", err
+	}
+	if len(bases) == 0 {
+		return "", ErrNoMergeBase
+	}
+	return bases[0].String(), nil
+}
+
+// mergeBases returns all best common ancestors of a and b.
+func (repo *Repository) mergeBases(a, b ObjectID) ([]ObjectID, error) {
+	if a.Equal(b) {
+		return []ObjectID{a}, nil
+	}
+
+	paint := make(map[ObjectID]int)
+	q := &commitQueue{}
+	paint[a] = paintOne
+	paint[b] = paintTwo
+	if err := repo.pushQueue(q, a); err != nil {
+		return nil, err
+	}
+	if err := repo.pushQueue(q, b); err != nil {
+		return nil, err
+	}
+
+	var results []ObjectID
+	for q.Len() > 0 && !allStale(q, paint) {
+		cur := heap.Pop(q).(*queuedCommit).commit
+		flags := paint[cur.Id] &^ paintResult
+		if flags == paintOne|paintTwo {
+			if paint[cur.Id]&paintResult == 0 {
+				paint[cur.Id] |= paintResult
+				results = append(results, cur.Id)
+			}
+			flags |= paintStale
+		}
+		for _, p := range cur.parents {
+			if paint[p]&flags == flags {
+				continue
+			}
+			paint[p] |= flags
+			if err := repo.pushQueue(q, p); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// drop results that are ancestors of other results
+	var bases []ObjectID
+	for i, r := range results {
+		redundant := false
+		for j, other := range results {
+			if i == j {
+				continue
+			}
+			anc, err := repo.isAncestor(r, other)
+			if err != nil {
+				return nil, err
+			}
+			if anc {
+				redundant = true
+				break
+			}
+		}
+		if !redundant {
+			bases = append(bases, r)
+		}
+	}
+	return bases, nil
+}
+
+func allStale(q *commitQueue, paint map[ObjectID]int) bool {
+	for _, qc := range *q {
+		if paint[qc.commit.Id]&paintStale == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// IsAncestor reports whether commitId1 is an ancestor of (or equal to)
+// commitId2.
+func (repo *Repository) IsAncestor(commitId1, commitId2 string) (bool, error) {
+	id1, err := NewIdFromString(commitId1)
+	if err != nil {
+		return false, err
+	}
+	id2, err := NewIdFromString(commitId2)
+	if err != nil {
+		return false, err
+	}
+	return repo.isAncestor(id1, id2)
+}
+
+func (repo *Repository) isAncestor(anc, desc ObjectID) (bool, error) {
+	if anc.Equal(desc) {
+		return true, nil
+	}
+	minGen, err := repo.generation(anc)
+	if err != nil {
+		return false, err
+	}
+
+	seen := map[ObjectID]struct{}{desc: {}}
+	stack := []ObjectID{desc}
+	for len(stack) > 0 {
+		cur := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		commit, err := repo.getCommit(cur)
+		if err != nil {
+			return false, err
+		}
+		for _, p := range commit.parents {
+			if p.Equal(anc) {
+				return true, nil
+			}
+			if _, ok := seen[p]; ok {
+				continue
+			}
+			seen[p] = struct{}{}
+			gen, err := repo.generation(p)
+			if err != nil {
+				return false, err
+			}
+			// parents of p have an even lower generation than anc
+			if gen <= minGen {
+				continue
+			}
+			stack = append(stack, p)
+		}
+	}
+	return false, nil
+}
+
+// GetChildren returns the commits that have commitId as a parent and are
+// reachable from the given refs, or from all refs if underRefs is empty.
+func (repo *Repository) GetChildren(commitId string, underRefs []string) ([]*Commit, error) {
+	id, err := NewIdFromString(commitId)
+	if err != nil {
+		return nil, err
+	}
+
+	var tips []ObjectID
+	if len(underRefs) == 0 {
+		refs, err := repo.listRefs()
+		if err != nil {
+			return nil, err
+		}
+		for _, tip := range refs {
+			if tip, err := repo.peelToCommit(tip); err == nil {
+				tips = append(tips, tip)
+			}
+		}
+	} else {
+		for _, ref := range underRefs {
+			tip, err := repo.resolveRevision(ref)
+			if err != nil {
+				return nil, err
+			}
+			tips = append(tips, tip)
+		}
+	}
+
+	return repo.children(id, tips)
+}
+
+func (repo *Repository) children(id ObjectID, tips []ObjectID) ([]*Commit, error) {
+	minGen, err := repo.generation(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var children []*Commit
+	seen := make(map[ObjectID]struct{})
+	stack := append([]ObjectID(nil), tips...)
+	for len(stack) > 0 {
+		cur := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if _, ok := seen[cur]; ok {
+			continue
+		}
+		seen[cur] = struct{}{}
+
+		// children have a higher generation than their parents
+		gen, err := repo.generation(cur)
+		if err != nil {
+			return nil, err
+		}
+		if gen <= minGen {
+			continue
+		}
+
+		commit, err := repo.getCommit(cur)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range commit.parents {
+			if p.Equal(id) {
+				children = append(children, commit)
+				break
+			}
+		}
+		stack = append(stack, commit.parents...)
+	}
+	return children, nil
+}
+
+// topoOrder returns all commits reachable from tips with every commit
+// after its parents.
+func (repo *Repository) topoOrder(tips []ObjectID) ([]*Commit, error) {
+	var order []*Commit
+	done := make(map[ObjectID]bool)
+
+	// iterative depth first search, a commit is emitted once all its
+	// parents are done
+	stack := append([]ObjectID(nil), tips...)
+	for len(stack) > 0 {
+		cur := stack[len(stack)-1]
+		if done[cur] {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		commit, err := repo.getCommit(cur)
+		if err != nil {
+			return nil, err
+		}
+		pending := false
+		for _, p := range commit.parents {
+			if !done[p] {
+				stack = append(stack, p)
+				pending = true
+			}
+		}
+		if pending {
+			continue
+		}
+		done[cur] = true
+		order = append(order, commit)
+		stack = stack[:len(stack)-1]
+	}
+	return order, nil
+}
@@ -2,6 +2,8 @@ package git
 
 import (
 	"container/list"
+	"context"
+	"time"
 )
 
 type HistoryWalkerAction int
@@ -26,68 +28,116 @@ type CommitWalkCallback func(*Commit) (HistoryWalkerAction, error)
 // commits are considered equal. See "History Simplification" chapter of git-log man for details
 type CommitComparator func(current, parent *Commit) bool
 
-func walkHistory(start *Commit, callback CommitWalkCallback) (*list.List, error) {
-	return walkHistoryLoop([]*Commit{start}, callback, nopComparator)
+// The walks stop with the context's error once ctx is done.
+func walkHistory(ctx context.Context, start *Commit, callback CommitWalkCallback) (*list.List, error) {
+	return walkHistoryLoop(ctx, []*Commit{start}, callback, nopComparator)
 }
 
-func walkFilteredHistory(start *Commit, callback CommitWalkCallback,
+func walkFilteredHistory(ctx context.Context, start *Commit, callback CommitWalkCallback,
 	eq CommitComparator) (*list.List, error) {
 
-	return walkHistoryLoop([]*Commit{start}, callback, eq)
+	return walkHistoryLoop(ctx, []*Commit{start}, callback, eq)
 }
 
 // roots must be not equal to each other
-func walkHistoryLoop(roots []*Commit, callback CommitWalkCallback,
+func walkHistoryLoop(ctx context.Context, roots []*Commit, callback CommitWalkCallback,
 	eq CommitComparator) (*list.List, error) {
 
-	results := list.New()
-	seen := make(map[sha1]struct{})
+	if len(roots) > 0 {
+		defer roots[0].repo.observeSince(MetricTraversalSeconds, time.Now())
+	}
 
+	results := list.New()
+	walk := newHistoryWalk(ctx, roots, callback, eq)
 	for {
-		if len(roots) == 0 {
+		next, err := walk.next()
+		if err != nil {
+			return nil, err
+		}
+		if next == nil {
 			return results, nil
 		}
+		// witness commit
+		results.PushBack(next)
+	}
+}
+
+// historyWalk is the state of a walk of the history, so that the commits
+// the callback takes can be produced one at a time.
+type historyWalk struct {
+	ctx      context.Context
+	roots    []*Commit
+	callback CommitWalkCallback
+	eq       CommitComparator
+	seen     map[ObjectID]struct{}
+	done     bool
+}
+
+// roots must be not equal to each other
+func newHistoryWalk(ctx context.Context, roots []*Commit, callback CommitWalkCallback,
+	eq CommitComparator) *historyWalk {
+
+	return &historyWalk{
+		ctx:      ctx,
+		roots:    roots,
+		callback: callback,
+		eq:       eq,
+		seen:     make(map[ObjectID]struct{}),
+	}
+}
+
+// next returns the next commit the callback takes, or nil once the walk is
+// over.
+func (w *historyWalk) next() (*Commit, error) {
+	for !w.done {
+		if err := w.ctx.Err(); err != nil {
+			w.done = true
+			return nil, err
+		}
 
 		var err error
 
-		roots, err = simplifyRoots(roots, eq, seen)
+		w.roots, err = simplifyRoots(w.roots, w.eq, w.seen)
 		if err != nil {
+			w.done = true
 			return nil, err
 		}
 
-		if len(roots) == 0 {
-			return results, nil
+		if len(w.roots) == 0 {
+			w.done = true
+			break
 		}
 
 		var next *Commit
-		next, roots = extractNewestCommit(roots)
+		next, w.roots = extractNewestCommit(w.roots)
 
-		action, err := callback(next)
+		action, err := w.callback(next)
 		if err != nil {
+			w.done = true
 			return nil, err
 		}
 
-		if action&HWTakeCommit > 0 {
-			// witness commit
-			results.PushBack(next)
-			seen[next.Id] = struct{}{}
-		}
-
 		if action&HWFollowParents > 0 {
 			// follow all parents of commit
 			pars, err := parents(next)
 			if err != nil {
+				w.done = true
 				return nil, err
 			}
-			roots = mergeRoots(pars, roots, eq, seen)
+			w.roots = mergeRoots(pars, w.roots, w.eq, w.seen)
 		}
 
 		if action&HWStop > 0 {
-			return results, nil
+			w.done = true
+		}
+
+		if action&HWTakeCommit > 0 {
+			w.seen[next.Id] = struct{}{}
+			return next, nil
 		}
 	}
 
-	return results, nil
+	return nil, nil
 }
 
 func parents(commit *Commit) ([]*Commit, error) {
@@ -104,7 +154,7 @@ func parents(commit *Commit) ([]*Commit, error) {
 
 // mergeRoots will merge two sets of commits and ensure that they are not equal to each other
 // the members of base and merging sets already nonequal to each other
-func mergeRoots(base, merging []*Commit, eq CommitComparator, seen map[sha1]struct{}) []*Commit {
+func mergeRoots(base, merging []*Commit, eq CommitComparator, seen map[ObjectID]struct{}) []*Commit {
 	newRoots := append([]*Commit(nil), base...)
 	for _, needle := range merging {
 		found := false
@@ -130,7 +180,7 @@ func mergeRoots(base, merging []*Commit, eq CommitComparator, seen map[sha1]stru
 // that equals to current commit the current commit will be dropped and parent will be followed
 // see "History Simplification" chapter of git-log man for full details.
 func skipEqualCommits(commit *Commit, eq CommitComparator,
-	seen map[sha1]struct{}) (*Commit, error) {
+	seen map[ObjectID]struct{}) (*Commit, error) {
 
 	for {
 		// we already seen that commit, no point to traverse further
@@ -168,7 +218,7 @@ func skipEqualCommits(commit *Commit, eq CommitComparator,
 }
 
 func simplifyRoots(roots []*Commit, eq CommitComparator,
-	seen map[sha1]struct{}) ([]*Commit, error) {
+	seen map[ObjectID]struct{}) ([]*Commit, error) {
 
 	newRoots := []*Commit{}
 	for _, commit := range roots {
@@ -184,7 +234,8 @@ func simplifyRoots(roots []*Commit, eq CommitComparator,
 	return newRoots, nil
 }
 
-// extractNewestCommit will find newest commit, extract it and return resulting set
+// extractNewestCommit will find newest commit, extract it and return resulting set.
+// Dates are corrected if the repository walks monotonically.
 func extractNewestCommit(roots []*Commit) (*Commit, []*Commit) {
 	if len(roots) == 1 {
 		return roots[0], roots[:0]
@@ -193,7 +244,7 @@ func extractNewestCommit(roots []*Commit) (*Commit, []*Commit) {
 	target := roots[0]
 	targetIdx := 0
 	for idx, current := range roots[1:] {
-		if current.Committer.When.After(target.Committer.When) {
+		if current.repo.walksBefore(current, target) {
 			target = current
 			targetIdx = idx + 1
 		}
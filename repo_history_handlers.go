@@ -1,7 +1,9 @@
 package git
 
 import (
+	"bytes"
 	"regexp"
+	"time"
 )
 
 func commitRootComparator(current, parent *Commit) bool {
@@ -14,15 +16,65 @@ func nopComparator(current, parent *Commit) bool {
 
 func makePathComparator(path string) CommitComparator {
 	return func(current, parent *Commit) bool {
-		centry, cerr := current.GetTreeEntryByPath(path)
-		pentry, perr := parent.GetTreeEntryByPath(path)
+		return samePathEntry(current, parent, path)
+	}
+}
+
+func samePathEntry(current, parent *Commit, path string) bool {
+	centry, cerr := current.GetTreeEntryByPath(path)
+	pentry, perr := parent.GetTreeEntryByPath(path)
+
+	if cerr != nil || perr != nil {
+		return cerr == ErrNotExist && perr == ErrNotExist
+	}
 
-		if cerr != nil || perr != nil {
-			return cerr == ErrNotExist && perr == ErrNotExist
+	return centry.Id.Equal(pentry.Id)
+}
+
+// makeFollower is makePathChecker and makePathComparator for a file that
+// may have been renamed: once a commit is found that renamed it, older
+// commits are checked for its old path, like git log --follow does. Like
+// there, the history of the file should be linear.
+func makeFollower(path string) (CommitWalkCallback, CommitComparator) {
+	checker := func(commit *Commit) (HistoryWalkerAction, error) {
+		_, err := commit.GetTreeEntryByPath(path)
+		if err == ErrNotExist {
+			return HWFollowParents, nil
+		} else if err != nil {
+			return HWStop, err
+		}
+		if commit.ParentCount() == 0 {
+			return HWTakeAndFollow, nil
 		}
 
-		return centry.Id.Equal(pentry.Id)
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return HWStop, err
+		}
+		if _, err := parent.GetTreeEntryByPath(path); err != ErrNotExist {
+			return HWTakeAndFollow, err
+		}
+		// the file was added, maybe by renaming another one
+		changes, err := diffTrees(&parent.Tree, &commit.Tree)
+		if err != nil {
+			return HWStop, err
+		}
+		changes, err = commit.repo.detectRenames(changes, RenameOptions{})
+		if err != nil {
+			return HWStop, err
+		}
+		for _, c := range changes {
+			if c.path == path && c.oldPath != "" {
+				path = c.oldPath
+				break
+			}
+		}
+		return HWTakeAndFollow, nil
+	}
+	eq := func(current, parent *Commit) bool {
+		return samePathEntry(current, parent, path)
 	}
+	return checker, eq
 }
 
 func makePathChecker(path string) (cb CommitWalkCallback) {
@@ -123,3 +175,117 @@ func makeCounter(cb CommitWalkCallback) (CommitWalkCallback, func() int) {
 
 	return callback, getter
 }
+
+// PickaxeOptions selects commits by the content they change, like the -S
+// and -G options of git log. If both are set, a commit must match both.
+type PickaxeOptions struct {
+	// Select commits that change the number of occurrences of String.
+	String string
+	// Select commits with added or removed lines matching Regexp.
+	Regexp string
+}
+
+func makePickaxeChecker(opts PickaxeOptions) (CommitWalkCallback, error) {
+	var matcher *regexp.Regexp
+	if opts.Regexp != "" {
+		var err error
+		matcher, err = regexp.Compile(opts.Regexp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return func(commit *Commit) (HistoryWalkerAction, error) {
+		// like git log, merges are not inspected
+		if commit.ParentCount() > 1 {
+			return HWFollowParents, nil
+		}
+
+		ptree, err := firstParentTree(commit)
+		if err != nil {
+			return HWStop, err
+		}
+		changes, err := diffTrees(ptree, &commit.Tree)
+		if err != nil {
+			return HWStop, err
+		}
+
+		for _, change := range changes {
+			ok, err := pickaxeMatches(commit.repo, change, opts.String, matcher)
+			if err != nil {
+				return HWStop, err
+			}
+			if ok {
+				return HWTakeAndFollow, nil
+			}
+		}
+		return HWFollowParents, nil
+	}, nil
+}
+
+func pickaxeMatches(repo *Repository, change *treeChange, needle string, matcher *regexp.Regexp) (bool, error) {
+	from, err := repo.readEntryData(change.from)
+	if err != nil {
+		return false, err
+	}
+	to, err := repo.readEntryData(change.to)
+	if err != nil {
+		return false, err
+	}
+
+	if needle != "" && bytes.Count(from, []byte(needle)) == bytes.Count(to, []byte(needle)) {
+		return false, nil
+	}
+
+	if matcher != nil {
+		a, b := splitLines(from), splitLines(to)
+		for _, op := range diffLines(a, b) {
+			switch {
+			case op.typ == lineDelete && matcher.MatchString(a[op.a]):
+				return true, nil
+			case op.typ == lineInsert && matcher.MatchString(b[op.b]):
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	return needle != "", nil
+}
+
+// TimeWindow limits a history walk to commits with a committer date
+// between Since and Until. A zero Since or Until means unbounded.
+//
+// The walker always continues with the newest pending commit, so the walk
+// stops as soon as that commit is older than Since. Slack moves this cutoff
+// further back, so that a few commits with skewed clocks do not end the
+// walk too early.
+type TimeWindow struct {
+	Since time.Time
+	Until time.Time
+	Slack time.Duration
+}
+
+func makeTimeWindowFilter(cb CommitWalkCallback, w TimeWindow) CommitWalkCallback {
+	if cb == nil {
+		cb = nopCallback
+	}
+	cutoff := w.Since.Add(-w.Slack)
+
+	return func(commit *Commit) (HistoryWalkerAction, error) {
+		when := commit.Committer.When
+		if !w.Since.IsZero() {
+			if when.Before(cutoff) {
+				// all pending commits are older than this one
+				return HWStop, nil
+			}
+			if when.Before(w.Since) {
+				return HWFollowParents, nil
+			}
+		}
+		if !w.Until.IsZero() && when.After(w.Until) {
+			return HWFollowParents, nil
+		}
+		return cb(commit)
+	}
+}
@@ -0,0 +1,228 @@
+package git
+
+import (
+	"container/list"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// A RepoManager opens repositories on demand and keeps up to MaxOpen of
+// them open, closing the least recently used ones. A Repository is not safe
+// for concurrent use, so calls for the same repository are serialized,
+// while different repositories can be used in parallel.
+type RepoManager struct {
+	// MaxOpen bounds the number of open repositories, 0 means unlimited.
+	MaxOpen int
+	// Open opens a repository. If nil, OpenRepository is used.
+	Open func(path string) (*Repository, error)
+	// If set, opening and evicting repositories is logged, and the
+	// repositories get the logger too.
+	Logger *slog.Logger
+
+	mu      sync.Mutex
+	entries map[string]*managedRepo
+	lru     *list.List
+	stats   RepoManagerStats
+}
+
+// RepoManagerStats are counters of a RepoManager.
+type RepoManagerStats struct {
+	Open       int
+	Hits       uint64
+	Misses     uint64
+	Evictions  uint64
+	OpenErrors uint64
+}
+
+type managedRepo struct {
+	path string
+	elem *list.Element
+
+	once sync.Once
+	repo *Repository
+	err  error
+
+	// serializes use of repo
+	mu sync.Mutex
+
+	// protected by the manager's mutex
+	users   int
+	evicted bool
+	opened  bool
+}
+
+// NewRepoManager returns a manager keeping up to maxOpen repositories open.
+func NewRepoManager(maxOpen int) *RepoManager {
+	return &RepoManager{MaxOpen: maxOpen}
+}
+
+// Do calls fn with the repository at path, opening it if it isn't open.
+// No other call of Do for the same repository runs at the same time. fn
+// must not keep the repository after it returns.
+func (m *RepoManager) Do(path string, fn func(*Repository) error) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	e := m.acquire(path)
+	defer m.release(e)
+
+	e.once.Do(func() {
+		open := m.Open
+		if open == nil {
+			open = OpenRepository
+		}
+		e.repo, e.err = open(path)
+		if e.err == nil && m.Logger != nil {
+			e.repo.SetLogger(m.Logger)
+		}
+	})
+	if e.err != nil {
+		m.log().Warn("opening repository failed", "path", path, "err", e.err)
+		m.mu.Lock()
+		m.stats.OpenErrors++
+		// don't cache the failure, the next call tries again
+		m.evictLocked(e)
+		m.mu.Unlock()
+		return e.err
+	}
+	m.mu.Lock()
+	e.opened = true
+	m.mu.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return fn(e.repo)
+}
+
+func (m *RepoManager) acquire(path string) *managedRepo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.entries == nil {
+		m.entries = make(map[string]*managedRepo)
+		m.lru = list.New()
+	}
+
+	e, ok := m.entries[path]
+	if ok {
+		m.stats.Hits++
+		if !e.evicted {
+			m.lru.MoveToFront(e.elem)
+		}
+	} else {
+		m.stats.Misses++
+		e = &managedRepo{path: path}
+		e.elem = m.lru.PushFront(e)
+		m.entries[path] = e
+		for m.MaxOpen > 0 && m.lru.Len() > m.MaxOpen {
+			m.evictLocked(m.lru.Back().Value.(*managedRepo))
+		}
+	}
+	e.users++
+	return e
+}
+
+func (m *RepoManager) release(e *managedRepo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e.users--
+	if e.evicted && e.users == 0 {
+		m.removeLocked(e)
+	}
+}
+
+// Evict closes the repository at path, once it is no longer in use.
+func (m *RepoManager) Evict(path string) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.entries[path]; ok {
+		m.evictLocked(e)
+	}
+}
+
+// Evict e. A repository in use stays in the map, so that calls for it are
+// still serialized, until it is released.
+func (m *RepoManager) evictLocked(e *managedRepo) {
+	if e.evicted {
+		return
+	}
+	m.log().Debug("evicting repository", "path", e.path, "users", e.users)
+	m.lru.Remove(e.elem)
+	e.evicted = true
+	m.stats.Evictions++
+	if e.users == 0 {
+		m.removeLocked(e)
+	}
+}
+
+func (m *RepoManager) removeLocked(e *managedRepo) {
+	if m.entries[e.path] == e {
+		delete(m.entries, e.path)
+	}
+	e.close()
+}
+
+func (e *managedRepo) close() {
+	if e.repo != nil {
+		e.repo.Close()
+	}
+}
+
+// Close evicts all repositories.
+func (m *RepoManager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.entries {
+		m.evictLocked(e)
+	}
+	return nil
+}
+
+// Stats returns the counters of the manager.
+func (m *RepoManager) Stats() RepoManagerStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := m.stats
+	stats.Open = len(m.entries)
+	return stats
+}
+
+// Health checks that the object directories of the open repositories still
+// exist, and returns the errors by repository path. Repositories that fail
+// the check are evicted.
+func (m *RepoManager) Health() map[string]error {
+	m.mu.Lock()
+	var dirs = make(map[*managedRepo]string, len(m.entries))
+	for _, e := range m.entries {
+		if e.opened {
+			dirs[e] = e.repo.ObjectsDir
+		}
+	}
+	m.mu.Unlock()
+
+	problems := make(map[string]error)
+	for e, dir := range dirs {
+		if _, err := os.Stat(dir); err != nil {
+			problems[e.path] = err
+			// not another entry opened for the path meanwhile
+			m.mu.Lock()
+			m.evictLocked(e)
+			m.mu.Unlock()
+		}
+	}
+	return problems
+}
+
+func (m *RepoManager) log() *slog.Logger {
+	if m.Logger != nil {
+		return m.Logger
+	}
+	return discardLogger
+}
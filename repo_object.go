@@ -1,10 +1,14 @@
 package git
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
 // Who am I?
@@ -25,14 +29,32 @@ func (t ObjectType) String() string {
 		return "tree"
 	case ObjectBlob:
 		return "blob"
+	case ObjectTag:
+		return "tag"
 	default:
 		return ""
 	}
 }
 
+// ParseObjectType returns the ObjectType for its name as used in object
+// headers.
+func ParseObjectType(name string) (ObjectType, error) {
+	switch name {
+	case "commit":
+		return ObjectCommit, nil
+	case "tree":
+		return ObjectTree, nil
+	case "blob":
+		return ObjectBlob, nil
+	case "tag":
+		return ObjectTag, nil
+	}
+	return 0, fmt.Errorf("unknown object type %q", name)
+}
+
 // Given a SHA1, find the pack it is in and the offset, or return nil if not
 // found.
-func (repo *Repository) findObjectPack(id sha1) (*idxFile, uint64) {
+func (repo *Repository) findObjectPack(id ObjectID) (*idxFile, uint64) {
 	for _, indexfile := range repo.indexfiles {
 		if offset, ok := indexfile.offsetValues[id]; ok {
 			return indexfile, offset
@@ -50,19 +72,57 @@ func (repo *Repository) HaveObject(idStr string) (found, packed bool, err error)
 	return repo.haveObject(id)
 }
 
-func (repo *Repository) haveObject(id sha1) (found, packed bool, err error) {
+// The object directories objects are read from, the object database
+// first.
+func (repo *Repository) objectDirs() []string {
+	return append([]string{repo.ObjectsDir}, repo.alternates...)
+}
+
+// Return the file of a loose object, or "" if there is none.
+func (repo *Repository) looseObjectPath(id ObjectID) (string, error) {
 	sha1 := id.String()
-	_, err = os.Stat(filepathFromSHA1(repo.Path, sha1))
-	if err == nil {
-		found = true
-		return
-	} else if !os.IsNotExist(err) {
+	for _, dir := range repo.objectDirs() {
+		p := filepathFromSHA1(dir, sha1)
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// Return the index files of the packs of all object directories.
+func (repo *Repository) packIndexPaths() ([]string, error) {
+	var paths []string
+	for _, dir := range repo.objectDirs() {
+		found, err := filepath.Glob(filepath.Join(dir, "pack/*idx"))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, found...)
+	}
+	return paths, nil
+}
+
+func (repo *Repository) haveObject(id ObjectID) (found, packed bool, err error) {
+	if _, ok := repo.memObject(id); ok {
+		return true, false, nil
+	}
+	loose, err := repo.looseObjectPath(id)
+	if err != nil || loose != "" {
+		found = loose != ""
 		return
-	} else if os.IsNotExist(err) {
-		err = nil
 	}
 
 	pack, _ := repo.findObjectPack(id)
+	if pack == nil && repo.snapshot != nil {
+		// it may have been repacked since the snapshot was taken
+		var added bool
+		if added, err = repo.pinNewPacks(); added {
+			pack, _ = repo.findObjectPack(id)
+		}
+	}
 	if pack == nil {
 		return
 	}
@@ -70,7 +130,87 @@ func (repo *Repository) haveObject(id sha1) (found, packed bool, err error) {
 	return
 }
 
-func (repo *Repository) GetRawObject(id sha1, metaOnly bool) (ObjectType, int64, io.ReadCloser, error) {
+// Return the object whose id starts with the hex digits of prefix, which
+// must name exactly one object.
+func (repo *Repository) expandShortId(prefix string) (ObjectID, error) {
+	if len(prefix) < 4 || len(prefix) > 40 || !isHexString(prefix) {
+		return ObjectID{}, fmt.Errorf("bad short id %q", prefix)
+	}
+	found := make(map[ObjectID]struct{})
+	match := func(id ObjectID) {
+		if strings.HasPrefix(id.String(), prefix) {
+			found[id] = struct{}{}
+		}
+	}
+
+	if repo.dryRun != nil {
+		repo.dryRun.mu.Lock()
+		for id := range repo.dryRun.objects {
+			match(id)
+		}
+		repo.dryRun.mu.Unlock()
+	}
+	for _, dir := range repo.objectDirs() {
+		names, err := ioutil.ReadDir(filepath.Join(dir, prefix[:2]))
+		if err != nil && !os.IsNotExist(err) {
+			return ObjectID{}, err
+		}
+		for _, fi := range names {
+			if id, err := NewIdFromString(prefix[:2] + fi.Name()); err == nil {
+				match(id)
+			}
+		}
+	}
+	for _, idx := range repo.indexfiles {
+		for id := range idx.offsetValues {
+			match(id)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return ObjectID{}, ErrNotExist
+	case 1:
+		for id := range found {
+			return id, nil
+		}
+	}
+	return ObjectID{}, fmt.Errorf("short id %s is ambiguous", prefix)
+}
+
+func (repo *Repository) GetRawObject(id ObjectID, metaOnly bool) (ObjectType, int64, io.ReadCloser, error) {
+	if repo.closed {
+		return 0, 0, nil, ErrRepositoryClosed
+	}
+	if repo.budget != nil {
+		return repo.getBudgetedObject(id, metaOnly)
+	}
+	return repo.getRawObject(id, metaOnly)
+}
+
+func (repo *Repository) getBudgetedObject(id ObjectID, metaOnly bool) (ObjectType, int64, io.ReadCloser, error) {
+	if metaOnly {
+		if err := repo.budget.checkTime(); err != nil {
+			return 0, 0, nil, err
+		}
+		return repo.getRawObject(id, true)
+	}
+
+	if err := repo.budget.chargeObject(); err != nil {
+		repo.log().Debug("object read budget exceeded", "id", id.String())
+		return 0, 0, nil, err
+	}
+	tp, size, rc, err := repo.getRawObject(id, false)
+	if err != nil {
+		return tp, size, rc, err
+	}
+	return tp, size, &budgetReader{rc, repo.budget}, nil
+}
+
+func (repo *Repository) getRawObject(id ObjectID, metaOnly bool) (ObjectType, int64, io.ReadCloser, error) {
+	if obj, ok := repo.memObject(id); ok {
+		return obj.typ, int64(len(obj.data)), ioutil.NopCloser(bytes.NewReader(obj.data)), nil
+	}
 	sha1 := id.String()
 	found, packed, err := repo.haveObject(id)
 	switch {
@@ -81,15 +221,50 @@ func (repo *Repository) GetRawObject(id sha1, metaOnly bool) (ObjectType, int64,
 		return 0, 0, nil, errors.New(fmt.Sprintf("Object not found %s", sha1))
 
 	case !packed:
-		return readObjectFile(filepathFromSHA1(repo.Path, sha1), metaOnly)
+		loose, err := repo.looseObjectPath(id)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		tp, size, rc, err := readObjectFile(loose, metaOnly)
+		if os.IsNotExist(err) && repo.snapshot != nil {
+			// packed and pruned by a repack since it was found
+			return repo.getRawObject(id, metaOnly)
+		}
+		rc = repo.verifyObject(rc, id, tp, size, metaOnly, err)
+		return tp, size, repo.meterObject(rc, metaOnly, "loose"), err
 	}
 
 	pack, offset := repo.findObjectPack(id)
-	return readObjectBytes(pack.packpath, &repo.indexfiles, offset, metaOnly)
+	repo.countMetric(MetricPackOpens, 1)
+	var budget *Budget
+	if !metaOnly {
+		budget = repo.budget
+	}
+	tp, size, rc, err := readPackedObject(pack.packpath, &repo.indexfiles, offset, metaOnly, budget, nil)
+	rc = repo.verifyObject(rc, id, tp, size, metaOnly, err)
+	return tp, size, repo.meterObject(rc, metaOnly, "packed"), err
+}
+
+// Check the content of an object read with SetVerifyObjects on.
+func (repo *Repository) verifyObject(rc io.ReadCloser, id ObjectID, tp ObjectType, size int64, metaOnly bool, err error) io.ReadCloser {
+	if !repo.verifyObjects || metaOnly || err != nil || rc == nil {
+		return rc
+	}
+	return newVerifyingReader(rc, id, tp, size)
+}
+
+// Report an object read to the repository's metrics.
+func (repo *Repository) meterObject(rc io.ReadCloser, metaOnly bool, kind string) io.ReadCloser {
+	m := repo.getMetrics()
+	if m == nil || metaOnly || rc == nil {
+		return rc
+	}
+	m.Add(MetricObjectReads, 1, "kind", kind)
+	return &meteredReader{rc, m, MetricObjectBytes}
 }
 
 // Get the type of an object.
-func (repo *Repository) objectType(id sha1) (ObjectType, error) {
+func (repo *Repository) objectType(id ObjectID) (ObjectType, error) {
 	objtype, _, _, err := repo.GetRawObject(id, true)
 	if err != nil {
 		return 0, err
@@ -98,7 +273,26 @@ func (repo *Repository) objectType(id sha1) (ObjectType, error) {
 }
 
 // Get (inflated) size of an object.
-func (repo *Repository) objectSize(id sha1) (int64, error) {
+func (repo *Repository) objectSize(id ObjectID) (int64, error) {
 	_, length, _, err := repo.GetRawObject(id, true)
 	return length, err
 }
+
+// Follow tag objects until a non-tag object is reached, and return that
+// object's id and type.
+func (repo *Repository) peel(id ObjectID) (ObjectID, ObjectType, error) {
+	for {
+		tp, err := repo.objectType(id)
+		if err != nil {
+			return id, 0, err
+		}
+		if tp != ObjectTag {
+			return id, tp, nil
+		}
+		tag, err := repo.getTag(id)
+		if err != nil {
+			return id, 0, err
+		}
+		id = tag.Object
+	}
+}
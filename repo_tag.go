@@ -1,12 +1,21 @@
 package git
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"strings"
 )
 
+var ErrTagExisted = errors.New("tag has existed")
+
 func (repo *Repository) IsTagExist(tagName string) bool {
+	if repo.snapshot != nil {
+		_, ok := repo.snapshot.refs["refs/tags/"+tagName]
+		return ok
+	}
 	tagPath := filepath.Join(repo.Path, "refs/tags", tagName)
 	return isFile(tagPath)
 }
@@ -24,36 +33,83 @@ func (repo *Repository) CreateTag(tagName, idStr string) error {
 	return repo.createRef("tags", tagName, idStr)
 }
 
+// CreateAnnotatedTag writes a tag object for the object id and creates the
+// tag ref pointing to it. If tagger is nil, DefaultCommitter is used. A
+// message without a trailing newline gets one, like git tag -m.
+func (repo *Repository) CreateAnnotatedTag(tagName string, id ObjectID, tagger *Signature, message string) (ObjectID, error) {
+	if err := checkRefName("refs/tags/" + tagName); err != nil {
+		return ObjectID{}, err
+	}
+	_, exists, err := repo.lookupRef("refs/tags/" + tagName)
+	if err != nil {
+		return ObjectID{}, err
+	}
+	if exists {
+		return ObjectID{}, ErrTagExisted
+	}
+	tp, err := repo.objectType(id)
+	if err != nil {
+		return ObjectID{}, err
+	}
+	if tagger == nil {
+		if tagger, err = repo.DefaultCommitter(); err != nil {
+			return ObjectID{}, err
+		}
+	}
+	if err := tagger.check(); err != nil {
+		return ObjectID{}, err
+	}
+	if message != "" && !strings.HasSuffix(message, "\n") {
+		message += "\n"
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "object %s\n", id)
+	fmt.Fprintf(&buf, "type %s\n", tp)
+	fmt.Fprintf(&buf, "tag %s\n", tagName)
+	fmt.Fprintf(&buf, "tagger %s\n", tagger.commitLine())
+	buf.WriteByte('\n')
+	buf.WriteString(message)
+	tagId, err := repo.StoreObjectLoose(ObjectTag, bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return ObjectID{}, err
+	}
+	return tagId, repo.createRef("tags", tagName, tagId.String())
+}
+
 func CreateTag(repoPath, tagName, id string) error {
 	return CreateRef("tags", repoPath, tagName, id)
 }
 
+// GetTag returns the tag with the name. For annotated tags, the tag object
+// is parsed; a lightweight tag is returned as a tag without tagger and
+// message whose Object is the object the ref points to.
 func (repo *Repository) GetTag(tagName string) (*Tag, error) {
-	d, err := ioutil.ReadFile(repo.TagPath(tagName))
+	ref, ok, err := repo.lookupRef("refs/tags/" + tagName)
 	if err != nil {
 		return nil, err
 	}
-
-	id, err := NewIdFromString(string(d))
-	if err != nil {
-		return nil, err
+	if !ok {
+		return nil, ErrNotExist
 	}
 
-	tag, err := repo.getTag(id)
+	tag, err := repo.getTag(ref.Id)
 	if err != nil {
 		return nil, err
 	}
-	tag.Name = tagName
-	return tag, nil
+	// the tag may be cached under another name
+	named := *tag
+	named.Name = tagName
+	return &named, nil
 }
 
-func (repo *Repository) getTag(id sha1) (*Tag, error) {
+func (repo *Repository) getTag(id ObjectID) (*Tag, error) {
 	if repo.tagCache != nil {
 		if c, ok := repo.tagCache[id]; ok {
 			return c, nil
 		}
 	} else {
-		repo.tagCache = make(map[sha1]*Tag, 10)
+		repo.tagCache = make(map[ObjectID]*Tag, 10)
 	}
 
 	tp, _, dataRc, err := repo.GetRawObject(id, false)
@@ -65,32 +121,27 @@ func (repo *Repository) getTag(id sha1) (*Tag, error) {
 		dataRc.Close()
 	}()
 
-	// tag with only reference to commit
-	if tp == ObjectCommit {
+	// lightweight tag, a ref to the object itself
+	if tp != ObjectTag {
 		tag := new(Tag)
 		tag.Id = id
 		tag.Object = id
-		tag.Type = "commit"
+		tag.Type = tp.String()
 		tag.repo = repo
 		repo.tagCache[id] = tag
 
 		return tag, nil
 	}
 
-	// tag with message
-	if tp != ObjectTag {
-		return nil, errors.New("Expected tag type, read error.")
-	}
-
 	// TODO reader
 	data, err := ioutil.ReadAll(dataRc)
 	if err != nil {
 		return nil, err
 	}
 
-	tag, err := parseTagData(data)
+	tag, err := parseTagData(data, repo.parseMode)
 	if err != nil {
-		return nil, err
+		return nil, withObjectId(err, id)
 	}
 
 	tag.Id = id
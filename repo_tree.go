@@ -11,19 +11,18 @@ func (repo *Repository) GetTree(idStr string) (*Tree, error) {
 	return repo.getTree(id)
 }
 
-func (repo *Repository) getTree(id sha1) (*Tree, error) {
-	treePath := filepathFromSHA1(repo.Path, id.String())
-	if !isFile(treePath) {
-		m := false
-		for _, indexfile := range repo.indexfiles {
-			if offset := indexfile.offsetValues[id]; offset != 0 {
-				m = true
-				break
-			}
-		}
-		if !m {
-			return nil, ErrNotExist
-		}
+// GetTreeById is like GetTree, without parsing a hex string.
+func (repo *Repository) GetTreeById(id ObjectID) (*Tree, error) {
+	return repo.getTree(id)
+}
+
+func (repo *Repository) getTree(id ObjectID) (*Tree, error) {
+	found, _, err := repo.haveObject(id)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNotExist
 	}
 
 	return NewTree(repo, id), nil
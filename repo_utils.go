@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
 )
@@ -24,6 +23,9 @@ func readIdxFile(path string) (*idxFile, error) {
 	if !bytes.HasPrefix(idx, []byte{255, 't', 'O', 'c'}) {
 		return nil, errors.New("Not version 2 index file")
 	}
+	if len(idx) < 8+256*4+40 {
+		return nil, errors.New("index file " + path + " is truncated")
+	}
 	pos := 8
 	var fanout [256]uint32
 	for i := 0; i < 256; i++ {
@@ -32,7 +34,10 @@ func readIdxFile(path string) (*idxFile, error) {
 		pos += 4
 	}
 	numObjects := int(fanout[255])
-	ids := make([]sha1, numObjects)
+	if len(idx) < 258*4+28*numObjects+40 {
+		return nil, errors.New("index file " + path + " is truncated")
+	}
+	ids := make([]ObjectID, numObjects)
 
 	for i := 0; i < numObjects; i++ {
 		for j := 0; j < 20; j++ {
@@ -53,7 +58,7 @@ func readIdxFile(path string) (*idxFile, error) {
 			pos = pos + 8
 		}
 	}
-	ifile.offsetValues = make(map[sha1]uint64, numObjects)
+	ifile.offsetValues = make(map[ObjectID]uint64, numObjects)
 	pos = 258*4 + 24*numObjects
 	for i := 0; i < numObjects; i++ {
 		offset := uint32(idx[pos])<<24 + uint32(idx[pos+1])<<16 + uint32(idx[pos+2])<<8 + uint32(idx[pos+3])
@@ -61,6 +66,9 @@ func readIdxFile(path string) (*idxFile, error) {
 		offset31bits := offset & 0x7FFFFFFF
 		if offset32ndbit == 0x80000000 {
 			// it's an index entry
+			if int(offset31bits) >= len(offsetValues8) {
+				return nil, errors.New("index file " + path + " has a bad offset")
+			}
 			ifile.offsetValues[ids[i]] = offsetValues8[offset31bits]
 		} else {
 			ifile.offsetValues[ids[i]] = uint64(offset31bits)
@@ -90,33 +98,65 @@ func readIdxFile(path string) (*idxFile, error) {
 // If the object is stored in its own file (i.e not in a pack file),
 // this function returns the full path to the object file.
 // It does not test if the file exists.
-func filepathFromSHA1(rootdir, sha1 string) string {
-	return filepath.Join(rootdir, "objects", sha1[:2], sha1[2:])
+func filepathFromSHA1(objectsDir, sha1 string) string {
+	return filepath.Join(objectsDir, sha1[:2], sha1[2:])
 }
 
 // The object length in a packfile is a bit more difficult than
 // just reading the bytes. The first byte has the length in its
 // lowest four bits, and if bit 7 is set, it means 'more' bytes
 // will follow. These are added to the »left side« of the length
-func readLenInPackFile(buf []byte) (length int, advance int) {
+// ok is false if buf ends before the length does.
+func readLenInPackFile(buf []byte) (length int, advance int, ok bool) {
 	advance = 0
 	shift := [...]byte{0, 4, 11, 18, 25, 32, 39, 46, 53, 60}
+	if len(buf) == 0 {
+		return 0, 0, false
+	}
 	length = int(buf[advance] & 0x0F)
 	for buf[advance]&0x80 > 0 {
 		advance += 1
+		if advance >= len(buf) || advance >= len(shift) {
+			return 0, 0, false
+		}
 		length += (int(buf[advance]&0x7F) << shift[advance])
 	}
 	advance++
-	return
+	return length, advance, true
 }
 
 // Read from a pack file (given by path) at position offset. If this is a
 // non-delta object, the (inflated) bytes are just returned, if the object
 // is a deltafied-object, we have to apply the delta to base objects
 // before hand.
+// Damaged packs are reported with a *CorruptPackError.
 func readObjectBytes(path string, indexfiles *map[string]*idxFile, offset uint64, sizeonly bool) (ot ObjectType, length int64, dataRc io.ReadCloser, err error) {
+	return readPackedObject(path, indexfiles, offset, sizeonly, nil, nil)
+}
+
+// A packPos is the position of an object in a pack.
+type packPos struct {
+	path   string
+	offset uint64
+}
+
+// chain holds the positions of the deltas that led to this object, to
+// detect cycles. Bases of ref deltas may be in other packs. If budget is
+// set, the delta bases are charged to it before they are inflated, and
+// deltas are only applied if the budget allows for the result.
+func readPackedObject(path string, indexfiles *map[string]*idxFile, offset uint64, sizeonly bool, budget *Budget, chain []packPos) (ot ObjectType, length int64, dataRc io.ReadCloser, err error) {
+	corrupt := func(reason string) error {
+		return &CorruptPackError{Pack: path, Offset: offset, Reason: reason}
+	}
+	for _, p := range chain {
+		if p.path == path && p.offset == offset {
+			err = corrupt("delta chain is a cycle")
+			return
+		}
+	}
+
 	offsetInt := int64(offset)
-	file, err := os.Open(path)
+	file, err := openPack(path, indexfiles)
 	if err != nil {
 		return
 	}
@@ -140,23 +180,31 @@ func readObjectBytes(path string, indexfiles *map[string]*idxFile, offset uint64
 	}
 
 	buf := make([]byte, 1024)
-	n, err := file.Read(buf)
-	if err != nil {
+	n, err := io.ReadFull(file, buf)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		err = nil
+	} else if err != nil {
 		return
 	}
 
 	if n == 0 {
-		err = errors.New("Nothing read from pack file")
+		err = corrupt("nothing to read, the pack is truncated")
 		return
 	}
+	buf = buf[:n]
 
 	ot = ObjectType(buf[0] & 0x70)
 
-	l, p := readLenInPackFile(buf)
+	l, p, ok := readLenInPackFile(buf)
+	if !ok {
+		err = corrupt("truncated object header")
+		return
+	}
 	pos = int64(p)
 	length = int64(l)
 
 	var baseObjectOffset uint64
+	basePath := path
 	switch ot {
 	case ObjectCommit, ObjectTree, ObjectBlob, ObjectTag:
 		if sizeonly {
@@ -172,9 +220,10 @@ func readObjectBytes(path string, indexfiles *map[string]*idxFile, offset uint64
 
 		dataRc, err = readerDecompressed(file)
 		if err != nil {
+			err = corrupt("bad zlib header: " + err.Error())
 			return
 		}
-		dataRc = wrapReadCloser(io.LimitReader(dataRc, length), dataRc)
+		dataRc = newPackDataReader(dataRc, length, corrupt)
 		return
 		// data, err = readCompressedDataFromFile(file, offsetInt+pos, length)
 
@@ -182,17 +231,34 @@ func readObjectBytes(path string, indexfiles *map[string]*idxFile, offset uint64
 		// DELTA_ENCODED object w/ offset to base
 		// Read the offset first, then calculate the starting point
 		// of the base object
+		if pos >= int64(len(buf)) {
+			err = corrupt("truncated delta base offset")
+			return
+		}
 		num := int64(buf[pos]) & 0x7f
 		for buf[pos]&0x80 > 0 {
 			pos = pos + 1
+			if pos >= int64(len(buf)) || num > 1<<56 {
+				err = corrupt("truncated delta base offset")
+				return
+			}
 			num = ((num + 1) << 7) | int64(buf[pos]&0x7f)
 		}
+		// the base comes before the delta, which also rules out cycles
+		if num <= 0 || num > offsetInt {
+			err = corrupt("delta base offset out of range")
+			return
+		}
 		baseObjectOffset = uint64(offsetInt - num)
 		pos = pos + 1
 
 	case 0x70:
 		// DELTA_ENCODED object w/ base BINARY_OBJID
-		var id sha1
+		if pos+20 > int64(len(buf)) {
+			err = corrupt("truncated delta base id")
+			return
+		}
+		var id ObjectID
 		id, err = NewId(buf[pos : pos+20])
 		if err != nil {
 			return
@@ -200,31 +266,57 @@ func readObjectBytes(path string, indexfiles *map[string]*idxFile, offset uint64
 
 		pos = pos + 20
 
-		f := (*indexfiles)[path[0:len(path)-4]+"idx"]
-		var ok bool
-		if baseObjectOffset, ok = f.offsetValues[id]; !ok {
-			log.Fatal("not implemented yet")
-			err = errors.New("base object is not exist")
+		// the base is usually in the same pack, thin packs completed
+		// by others may have it in another one
+		found := false
+		if f, ok := (*indexfiles)[path[0:len(path)-4]+"idx"]; ok {
+			baseObjectOffset, found = f.offsetValues[id]
+		}
+		for _, f := range *indexfiles {
+			if found {
+				break
+			}
+			if baseObjectOffset, found = f.offsetValues[id]; found {
+				basePath = f.packpath
+			}
+		}
+		if !found {
+			err = corrupt("missing delta base " + id.String())
 			return
 		}
+
+	default:
+		err = corrupt(fmt.Sprintf("unknown object type %d", ot>>4))
+		return
 	}
 
+	// the type and size of a delta don't need the data of its bases, only
+	// the type at the end of the chain and the size of the base
 	var (
-		base   []byte
-		baseRc io.ReadCloser
+		base       []byte
+		baseRc     io.ReadCloser
+		baseLength int64
 	)
-	ot, _, baseRc, err = readObjectBytes(path, indexfiles, baseObjectOffset, false)
+	ot, baseLength, baseRc, err = readPackedObject(basePath, indexfiles, baseObjectOffset, sizeonly, budget, append(chain, packPos{path, offset}))
 	if err != nil {
 		return
 	}
 
-	defer func() {
-		baseRc.Close()
-	}()
+	if !sizeonly {
+		defer func() {
+			baseRc.Close()
+		}()
 
-	base, err = ioutil.ReadAll(baseRc)
-	if err != nil {
-		return
+		if budget != nil {
+			if err = budget.chargeBytes(int(baseLength)); err != nil {
+				return
+			}
+		}
+		base, err = ioutil.ReadAll(baseRc)
+		if err != nil {
+			return
+		}
+		baseLength = int64(len(base))
 	}
 
 	_, err = file.Seek(offsetInt+pos, os.SEEK_SET)
@@ -234,27 +326,42 @@ func readObjectBytes(path string, indexfiles *map[string]*idxFile, offset uint64
 
 	rc, err := readerDecompressed(file)
 	if err != nil {
+		err = corrupt("bad zlib header: " + err.Error())
 		return
 	}
+	defer rc.Close()
 
 	zpos := 0
-	// This is the length of the base object. Do we need to know it?
-	_, bytesRead := readerLittleEndianBase128Number(rc)
+	deltaBaseLength, bytesRead := readerLittleEndianBase128Number(rc)
 	//log.Println(zpos, bytesRead)
 	zpos += bytesRead
+	if deltaBaseLength != baseLength {
+		err = corrupt("delta base has the wrong size")
+		return
+	}
 
 	resultObjectLength, bytesRead := readerLittleEndianBase128Number(rc)
 	zpos += bytesRead
+	// the header has the size of the delta, not of the object
+	length = resultObjectLength
 
 	if sizeonly {
 		// if we are only interested in the size of the object,
 		// we don't need to do more expensive stuff
-		length = resultObjectLength
 		return
 	}
 
+	if budget != nil {
+		if err = budget.allows(resultObjectLength); err != nil {
+			return
+		}
+	}
 	br := &readAter{base}
 	data, err := readerApplyDelta(br, rc, resultObjectLength)
+	if err != nil {
+		err = corrupt(err.Error())
+		return
+	}
 
 	dataRc = newBufReadCloser(data)
 	return
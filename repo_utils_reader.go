@@ -1,11 +1,12 @@
 package git
 
 import (
+	"bufio"
 	"bytes"
-	"compress/zlib"
 	"errors"
 	"io"
 	"io/ioutil"
+	"sync"
 )
 
 var (
@@ -90,14 +91,62 @@ func (o *readAter) ReadAt(p []byte, off int64) (n int, err error) {
 	return
 }
 
+// Inflaters are reused, as setting one up allocates its window and a
+// buffer for the input, which dominates reading small objects like
+// commits and trees.
+var inflaters sync.Pool
+
+type inflater struct {
+	br *bufio.Reader
+	zr io.ReadCloser
+}
+
+// An inflating reader, which puts its inflater back into the pool when
+// it's closed.
+type inflateReader struct {
+	z   *inflater
+	src io.Closer
+}
+
+func (r *inflateReader) Read(p []byte) (int, error) {
+	if r.z == nil {
+		return 0, errors.New("read after close")
+	}
+	return r.z.zr.Read(p)
+}
+
+func (r *inflateReader) Close() error {
+	if r.z == nil {
+		return nil
+	}
+	z := r.z
+	r.z = nil
+	errz := z.zr.Close()
+	inflaters.Put(z)
+	if err := r.src.Close(); err != nil {
+		return err
+	}
+	return errz
+}
+
 // Read deflated object from the file.
 func readerDecompressed(r io.ReadCloser) (io.ReadCloser, error) {
-	zr, err := zlib.NewReader(r)
-	if err != nil {
-		return nil, err
+	z, _ := inflaters.Get().(*inflater)
+	if z == nil {
+		z = &inflater{br: bufio.NewReader(r)}
+		zr, err := newZlibReader(z.br)
+		if err != nil {
+			return nil, err
+		}
+		z.zr = zr
+	} else {
+		z.br.Reset(r)
+		if err := resetZlibReader(z.zr, z.br); err != nil {
+			inflaters.Put(z)
+			return nil, err
+		}
 	}
-
-	return newReadCloser(zr, r), nil
+	return &inflateReader{z: z, src: r}, nil
 }
 
 // buf must be large enough to read the number.
@@ -126,13 +175,25 @@ func readerLittleEndianBase128Number(r io.Reader) (int64, int) {
 	return length, zpos
 }
 
-func readerApplyDelta(br io.ReaderAt, dr io.Reader, resultLen int64) (res []byte, err error) {
+// The most readerApplyDelta allocates for the result before the delta is
+// applied. The size in the header of a corrupt delta can be anything.
+const deltaPreallocLimit = 1 << 20
+
+func readerApplyDelta(br *readAter, dr io.Reader, resultLen int64) (res []byte, err error) {
 	var (
 		resultpos uint64
 	)
 
 	buf := []byte{0}
-	res = make([]byte, resultLen)
+	if resultLen < 0 {
+		return nil, errors.New("negative delta result size")
+	}
+	// the result grows as the delta is applied, up to resultLen
+	prealloc := resultLen
+	if prealloc > deltaPreallocLimit {
+		prealloc = deltaPreallocLimit
+	}
+	res = make([]byte, 0, prealloc)
 
 	read := func(r io.Reader) (ret bool) {
 		var n int
@@ -162,6 +223,13 @@ func readerApplyDelta(br io.ReaderAt, dr io.Reader, resultLen int64) (res []byte
 		return
 	}
 
+	truncated := func() ([]byte, error) {
+		if err == nil {
+			err = errors.New("delta is truncated")
+		}
+		return nil, err
+	}
+
 	for {
 		// two modes: copy and insert. copy reads offset and len from the delta
 		// instructions and copy len bytes from offset into the resulting object
@@ -169,6 +237,9 @@ func readerApplyDelta(br io.ReaderAt, dr io.Reader, resultLen int64) (res []byte
 		// resulting object
 
 		if !read(dr) {
+			if err == nil && resultpos != uint64(resultLen) {
+				err = errors.New("delta result is truncated")
+			}
 			return
 		}
 		opcode := buf[0]
@@ -181,7 +252,7 @@ func readerApplyDelta(br io.ReaderAt, dr io.Reader, resultLen int64) (res []byte
 			for i := 0; i < 4; i++ {
 				if opcode&0x01 > 0 {
 					if !read(dr) {
-						return
+						return truncated()
 					}
 					copy_offset |= uint64(buf[0]) << shift
 				}
@@ -193,7 +264,7 @@ func readerApplyDelta(br io.ReaderAt, dr io.Reader, resultLen int64) (res []byte
 			for i := 0; i < 3; i++ {
 				if opcode&0x01 > 0 {
 					if !read(dr) {
-						return
+						return truncated()
 					}
 					copy_length |= uint64(buf[0]) << shift
 				}
@@ -204,28 +275,34 @@ func readerApplyDelta(br io.ReaderAt, dr io.Reader, resultLen int64) (res []byte
 				copy_length = 1 << 16
 			}
 
+			if copy_offset+copy_length > uint64(len(br.buf)) || resultpos+copy_length > uint64(resultLen) {
+				return nil, errors.New("delta copies out of bounds")
+			}
 			brOffset := int64(copy_offset)
 			for i := uint64(0); i < copy_length; i++ {
 				if !readAt(br, brOffset) {
-					return
+					return truncated()
 				}
-				res[resultpos] = buf[0]
+				res = append(res, buf[0])
 				resultpos++
 				brOffset++
 			}
 		} else if opcode > 0 {
 			// insert n bytes at the end of the resulting object. n==opcode
+			if resultpos+uint64(opcode) > uint64(resultLen) {
+				return nil, errors.New("delta inserts out of bounds")
+			}
 			for i := 0; i < int(opcode); i++ {
 				if !read(dr) {
-					return
+					return truncated()
 				}
-				res[resultpos] = buf[0]
+				res = append(res, buf[0])
 				resultpos++
 			}
 		} else {
 			return nil, errors.New("[readerApplyDelta] opcode == 0")
 		}
 	}
-	// TODO: check if resultlen == resultpos
+	// resultLen == resultpos is checked when the delta ends
 	return
 }
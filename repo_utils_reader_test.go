@@ -0,0 +1,133 @@
+package git
+
+import (
+	"bytes"
+	"compress/zlib"
+	libsha1 "crypto/sha1"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Append the size varint of a delta header.
+func appendDeltaSize(buf []byte, n uint64) []byte {
+	for n >= 0x80 {
+		buf = append(buf, byte(n)|0x80)
+		n >>= 7
+	}
+	return append(buf, byte(n))
+}
+
+// Write a pack with a base blob and OFS_DELTA objects against it, and
+// return the made up ids of the deltas.
+func writeDeltaPack(t *testing.T, repo *Repository, base string, deltas [][]byte) []ObjectID {
+	t.Helper()
+	var pack bytes.Buffer
+	hdr := []byte("PACK\x00\x00\x00\x02\x00\x00\x00\x00")
+	binary.BigEndian.PutUint32(hdr[8:], uint32(1+len(deltas)))
+	pack.Write(hdr)
+
+	var entries []packEntry
+	baseId, err := HashObject("blob", strings.NewReader(base))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crc := crc32.NewIEEE()
+	entries = append(entries, packEntry{id: baseId, offset: uint64(pack.Len())})
+	if err := writePackObject(io.MultiWriter(&pack, crc), ObjectBlob, int64(len(base)), strings.NewReader(base)); err != nil {
+		t.Fatal(err)
+	}
+	entries[0].crc = crc.Sum32()
+
+	var ids []ObjectID
+	for i, delta := range deltas {
+		offset := uint64(pack.Len())
+		var obj bytes.Buffer
+		// OFS_DELTA, the size of the delta and the distance to the base
+		hdr := []byte{0x60 | byte(len(delta)&0x0f)}
+		for rest := len(delta) >> 4; rest > 0; rest >>= 7 {
+			hdr[len(hdr)-1] |= 0x80
+			hdr = append(hdr, byte(rest&0x7f))
+		}
+		obj.Write(hdr)
+		rel := offset - entries[0].offset
+		dist := []byte{byte(rel & 0x7f)}
+		for rel >>= 7; rel > 0; rel >>= 7 {
+			rel--
+			dist = append([]byte{0x80 | byte(rel&0x7f)}, dist...)
+		}
+		obj.Write(dist)
+		zw := zlib.NewWriter(&obj)
+		zw.Write(delta)
+		zw.Close()
+
+		id := ObjectID{0xde, 0x17, byte(i)}
+		ids = append(ids, id)
+		entries = append(entries, packEntry{id: id, offset: offset, crc: crc32.ChecksumIEEE(obj.Bytes())})
+		pack.Write(obj.Bytes())
+	}
+	sum := libsha1.Sum(pack.Bytes())
+	pack.Write(sum[:])
+
+	var idx bytes.Buffer
+	if err := writePackIndex(&idx, entries, sum[:]); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(repo.ObjectsDir, "pack", "pack-"+ObjectID(sum).String())
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(name+".pack", pack.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(name+".idx", idx.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.ReloadPacks(); err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func TestCorruptDeltas(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	base := "hello world\n"
+	header := func(baseLen, resultLen uint64) []byte {
+		return appendDeltaSize(appendDeltaSize(nil, baseLen), resultLen)
+	}
+	valid := append(header(12, 7), 0x91, 0, 5, 2, '!', '\n') // copy "hello", insert "!\n"
+	tests := []struct {
+		name  string
+		delta []byte
+	}{
+		{"huge result", append(header(12, 1<<62), 1, 'x')},
+		{"result larger than the base allows", append(header(12, 1<<40), 0x90, 0, 0x90, 0)},
+		{"result too short", append(header(12, 8), 0x91, 0, 5)},
+		{"result too long", append(header(12, 4), 0x91, 0, 5)},
+		{"copy beyond the base", append(header(12, 20), 0x91, 8, 20)},
+		{"truncated insert", append(header(12, 5), 5, 'a')},
+		{"truncated copy", append(header(12, 5), 0x91, 0)},
+		{"opcode 0", append(header(12, 5), 0)},
+		{"wrong base size", append(header(11, 5), 0x91, 0, 5)},
+	}
+	deltas := [][]byte{valid}
+	for _, test := range tests {
+		deltas = append(deltas, test.delta)
+	}
+	ids := writeDeltaPack(t, repo, base, deltas)
+
+	data, err := repo.readBlob(ids[0])
+	if err != nil || string(data) != "hello!\n" {
+		t.Fatalf("valid delta read as %q (%v)", data, err)
+	}
+	for i, test := range tests {
+		if data, err := repo.readBlob(ids[i+1]); err == nil {
+			t.Errorf("%s: read as %q", test.name, data)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// RestoreOptions select what Repository.RestorePaths updates, like the
+// options of git restore. If neither is set, the working tree is.
+type RestoreOptions struct {
+	// Update the index (--staged).
+	Staged bool
+	// Update the working tree (--worktree).
+	WorkTree bool
+}
+
+// RestorePaths updates the files at paths, or below them if they are
+// directories, to their content in the commit source names, like git
+// restore --source. Files that source doesn't have are removed. If source
+// is empty, the working tree is restored from the index, or the index from
+// HEAD with opts.Staged. Other files are left alone.
+//
+// Conflicted files restored in the index are resolved. Paths matching no
+// file are an error, and so are unsafe paths like those Checkout refuses;
+// nothing is changed then.
+func (repo *Repository) RestorePaths(source string, paths []string, opts RestoreOptions) error {
+	if repo.WorkTree == "" {
+		return ErrBareRepository
+	}
+	if len(paths) == 0 {
+		return errors.New("no paths to restore")
+	}
+	if !opts.Staged && !opts.WorkTree {
+		opts.WorkTree = true
+	}
+	if source == "" && opts.Staged {
+		source = "HEAD"
+	}
+
+	index, err := repo.readIndex()
+	if err != nil {
+		return err
+	}
+	var files map[string]treeFile
+	if source == "" {
+		files = make(map[string]treeFile, len(index))
+		for _, e := range index {
+			if e.Stage == 0 {
+				files[e.Path] = treeFile{e.Mode, e.Id}
+			}
+		}
+	} else {
+		id, err := repo.resolveRevision(source)
+		if err != nil {
+			return err
+		}
+		commit, err := repo.getCommit(id)
+		if err != nil {
+			return err
+		}
+		if files, err = repo.flattenTree(&commit.Tree); err != nil {
+			return err
+		}
+	}
+
+	specs := make([]string, len(paths))
+	for i, p := range paths {
+		specs[i] = strings.Trim(path.Clean("/"+filepath.ToSlash(p)), "/")
+	}
+	matched := make([]bool, len(specs))
+	selected := func(p string) bool {
+		found := false
+		for i, spec := range specs {
+			if spec == "" || p == spec || strings.HasPrefix(p, spec+"/") {
+				matched[i], found = true, true
+			}
+		}
+		return found
+	}
+	restored := make(map[string]treeFile)
+	for p, f := range files {
+		if selected(p) {
+			restored[p] = f
+		}
+	}
+	removed := make(map[string]treeFile)
+	for _, e := range index {
+		if _, ok := restored[e.Path]; !ok && selected(e.Path) && source != "" {
+			removed[e.Path] = treeFile{e.Mode, e.Id}
+		}
+	}
+	for i, ok := range matched {
+		if !ok {
+			return fmt.Errorf("pathspec %q did not match any file", paths[i])
+		}
+	}
+	// like Checkout, and the index may have been written by anyone
+	if err := repo.checkCheckout(restored, CheckoutOptions{}); err != nil {
+		return err
+	}
+	for p := range removed {
+		if err := ValidatePath(p); err != nil {
+			return err
+		}
+	}
+
+	if repo.dryRun != nil {
+		if opts.WorkTree {
+			repo.recordCheckout(restored, removed)
+		}
+		if opts.Staged {
+			repo.recordChange(Change{Op: ChangeWriteFile, Name: "index"})
+		}
+		return nil
+	}
+	if repo.snapshot != nil {
+		return ErrReadOnlySnapshot
+	}
+
+	lock, err := repo.lock(filepath.Join(repo.Path, "index"), FsyncIndex)
+	if err != nil {
+		return err
+	}
+	defer lock.rollback()
+
+	written := make(map[string]*IndexEntry, len(restored))
+	if opts.WorkTree {
+		for p := range removed {
+			if err := repo.removeWorkTreeFile(p); err != nil {
+				return err
+			}
+		}
+		for p, f := range restored {
+			e, _, err := repo.checkoutFile(p, f)
+			if err != nil {
+				return err
+			}
+			written[p] = e
+		}
+	}
+
+	entries := make([]*IndexEntry, 0, len(index))
+	for _, e := range index {
+		_, restore := restored[e.Path]
+		_, remove := removed[e.Path]
+		switch {
+		case !restore && !remove:
+			entries = append(entries, e)
+		case !opts.Staged && written[e.Path] != nil && written[e.Path].Id.Equal(e.Id) && e.Stage == 0:
+			// the file is as in the index again
+			entries = append(entries, written[e.Path])
+		case !opts.Staged:
+			entries = append(entries, e)
+		}
+	}
+	if opts.Staged {
+		for p, f := range restored {
+			if e := written[p]; e != nil {
+				entries = append(entries, e)
+			} else {
+				entries = append(entries, &IndexEntry{Path: p, Id: f.id, Mode: f.mode})
+			}
+		}
+	}
+	if err := writeIndex(lock, entries); err != nil {
+		return err
+	}
+	return lock.commit()
+}
+
+// SwitchOptions configure Repository.SwitchBranch.
+type SwitchOptions struct {
+	// Create the branch, which must not exist, like git switch -c.
+	Create bool
+	// The revision a created branch starts at, HEAD if empty.
+	StartPoint string
+	// Overwrite changes of the working tree instead of refusing to
+	// switch, like git switch --discard-changes.
+	Discard bool
+	CheckoutOptions
+}
+
+// SwitchBranch checks out the branch name and points HEAD at it, like git
+// switch. Unless opts.Discard is set, it returns a *DirtyWorkTreeError
+// without changing anything if files of the working tree differ from HEAD,
+// or untracked files would be overwritten. See Checkout for how files are
+// written.
+func (repo *Repository) SwitchBranch(ctx context.Context, name string, opts SwitchOptions) error {
+	if repo.WorkTree == "" {
+		return ErrBareRepository
+	}
+	var id ObjectID
+	var err error
+	if opts.Create {
+		if repo.IsBranchExist(name) {
+			return ErrBranchExisted
+		}
+		if err := checkRefName("refs/heads/" + name); err != nil {
+			return err
+		}
+		start := opts.StartPoint
+		if start == "" {
+			start = "HEAD"
+		}
+		id, err = repo.resolveRevision(start)
+	} else {
+		id, err = repo.resolveRevision("refs/heads/" + name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !opts.Discard {
+		var oldFiles map[string]treeFile
+		if tree, err := repo.headTree(); err == nil {
+			if oldFiles, err = repo.flattenTree(tree); err != nil {
+				return err
+			}
+		}
+		commit, err := repo.getCommit(id)
+		if err != nil {
+			return err
+		}
+		newFiles, err := repo.flattenTree(&commit.Tree)
+		if err != nil {
+			return err
+		}
+		dirty, err := repo.dirtyFiles(oldFiles, newFiles)
+		if err != nil {
+			return err
+		}
+		if len(dirty) > 0 {
+			return &DirtyWorkTreeError{dirty}
+		}
+	}
+
+	if opts.Create {
+		if err := repo.CreateBranch(name, id.String()); err != nil {
+			return err
+		}
+	}
+	// Checkout detaches HEAD at the commit, as a branch created in a dry
+	// run can't be resolved
+	if err := repo.Checkout(ctx, id.String(), opts.CheckoutOptions); err != nil {
+		return err
+	}
+	if repo.dryRun != nil {
+		return nil
+	}
+	return repo.setHead("ref: refs/heads/" + name)
+}
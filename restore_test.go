@@ -0,0 +1,58 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRestoreUnsafePaths(t *testing.T) {
+	repo := openTestWorkTree(t)
+	hook, err := repo.WriteObject(ObjectBlob, []byte("#!/bin/sh\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := repo.writeTree(map[string]treeFile{
+		".git/hooks/post-checkout": {ModeExec, hook},
+		"file":                     {ModeBlob, hook},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.CreateCommit(CommitOptions{Tree: tree, Message: "hook\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hookPath := filepath.Join(repo.Path, "hooks", "post-checkout")
+
+	for _, paths := range [][]string{{"."}, {".git"}} {
+		err := repo.RestorePaths(commit.String(), paths, RestoreOptions{WorkTree: true, Staged: true})
+		if _, ok := err.(*UnsafePathsError); !ok {
+			t.Errorf("%v: expected an *UnsafePathsError, got %v", paths, err)
+		}
+		if _, err := os.Lstat(hookPath); !os.IsNotExist(err) {
+			t.Fatalf("%v: hook written", paths)
+		}
+		if _, err := os.Lstat(filepath.Join(repo.WorkTree, "file")); !os.IsNotExist(err) {
+			t.Errorf("%v: file written", paths)
+		}
+	}
+
+	// from an index someone else wrote
+	idx := &Index{Entries: []*IndexEntry{
+		{Path: ".git/hooks/post-checkout", Id: hook, Mode: ModeExec},
+		{Path: "../escaped", Id: hook, Mode: ModeBlob},
+	}}
+	if err := repo.WriteIndex(idx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := repo.RestorePaths("", []string{"."}, RestoreOptions{}).(*UnsafePathsError); !ok {
+		t.Error("restored unsafe paths from the index")
+	}
+	if _, err := os.Lstat(hookPath); !os.IsNotExist(err) {
+		t.Error("hook written from the index")
+	}
+	if _, err := os.Lstat(filepath.Join(filepath.Dir(repo.WorkTree), "escaped")); !os.IsNotExist(err) {
+		t.Error("file written outside the working tree")
+	}
+}
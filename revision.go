@@ -0,0 +1,42 @@
+package git
+
+import (
+	"fmt"
+)
+
+// resolveRevision resolves a commit id or a ref name to the id of the
+// commit it names. Ref names are looked up like git does, so "master" finds
+// refs/heads/master. Tags are peeled to the commit they point to.
+func (repo *Repository) resolveRevision(rev string) (ObjectID, error) {
+	if IsSha1(rev) {
+		id, err := NewIdFromString(rev)
+		if err != nil {
+			return id, err
+		}
+		return repo.peelToCommit(id)
+	}
+
+	for _, prefix := range []string{"", "refs/", "refs/tags/", "refs/heads/", "refs/remotes/"} {
+		idStr, err := repo.getCommitIdOfRef(prefix + rev)
+		if err != nil {
+			continue
+		}
+		id, err := NewIdFromString(idStr)
+		if err != nil {
+			return id, err
+		}
+		return repo.peelToCommit(id)
+	}
+	return ObjectID{}, repo.unbornError(rev, fmt.Errorf("unknown revision %q", rev))
+}
+
+func (repo *Repository) peelToCommit(id ObjectID) (ObjectID, error) {
+	id, tp, err := repo.peel(id)
+	if err != nil {
+		return id, err
+	}
+	if tp != ObjectCommit {
+		return id, fmt.Errorf("%s is a %s, not a commit", id, tp)
+	}
+	return id, nil
+}
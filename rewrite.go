@@ -0,0 +1,246 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+)
+
+// A HistoryRewriter rewrites the history of a ref through callbacks, like
+// git filter-repo. Nil callbacks leave the respective part unchanged.
+//
+// Rewritten commits lose their signatures and any extra headers.
+type HistoryRewriter struct {
+	// Files and directories for which DropPath returns true are removed
+	// from every commit.
+	DropPath func(path string) bool
+	// ReplaceBlob returns the new content of a file, or data itself to keep
+	// it.
+	ReplaceBlob func(path string, data []byte) []byte
+	// RewriteMessage returns the new message of a commit.
+	RewriteMessage func(message string) string
+	// RewriteIdentity maps author and committer names and emails.
+	RewriteIdentity func(name, email string) (string, string)
+	// Drop commits that don't change anything after rewriting. Merges are
+	// kept if they still have two parents that aren't ancestors of each
+	// other.
+	PruneEmpty bool
+}
+
+// A RewriteResult is the outcome of a history rewrite.
+type RewriteResult struct {
+	Tip ObjectID
+	// The original commits, parents first.
+	Commits []ObjectID
+	// Maps each original commit to its rewritten version. Pruned commits
+	// map to the zero id.
+	CommitMap map[ObjectID]ObjectID
+}
+
+// WriteCommitMap writes the commit map in the format of git filter-repo's
+// commit-map file.
+func (r *RewriteResult) WriteCommitMap(w io.Writer) error {
+	if _, err := io.WriteString(w, "old                                      new\n"); err != nil {
+		return err
+	}
+	for _, old := range r.Commits {
+		if _, err := fmt.Fprintf(w, "%s %s\n", old, r.CommitMap[old]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rewrite rewrites the history of rev and points newRef (e.g.
+// "refs/heads/filtered") at the result. The original history is left
+// untouched.
+func (rw *HistoryRewriter) Rewrite(repo *Repository, rev, newRef string) (*RewriteResult, error) {
+	tip, err := repo.resolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := repo.topoOrder([]ObjectID{tip})
+	if err != nil {
+		return nil, err
+	}
+
+	state := &rewriteState{
+		HistoryRewriter: rw,
+		repo:            repo,
+		trees:           make(map[string]ObjectID),
+		blobs:           make(map[string]ObjectID),
+	}
+	result := &RewriteResult{CommitMap: make(map[ObjectID]ObjectID, len(commits))}
+	// what children of a commit use as parent, differs from CommitMap for
+	// pruned commits
+	replacement := make(map[ObjectID]ObjectID, len(commits))
+
+	for _, c := range commits {
+		result.Commits = append(result.Commits, c.Id)
+
+		var parents []ObjectID
+		for _, p := range c.parents {
+			if np, ok := replacement[p]; ok && !containsId(parents, np) {
+				parents = append(parents, np)
+			}
+		}
+
+		tree, err := state.rewriteTree(&c.Tree, "")
+		if err != nil {
+			return nil, err
+		}
+
+		if rw.PruneEmpty && len(parents) > 1 {
+			// a merge whose other side was pruned away
+			if parents, err = repo.reduceHeads(parents); err != nil {
+				return nil, err
+			}
+		}
+
+		if rw.PruneEmpty && len(parents) <= 1 {
+			var parentTree ObjectID
+			if len(parents) == 1 {
+				pc, err := repo.getCommit(parents[0])
+				if err != nil {
+					return nil, err
+				}
+				parentTree = pc.Tree.Id
+			} else {
+				parentTree = emptyTreeId
+			}
+			if tree.Equal(parentTree) {
+				if len(parents) == 1 {
+					replacement[c.Id] = parents[0]
+				}
+				result.CommitMap[c.Id] = ObjectID{}
+				continue
+			}
+		}
+
+		opts := CommitOptions{
+			Tree:      tree,
+			Parents:   parents,
+			Author:    rw.rewriteSignature(c.Author),
+			Committer: rw.rewriteSignature(c.Committer),
+			Message:   c.CommitMessage,
+		}
+		if rw.RewriteMessage != nil {
+			opts.Message = rw.RewriteMessage(opts.Message)
+		}
+		id, err := repo.CreateCommit(opts)
+		if err != nil {
+			return nil, err
+		}
+		replacement[c.Id] = id
+		result.CommitMap[c.Id] = id
+	}
+
+	var ok bool
+	if result.Tip, ok = replacement[tip]; !ok {
+		return nil, fmt.Errorf("all commits of %s were pruned", rev)
+	}
+	if err := repo.setRef(newRef, result.Tip); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// the id of the tree without entries
+var emptyTreeId, _ = NewIdFromString("4b825dc642cb6eb9a060e54bf8d69288fbee4904")
+
+func (rw *HistoryRewriter) rewriteSignature(sig *Signature) *Signature {
+	if rw.RewriteIdentity == nil || sig == nil {
+		return sig
+	}
+	name, email := rw.RewriteIdentity(sig.Name, sig.Email)
+	return &Signature{Name: name, Email: email, When: sig.When}
+}
+
+type rewriteState struct {
+	*HistoryRewriter
+	repo *Repository
+	// rewritten trees and blobs by path and original id, the same object
+	// may be rewritten differently at different paths
+	trees map[string]ObjectID
+	blobs map[string]ObjectID
+}
+
+func (s *rewriteState) rewriteTree(t *Tree, dir string) (ObjectID, error) {
+	key := dir + "\x00" + t.Id.String()
+	if id, ok := s.trees[key]; ok {
+		return id, nil
+	}
+
+	scanner, err := t.Scanner()
+	if err != nil {
+		return ObjectID{}, err
+	}
+	var tes []*TreeEntry
+	for scanner.Scan() {
+		tes = append(tes, scanner.TreeEntry())
+	}
+	if err := scanner.Err(); err != nil {
+		return ObjectID{}, err
+	}
+
+	entries := make(map[string]treeFile, len(tes))
+	for _, te := range tes {
+		p := path.Join(dir, te.name)
+		if s.DropPath != nil && s.DropPath(p) {
+			continue
+		}
+
+		id := te.Id
+		switch te.mode {
+		case ModeTree:
+			sub, err := s.repo.getTree(te.Id)
+			if err != nil {
+				return ObjectID{}, err
+			}
+			if id, err = s.rewriteTree(sub, p); err != nil {
+				return ObjectID{}, err
+			}
+			if id.Equal(emptyTreeId) {
+				continue
+			}
+		case ModeCommit:
+			// submodules are kept as they are
+		default:
+			if id, err = s.rewriteBlob(te.Id, p); err != nil {
+				return ObjectID{}, err
+			}
+		}
+		entries[te.name] = treeFile{te.mode, id}
+	}
+
+	id, err := s.repo.writeTreeObject(entries)
+	if err != nil {
+		return ObjectID{}, err
+	}
+	s.trees[key] = id
+	return id, nil
+}
+
+func (s *rewriteState) rewriteBlob(id ObjectID, p string) (ObjectID, error) {
+	if s.ReplaceBlob == nil {
+		return id, nil
+	}
+	key := p + "\x00" + id.String()
+	if nid, ok := s.blobs[key]; ok {
+		return nid, nil
+	}
+
+	data, err := s.repo.readBlob(id)
+	if err != nil {
+		return ObjectID{}, err
+	}
+	nid := id
+	if replaced := s.ReplaceBlob(p, data); !bytes.Equal(replaced, data) {
+		if nid, err = s.repo.StoreObjectLoose(ObjectBlob, bytes.NewReader(replaced)); err != nil {
+			return ObjectID{}, err
+		}
+	}
+	s.blobs[key] = nid
+	return nid, nil
+}
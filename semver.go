@@ -0,0 +1,202 @@
+package git
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var ErrNoVersionTag = errors.New("no version tag found")
+
+// A Version is a semantic version, like the name of a release tag.
+type Version struct {
+	Major, Minor, Patch int
+	Prerelease          string
+	Build               string
+}
+
+// ParseVersion parses a semantic version like "1.2.3-rc.1+build.5", with
+// an optional "v" in front as tags often have.
+func ParseVersion(s string) (Version, bool) {
+	var v Version
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s, v.Build = s[:i], s[i+1:]
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		s, v.Prerelease = s[:i], s[i+1:]
+		if v.Prerelease == "" {
+			return v, false
+		}
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return v, false
+	}
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || p[0] == '+' || len(p) > 1 && p[0] == '0' {
+			return v, false
+		}
+		*nums[i] = n
+	}
+	return v, true
+}
+
+func (v Version) String() string {
+	s := strconv.Itoa(v.Major) + "." + strconv.Itoa(v.Minor) + "." + strconv.Itoa(v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 if v is lower, the same as or higher than w
+// by semver precedence. Build metadata doesn't count.
+func (v Version) Compare(w Version) int {
+	for _, d := range []int{v.Major - w.Major, v.Minor - w.Minor, v.Patch - w.Patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+	switch {
+	case v.Prerelease == w.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case w.Prerelease == "":
+		return -1
+	}
+	a, b := strings.Split(v.Prerelease, "."), strings.Split(w.Prerelease, ".")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] == b[i] {
+			continue
+		}
+		m, errM := strconv.Atoi(a[i])
+		n, errN := strconv.Atoi(b[i])
+		switch {
+		case errM == nil && errN == nil:
+			return sign(m - n)
+		case errM == nil:
+			return -1
+		case errN == nil:
+			return 1
+		case a[i] < b[i]:
+			return -1
+		default:
+			return 1
+		}
+	}
+	return sign(len(a) - len(b))
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// Which part of a version to increment.
+type VersionBump int
+
+const (
+	BumpPatch VersionBump = iota
+	BumpMinor
+	BumpMajor
+)
+
+// Bump returns the next version. The prerelease and build are dropped, so
+// the release of a prerelease like 1.3.0-rc.1 bumped by minor is 1.3.0.
+func (v Version) Bump(b VersionBump) Version {
+	pre := v.Prerelease != ""
+	next := Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch}
+	switch b {
+	case BumpMajor:
+		if !pre || v.Minor != 0 || v.Patch != 0 {
+			next = Version{Major: v.Major + 1}
+		}
+	case BumpMinor:
+		if !pre || v.Patch != 0 {
+			next = Version{Major: v.Major, Minor: v.Minor + 1}
+		}
+	default:
+		if !pre {
+			next.Patch++
+		}
+	}
+	return next
+}
+
+// LatestVersionTag returns the name and version of the highest version tag
+// reachable from the commit named by rev, or ErrNoVersionTag if there is
+// none. Tags that aren't semantic versions are ignored.
+func (repo *Repository) LatestVersionTag(rev string) (string, Version, error) {
+	tip, err := repo.resolveRevision(rev)
+	if err != nil {
+		return "", Version{}, err
+	}
+
+	var name string
+	var latest Version
+	err = repo.ForEachRef("refs/tags/", func(ref Ref) error {
+		tagName := strings.TrimPrefix(ref.Name, "refs/tags/")
+		v, ok := ParseVersion(tagName)
+		if !ok || name != "" && v.Compare(latest) <= 0 {
+			return nil
+		}
+		id, tp, err := repo.peel(ref.Id)
+		if err != nil {
+			return err
+		}
+		if tp != ObjectCommit {
+			return nil
+		}
+		if reachable, err := repo.isAncestor(id, tip); err != nil || !reachable {
+			return err
+		}
+		name, latest = tagName, v
+		return nil
+	})
+	if err != nil {
+		return "", Version{}, err
+	}
+	if name == "" {
+		return "", Version{}, ErrNoVersionTag
+	}
+	return name, latest, nil
+}
+
+// TagNextVersion creates an annotated tag for the next version on the
+// commit named by rev, and returns its name. The version is the latest one
+// reachable from rev bumped by b, with a "v" in front if the latest tag
+// has one. Without a version tag, the first version is 0.0.0 bumped by b,
+// tagged with a "v".
+func (repo *Repository) TagNextVersion(rev string, b VersionBump, tagger *Signature, message string) (string, error) {
+	prefix := "v"
+	name, latest, err := repo.LatestVersionTag(rev)
+	if err == nil {
+		if !strings.HasPrefix(name, "v") {
+			prefix = ""
+		}
+	} else if err != ErrNoVersionTag {
+		return "", err
+	}
+
+	id, err := repo.resolveRevision(rev)
+	if err != nil {
+		return "", err
+	}
+	next := prefix + latest.Bump(b).String()
+	if _, err := repo.CreateAnnotatedTag(next, id, tagger, message); err != nil {
+		return "", err
+	}
+	return next, nil
+}
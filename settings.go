@@ -0,0 +1,117 @@
+package git
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// RepositorySettings are the config variables that change what the
+// package does, read once with their defaults applied.
+type RepositorySettings struct {
+	// init.defaultBranch, the branch of new repositories; "master" if
+	// unset.
+	DefaultBranch string
+	// receive.denyCurrentBranch in lower case; "refuse" if unset. See
+	// ReceiveRef.
+	DenyCurrentBranch string
+	// receive.denyNonFastForwards: ReceiveRef refuses updates that drop
+	// commits from a ref.
+	DenyNonFastForwards bool
+	// gogits.updateUnbornHead, which git doesn't have: the first branch
+	// created in a repository whose HEAD has no commits becomes HEAD.
+	UpdateUnbornHead bool
+	// core.ignoreCase: the working tree's file system ignores case. It
+	// defaults to true on macOS and Windows.
+	IgnoreCase bool
+	// gc.auto, the number of loose objects above which git gc --auto
+	// packs them; 6700 if unset, 0 disables it.
+	GCAuto int64
+	// diff.algorithm in lower case; "myers" if unset.
+	DiffAlgorithm string
+	// checkout.workers, the number of files checked out in parallel; 1 if
+	// unset.
+	CheckoutWorkers int
+	// core.logAllRefUpdates in lower case: "true" to keep reflogs of
+	// branches and HEAD, "always" for all refs, "false" for none but those
+	// that have one already. Empty if unset, which is "true" in repositories
+	// with a working tree and "false" in bare ones.
+	LogAllRefUpdates string
+	// clean.requireForce: Clean needs Force or DryRun. It defaults to
+	// true.
+	CleanRequireForce bool
+	// core.fsync, the files flushed to disk before they are put in place;
+	// FsyncDefault if unset. The legacy core.fsyncObjectFiles adds loose
+	// objects.
+	Fsync FsyncComponents
+	// core.fsyncMethod in lower case; "fsync" if unset. "writeout-only"
+	// syncs like "fsync", Go has no portable way to only write the data
+	// out. "batch" syncs the loose objects of a TempObjectDir once, when
+	// it is migrated, instead of one by one.
+	FsyncMethod string
+}
+
+// ReadRepositorySettings extracts the settings from config. A nil config
+// gives the defaults.
+func ReadRepositorySettings(config *Config) *RepositorySettings {
+	if config == nil {
+		config = new(Config)
+	}
+	s := &RepositorySettings{
+		DefaultBranch:       "master",
+		DenyCurrentBranch:   "refuse",
+		DenyNonFastForwards: config.Bool("receive.denyNonFastForwards", false),
+		UpdateUnbornHead:    config.Bool("gogits.updateUnbornHead", false),
+		IgnoreCase:          config.Bool("core.ignoreCase", runtime.GOOS == "darwin" || runtime.GOOS == "windows"),
+		GCAuto:              config.Int("gc.auto", 6700),
+		DiffAlgorithm:       "myers",
+		CheckoutWorkers:     int(config.Int("checkout.workers", 1)),
+		CleanRequireForce:   config.Bool("clean.requireForce", true),
+		Fsync:               FsyncDefault,
+		FsyncMethod:         "fsync",
+	}
+	if v, ok := config.Get("init.defaultBranch"); ok && v != "" {
+		s.DefaultBranch = v
+	}
+	if v, ok := config.Get("receive.denyCurrentBranch"); ok {
+		s.DenyCurrentBranch = strings.ToLower(v)
+	}
+	if v, ok := config.Get("diff.algorithm"); ok && v != "" {
+		s.DiffAlgorithm = strings.ToLower(v)
+	}
+	if v, ok := config.Get("core.logAllRefUpdates"); ok {
+		s.LogAllRefUpdates = strings.ToLower(v)
+		if s.LogAllRefUpdates != "always" {
+			s.LogAllRefUpdates = strconv.FormatBool(config.Bool("core.logAllRefUpdates", false))
+		}
+	}
+	if v, ok := config.Get("core.fsync"); ok {
+		s.Fsync = ParseFsyncComponents(v)
+	}
+	if config.Bool("core.fsyncObjectFiles", false) {
+		s.Fsync |= FsyncLooseObject
+	}
+	if v, ok := config.Get("core.fsyncMethod"); ok && v != "" {
+		s.FsyncMethod = strings.ToLower(v)
+	}
+	return s
+}
+
+// Settings reads the settings of the repository from its config.
+func (repo *Repository) Settings() (*RepositorySettings, error) {
+	config, err := repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	return ReadRepositorySettings(config), nil
+}
+
+// Return the settings of the repository, the defaults if its config can't
+// be read.
+func (repo *Repository) settings() *RepositorySettings {
+	config, err := repo.Config()
+	if err != nil {
+		repo.log().Warn("can't read config, using defaults", "err", err)
+	}
+	return ReadRepositorySettings(config)
+}
@@ -1,6 +1,7 @@
 package git
 
 import (
+	"bytes"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -11,10 +12,32 @@ var (
 	IdNotExist = errors.New("sha1 id not exist")
 )
 
-type sha1 [20]byte
+// An ObjectID is the sha1 name of a git object.
+type ObjectID [20]byte
+
+// IsZero reports whether id is the zero id, which git uses for missing
+// objects, e.g. the old value of a newly created ref.
+func (id ObjectID) IsZero() bool {
+	return id == ObjectID{}
+}
+
+// Short returns the first n hex digits of the id.
+func (id ObjectID) Short(n int) string {
+	s := id.String()
+	if n < 0 || n > len(s) {
+		return s
+	}
+	return s[:n]
+}
+
+// Compare returns -1, 0 or 1 if id sorts before, equal to or after other,
+// comparing the raw bytes.
+func (id ObjectID) Compare(other ObjectID) int {
+	return bytes.Compare(id[:], other[:])
+}
 
 // Return string (hex) representation of the Oid
-func (s sha1) String() string {
+func (s ObjectID) String() string {
 	result := make([]byte, 0, 40)
 	hexvalues := []byte("0123456789abcdef")
 	for i := 0; i < 20; i++ {
@@ -26,7 +49,7 @@ func (s sha1) String() string {
 
 // Return true if s has the same sha1 as caller.
 // Support 40-length-string, []byte, sha1
-func (id sha1) Equal(s2 interface{}) bool {
+func (id ObjectID) Equal(s2 interface{}) bool {
 	switch v := s2.(type) {
 	case string:
 		if len(v) != 40 {
@@ -42,7 +65,7 @@ func (id sha1) Equal(s2 interface{}) bool {
 				return false
 			}
 		}
-	case sha1:
+	case ObjectID:
 		for i, v := range v {
 			if id[i] != v {
 				return false
@@ -68,9 +91,9 @@ func IsSha1(sha1 string) bool {
 }
 
 // Create a new sha1 from a Sha1 string of length 40.
-func NewIdFromString(s string) (sha1, error) {
+func NewIdFromString(s string) (ObjectID, error) {
 	s = strings.TrimSpace(s)
-	var id sha1
+	var id ObjectID
 	if len(s) != 40 {
 		return id, fmt.Errorf("Length must be 40")
 	}
@@ -83,8 +106,8 @@ func NewIdFromString(s string) (sha1, error) {
 }
 
 // Create a new sha1 from a 20 byte slice.
-func NewId(b []byte) (sha1, error) {
-	var id sha1
+func NewId(b []byte) (ObjectID, error) {
+	var id ObjectID
 	if len(b) != 20 {
 		return id, errors.New("Length must be 20")
 	}
@@ -94,3 +117,18 @@ func NewId(b []byte) (sha1, error) {
 	}
 	return id, nil
 }
+
+// MarshalText encodes the id as 40 hex digits, so that ids are strings in
+// JSON and other text formats.
+func (id ObjectID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+func (id *ObjectID) UnmarshalText(text []byte) error {
+	parsed, err := NewIdFromString(string(text))
+	if err != nil {
+		return err
+	}
+	*id = parsed
+	return nil
+}
@@ -2,7 +2,10 @@ package git
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -20,24 +23,93 @@ func (s Signature) String() string {
 	return s.Name + " <" + s.Email + ">"
 }
 
-// Helper to get a signature from the commit line, which looks like this:
+// The time of signatures without a usable date.
+var unixEpoch = time.Unix(0, 0)
+
+// Parse a signature from the commit line, which looks like this:
 //     author Patrick Gundlach <gundlach@speedata.de> 1378823654 +0200
 // but without the "author " at the beginning (this method should)
 // be used for author and committer.
-//
-// FIXME: include timezone!
-func newSignatureFromCommitline(line []byte) (*Signature, error) {
+// In strict mode, the reason a malformed line is rejected is returned.
+// Otherwise, what can't be parsed is left empty, with a time of 0 for a
+// garbled date and the local timezone for a garbled timezone.
+func parseSignature(line []byte, mode ParseMode) (*Signature, string) {
+	strict := mode == ParseStrict
 	sig := new(Signature)
 	emailstart := bytes.IndexByte(line, '<')
-	sig.Name = string(line[:emailstart-1])
 	emailstop := bytes.IndexByte(line, '>')
+	if emailstart < 0 || emailstop < emailstart {
+		if strict {
+			return nil, "missing email"
+		}
+		sig.Name = string(bytes.TrimSpace(line))
+		sig.When = unixEpoch
+		return sig, ""
+	}
+	if strict && (emailstart == 0 || line[emailstart-1] != ' ') {
+		return nil, "missing space before email"
+	}
+	sig.Name = string(bytes.TrimSpace(line[:emailstart]))
 	sig.Email = string(line[emailstart+1 : emailstop])
-	timestop := bytes.IndexByte(line[emailstop+2:], ' ')
-	timestring := string(line[emailstop+2 : emailstop+2+timestop])
-	seconds, err := strconv.ParseInt(timestring, 10, 64)
-	if err != nil {
-		return nil, err
-	}
-	sig.When = time.Unix(seconds, 0)
-	return sig, nil
+	if strict && strings.ContainsAny(sig.Email, "<\n") {
+		return nil, "bad email"
+	}
+
+	fields := bytes.Fields(line[emailstop+1:])
+	if strict && (len(fields) != 2 || !bytes.HasPrefix(line[emailstop+1:], []byte(" "))) {
+		return nil, "bad date"
+	}
+	sig.When = unixEpoch
+	if len(fields) == 0 {
+		return sig, ""
+	}
+	seconds, err := strconv.ParseInt(string(fields[0]), 10, 64)
+	if strict && (err != nil || seconds < 0) {
+		return nil, "bad date"
+	} else if strict && len(fields[0]) > 1 && fields[0][0] == '0' {
+		return nil, "zero-padded date"
+	}
+	if err == nil {
+		sig.When = time.Unix(seconds, 0)
+	}
+	if len(fields) > 1 {
+		loc, err := parseTimezone(string(fields[1]))
+		if err == nil {
+			sig.When = sig.When.In(loc)
+		} else if strict {
+			return nil, "bad timezone"
+		}
+	}
+	return sig, ""
+}
+
+// ErrInvalidSignature is returned when a signature to write has a name or
+// email with a character that would end it early: a newline, a NUL, "<"
+// or ">".
+var ErrInvalidSignature = errors.New("name or email of signature contains a newline, NUL, < or >")
+
+// Check that the signature can be written into an object or a reflog
+// without changing what follows it.
+func (s *Signature) check() error {
+	if strings.ContainsAny(s.Name, "<>\n\x00") || strings.ContainsAny(s.Email, "<>\n\x00") {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Format the signature as in commit and tag objects, without the leading
+// "author " or "committer ".
+func (s *Signature) commitLine() string {
+	return s.Name + " <" + s.Email + "> " + formatGitTime(s.When)
+}
+
+// Format a time as seconds since the epoch and timezone offset.
+func formatGitTime(t time.Time) string {
+	_, offset := t.Zone()
+	sign := byte('+')
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+	return fmt.Sprintf("%d %c%02d%02d", t.Unix(), sign, offset/3600, offset%3600/60)
 }
@@ -0,0 +1,190 @@
+package git
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ErrReadOnlySnapshot is returned by operations that would modify the
+// repository through a view returned by Snapshot.
+var ErrReadOnlySnapshot = errors.New("repository snapshot is read-only")
+
+type snapshotState struct {
+	// all refs below refs/ and HEAD, by name
+	refs  map[string]Ref
+	names []string
+	packs []*os.File
+	// the branch HEAD points to if it has no commits yet
+	unbornHead string
+}
+
+// Snapshot returns a read-only view of the repository as it is now. The
+// refs are read once and the packs are kept open, so a long request reading
+// through the view sees the same refs and finds the same objects, even if
+// a push updates refs and a repack replaces and removes packs meanwhile.
+// Objects packed since are looked up in the new packs. Close releases the
+// packs. Like a Repository, a snapshot isn't safe for concurrent use.
+func (repo *Repository) Snapshot() (*Repository, error) {
+	if repo.closed {
+		return nil, ErrRepositoryClosed
+	}
+	if repo.snapshot != nil {
+		// reading HEAD and the refs again would read the pinned ones
+		return nil, errors.New("can't take a snapshot of a snapshot")
+	}
+
+	state := &snapshotState{refs: make(map[string]Ref)}
+	if head, ok, err := repo.readLooseRef("HEAD"); err != nil {
+		return nil, err
+	} else if ok {
+		state.refs["HEAD"] = head
+	} else if state.unbornHead, err = repo.headTarget(); err != nil {
+		return nil, err
+	}
+	err := repo.ForEachRef("refs/", func(ref Ref) error {
+		state.refs[ref.Name] = ref
+		state.names = append(state.names, ref.Name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	view := *repo
+	view.commitCache = nil
+	view.tagCache = nil
+	view.generations = nil
+	view.correctedDates = nil
+	view.cacheKeys = nil
+	view.snapshot = state
+	view.indexfiles = make(map[string]*idxFile, len(repo.indexfiles))
+	for path, idx := range repo.indexfiles {
+		if err := view.pinPack(path, idx); os.IsNotExist(err) {
+			// removed by a repack since the packs were loaded; the
+			// objects are in the pack that replaced it
+			continue
+		} else if err != nil {
+			view.Close()
+			return nil, err
+		}
+	}
+	if _, err := view.pinNewPacks(); err != nil {
+		view.Close()
+		return nil, err
+	}
+	repo.log().Debug("took snapshot", "refs", len(state.names), "packs", len(view.indexfiles))
+	return &view, nil
+}
+
+// IsSnapshot reports whether the repository is a view returned by
+// Snapshot.
+func (repo *Repository) IsSnapshot() bool {
+	return repo.snapshot != nil
+}
+
+// Open the pack of idx and add it to the packs of the snapshot.
+func (repo *Repository) pinPack(indexpath string, idx *idxFile) error {
+	f, err := os.Open(idx.packpath)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	repo.snapshot.packs = append(repo.snapshot.packs, f)
+	repo.indexfiles[indexpath] = &idxFile{
+		indexpath:    idx.indexpath,
+		packpath:     idx.packpath,
+		packversion:  idx.packversion,
+		offsetValues: idx.offsetValues,
+		pinned:       io.NewSectionReader(f, 0, fi.Size()),
+	}
+	return nil
+}
+
+// Pin the packs written since the snapshot was taken, for objects that
+// were repacked meanwhile. It reports whether there were any.
+func (repo *Repository) pinNewPacks() (bool, error) {
+	indexfiles, err := repo.packIndexPaths()
+	if err != nil {
+		return false, err
+	}
+	added := false
+	for _, indexfile := range indexfiles {
+		if _, ok := repo.indexfiles[indexfile]; ok {
+			continue
+		}
+		idx, err := readIdxFile(indexfile)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return added, err
+		}
+		if err := repo.pinPack(indexfile, idx); os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return added, err
+		}
+		added = true
+	}
+	return added, nil
+}
+
+// Release the packs of a snapshot.
+func (s *snapshotState) close() {
+	for _, f := range s.packs {
+		f.Close()
+	}
+	s.packs = nil
+}
+
+// Call fn for the refs of the snapshot starting with prefix, in order.
+func (s *snapshotState) forEachRef(prefix string, fn func(Ref) error) error {
+	i := sort.SearchStrings(s.names, prefix)
+	for ; i < len(s.names) && strings.HasPrefix(s.names[i], prefix); i++ {
+		if err := fn(s.refs[s.names[i]]); err == StopIteration {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Return the names of the refs below dir, relative to it, like readRefDir.
+func (s *snapshotState) refNames(dir string) []string {
+	var names []string
+	s.forEachRef(dir+"/", func(ref Ref) error {
+		names = append(names, strings.TrimPrefix(ref.Name, dir+"/"))
+		return nil
+	})
+	return names
+}
+
+// A pack kept open by a snapshot. It is read with ReadAt, so the file is
+// shared by all readers, and closed with the snapshot.
+type pinnedPack struct {
+	*io.SectionReader
+}
+
+func (pinnedPack) Close() error {
+	return nil
+}
+
+// Open the pack at path, through the file a snapshot keeps open if it is
+// one of its packs.
+func openPack(path string, indexfiles *map[string]*idxFile) (io.ReadSeekCloser, error) {
+	if idx, ok := (*indexfiles)[path[0:len(path)-4]+"idx"]; ok && idx.pinned != nil {
+		return pinnedPack{io.NewSectionReader(idx.pinned, 0, idx.pinned.Size())}, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,233 @@
+package git
+
+import (
+	"errors"
+	"path"
+	"strings"
+)
+
+var (
+	ErrSubtreeNotFound = errors.New("prefix not found in any commit")
+	ErrSubtreeExists   = errors.New("prefix already exists and shares no history with the merged commit")
+)
+
+// SubtreeSplitOptions configure SubtreeSplit.
+type SubtreeSplitOptions struct {
+	// Revision whose history is split, HEAD if empty.
+	Rev string
+	// If not empty, refs/heads/Branch is set to the split history.
+	Branch string
+	// Prepended to the message of each synthetic commit.
+	Annotate string
+}
+
+// SubtreeSplit creates a synthetic history of the directory prefix, like
+// git subtree split: each commit that changed the directory gets a copy
+// with the directory as its root tree. Commits are created with the same
+// author, committer and message, so splitting the same history again
+// gives the same ids. Returns the id of the copy of the newest commit.
+func (repo *Repository) SubtreeSplit(prefix string, opts SubtreeSplitOptions) (ObjectID, error) {
+	prefix = strings.Trim(path.Clean("/"+prefix), "/")
+	rev := opts.Rev
+	if rev == "" {
+		rev = "HEAD"
+	}
+	tip, err := repo.resolveRevision(rev)
+	if err != nil {
+		return ObjectID{}, err
+	}
+
+	commits, err := repo.topoOrder([]ObjectID{tip})
+	if err != nil {
+		return ObjectID{}, err
+	}
+
+	split := make(map[ObjectID]ObjectID, len(commits))
+	for _, c := range commits {
+		var parents []ObjectID
+		for _, p := range c.parents {
+			if np, ok := split[p]; ok && !containsId(parents, np) {
+				parents = append(parents, np)
+			}
+		}
+
+		subtree, ok, err := subtreeId(&c.Tree, prefix)
+		if err != nil {
+			return ObjectID{}, err
+		}
+		if !ok {
+			// the directory doesn't exist in this commit
+			if len(parents) > 0 {
+				split[c.Id] = parents[0]
+			}
+			continue
+		}
+
+		id, err := repo.splitCommit(c, subtree, parents, opts.Annotate)
+		if err != nil {
+			return ObjectID{}, err
+		}
+		split[c.Id] = id
+	}
+
+	id, ok := split[tip]
+	if !ok {
+		return ObjectID{}, ErrSubtreeNotFound
+	}
+	if opts.Branch != "" {
+		if err := repo.setRef("refs/heads/"+opts.Branch, id); err != nil {
+			return ObjectID{}, err
+		}
+	}
+	return id, nil
+}
+
+// Copy c with the given tree and parents, unless the copy would be
+// identical to one of the parents.
+func (repo *Repository) splitCommit(c *Commit, tree ObjectID, parents []ObjectID, annotate string) (ObjectID, error) {
+	for _, p := range parents {
+		pc, err := repo.getCommit(p)
+		if err != nil {
+			return ObjectID{}, err
+		}
+		if !pc.Tree.Id.Equal(tree) {
+			continue
+		}
+		// reuse p if the other parents are already part of it
+		redundant := true
+		for _, other := range parents {
+			if anc, err := repo.isAncestor(other, p); err != nil {
+				return ObjectID{}, err
+			} else if !anc {
+				redundant = false
+				break
+			}
+		}
+		if redundant {
+			return p, nil
+		}
+	}
+
+	return repo.CreateCommit(CommitOptions{
+		Tree:      tree,
+		Parents:   parents,
+		Author:    c.Author,
+		Committer: c.Committer,
+		Message:   annotate + c.CommitMessage,
+	})
+}
+
+// SubtreeMerge merges the commit commitId of another project into the
+// directory prefix of target, like git subtree add and git subtree merge.
+// If prefix doesn't exist in target, the other project's tree is added
+// there. Otherwise the directory is merged with the other project's tree,
+// using the common history from earlier subtree merges; a
+// *MergeConflictError is returned if both sides changed the same files.
+//
+// The returned merge commit has target and commitId as parents. Tree and
+// Parents of opts are ignored. No ref is updated.
+func (repo *Repository) SubtreeMerge(prefix, target, commitId string, opts CommitOptions) (ObjectID, error) {
+	prefix = strings.Trim(path.Clean("/"+prefix), "/")
+	ours, err := repo.resolveRevision(target)
+	if err != nil {
+		return ObjectID{}, err
+	}
+	theirs, err := repo.resolveRevision(commitId)
+	if err != nil {
+		return ObjectID{}, err
+	}
+
+	ourCommit, err := repo.getCommit(ours)
+	if err != nil {
+		return ObjectID{}, err
+	}
+	theirCommit, err := repo.getCommit(theirs)
+	if err != nil {
+		return ObjectID{}, err
+	}
+
+	files, err := repo.flattenTree(&ourCommit.Tree)
+	if err != nil {
+		return ObjectID{}, err
+	}
+	theirFiles, err := repo.flattenTree(&theirCommit.Tree)
+	if err != nil {
+		return ObjectID{}, err
+	}
+
+	// the files of the directory, relative to it
+	ourFiles := make(map[string]treeFile)
+	for p, f := range files {
+		if strings.HasPrefix(p, prefix+"/") {
+			ourFiles[strings.TrimPrefix(p, prefix+"/")] = f
+			delete(files, p)
+		}
+	}
+
+	merged := theirFiles
+	if len(ourFiles) > 0 {
+		bases, err := repo.mergeBases(ours, theirs)
+		if err != nil {
+			return ObjectID{}, err
+		}
+		if len(bases) == 0 {
+			return ObjectID{}, ErrSubtreeExists
+		}
+		base, err := repo.getCommit(bases[0])
+		if err != nil {
+			return ObjectID{}, err
+		}
+		baseFiles, err := repo.flattenTree(&base.Tree)
+		if err != nil {
+			return ObjectID{}, err
+		}
+
+		var conflicts []string
+		merged, conflicts = mergeFlatTrees(baseFiles, ourFiles, theirFiles)
+		if len(conflicts) > 0 {
+			for i := range conflicts {
+				conflicts[i] = path.Join(prefix, conflicts[i])
+			}
+			return ObjectID{}, &MergeConflictError{Paths: conflicts}
+		}
+	}
+	if _, ok := files[prefix]; ok {
+		return ObjectID{}, &MergeConflictError{Paths: []string{prefix}}
+	}
+	for p, f := range merged {
+		files[path.Join(prefix, p)] = f
+	}
+
+	opts.Tree, err = repo.writeTree(files)
+	if err != nil {
+		return ObjectID{}, err
+	}
+	opts.Parents = []ObjectID{ours, theirs}
+	if opts.Message == "" {
+		opts.Message = "Merge commit '" + theirs.String() + "' into " + prefix + "\n"
+	}
+	return repo.CreateCommit(opts)
+}
+
+// Return the id of the tree at dir, and whether there is one.
+func subtreeId(t *Tree, dir string) (ObjectID, bool, error) {
+	te, err := t.GetTreeEntryByPath(dir)
+	if err == ErrNotExist {
+		return ObjectID{}, false, nil
+	} else if err != nil {
+		return ObjectID{}, false, err
+	}
+	if !te.IsDir() {
+		return ObjectID{}, false, nil
+	}
+	return te.Id, true, nil
+}
+
+func containsId(ids []ObjectID, id ObjectID) bool {
+	for _, i := range ids {
+		if i.Equal(id) {
+			return true
+		}
+	}
+	return false
+}
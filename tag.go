@@ -1,61 +1,159 @@
 package git
 
-import "bytes"
+import (
+	"bytes"
+	"fmt"
+)
 
-// Tag
+// Tag is an annotated tag object, or a lightweight tag: then Id and Object
+// are both the object the tag ref points to, and there is no tagger and
+// message.
 type Tag struct {
 	Name       string
-	Id         sha1
+	Id         ObjectID
 	repo       *Repository
-	Object     sha1 // The id of this commit object
-	Type       string
+	Object     ObjectID // The id of the tagged object
+	Type       string   // The type of the tagged object, e.g. "commit"
 	Tagger     *Signature
 	TagMessage string
+
+	// the raw object, for checking its signature
+	raw []byte
+}
+
+// IsAnnotated reports whether the tag is a tag object.
+func (tag *Tag) IsAnnotated() bool {
+	return !tag.Id.Equal(tag.Object)
+}
+
+// Target returns the object the tag points to, following tags of tags,
+// and its type.
+func (tag *Tag) Target() (ObjectID, ObjectType, error) {
+	return tag.repo.peel(tag.Object)
 }
 
+// Commit returns the commit the tag points to.
 func (tag *Tag) Commit() (*Commit, error) {
-	return tag.repo.getCommit(tag.Object)
+	id, tp, err := tag.Target()
+	if err != nil {
+		return nil, err
+	}
+	if tp != ObjectCommit {
+		return nil, fmt.Errorf("tag %s points to a %s, not a commit", tag.Name, tp)
+	}
+	return tag.repo.getCommit(id)
+}
+
+// Tree returns the tree the tag points to, or the tree of the commit it
+// points to.
+func (tag *Tag) Tree() (*Tree, error) {
+	id, tp, err := tag.Target()
+	if err != nil {
+		return nil, err
+	}
+	switch tp {
+	case ObjectCommit:
+		c, err := tag.repo.getCommit(id)
+		if err != nil {
+			return nil, err
+		}
+		return &c.Tree, nil
+	case ObjectTree:
+		return tag.repo.getTree(id)
+	}
+	return nil, fmt.Errorf("tag %s points to a %s, not a tree", tag.Name, tp)
+}
+
+// Blob returns the blob the tag points to, like the tags git.git uses for
+// its signing keys. The blob has no name or mode.
+func (tag *Tag) Blob() (*Blob, error) {
+	id, tp, err := tag.Target()
+	if err != nil {
+		return nil, err
+	}
+	if tp != ObjectBlob {
+		return nil, fmt.Errorf("tag %s points to a %s, not a blob", tag.Name, tp)
+	}
+	return &Blob{&TreeEntry{Id: id, Type: ObjectBlob, mode: ModeBlob, ptree: NewTree(tag.repo, ObjectID{})}}, nil
 }
 
 // Parse commit information from the (uncompressed) raw
 // data from the commit object.
 // \n\n separate headers from message
-func parseTagData(data []byte) (*Tag, error) {
-	tag := new(Tag)
+// In strict mode, the object, type and tag headers must come first, in
+// that order, and the type must be a valid object type.
+func parseTagData(data []byte, mode ParseMode) (*Tag, error) {
+	strict := mode == ParseStrict
+	tag := &Tag{raw: data}
+	fail := func(line int, reason string) (*Tag, error) {
+		return nil, &ParseError{Type: ObjectTag, Line: line, Reason: reason}
+	}
+	required := []string{"object", "type", "tag"}
+	haveObject := false
+
 	// we now have the contents of the commit object. Let's investigate...
 	nextline := 0
-l:
-	for {
+	for lineNo := 1; ; lineNo++ {
 		eol := bytes.IndexByte(data[nextline:], '\n')
-		switch {
-		case eol > 0:
-			line := data[nextline : nextline+eol]
-			spacepos := bytes.IndexByte(line, ' ')
-			reftype := line[:spacepos]
-			switch string(reftype) {
-			case "object":
-				id, err := NewIdFromString(string(line[spacepos+1:]))
-				if err != nil {
-					return nil, err
-				}
-				tag.Object = id
-			case "type":
-				// A commit can have one or more parents
-				tag.Type = string(line[spacepos+1:])
-			case "tagger":
-				sig, err := newSignatureFromCommitline(line[spacepos+1:])
-				if err != nil {
-					return nil, err
-				}
-				tag.Tagger = sig
+		if eol < 0 {
+			if strict {
+				return fail(lineNo, "unterminated header")
 			}
-			nextline += eol + 1
-		case eol == 0:
+			break
+		}
+		if eol == 0 {
 			tag.TagMessage = string(data[nextline+1:])
-			break l
-		default:
-			break l
+			break
+		}
+		line := data[nextline : nextline+eol]
+		nextline += eol + 1
+
+		if line[0] == ' ' {
+			continue
+		}
+		spacepos := bytes.IndexByte(line, ' ')
+		if spacepos < 0 {
+			if strict {
+				return fail(lineNo, "header without value")
+			}
+			continue
+		}
+		reftype, value := string(line[:spacepos]), line[spacepos+1:]
+		if strict && len(required) > 0 {
+			if reftype != required[0] {
+				return fail(lineNo, "expected "+required[0]+" header")
+			}
+			required = required[1:]
+		}
+		switch reftype {
+		case "object":
+			id, err := NewIdFromString(string(value))
+			if err != nil {
+				return fail(lineNo, "bad object id")
+			}
+			tag.Object = id
+			haveObject = true
+		case "tag":
+			tag.Name = string(value)
+		case "type":
+			tag.Type = string(value)
+			if _, err := ParseObjectType(tag.Type); err != nil && strict {
+				return fail(lineNo, "bad type")
+			}
+		case "tagger":
+			sig, reason := parseSignature(value, mode)
+			if sig == nil {
+				return fail(lineNo, "tagger: "+reason)
+			}
+			tag.Tagger = sig
 		}
 	}
+
+	if !haveObject {
+		return fail(0, "missing object")
+	}
+	if strict && len(required) > 0 {
+		return fail(0, "missing "+required[0])
+	}
 	return tag, nil
 }
@@ -0,0 +1,100 @@
+package git
+
+import (
+	"strings"
+)
+
+// A TagFollowing is how git fetch picks the tags of a remote to fetch
+// besides the refs its refspecs select.
+type TagFollowing int
+
+const (
+	// Tags pointing into the fetched history, git fetch's default.
+	TagFollowAuto TagFollowing = iota
+	// All tags, like git fetch --tags.
+	TagFollowAll
+	// No tags, like git fetch --no-tags.
+	TagFollowNone
+)
+
+// RemoteTagFollowing returns the tag following of a remote, from its
+// remote.<name>.tagOpt config variable.
+func (repo *Repository) RemoteTagFollowing(remote string) TagFollowing {
+	config, err := repo.Config()
+	if err != nil {
+		repo.log().Warn("can't read config, following tags", "err", err)
+		return TagFollowAuto
+	}
+	v, _ := config.Get("remote." + remote + ".tagOpt")
+	switch v {
+	case "--tags":
+		return TagFollowAll
+	case "--no-tags":
+		return TagFollowNone
+	}
+	return TagFollowAuto
+}
+
+// FollowTags returns the tags among the refs a remote advertises that a
+// fetch with the given tag following adds, besides the refs it fetches.
+// fetching are the commits the fetch asks for. With TagFollowAuto, a tag
+// is followed if what it points to, after peeling annotated tags, is
+// fetched or in the repository already, so call it again once the fetch
+// is done to pick the tags pointing deeper into the fetched history, like
+// git does. Tags the repository has already are left out; TagFollowAll
+// includes those that point elsewhere than the remote's.
+//
+// Advertised annotated tags should have Peeled set, as the "^{}" lines of
+// the advertisement give it; for the others the tag object is read if the
+// repository has it.
+func (repo *Repository) FollowTags(advertised []Ref, fetching []ObjectID, following TagFollowing) ([]Ref, error) {
+	if following == TagFollowNone {
+		return nil, nil
+	}
+	fetched := make(map[ObjectID]bool, len(fetching))
+	for _, id := range fetching {
+		fetched[id] = true
+	}
+
+	var tags []Ref
+	for _, ref := range advertised {
+		if !strings.HasPrefix(ref.Name, "refs/tags/") || strings.HasSuffix(ref.Name, "^{}") {
+			continue
+		}
+		local, exists, err := repo.lookupRef(ref.Name)
+		if err != nil {
+			return nil, err
+		}
+		if exists && (following == TagFollowAuto || local.Id.Equal(ref.Id)) {
+			continue
+		}
+		if following == TagFollowAll {
+			tags = append(tags, ref)
+			continue
+		}
+
+		target := ref.Peeled
+		if target.IsZero() {
+			target = ref.Id
+			if found, _, err := repo.haveObject(ref.Id); err != nil {
+				return nil, err
+			} else if found {
+				if target, _, err = repo.peel(ref.Id); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if fetched[target] {
+			tags = append(tags, ref)
+			continue
+		}
+		found, _, err := repo.haveObject(target)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			tags = append(tags, ref)
+		}
+	}
+	return tags, nil
+}
@@ -0,0 +1,163 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A TempObjectDir is a temporary object directory that the objects of an
+// operation writing many, like an import, a merge or a history rewrite,
+// are written to instead of the object database, like git's
+// tmp_objdir-*. If the operation fails, Discard removes them all at once;
+// if it succeeds, Migrate moves them into the object database. With
+// core.fsyncMethod=batch, loose objects are synced to disk in one go then
+// instead of one by one as they are written.
+type TempObjectDir struct {
+	repo *Repository
+	view *Repository
+	dir  string
+}
+
+// TempObjectDir creates a temporary object directory inside the object
+// database. Write objects through its Repository, and call Migrate or
+// Discard when done.
+func (repo *Repository) TempObjectDir() (*TempObjectDir, error) {
+	if repo.snapshot != nil {
+		return nil, ErrReadOnlySnapshot
+	}
+	dir, err := ioutil.TempDir(repo.ObjectsDir, "tmp_objdir-")
+	if err != nil {
+		return nil, err
+	}
+	view := *repo
+	view.ObjectsDir = dir
+	view.alternates = repo.objectDirs()
+	view.batchFsync = repo.settings().FsyncMethod == "batch"
+	view.commitCache = nil
+	view.tagCache = nil
+	return &TempObjectDir{repo: repo, view: &view, dir: dir}, nil
+}
+
+// Repository returns a view of the repository that writes objects into
+// the temporary directory. Objects of the repository can be read through
+// it as usual.
+func (t *TempObjectDir) Repository() *Repository {
+	return t.view
+}
+
+// Migrate moves the objects written to the temporary directory into the
+// object database and removes the directory. Objects the object database
+// has already are dropped. Each object is complete when it appears, and
+// packs only appear once their index does, so readers never see partial
+// objects; refs should only be pointed at the objects after Migrate
+// succeeded.
+func (t *TempObjectDir) Migrate() error {
+	var files []string
+	err := filepath.Walk(t.dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() && !strings.HasPrefix(fi.Name(), ".gogit_") {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// pack indexes last, so that a pack is complete once it is found
+	sort.SliceStable(files, func(i, j int) bool {
+		return !strings.HasSuffix(files[i], ".idx") && strings.HasSuffix(files[j], ".idx")
+	})
+
+	// sync all files first, then rename them: packs and their metadata if
+	// core.fsync says so, loose objects if they weren't synced when written
+	syncPack, syncMeta := t.repo.fsyncs(FsyncPack), t.repo.fsyncs(FsyncPackMetadata)
+	syncLoose := t.view.batchFsync && t.repo.fsyncs(FsyncLooseObject)
+	synced := false
+	for _, p := range files {
+		switch filepath.Ext(p) {
+		case ".pack":
+			if !syncPack {
+				continue
+			}
+		case ".idx", ".rev", ".bitmap":
+			if !syncMeta {
+				continue
+			}
+		default:
+			if !syncLoose {
+				continue
+			}
+		}
+		if err := syncPath(p); err != nil {
+			return err
+		}
+		synced = true
+	}
+	dirs := make(map[string]bool)
+	packs := false
+	for _, p := range files {
+		rel, err := filepath.Rel(t.dir, p)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(t.repo.ObjectsDir, rel)
+		if err := os.MkdirAll(filepath.Dir(dst), 0775); err != nil {
+			return err
+		}
+		if err := finalizeObjectFile(p, dst); err != nil {
+			return err
+		}
+		dirs[filepath.Dir(dst)] = true
+		packs = packs || strings.HasSuffix(p, ".idx")
+	}
+	for dir := range dirs {
+		if synced {
+			// not all systems can sync directories
+			syncPath(dir)
+		}
+	}
+	if err := os.RemoveAll(t.dir); err != nil {
+		return err
+	}
+	t.repo.log().Debug("migrated temporary objects", "dir", t.dir, "files", len(files))
+	if packs {
+		return t.repo.ReloadPacks()
+	}
+	return nil
+}
+
+// Discard removes the temporary directory with the objects written to it.
+func (t *TempObjectDir) Discard() error {
+	return os.RemoveAll(t.dir)
+}
+
+// Move a finished object file to its place, unless an object is there
+// already. Objects with the same name have the same content, so the
+// existing one is kept.
+func finalizeObjectFile(src, dst string) error {
+	if err := os.Link(src, dst); err != nil && !os.IsExist(err) {
+		// file systems without hard links
+		if _, serr := os.Stat(dst); os.IsNotExist(serr) {
+			return os.Rename(src, dst)
+		}
+	}
+	return os.Remove(src)
+}
+
+// Flush a file or a directory to disk.
+func syncPath(p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package git
+
+import (
+	"os"
+	"testing"
+)
+
+func haveObject(t *testing.T, repo *Repository, id ObjectID) bool {
+	t.Helper()
+	found, _, err := repo.haveObject(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func TestTempObjectDirMigrate(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	tmp, err := repo.TempObjectDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	view := tmp.Repository()
+	id, err := view.WriteObject(ObjectBlob, []byte("temporary\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// an object the repository has already
+	master := refId(t, repo, "refs/heads/master")
+	if !haveObject(t, view, master) {
+		t.Error("objects of the repository aren't visible through the view")
+	}
+	if !haveObject(t, view, id) {
+		t.Error("written object isn't visible through the view")
+	}
+	if haveObject(t, repo, id) {
+		t.Error("written object visible before Migrate")
+	}
+
+	if err := tmp.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if !haveObject(t, repo, id) {
+		t.Error("object missing after Migrate")
+	}
+	data, err := repo.readBlob(id)
+	if err != nil || string(data) != "temporary\n" {
+		t.Errorf("migrated object reads %q (%v)", data, err)
+	}
+	if _, err := os.Stat(tmp.dir); !os.IsNotExist(err) {
+		t.Errorf("temporary directory left behind: %v", err)
+	}
+}
+
+func TestTempObjectDirDiscard(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	tmp, err := repo.TempObjectDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := tmp.Repository().WriteObject(ObjectBlob, []byte("discarded\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tmp.Discard(); err != nil {
+		t.Fatal(err)
+	}
+	if haveObject(t, repo, id) {
+		t.Error("discarded object in the repository")
+	}
+	if _, err := os.Stat(tmp.dir); !os.IsNotExist(err) {
+		t.Errorf("temporary directory left behind: %v", err)
+	}
+}
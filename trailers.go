@@ -0,0 +1,102 @@
+package git
+
+import (
+	"strings"
+)
+
+// A Trailer is a "Key: value" line at the end of a commit message, like
+// "Signed-off-by: A U Thor <author@example.com>".
+type Trailer struct {
+	Key   string
+	Value string
+}
+
+// Trailers returns the trailers of the commit message, see ParseTrailers.
+func (c *Commit) Trailers() []Trailer {
+	return ParseTrailers(c.CommitMessage)
+}
+
+// ParseTrailers returns the trailers of a message, in order, following the
+// rules of git interpret-trailers: they are in the last paragraph, which
+// can't be the first one. The paragraph must consist of trailers only, or
+// have a line git writes itself, like Signed-off-by, and at least a
+// quarter of trailers. Keys are letters, digits and dashes. Values folded
+// over several lines, with the following lines indented, are unfolded.
+func ParseTrailers(msg string) []Trailer {
+	lines := strings.Split(strings.TrimRight(msg, "\n"), "\n")
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	start := len(lines)
+	for start > 0 && strings.TrimSpace(lines[start-1]) != "" {
+		start--
+	}
+	if start == 0 {
+		// the title can't be trailers
+		return nil
+	}
+	block := lines[start:]
+
+	trailerLines, nonTrailerLines, continuationLines := 0, 0, 0
+	recognized := false
+	for i := len(block) - 1; i >= 0; i-- {
+		line := block[i]
+		if line[0] == ' ' || line[0] == '\t' {
+			continuationLines++
+			continue
+		}
+		if strings.HasPrefix(line, "Signed-off-by: ") || strings.HasPrefix(line, "(cherry picked from commit ") {
+			recognized = true
+		}
+		if trailerSeparator(line) > 0 {
+			trailerLines += 1 + continuationLines
+		} else {
+			nonTrailerLines += 1 + continuationLines
+		}
+		continuationLines = 0
+	}
+	nonTrailerLines += continuationLines
+	if !(trailerLines > 0 && nonTrailerLines == 0 || recognized && trailerLines*3 >= nonTrailerLines) {
+		return nil
+	}
+
+	var trailers []Trailer
+	inTrailer := false
+	for _, line := range block {
+		if line[0] == ' ' || line[0] == '\t' {
+			if inTrailer {
+				t := &trailers[len(trailers)-1]
+				t.Value = strings.TrimSpace(t.Value + " " + strings.TrimSpace(line))
+			}
+			continue
+		}
+		i := trailerSeparator(line)
+		inTrailer = i > 0
+		if inTrailer {
+			trailers = append(trailers, Trailer{
+				Key:   strings.TrimSpace(line[:i]),
+				Value: strings.TrimSpace(line[i+1:]),
+			})
+		}
+	}
+	return trailers
+}
+
+// Return the index of the colon after the key of a trailer line, or -1 if
+// line isn't one. Whitespace may come between the key and the colon.
+func trailerSeparator(line string) int {
+	whitespace := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == ':':
+			return i
+		case !whitespace && (c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-'):
+		case i > 0 && (c == ' ' || c == '\t'):
+			whitespace = true
+		default:
+			return -1
+		}
+	}
+	return -1
+}
@@ -14,7 +14,7 @@ type TreeWalkCallback func(string, *TreeEntry) int
 
 // A tree is a flat directory listing.
 type Tree struct {
-	Id   sha1
+	Id   ObjectID
 	repo *Repository
 
 	// parent tree
@@ -22,6 +22,8 @@ type Tree struct {
 
 	entries       Entries
 	entriesParsed bool
+
+	view *TreeView
 }
 
 func (t *Tree) String() string {
@@ -120,7 +122,7 @@ func (t *Tree) ListEntries() Entries {
 	return t.entries
 }
 
-func NewTree(repo *Repository, id sha1) *Tree {
+func NewTree(repo *Repository, id ObjectID) *Tree {
 	tree := new(Tree)
 	tree.Id = id
 	tree.repo = repo
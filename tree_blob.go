@@ -1,34 +1,18 @@
 package git
 
-import (
-	"path"
-	"strings"
-)
-
 func (t *Tree) GetTreeEntryByPath(rpath string) (*TreeEntry, error) {
 	if len(rpath) == 0 {
 		return nil, ErrNotExist
 	}
 
-	parts := strings.Split(path.Clean(rpath), "/")
-	var err error
-	tree := t
-	for i, name := range parts {
-		if i == len(parts)-1 {
-			for _, v := range tree.ListEntries() {
-				if v.name == name {
-					return v, nil
-				}
-			}
-		} else {
-			tree, err = tree.SubTree(name)
-			if err != nil {
-				return nil, err
-			}
+	if t.view == nil {
+		view, err := t.repo.TreeView(t.Id)
+		if err != nil {
+			return nil, err
 		}
+		t.view = view
 	}
-
-	return nil, ErrNotExist
+	return t.view.Lookup(rpath)
 }
 
 func (t *Tree) GetBlobByPath(rpath string) (*Blob, error) {
@@ -0,0 +1,190 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A TreeBuilder edits a tree by path and writes the result as new tree
+// objects. Only the subtrees along edited paths are read and written
+// again, so editing a few files of a large tree is cheap.
+type TreeBuilder struct {
+	repo *Repository
+	root *builderTree
+}
+
+// a tree being edited
+type builderTree struct {
+	// the tree it started from, zero for a new one
+	id ObjectID
+	// nil until the tree is read
+	entries map[string]*builderEntry
+	dirty   bool
+}
+
+type builderEntry struct {
+	mode EntryMode
+	id   ObjectID
+	// set once the subtree is edited
+	tree *builderTree
+}
+
+// NewTreeBuilder returns a TreeBuilder starting from the tree base, or
+// from an empty tree if base is zero.
+func (repo *Repository) NewTreeBuilder(base ObjectID) (*TreeBuilder, error) {
+	if !base.IsZero() {
+		tp, err := repo.objectType(base)
+		if err != nil {
+			return nil, err
+		}
+		if tp != ObjectTree {
+			return nil, fmt.Errorf("%s is not a tree", base)
+		}
+	}
+	// a new tree is written even if nothing is inserted
+	return &TreeBuilder{repo: repo, root: &builderTree{id: base, dirty: base.IsZero()}}, nil
+}
+
+// Insert puts an entry at the slash separated path p, replacing what is
+// there, and creates the missing directories leading to it, replacing
+// files in their way. mode is one of ModeBlob, ModeExec, ModeSymlink,
+// ModeCommit and ModeTree; with ModeTree, id is an existing tree. Paths
+// that can't be checked out safely are refused with an UnsafePathsError.
+func (b *TreeBuilder) Insert(p string, mode EntryMode, id ObjectID) error {
+	switch mode {
+	case ModeBlob, ModeExec, ModeSymlink, ModeCommit, ModeTree:
+	default:
+		return fmt.Errorf("invalid mode %o", mode)
+	}
+	if err := ValidatePath(p); err != nil {
+		return err
+	}
+
+	dirs := strings.Split(p, "/")
+	name := dirs[len(dirs)-1]
+	trees, err := b.walk(dirs[:len(dirs)-1], true)
+	if err != nil {
+		return err
+	}
+	trees[len(trees)-1].entries[name] = &builderEntry{mode: mode, id: id}
+	for _, t := range trees {
+		t.dirty = true
+	}
+	return nil
+}
+
+// Remove deletes the entry at the slash separated path p, a file or a
+// whole directory. Directories left empty are removed as well. It returns
+// ErrNotExist if there is no such entry.
+func (b *TreeBuilder) Remove(p string) error {
+	dirs := strings.Split(p, "/")
+	name := dirs[len(dirs)-1]
+	trees, err := b.walk(dirs[:len(dirs)-1], false)
+	if err != nil {
+		return err
+	}
+	parent := trees[len(trees)-1]
+	if _, ok := parent.entries[name]; !ok {
+		return ErrNotExist
+	}
+	delete(parent.entries, name)
+	for _, t := range trees {
+		t.dirty = true
+	}
+	return nil
+}
+
+// Return the trees from the root down to the directory dirs names, read
+// for editing. Missing directories are created if create is set, otherwise
+// ErrNotExist is returned.
+func (b *TreeBuilder) walk(dirs []string, create bool) ([]*builderTree, error) {
+	t := b.root
+	if err := b.read(t); err != nil {
+		return nil, err
+	}
+	trees := []*builderTree{t}
+	for i, name := range dirs {
+		e, ok := t.entries[name]
+		switch {
+		case !ok && !create:
+			return nil, ErrNotExist
+		case !ok || e.mode != ModeTree && create:
+			// a file in the way is replaced by the directory
+			e = &builderEntry{mode: ModeTree, tree: &builderTree{}}
+			t.entries[name] = e
+		case e.mode != ModeTree:
+			return nil, fmt.Errorf("%s is not a directory", strings.Join(dirs[:i+1], "/"))
+		case e.tree == nil:
+			e.tree = &builderTree{id: e.id}
+		}
+		t = e.tree
+		if err := b.read(t); err != nil {
+			return nil, err
+		}
+		trees = append(trees, t)
+	}
+	return trees, nil
+}
+
+// Read the entries of t, unless they are already.
+func (b *TreeBuilder) read(t *builderTree) error {
+	if t.entries != nil {
+		return nil
+	}
+	t.entries = make(map[string]*builderEntry)
+	if t.id.IsZero() {
+		return nil
+	}
+	tree, err := b.repo.getTree(t.id)
+	if err != nil {
+		return err
+	}
+	scanner, err := tree.Scanner()
+	if err != nil {
+		return err
+	}
+	for scanner.Scan() {
+		te := scanner.TreeEntry()
+		t.entries[te.name] = &builderEntry{mode: te.mode, id: te.Id}
+	}
+	return scanner.Err()
+}
+
+// Write writes the tree objects of the edited trees and returns the id of
+// the root tree. The builder can be edited and written again afterwards.
+func (b *TreeBuilder) Write() (ObjectID, error) {
+	id, _, err := b.write(b.root)
+	return id, err
+}
+
+// Write t if it was edited, and return its id and whether it's empty.
+// Empty subtrees aren't written, git doesn't record empty directories.
+func (b *TreeBuilder) write(t *builderTree) (ObjectID, bool, error) {
+	if !t.dirty {
+		return t.id, false, nil
+	}
+	entries := make(map[string]treeFile, len(t.entries))
+	for name, e := range t.entries {
+		if e.tree != nil {
+			id, empty, err := b.write(e.tree)
+			if err != nil {
+				return ObjectID{}, false, err
+			}
+			if empty {
+				delete(t.entries, name)
+				continue
+			}
+			e.id = id
+		}
+		entries[name] = treeFile{e.mode, e.id}
+	}
+	if len(entries) == 0 && t != b.root {
+		return ObjectID{}, true, nil
+	}
+	id, err := b.repo.writeTreeObject(entries)
+	if err != nil {
+		return ObjectID{}, false, err
+	}
+	t.id, t.dirty = id, false
+	return id, false, nil
+}
@@ -0,0 +1,128 @@
+package git
+
+import (
+	"testing"
+)
+
+func mustIdFromString(t *testing.T, s string) ObjectID {
+	t.Helper()
+	id, err := NewIdFromString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestTreeBuilder(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	// the tree of master has the files data, hello and independent-file
+	base := mustIdFromString(t, "3653a91b9cb7fd42c00609855aba0c25e83df287")
+	data := mustIdFromString(t, "28c7f98408356c823d0247f3ee40746e24e3a78b")
+	empty := mustIdFromString(t, "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391")
+
+	b, err := repo.NewTreeBuilder(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := b.Write(); err != nil || !id.Equal(base) {
+		t.Errorf("unedited tree written as %s (%v), expected %s", id, err, base)
+	}
+	if err := b.Insert("dir/sub/file", ModeBlob, empty); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Insert("exec", ModeExec, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Remove("independent-file"); err != nil {
+		t.Fatal(err)
+	}
+	// ids from git mktree
+	expected := "ab18deaa1158ced5c34ec7dbd36e9598abf8fa57"
+	id, err := b.Write()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.String() != expected {
+		t.Errorf("expected tree %s, got %s", expected, id)
+	}
+	tree, err := repo.GetTree(id.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, err := tree.GetTreeEntryByPath("dir/sub/file"); err != nil || !entry.Id.Equal(empty) {
+		t.Errorf("dir/sub/file not written: %v", err)
+	}
+
+	// removing the only file of dir/sub removes dir as well
+	if err := b.Remove("dir/sub/file"); err != nil {
+		t.Fatal(err)
+	}
+	expected = "837dc8fe8d04dce27c94bd973d342a30249bef8d"
+	if id, err := b.Write(); err != nil || id.String() != expected {
+		t.Errorf("expected tree %s, got %s (%v)", expected, id, err)
+	}
+}
+
+func TestTreeBuilderErrors(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	base := mustIdFromString(t, "3653a91b9cb7fd42c00609855aba0c25e83df287")
+	data := mustIdFromString(t, "28c7f98408356c823d0247f3ee40746e24e3a78b")
+
+	if _, err := repo.NewTreeBuilder(data); err == nil {
+		t.Error("builder started from a blob")
+	}
+	b, err := repo.NewTreeBuilder(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Remove("missing"); err != ErrNotExist {
+		t.Errorf("removing a missing file: expected ErrNotExist, got %v", err)
+	}
+	if err := b.Remove("missing/file"); err != ErrNotExist {
+		t.Errorf("removing below a missing directory: expected ErrNotExist, got %v", err)
+	}
+	if err := b.Remove("data/file"); err == nil {
+		t.Error("removed below a file")
+	}
+	if _, ok := b.Insert(".git/config", ModeBlob, data).(*UnsafePathsError); !ok {
+		t.Error("inserted below .git")
+	}
+	if err := b.Insert("file", 0100664, data); err == nil {
+		t.Error("inserted with an invalid mode")
+	}
+	if id, err := b.Write(); err != nil || !id.Equal(base) {
+		t.Errorf("tree changed by failed edits: %s (%v)", id, err)
+	}
+}
+
+func TestEmptyTreeBuilder(t *testing.T) {
+	repo := openTestRepoCopy(t)
+	data := mustIdFromString(t, "28c7f98408356c823d0247f3ee40746e24e3a78b")
+
+	b, err := repo.NewTreeBuilder(ObjectID{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+	if id, err := b.Write(); err != nil || id.String() != expected {
+		t.Errorf("expected the empty tree %s, got %s (%v)", expected, id, err)
+	}
+	// a file in the way of a directory is replaced
+	if err := b.Insert("file", ModeBlob, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Insert("file/sub", ModeBlob, data); err != nil {
+		t.Fatal(err)
+	}
+	id, err := b.Write()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := repo.GetTree(id.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, err := tree.GetTreeEntryByPath("file"); err != nil || !entry.IsDir() {
+		t.Errorf("file wasn't replaced by a directory: %v", err)
+	}
+}
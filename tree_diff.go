@@ -0,0 +1,162 @@
+package git
+
+import (
+	"io/ioutil"
+	"path"
+	"sort"
+)
+
+// A treeChange is a difference between two trees. From is nil for added
+// paths, To is nil for deleted paths.
+type treeChange struct {
+	path     string
+	from, to *TreeEntry
+	// for renames and copies, the path of from and the similarity in
+	// percent
+	oldPath    string
+	similarity int
+	copy       bool
+}
+
+// How the change changed the file.
+func (c *treeChange) status() FileStatus {
+	switch {
+	case c.from == nil:
+		return FileAdded
+	case c.to == nil:
+		return FileDeleted
+	case c.copy:
+		return FileCopied
+	case c.oldPath != "":
+		return FileRenamed
+	case !sameFileType(c.from, c.to):
+		return FileTypeChanged
+	}
+	return FileModified
+}
+
+// diffTrees returns the changed files between two trees, recursing into
+// subtrees. Subtrees with equal ids are skipped without being read. A nil
+// tree is treated as empty.
+func diffTrees(from, to *Tree) ([]*treeChange, error) {
+	var changes []*treeChange
+	err := diffTreesRec(from, to, "", &changes)
+	return changes, err
+}
+
+func diffTreesRec(from, to *Tree, prefix string, changes *[]*treeChange) error {
+	fromEntries, err := readTreeEntries(from)
+	if err != nil {
+		return err
+	}
+	toEntries, err := readTreeEntries(to)
+	if err != nil {
+		return err
+	}
+
+	byName := make(map[string][2]*TreeEntry, len(fromEntries)+len(toEntries))
+	for _, e := range fromEntries {
+		byName[e.name] = [2]*TreeEntry{e, nil}
+	}
+	for _, e := range toEntries {
+		pair := byName[e.name]
+		pair[1] = e
+		byName[e.name] = pair
+	}
+
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		pair := byName[name]
+		f, t := pair[0], pair[1]
+		p := path.Join(prefix, name)
+
+		if f != nil && t != nil && f.Id.Equal(t.Id) && f.mode == t.mode {
+			continue
+		}
+
+		fDir := f != nil && f.IsDir()
+		tDir := t != nil && t.IsDir()
+
+		if fDir || tDir {
+			var ft, tt *Tree
+			var err error
+			if fDir {
+				if ft, err = from.repo.getTree(f.Id); err != nil {
+					return err
+				}
+			}
+			if tDir {
+				if tt, err = to.repo.getTree(t.Id); err != nil {
+					return err
+				}
+			}
+			// a file replaced by a directory or the other way round
+			if f != nil && !fDir {
+				*changes = append(*changes, &treeChange{path: p, from: f})
+			}
+			if err := diffTreesRec(ft, tt, p, changes); err != nil {
+				return err
+			}
+			if t != nil && !tDir {
+				*changes = append(*changes, &treeChange{path: p, to: t})
+			}
+			continue
+		}
+
+		*changes = append(*changes, &treeChange{path: p, from: f, to: t})
+	}
+	return nil
+}
+
+// Read the entries of a tree, none if it's nil. Unlike ListEntries, a tree
+// that can't be read or parsed is an error rather than empty.
+func readTreeEntries(t *Tree) (Entries, error) {
+	if t == nil {
+		return nil, nil
+	}
+	scanner, err := t.Scanner()
+	if err != nil {
+		return nil, err
+	}
+	var entries Entries
+	for scanner.Scan() {
+		entries = append(entries, scanner.TreeEntry())
+	}
+	return entries, scanner.Err()
+}
+
+// Read the whole content of a blob.
+func (repo *Repository) readBlob(id ObjectID) ([]byte, error) {
+	_, _, dataRc, err := repo.GetRawObject(id, false)
+	if err != nil {
+		return nil, err
+	}
+	defer dataRc.Close()
+	return ioutil.ReadAll(dataRc)
+}
+
+// Read the content of one side of a change, nil if the side does not exist
+// or is not a blob.
+func (repo *Repository) readEntryData(te *TreeEntry) ([]byte, error) {
+	if te == nil || te.Type != ObjectBlob {
+		return nil, nil
+	}
+	return repo.readBlob(te.Id)
+}
+
+// Tree of the first parent of a commit, nil for root commits.
+func firstParentTree(c *Commit) (*Tree, error) {
+	if c.ParentCount() == 0 {
+		return nil, nil
+	}
+	p, err := c.Parent(0)
+	if err != nil {
+		return nil, err
+	}
+	return &p.Tree, nil
+}
@@ -16,6 +16,11 @@ type TreeScanner struct {
 
 	treeEntry *TreeEntry
 	err       error
+
+	// for the checks of strict parsing
+	entries  int
+	prevName []byte
+	prevDir  bool
 }
 
 func NewTreeScanner(parent *Tree, rc io.ReadCloser) *TreeScanner {
@@ -46,10 +51,21 @@ func (t *TreeScanner) parse() error {
 		return err
 	}
 
-	entryMode, objectType, err := ParseModeType(modeString)
+	var repo *Repository
+	if t.parent != nil {
+		repo = t.parent.repo
+	}
+	mode := repo.ParseMode()
+	entryMode, objectType, err := parseEntryMode(modeString, mode)
 	if err != nil {
 		return err
 	}
+	t.entries++
+	if mode == ParseStrict {
+		if reason := t.checkEntry(match[2], entryMode == ModeTree); reason != "" {
+			return &ParseError{Type: ObjectTree, Id: t.parent.Id, Line: t.entries, Reason: reason}
+		}
+	}
 
 	t.treeEntry = &TreeEntry{
 		name:  name,
@@ -62,6 +78,29 @@ func (t *TreeScanner) parse() error {
 	return nil
 }
 
+// Check an entry name like git fsck does, returning what is wrong with it.
+func (t *TreeScanner) checkEntry(name []byte, isDir bool) string {
+	switch {
+	case bytes.IndexByte(name, '/') >= 0:
+		return "name contains a slash"
+	case string(name) == "." || string(name) == "..":
+		return "name is . or .."
+	case isGitDirName(string(name)):
+		return "name is .git"
+	}
+	if t.prevName != nil {
+		switch c := compareTreeNames(t.prevName, t.prevDir, string(name), isDir); {
+		case c == 0 || bytes.Equal(t.prevName, name):
+			return "duplicate entry " + string(name)
+		case c > 0:
+			return "entries not sorted"
+		}
+	}
+	t.prevName = append(t.prevName[:0], name...)
+	t.prevDir = isDir
+	return ""
+}
+
 func (t *TreeScanner) Scan() bool {
 	if !t.Scanner.Scan() {
 		if t.closer != nil {
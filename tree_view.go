@@ -0,0 +1,212 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// A TreeView is a read-only view of the raw data of a tree object. Entries
+// are decoded only when asked for, and looked up by name with a binary
+// search, so deep path lookups don't allocate an entry per sibling.
+type TreeView struct {
+	Id   ObjectID
+	repo *Repository
+	data []byte
+	// start of each entry in data, computed on first use
+	offsets []int
+}
+
+// TreeView reads the tree object with the given id.
+func (repo *Repository) TreeView(id ObjectID) (*TreeView, error) {
+	_, _, rc, err := repo.GetRawObject(id, false)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	return &TreeView{Id: id, repo: repo, data: data}, nil
+}
+
+func (v *TreeView) index() error {
+	if v.offsets != nil {
+		return nil
+	}
+	offsets := make([]int, 0, len(v.data)/32)
+	for pos := 0; pos < len(v.data); {
+		nul := bytes.IndexByte(v.data[pos:], 0)
+		if nul < 0 || pos+nul+21 > len(v.data) || bytes.IndexByte(v.data[pos:pos+nul], ' ') <= 0 {
+			return fmt.Errorf("tree %s: malformed entry at offset %d", v.Id, pos)
+		}
+		offsets = append(offsets, pos)
+		pos += nul + 21
+	}
+	v.offsets = offsets
+	return nil
+}
+
+// Len returns the number of entries.
+func (v *TreeView) Len() (int, error) {
+	if err := v.index(); err != nil {
+		return 0, err
+	}
+	return len(v.offsets), nil
+}
+
+// raw returns the mode, name and id bytes of entry i, pointing into the
+// tree data.
+func (v *TreeView) raw(i int) (mode, name, id []byte) {
+	entry := v.data[v.offsets[i]:]
+	nul := bytes.IndexByte(entry, 0)
+	sp := bytes.IndexByte(entry[:nul], ' ')
+	return entry[:sp], entry[sp+1 : nul], entry[nul+1 : nul+21]
+}
+
+var treeModeBytes = []byte("40000")
+
+// Entry decodes entry i.
+func (v *TreeView) Entry(i int) (*TreeEntry, error) {
+	if err := v.index(); err != nil {
+		return nil, err
+	}
+	if i < 0 || i >= len(v.offsets) {
+		return nil, ErrNotExist
+	}
+	mode, name, rawId := v.raw(i)
+	entryMode, objectType, err := parseEntryMode(string(mode), v.repo.ParseMode())
+	if err != nil {
+		return nil, err
+	}
+	id, err := NewId(rawId)
+	if err != nil {
+		return nil, err
+	}
+	return &TreeEntry{
+		Id:    id,
+		Type:  objectType,
+		mode:  entryMode,
+		name:  string(name),
+		ptree: NewTree(v.repo, v.Id),
+	}, nil
+}
+
+// Find returns the index of the entry called name. Entries are sorted the
+// way git sorts them, with trees compared as if their name ended in a
+// slash, so a file and a tree of the same name are looked for separately.
+func (v *TreeView) Find(name string) (int, bool, error) {
+	if err := v.index(); err != nil {
+		return 0, false, err
+	}
+	if i, ok := v.search(name, false); ok {
+		return i, true, nil
+	}
+	i, ok := v.search(name, true)
+	return i, ok, nil
+}
+
+func (v *TreeView) search(name string, dir bool) (int, bool) {
+	lo, hi := 0, len(v.offsets)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		mode, entryName, _ := v.raw(mid)
+		c := compareTreeNames(entryName, bytes.Equal(mode, treeModeBytes), name, dir)
+		switch {
+		case c == 0:
+			return mid, true
+		case c < 0:
+			lo = mid + 1
+		default:
+			hi = mid
+		}
+	}
+	return lo, false
+}
+
+// Compare two entry names in git's tree order.
+func compareTreeNames(a []byte, aDir bool, b string, bDir bool) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	// one name is a prefix of the other, compare the next byte with
+	// trees continuing with a slash
+	var ca, cb int
+	if n < len(a) {
+		ca = int(a[n])
+	} else if aDir {
+		ca = '/'
+	}
+	if n < len(b) {
+		cb = int(b[n])
+	} else if bDir {
+		cb = '/'
+	}
+	switch {
+	case ca < cb:
+		return -1
+	case ca > cb:
+		return 1
+	}
+	return 0
+}
+
+// Lookup returns the entry at a slash separated path below the tree.
+func (v *TreeView) Lookup(p string) (*TreeEntry, error) {
+	p = strings.Trim(path.Clean("/"+p), "/")
+	if p == "" {
+		return nil, ErrNotExist
+	}
+
+	view := v
+	for {
+		var name string
+		i := strings.IndexByte(p, '/')
+		if i < 0 {
+			name = p
+		} else {
+			name = p[:i]
+		}
+
+		if i < 0 {
+			idx, ok, err := view.Find(name)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, ErrNotExist
+			}
+			return view.Entry(idx)
+		}
+
+		// intermediate components must be trees
+		if err := view.index(); err != nil {
+			return nil, err
+		}
+		idx, ok := view.search(name, true)
+		if !ok {
+			return nil, ErrNotExist
+		}
+		_, _, rawId := view.raw(idx)
+		id, err := NewId(rawId)
+		if err != nil {
+			return nil, err
+		}
+		if view, err = v.repo.TreeView(id); err != nil {
+			return nil, err
+		}
+		p = p[i+1:]
+	}
+}
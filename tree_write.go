@@ -0,0 +1,133 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// A treeFile is a file of a flattened tree: a blob, symlink or submodule.
+type treeFile struct {
+	mode EntryMode
+	id   ObjectID
+}
+
+// flattenTree returns all non-tree entries of a tree and its subtrees by
+// their slash separated path. A nil tree is empty.
+func (repo *Repository) flattenTree(t *Tree) (map[string]treeFile, error) {
+	files := make(map[string]treeFile)
+	if t == nil {
+		return files, nil
+	}
+	err := repo.flattenTreeRec(t, "", files)
+	return files, err
+}
+
+func (repo *Repository) flattenTreeRec(t *Tree, prefix string, files map[string]treeFile) error {
+	scanner, err := t.Scanner()
+	if err != nil {
+		return err
+	}
+	var subtrees []*TreeEntry
+	for scanner.Scan() {
+		te := scanner.TreeEntry()
+		if te.IsDir() {
+			subtrees = append(subtrees, te)
+			continue
+		}
+		files[path.Join(prefix, te.name)] = treeFile{te.mode, te.Id}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for _, te := range subtrees {
+		sub, err := repo.getTree(te.Id)
+		if err != nil {
+			return err
+		}
+		if err := repo.flattenTreeRec(sub, path.Join(prefix, te.name), files); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTree writes the tree objects for a flattened tree and returns the
+// id of the root tree.
+func (repo *Repository) writeTree(files map[string]treeFile) (ObjectID, error) {
+	// group files by directory, creating entries for all directories
+	dirs := map[string]map[string]treeFile{"": {}}
+	for p, f := range files {
+		dir, name := path.Split(p)
+		dir = strings.TrimSuffix(dir, "/")
+		if dirs[dir] == nil {
+			dirs[dir] = make(map[string]treeFile)
+		}
+		dirs[dir][name] = f
+		for dir != "" {
+			parent, _ := path.Split(dir)
+			parent = strings.TrimSuffix(parent, "/")
+			if dirs[parent] == nil {
+				dirs[parent] = make(map[string]treeFile)
+			}
+			dir = parent
+		}
+	}
+
+	// write the deepest directories first
+	names := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		names = append(names, dir)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return strings.Count(names[i], "/") > strings.Count(names[j], "/") ||
+			(names[i] != "" && names[j] == "")
+	})
+
+	for _, dir := range names {
+		if dir == "" {
+			continue
+		}
+		id, err := repo.writeTreeObject(dirs[dir])
+		if err != nil {
+			return ObjectID{}, err
+		}
+		parent, name := path.Split(dir)
+		dirs[strings.TrimSuffix(parent, "/")][name] = treeFile{ModeTree, id}
+	}
+	return repo.writeTreeObject(dirs[""])
+}
+
+// writeTreeObject writes a single tree object with the given entries.
+func (repo *Repository) writeTreeObject(entries map[string]treeFile) (ObjectID, error) {
+	return repo.StoreObjectLoose(ObjectTree, bytes.NewReader(encodeTree(entries)))
+}
+
+// Serialize tree entries. Entries are sorted like git does, comparing
+// directory names as if they had a trailing slash.
+func encodeTree(entries map[string]treeFile) []byte {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sortKey := func(name string) string {
+		if entries[name].mode == ModeTree {
+			return name + "/"
+		}
+		return name
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return sortKey(names[i]) < sortKey(names[j])
+	})
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		e := entries[name]
+		fmt.Fprintf(&buf, "%o %s\x00", e.mode, name)
+		buf.Write(e.id[:])
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,111 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnbornBranch is returned when HEAD is needed but points to a branch
+// without commits, like in a new repository or after CreateOrphanBranch.
+var ErrUnbornBranch = errors.New("HEAD points to a branch without commits")
+
+// Return the name of the ref HEAD points to, like "refs/heads/master", or
+// "" if HEAD is detached.
+func (repo *Repository) headTarget() (string, error) {
+	if repo.snapshot != nil {
+		if head, ok := repo.snapshot.refs["HEAD"]; ok {
+			return head.Target, nil
+		}
+		return repo.snapshot.unbornHead, nil
+	}
+	if head, ok := repo.dryRunRef("HEAD"); ok {
+		return head.target, nil
+	}
+	data, err := ioutil.ReadFile(filepath.Join(repo.Path, "HEAD"))
+	if err != nil {
+		return "", err
+	}
+	if !bytes.HasPrefix(data, []byte("ref: ")) {
+		return "", nil
+	}
+	return strings.TrimSpace(string(data[5:])), nil
+}
+
+// HeadBranch returns the name of the branch HEAD points to, like "master",
+// also if the branch has no commits yet. It returns "" if HEAD is detached.
+func (repo *Repository) HeadBranch() (string, error) {
+	target, err := repo.headTarget()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(target, "refs/heads/"), nil
+}
+
+// IsUnborn reports whether HEAD points to a branch without commits, like
+// in a new repository or after CreateOrphanBranch.
+func (repo *Repository) IsUnborn() (bool, error) {
+	target, err := repo.headTarget()
+	if err != nil || target == "" {
+		return false, err
+	}
+	_, ok, err := repo.lookupRef(target)
+	return !ok, err
+}
+
+// IsEmpty reports whether the repository has no refs, e.g. right after
+// git init.
+func (repo *Repository) IsEmpty() (bool, error) {
+	empty := true
+	err := repo.ForEachRef("refs/", func(Ref) error {
+		empty = false
+		return StopIteration
+	})
+	return empty, err
+}
+
+// Return ErrUnbornBranch if rev names HEAD or the branch it points to and
+// that branch has no commits, err otherwise. For errors of lookups of rev.
+func (repo *Repository) unbornError(rev string, err error) error {
+	target, terr := repo.headTarget()
+	if terr != nil || target == "" {
+		return err
+	}
+	if rev != "HEAD" && rev != target && "refs/"+rev != target && "refs/heads/"+rev != target {
+		return err
+	}
+	if unborn, uerr := repo.IsUnborn(); uerr == nil && unborn {
+		return ErrUnbornBranch
+	}
+	return err
+}
+
+// Point HEAD at the branch name, a full ref name, if it's the first branch
+// of the repository and HEAD still points to a branch without commits.
+// This is done with gogits.updateUnbornHead set, so that clones of a
+// repository created empty check out the first branch pushed to it,
+// whatever it's called. Called after the branch was written.
+func (repo *Repository) adoptFirstBranch(name string) {
+	if !strings.HasPrefix(name, "refs/heads/") {
+		return
+	}
+	if unborn, err := repo.IsUnborn(); err != nil || !unborn {
+		return
+	}
+	if !repo.settings().UpdateUnbornHead {
+		return
+	}
+	only := true
+	err := repo.ForEachRef("refs/heads/", func(ref Ref) error {
+		only = only && ref.Name == name
+		return nil
+	})
+	if err != nil || !only {
+		return
+	}
+	if err := repo.setHead("ref: " + name); err != nil {
+		repo.log().Warn("can't point HEAD at the first branch", "ref", name, "err", err)
+	}
+}
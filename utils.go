@@ -14,6 +14,14 @@ func isFile(filePath string) bool {
 	return !f.IsDir()
 }
 
+func isDir(filePath string) bool {
+	f, e := os.Stat(filePath)
+	if e != nil {
+		return false
+	}
+	return f.IsDir()
+}
+
 func RefEndName(refStr string) string {
 	index := strings.LastIndex(refStr, "/")
 	if index != -1 {